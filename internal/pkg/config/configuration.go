@@ -3,7 +3,10 @@ package config
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -12,10 +15,15 @@ import (
 // ModbusTcpConfig 保持Modbus TCP特定配置
 type ModbusTcpConfig struct {
 	Host    string `yaml:"Host"`
-	Port    int    `yaml:"Port"`
+	Port    int    `yaml:"Port"` // 配置文件中显式配置 0 表示自动选择空闲端口，未配置时默认为 502
 	SlaveID byte   `yaml:"SlaveID"`
+
+	autoPort bool // 配置文件中显式配置了 Port: 0；代码中构造的零值配置仍默认为 502
 }
 
+// unsetPort 在加载时标记配置文件中未出现的Modbus TCP端口，以区分显式配置的 0
+const unsetPort = -1
+
 // ModbusRtuConfig 保持Modbus RTU特定配置
 type ModbusRtuConfig struct {
 	Port     string `yaml:"Port"`
@@ -26,15 +34,240 @@ type ModbusRtuConfig struct {
 	SlaveID  byte   `yaml:"SlaveID"`
 }
 
+// Modbus对象类型
+const (
+	ObjectCoil            = "Coil"
+	ObjectDiscreteInput   = "DiscreteInput"
+	ObjectInputRegister   = "InputRegister"
+	ObjectHoldingRegister = "HoldingRegister"
+)
+
+// 写多个线圈（0x0F）遇到只读线圈时的处理策略
+const (
+	CoilWritePolicyAllOrNothing = "allOrNothing" // 任一线圈只读则拒绝整个写请求
+	CoilWritePolicySkipReadOnly = "skipReadOnly" // 跳过只读线圈，写入其余可写线圈
+)
+
+// AddressOffsetConfig 保持各Modbus对象类型的基地址偏移
+// 例如 HoldingRegisters: 40001 表示资源地址 40010 对应保持寄存器表中的地址 9
+// 0 表示该类型不使用偏移。配置了偏移的对象类型使用独立的地址表（见 AddressKey），线圈1与保持寄存器40001互不冲突
+type AddressOffsetConfig struct {
+	Coils            uint16 `yaml:"Coils"`            // 通常为 1 (0xxxx)
+	DiscreteInputs   uint16 `yaml:"DiscreteInputs"`   // 通常为 10001 (1xxxx)
+	InputRegisters   uint16 `yaml:"InputRegisters"`   // 通常为 30001 (3xxxx)
+	HoldingRegisters uint16 `yaml:"HoldingRegisters"` // 通常为 40001 (4xxxx)
+}
+
+// AddressKey 是映射和缓存使用的地址键：高16位为对象类型表，低16位为表内地址
+// 未配置基地址偏移的对象类型共用表0，此时键与地址数值相同，与未配置偏移时的平坦地址兼容
+type AddressKey uint32
+
+// 地址表编号，0 为未配置偏移的对象类型共用的表
+const (
+	addressTableShared = iota
+	addressTableCoil
+	addressTableDiscreteInput
+	addressTableInputRegister
+	addressTableHoldingRegister
+)
+
+// addressTableTypes 按表编号保存对象类型
+var addressTableTypes = [...]string{"", ObjectCoil, ObjectDiscreteInput, ObjectInputRegister, ObjectHoldingRegister}
+
+// NewAddressKey 返回对象类型表中表内地址的键，objectType 为空时使用共用表
+func NewAddressKey(objectType string, addr uint16) AddressKey {
+	for table, t := range addressTableTypes {
+		if t == objectType {
+			return AddressKey(uint32(table)<<16 | uint32(addr))
+		}
+	}
+	return AddressKey(addr)
+}
+
+// Addr 返回键的表内地址
+func (k AddressKey) Addr() uint16 {
+	return uint16(k)
+}
+
+// ObjectType 返回键所在表的对象类型，共用表返回空字符串
+func (k AddressKey) ObjectType() string {
+	table := int(k >> 16)
+	if table >= len(addressTableTypes) {
+		return ""
+	}
+	return addressTableTypes[table]
+}
+
+// Add 返回同一表内向后偏移 n 个地址的键，超出表的地址范围时返回 false
+func (k AddressKey) Add(n int) (AddressKey, bool) {
+	addr := int(k.Addr()) + n
+	if addr < 0 || addr > math.MaxUint16 {
+		return 0, false
+	}
+	return k&^math.MaxUint16 | AddressKey(addr), true
+}
+
+// String 返回表内地址，非共用表时带对象类型前缀，例如 "HoldingRegister:9"
+func (k AddressKey) String() string {
+	if t := k.ObjectType(); t != "" {
+		return fmt.Sprintf("%s:%d", t, k.Addr())
+	}
+	return strconv.Itoa(int(k.Addr()))
+}
+
+// Base 返回对象类型的基地址
+func (a *AddressOffsetConfig) Base(objectType string) uint16 {
+	switch objectType {
+	case ObjectCoil:
+		return a.Coils
+	case ObjectDiscreteInput:
+		return a.DiscreteInputs
+	case ObjectInputRegister:
+		return a.InputRegisters
+	case ObjectHoldingRegister:
+		return a.HoldingRegisters
+	default:
+		return 0
+	}
+}
+
+// Key 返回Modbus请求中对象类型表内地址（PDU地址）的键
+// 该类型配置了基地址时使用其独立的表，否则使用共用表；PDU地址总是表内地址，不做任何换算
+func (a *AddressOffsetConfig) Key(objectType string, pdu uint16) AddressKey {
+	if a == nil || a.Base(objectType) == 0 {
+		return AddressKey(pdu)
+	}
+	return NewAddressKey(objectType, pdu)
+}
+
+// ResourceKey 返回资源地址的键。配置了基地址的对象类型中，资源地址按基地址编号，表内地址为资源地址减去基地址
+// 未指定对象类型时按地址所在范围确定类型（不大于地址的最大基地址），低于所有已配置基地址的地址使用共用表。
+// 指定的对象类型配置了基地址而资源地址低于该基地址时返回 false
+func (a *AddressOffsetConfig) ResourceKey(objectType string, addr uint16) (AddressKey, bool) {
+	if a == nil {
+		return AddressKey(addr), true
+	}
+	if objectType == "" {
+		var best uint16
+		for _, t := range addressTableTypes[1:] {
+			if base := a.Base(t); base > 0 && addr >= base && base > best {
+				best, objectType = base, t
+			}
+		}
+	}
+	base := a.Base(objectType)
+	if base == 0 {
+		return AddressKey(addr), true
+	}
+	if addr < base {
+		return 0, false
+	}
+	return NewAddressKey(objectType, addr-base), true
+}
+
+// ValidObjectType 返回 objectType 是否为空或已知的对象类型
+func ValidObjectType(objectType string) bool {
+	switch objectType {
+	case "", ObjectCoil, ObjectDiscreteInput, ObjectInputRegister, ObjectHoldingRegister:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsZero 返回是否未配置任何基地址偏移
+func (a *AddressOffsetConfig) IsZero() bool {
+	return a.Coils == 0 && a.DiscreteInputs == 0 && a.InputRegisters == 0 && a.HoldingRegisters == 0
+}
+
 // ModbusConfig 保持所有Modbus配置
 type ModbusConfig struct {
-	Type        string          `yaml:"Type"` // "TCP" 或 "RTU"
-	TCP         ModbusTcpConfig `yaml:"TCP"`
-	RTU         ModbusRtuConfig `yaml:"RTU"`
-	Timeout     int             `yaml:"Timeout"`     // 毫秒
-	PollingRate int             `yaml:"PollingRate"` // 毫秒
+	Type           string              `yaml:"Type"` // "TCP" 或 "RTU"
+	TCP            ModbusTcpConfig     `yaml:"TCP"`
+	RTU            ModbusRtuConfig     `yaml:"RTU"`
+	Timeout        int                 `yaml:"Timeout"`        // 毫秒
+	PollingRate    int                 `yaml:"PollingRate"`    // 毫秒
+	AddressOffsets AddressOffsetConfig `yaml:"AddressOffsets"` // 各对象类型的基地址偏移
+	Diagnostics    bool                `yaml:"Diagnostics"`    // 启用功能码0x08诊断，返回服务器通信计数
+	ReadOnly       bool                `yaml:"ReadOnly"`       // 只读模式：不注册写功能码，写请求返回非法功能异常
+
+	ExceptionStatusCoils []uint16 `yaml:"ExceptionStatusCoils"` // 功能码0x07异常状态各位对应的线圈地址（最多8个，依次为bit0..bit7）
+
+	BusyDuringReload bool `yaml:"BusyDuringReload"` // 映射重载期间的读请求返回从站忙异常，而不是等待重载完成后重试
+
+	OneBased bool `yaml:"OneBased"` // 资源地址使用从1开始的文档编号：PDU地址0对应地址1，查询缓存前加1
+
+	RejectWritesWhenDisconnected bool `yaml:"RejectWritesWhenDisconnected"` // MQTT断开时写请求返回从站忙异常，而不是确认无法下发的写入
+
+	MultiCoilWritePolicy string `yaml:"MultiCoilWritePolicy"` // 写多个线圈包含只读线圈时的策略：allOrNothing（默认）或 skipReadOnly
+
+	QualityRegisters []QualityRegisterConfig `yaml:"QualityRegisters"` // 反映数据寄存器新鲜度的质量寄存器
+
+	ReportConversionErrors        bool   `yaml:"ReportConversionErrors"`        // 读取时类型转换失败的资源及其累计失败次数作为前向日志上报
+	ConversionErrorReportInterval string `yaml:"ConversionErrorReportInterval"` // 上报间隔，每次只上报自上次以来计数有变化的资源，例如 "1m"
+
+	ConversionCacheSize int `yaml:"ConversionCacheSize"` // 缓存的寄存器编码结果数，用于大量地址共享相同值的场景，0表示不缓存
+
+	OrderProbe OrderProbeConfig `yaml:"OrderProbe"` // 启动时从探测寄存器的魔数推断字节/字顺序
+
+	MaxReadQuantity int `yaml:"MaxReadQuantity"` // 单次读请求的最大地址数，低于协议上限(寄存器125/位2000)时生效，0表示仅受协议限制
+
+	NodeUnitIDs map[string]byte `yaml:"NodeUnitIDs"` // 额外节点ID -> 服务该节点映射的单元标识符，其他单元标识符的请求由主节点处理
+
+	BroadcastWrites bool `yaml:"BroadcastWrites"` // Modbus TCP 单元标识符0的写请求作为广播：由主节点和所有额外节点执行且不回复，其他功能码的广播被忽略
+}
+
+// SlaveID 返回按 Type 生效的主节点从站地址（单元标识符）
+func (c *ModbusConfig) SlaveID() byte {
+	if c.Type == "RTU" {
+		return c.RTU.SlaveID
+	}
+	return c.TCP.SlaveID
+}
+
+// QualityRegisterConfig 将质量寄存器关联到一个数据寄存器
+// 读取Address时返回DataAddress处缓存值的质量码，两个地址都与资源地址使用相同的编号
+type QualityRegisterConfig struct {
+	Address     uint16 `yaml:"Address"`     // 质量寄存器地址，不应与已映射的资源重叠
+	DataAddress uint16 `yaml:"DataAddress"` // 被监视的数据寄存器地址
+}
+
+// OrderProbeConfig 配置启动时的字节/字顺序探测
+// 设备在 Address 处上报已知魔数的原始寄存器内容，服务器启动前比较其按各顺序解码的结果与 Magic，选出匹配的顺序
+type OrderProbeConfig struct {
+	Enabled bool   `yaml:"Enabled"`
+	Address uint16 `yaml:"Address"` // 探测寄存器地址，与资源地址使用相同的编号
+	Magic   uint32 `yaml:"Magic"`   // 期望的魔数，不超过0xFFFF时探测一个寄存器（只能确定字节顺序），否则探测两个寄存器
+	Timeout string `yaml:"Timeout"` // 探测地址尚无缓存值时等待其到达的时长，例如 "10s"
 }
 
+// DefaultOrderProbeTimeout 等待探测值到达的默认时长
+const DefaultOrderProbeTimeout = 10 * time.Second
+
+// GetTimeout 返回等待探测值的时长，未配置或无效时为 DefaultOrderProbeTimeout
+func (p *OrderProbeConfig) GetTimeout() time.Duration {
+	d, err := time.ParseDuration(p.Timeout)
+	if err != nil || d <= 0 {
+		return DefaultOrderProbeTimeout
+	}
+	return d
+}
+
+// DefaultConversionErrorReportInterval 转换失败计数上报间隔的默认值
+const DefaultConversionErrorReportInterval = time.Minute
+
+// GetConversionErrorReportInterval 返回转换失败计数的上报间隔，未配置或无效时为 DefaultConversionErrorReportInterval
+func (c *ModbusConfig) GetConversionErrorReportInterval() time.Duration {
+	d, err := time.ParseDuration(c.ConversionErrorReportInterval)
+	if err != nil || d <= 0 {
+		return DefaultConversionErrorReportInterval
+	}
+	return d
+}
+
+// MaxExceptionStatusCoils 异常状态字节的位数
+const MaxExceptionStatusCoils = 8
+
 // MqttConfig 保持MQTT客户端配置
 type MqttConfig struct {
 	Broker    string `yaml:"Broker"`
@@ -44,20 +277,179 @@ type MqttConfig struct {
 	QoS       int    `yaml:"QoS"`
 	KeepAlive int    `yaml:"KeepAlive"` // 秒
 	Workers   int    `yaml:"Workers"`
+
+	SensorDataAck bool `yaml:"SensorDataAck"` // 处理传感器数据后回复应用/跳过数量
+
+	WriteConfirmTimeout string `yaml:"WriteConfirmTimeout"` // PUT后等待传感器数据确认写入的超时，例如 "10s"，为空表示不确认
+
+	MaxPendingRequests int `yaml:"MaxPendingRequests"` // 同时等待响应的请求数上限，超出时新请求直接失败
+
+	ResponseRetries    *int   `yaml:"ResponseRetries"`    // 命令响应发布失败后的重试次数，0表示不重试；未配置时为 DefaultResponseRetries
+	ResponseRetryDelay string `yaml:"ResponseRetryDelay"` // 首次重试前的等待，之后每次翻倍，例如 "200ms"
+
+	CommandQoS         int    `yaml:"CommandQoS"`         // 承载命令的上行主题订阅和命令响应发布使用的QoS，2表示恰好一次；未配置时为1
+	CommandDedupWindow string `yaml:"CommandDedupWindow"` // 相同requestId的命令在该时长内只执行一次，重复投递时重发原响应，例如 "5m"；"0s" 表示不去重
+
+	ReconnectJitter string `yaml:"ReconnectJitter"` // 自动重连前额外等待的随机时长上限，例如 "5s"，为空表示不加抖动
+
+	CleanSession *bool `yaml:"CleanSession"` // false 时使用持久会话，断线期间Broker保留QoS 1/2消息；未配置时为true
+
+	TLS MqttTLSConfig `yaml:"TLS"`
+
+	SharedSubscription MqttSharedSubscriptionConfig `yaml:"SharedSubscription"`
+
+	SequenceField string `yaml:"SequenceField"` // 携带单调消息序号的顶层字段，例如 "seq"，为空表示不检测丢失/乱序
+
+	DeadLetter MqttDeadLetterConfig `yaml:"DeadLetter"`
+}
+
+// GetWriteConfirmTimeout 返回写入确认超时作为time.Duration，未配置时为0（不确认）
+func (c *MqttConfig) GetWriteConfirmTimeout() time.Duration {
+	d, err := time.ParseDuration(c.WriteConfirmTimeout)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// DefaultResponseRetries 命令响应发布失败后重试次数的默认值
+const DefaultResponseRetries = 3
+
+// GetResponseRetries 返回命令响应发布失败后的重试次数，未配置时为 DefaultResponseRetries
+func (c *MqttConfig) GetResponseRetries() int {
+	if c.ResponseRetries == nil {
+		return DefaultResponseRetries
+	}
+	return *c.ResponseRetries
+}
+
+// DefaultResponseRetryDelay 命令响应首次重试前等待的默认值
+const DefaultResponseRetryDelay = 200 * time.Millisecond
+
+// GetResponseRetryDelay 返回命令响应首次重试前的等待作为time.Duration，未配置时为 DefaultResponseRetryDelay
+func (c *MqttConfig) GetResponseRetryDelay() time.Duration {
+	d, err := time.ParseDuration(c.ResponseRetryDelay)
+	if err != nil || d <= 0 {
+		return DefaultResponseRetryDelay
+	}
+	return d
+}
+
+// DefaultCommandDedupWindow 命令去重窗口的默认值
+const DefaultCommandDedupWindow = 5 * time.Minute
+
+// GetCommandDedupWindow 返回命令去重窗口作为time.Duration，未配置或无效时为 DefaultCommandDedupWindow
+func (c *MqttConfig) GetCommandDedupWindow() time.Duration {
+	d, err := time.ParseDuration(c.CommandDedupWindow)
+	if err != nil || d < 0 {
+		return DefaultCommandDedupWindow
+	}
+	return d
+}
+
+// GetReconnectJitter 返回重连抖动上限作为time.Duration，未配置或无效时为0（不加抖动）
+func (c *MqttConfig) GetReconnectJitter() time.Duration {
+	d, err := time.ParseDuration(c.ReconnectJitter)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// GetCleanSession 返回是否使用清除会话，未配置时为true
+func (c *MqttConfig) GetCleanSession() bool {
+	if c.CleanSession == nil {
+		return true
+	}
+	return *c.CleanSession
+}
+
+// MqttTLSConfig 保持MQTT TLS配置
+type MqttTLSConfig struct {
+	CAFile   string `yaml:"CAFile"`   // Broker CA证书
+	CertFile string `yaml:"CertFile"` // 客户端证书，CN必须与NodeID一致
+	KeyFile  string `yaml:"KeyFile"`  // 客户端私钥
 }
 
+// MqttSharedSubscriptionConfig 保持共享订阅配置
+// 启用后以 $share/{Group}/ 前缀订阅上行主题，由Broker在同组实例间负载均衡消息。
+// 共享订阅是MQTT v5特性，客户端使用MQTT 3.1.1连接，因此仅在Broker对3.1.1会话也支持
+// $share 时启用（如EMQX、HiveMQ、Mosquitto 1.6+）
+type MqttSharedSubscriptionConfig struct {
+	Enabled bool   `yaml:"Enabled"`
+	Group   string `yaml:"Group"` // 共享组名，不能包含 '/'、'+'、'#'
+}
+
+// GetGroup 返回生效的共享组名，未启用时为空
+func (c *MqttSharedSubscriptionConfig) GetGroup() string {
+	if !c.Enabled {
+		return ""
+	}
+	return c.Group
+}
+
+// MqttDeadLetterConfig 保持无法解析的上行消息的死信文件配置
+// 启用后原始载荷按行写入文件，便于排查上游的编码问题
+type MqttDeadLetterConfig struct {
+	File            string `yaml:"File"`            // 死信文件路径，为空表示不启用
+	MaxPayloadBytes int    `yaml:"MaxPayloadBytes"` // 每条记录保留的载荷字节数上限，超出部分截断
+	MaxFileBytes    int64  `yaml:"MaxFileBytes"`    // 文件大小上限，超出时轮转为 File.1（覆盖旧的轮转文件）
+}
+
+// DefaultDeadLetterMaxPayloadBytes 死信记录载荷上限的默认值
+const DefaultDeadLetterMaxPayloadBytes = 64 * 1024
+
+// DefaultDeadLetterMaxFileBytes 死信文件大小上限的默认值
+const DefaultDeadLetterMaxFileBytes = 10 * 1024 * 1024
+
 // CacheConfig 保持缓存配置
 type CacheConfig struct {
-	DefaultTTL      string `yaml:"DefaultTTL"`      // 例如 "30s"
-	CleanupInterval string `yaml:"CleanupInterval"` // 例如 "5m"
+	DefaultTTL       string `yaml:"DefaultTTL"`       // 例如 "30s"
+	CleanupInterval  string `yaml:"CleanupInterval"`  // 例如 "5m"
+	CompactOnCleanup bool   `yaml:"CompactOnCleanup"` // 清理后占用率过低时重建map以回收内存
+	SnapshotPath     string `yaml:"SnapshotPath"`     // 缓存快照文件路径，为空表示不启用快照
+	SnapshotTimeout  string `yaml:"SnapshotTimeout"`  // 停止时写入快照的超时，例如 "5s"
+	StaleGracePeriod string `yaml:"StaleGracePeriod"` // 过期后仍返回旧值（标记为过期）的宽限期，例如 "10s"
+	WriteBackMaxAge  string `yaml:"WriteBackMaxAge"`  // 写操作回写值的最长保留时间，例如 "5s"
+	HistorySize      int    `yaml:"HistorySize"`      // 每个地址保留的历史值数量，用于调试，0表示不记录
+	MinTTL           string `yaml:"MinTTL"`           // TTL下限，更小的TTL被提升到该值，避免缓存总是未命中，例如 "1s"
+	RequeryInterval  string `yaml:"RequeryInterval"`  // 资源数据超过其maxAge后，向数据中心重新查询同一资源的最小间隔，例如 "10s"
+	RequeryEnabled   bool   `yaml:"RequeryEnabled"`   // 读取超过maxAge的数据时以 type=2 cmd "0102" 向数据中心重新查询，需数据中心支持该扩展
 }
 
-// GetDefaultTTL 返回默认TTL作为time.Duration
+// DefaultRequeryInterval 是未配置RequeryInterval时重新查询同一资源的最小间隔
+const DefaultRequeryInterval = 10 * time.Second
+
+// GetRequeryInterval 返回重新查询的最小间隔作为time.Duration，未配置或无效时为 DefaultRequeryInterval
+func (c *CacheConfig) GetRequeryInterval() time.Duration {
+	d, err := time.ParseDuration(c.RequeryInterval)
+	if err != nil || d <= 0 {
+		return DefaultRequeryInterval
+	}
+	return d
+}
+
+// DefaultMinTTL 是未配置MinTTL时的TTL下限
+const DefaultMinTTL = 10 * time.Millisecond
+
+// GetDefaultTTL 返回默认TTL作为time.Duration，低于TTL下限时返回下限
 func (c *CacheConfig) GetDefaultTTL() time.Duration {
 	d, err := time.ParseDuration(c.DefaultTTL)
 	if err != nil {
 		return 30 * time.Second
 	}
+	if minTTL := c.GetMinTTL(); d < minTTL {
+		return minTTL
+	}
+	return d
+}
+
+// GetMinTTL 返回TTL下限作为time.Duration，未配置时为 DefaultMinTTL
+func (c *CacheConfig) GetMinTTL() time.Duration {
+	d, err := time.ParseDuration(c.MinTTL)
+	if err != nil || d <= 0 {
+		return DefaultMinTTL
+	}
 	return d
 }
 
@@ -70,10 +462,61 @@ func (c *CacheConfig) GetCleanupInterval() time.Duration {
 	return d
 }
 
+// GetSnapshotTimeout 返回快照写入超时作为time.Duration
+func (c *CacheConfig) GetSnapshotTimeout() time.Duration {
+	d, err := time.ParseDuration(c.SnapshotTimeout)
+	if err != nil || d <= 0 {
+		return 5 * time.Second
+	}
+	return d
+}
+
+// GetStaleGracePeriod 返回过期宽限期作为time.Duration，未配置时为0（不启用）
+func (c *CacheConfig) GetStaleGracePeriod() time.Duration {
+	d, err := time.ParseDuration(c.StaleGracePeriod)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// GetWriteBackMaxAge 返回回写值的最长保留时间作为time.Duration，未配置时为0（仅受TTL限制）
+func (c *CacheConfig) GetWriteBackMaxAge() time.Duration {
+	d, err := time.ParseDuration(c.WriteBackMaxAge)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// MappingConfig 保持映射配置
+type MappingConfig struct {
+	MaxMappings int `yaml:"MaxMappings"` // 单次更新允许的最大资源映射数
+
+	StrictSensorKeys bool `yaml:"StrictSensorKeys"` // 传感器数据中无匹配资源的键记录警告并作为错误返回
+
+	SkipUnknownValueTypes bool `yaml:"SkipUnknownValueTypes"` // 跳过值类型不受支持的资源；为false时仅警告，读取时按uint16处理
+}
+
 // HeartbeatConfig 保持心跳配置
 type HeartbeatConfig struct {
-	Interval string `yaml:"Interval"` // 例如 "2m"
-	Timeout  string `yaml:"Timeout"`  // 例如 "10s"
+	Interval     string `yaml:"Interval"`     // 例如 "2m"
+	Timeout      string `yaml:"Timeout"`      // 例如 "10s"
+	InitialDelay string `yaml:"InitialDelay"` // 首次心跳前的延迟，例如 "5s"，为空表示立即发送
+
+	ReconnectGrace string `yaml:"ReconnectGrace"` // MQTT断开后自动重连期间，该时长内的心跳失败只记录警告、不计入连续失败，例如 "1m"；"0s" 表示不宽限
+}
+
+// DefaultHeartbeatReconnectGrace 心跳重连宽限期的默认值
+const DefaultHeartbeatReconnectGrace = time.Minute
+
+// GetReconnectGrace 返回心跳重连宽限期作为time.Duration，未配置或无效时为 DefaultHeartbeatReconnectGrace
+func (h *HeartbeatConfig) GetReconnectGrace() time.Duration {
+	d, err := time.ParseDuration(h.ReconnectGrace)
+	if err != nil || d < 0 {
+		return DefaultHeartbeatReconnectGrace
+	}
+	return d
 }
 
 // GetInterval 返回心跳间隔作为time.Duration
@@ -94,15 +537,95 @@ func (h *HeartbeatConfig) GetTimeout() time.Duration {
 	return d
 }
 
+// GetInitialDelay 返回首次心跳前的延迟作为time.Duration
+func (h *HeartbeatConfig) GetInitialDelay() time.Duration {
+	d, err := time.ParseDuration(h.InitialDelay)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
 // WritableConfig 保持运行时可更改的配置
 type WritableConfig struct {
-	LogLevel string `yaml:"LogLevel"`
+	LogLevel          string `yaml:"LogLevel"`
+	LogCallerDisabled bool   `yaml:"LogCallerDisabled"` // 禁用日志source查找以降低开销
+	LogSourceDepth    int    `yaml:"LogSourceDepth"`    // 日志source保留的路径层级数
 }
 
 // ServiceConfig 保持服务HTTP端点配置
 type ServiceConfig struct {
 	Host string `yaml:"Host"`
 	Port int    `yaml:"Port"`
+
+	AllowMappingReload bool `yaml:"AllowMappingReload"` // 允许通过 POST /mappings 推送本地映射文件
+	AllowCacheImport   bool `yaml:"AllowCacheImport"`   // 允许通过 POST /cache/import 恢复缓存数据
+	FloatPrecision     *int `yaml:"FloatPrecision"`     // GET命令和HTTP响应中浮点值的小数位数，未配置时不限制
+
+	ForwardLogFailureThreshold   int `yaml:"ForwardLogFailureThreshold"`   // 前向日志连续发送失败达到该数量时健康状态降级
+	ForwardLogMaxQueueSize       int `yaml:"ForwardLogMaxQueueSize"`       // 前向日志队列上限，超出时丢弃最旧的条目；0 使用默认值，负数表示不限制
+	ForwardLogSignificantFigures int `yaml:"ForwardLogSignificantFigures"` // 前向日志中浮点值保留的有效数字位数，0表示不舍入，不影响Modbus寄存器值
+
+	TimeFormat string `yaml:"TimeFormat"` // HTTP响应中缓存时间戳的格式：RFC3339、RFC3339Nano或Go时间布局，未配置时为RFC3339
+
+	EmptyCacheWindow string `yaml:"EmptyCacheWindow"` // 启动后超过该时长仍未收到真实数据（资源默认值不计）时健康状态降级，例如 "5m"，为空表示不检查
+}
+
+// GetEmptyCacheWindow 返回空缓存启动窗口作为time.Duration，未配置或无效时为0（不检查）
+func (c *ServiceConfig) GetEmptyCacheWindow() time.Duration {
+	d, err := time.ParseDuration(c.EmptyCacheWindow)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// GetTimeFormat 返回HTTP响应使用的时间布局
+func (c *ServiceConfig) GetTimeFormat() string {
+	switch c.TimeFormat {
+	case "", "RFC3339":
+		return time.RFC3339
+	case "RFC3339Nano":
+		return time.RFC3339Nano
+	default:
+		return c.TimeFormat
+	}
+}
+
+// DefaultForwardLogFailureThreshold 前向日志连续失败降级阈值的默认值
+const DefaultForwardLogFailureThreshold = 3
+
+// DefaultForwardLogMaxQueueSize 前向日志队列上限的默认值
+const DefaultForwardLogMaxQueueSize = 10000
+
+// SelfTestConfig 保持缓存转换自检配置
+type SelfTestConfig struct {
+	Interval   string `yaml:"Interval"`   // 自检间隔，例如 "10m"，为空表示不启用
+	SampleSize int    `yaml:"SampleSize"` // 每次自检抽样的缓存条目数
+}
+
+// GetInterval 返回自检间隔作为time.Duration，未配置时为0（不启用）
+func (c *SelfTestConfig) GetInterval() time.Duration {
+	d, err := time.ParseDuration(c.Interval)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// PreflightConfig 保持启动前自检配置
+type PreflightConfig struct {
+	CheckBroker   bool   `yaml:"CheckBroker"`   // 启动前检查MQTT Broker是否可以建立TCP连接
+	BrokerTimeout string `yaml:"BrokerTimeout"` // 连接Broker的超时，例如 "3s"
+}
+
+// GetBrokerTimeout 返回连接Broker的超时作为time.Duration
+func (c *PreflightConfig) GetBrokerTimeout() time.Duration {
+	d, err := time.ParseDuration(c.BrokerTimeout)
+	if err != nil || d <= 0 {
+		return 3 * time.Second
+	}
+	return d
 }
 
 // AppConfig 是主配置结构
@@ -110,10 +633,14 @@ type AppConfig struct {
 	Writable  WritableConfig  `yaml:"Writable"`
 	Service   ServiceConfig   `yaml:"Service"`
 	NodeID    string          `yaml:"NodeID"`
+	NodeIDs   []string        `yaml:"NodeIDs"` // 同一进程额外服务的节点ID，各自使用独立的MQTT客户端和映射管理器
 	Mqtt      MqttConfig      `yaml:"Mqtt"`
 	Modbus    ModbusConfig    `yaml:"Modbus"`
 	Cache     CacheConfig     `yaml:"Cache"`
+	Mapping   MappingConfig   `yaml:"Mapping"`
 	Heartbeat HeartbeatConfig `yaml:"Heartbeat"`
+	SelfTest  SelfTestConfig  `yaml:"SelfTest"`
+	Preflight PreflightConfig `yaml:"Preflight"`
 }
 
 // Validate 验证配置
@@ -121,6 +648,16 @@ func (c *AppConfig) Validate() error {
 	if c.NodeID == "" {
 		return errors.New("NodeID cannot be empty")
 	}
+	seenNodes := map[string]bool{c.NodeID: true}
+	for _, id := range c.NodeIDs {
+		if id == "" {
+			return errors.New("NodeIDs entry cannot be empty")
+		}
+		if seenNodes[id] {
+			return fmt.Errorf("NodeIDs has duplicate node %s", id)
+		}
+		seenNodes[id] = true
+	}
 	if c.Mqtt.Broker == "" {
 		return errors.New("MQTT Broker cannot be empty")
 	}
@@ -136,6 +673,40 @@ func (c *AppConfig) Validate() error {
 	if c.Mqtt.KeepAlive <= 0 {
 		c.Mqtt.KeepAlive = 60 // 默认值
 	}
+	if c.Mqtt.MaxPendingRequests <= 0 {
+		c.Mqtt.MaxPendingRequests = 1000 // 默认值
+	}
+	if c.Mqtt.ResponseRetries == nil {
+		retries := DefaultResponseRetries // 默认值
+		c.Mqtt.ResponseRetries = &retries
+	} else if *c.Mqtt.ResponseRetries < 0 {
+		return errors.New("MQTT ResponseRetries cannot be negative")
+	}
+	if c.Mqtt.CommandQoS <= 0 {
+		c.Mqtt.CommandQoS = 1 // 默认值
+	}
+	if c.Mqtt.CommandQoS > 2 {
+		return errors.New("MQTT CommandQoS must be 1 or 2")
+	}
+	if c.Mqtt.DeadLetter.MaxPayloadBytes <= 0 {
+		c.Mqtt.DeadLetter.MaxPayloadBytes = DefaultDeadLetterMaxPayloadBytes
+	}
+	if c.Mqtt.DeadLetter.MaxFileBytes <= 0 {
+		c.Mqtt.DeadLetter.MaxFileBytes = DefaultDeadLetterMaxFileBytes
+	}
+	if c.Mqtt.SharedSubscription.Enabled {
+		group := c.Mqtt.SharedSubscription.Group
+		if group == "" {
+			return errors.New("MQTT SharedSubscription Group cannot be empty when enabled")
+		}
+		if strings.ContainsAny(group, "/+#") {
+			return fmt.Errorf("MQTT SharedSubscription Group %q must not contain '/', '+' or '#'", group)
+		}
+		// ClientID 是本实例私有响应主题的最后一层
+		if strings.ContainsAny(c.Mqtt.ClientID, "/+#") {
+			return fmt.Errorf("MQTT ClientID %q must not contain '/', '+' or '#' when SharedSubscription is enabled", c.Mqtt.ClientID)
+		}
+	}
 
 	// 根据类型验证Modbus配置
 	switch c.Modbus.Type {
@@ -143,7 +714,7 @@ func (c *AppConfig) Validate() error {
 		if c.Modbus.TCP.Host == "" {
 			c.Modbus.TCP.Host = "0.0.0.0"
 		}
-		if c.Modbus.TCP.Port <= 0 {
+		if c.Modbus.TCP.Port <= 0 && !c.Modbus.TCP.autoPort {
 			c.Modbus.TCP.Port = 502
 		}
 		if c.Modbus.TCP.SlaveID == 0 {
@@ -171,14 +742,56 @@ func (c *AppConfig) Validate() error {
 	default:
 		c.Modbus.Type = "TCP" // 默认使用TCP
 	}
+	if c.Modbus.OneBased && !c.Modbus.AddressOffsets.IsZero() {
+		// 基地址（如40001）已包含从1开始编号的偏移，同时启用会重复换算
+		return errors.New("Modbus OneBased cannot be combined with AddressOffsets")
+	}
+	switch c.Modbus.MultiCoilWritePolicy {
+	case "":
+		c.Modbus.MultiCoilWritePolicy = CoilWritePolicyAllOrNothing
+	case CoilWritePolicyAllOrNothing, CoilWritePolicySkipReadOnly:
+	default:
+		return fmt.Errorf("Modbus MultiCoilWritePolicy must be %s or %s, got %q",
+			CoilWritePolicyAllOrNothing, CoilWritePolicySkipReadOnly, c.Modbus.MultiCoilWritePolicy)
+	}
+	if c.Modbus.ConversionCacheSize < 0 {
+		return errors.New("Modbus ConversionCacheSize cannot be negative")
+	}
+	if c.Modbus.MaxReadQuantity < 0 {
+		return errors.New("Modbus MaxReadQuantity cannot be negative")
+	}
+	if err := c.validateNodeUnitIDs(); err != nil {
+		return err
+	}
+	if c.Modbus.OrderProbe.Enabled && c.Modbus.OrderProbe.Magic == 0 {
+		// 全零寄存器在任何顺序下读数相同，无法区分
+		return errors.New("Modbus OrderProbe Magic must be non-zero")
+	}
+	qualityAddrs := make(map[uint16]bool, len(c.Modbus.QualityRegisters))
+	for _, q := range c.Modbus.QualityRegisters {
+		if q.Address == q.DataAddress {
+			return fmt.Errorf("Modbus QualityRegisters address %d cannot monitor itself", q.Address)
+		}
+		if qualityAddrs[q.Address] {
+			return fmt.Errorf("Modbus QualityRegisters address %d is configured more than once", q.Address)
+		}
+		qualityAddrs[q.Address] = true
+	}
+	if len(c.Modbus.ExceptionStatusCoils) > MaxExceptionStatusCoils {
+		return fmt.Errorf("Modbus ExceptionStatusCoils supports at most %d addresses, got %d",
+			MaxExceptionStatusCoils, len(c.Modbus.ExceptionStatusCoils))
+	}
 
-	// 为缓存和心跳设置默认值
+	// 为缓存、映射和心跳设置默认值
 	if c.Cache.DefaultTTL == "" {
 		c.Cache.DefaultTTL = "30s"
 	}
 	if c.Cache.CleanupInterval == "" {
 		c.Cache.CleanupInterval = "5m"
 	}
+	if c.Mapping.MaxMappings <= 0 {
+		c.Mapping.MaxMappings = 10000
+	}
 	if c.Heartbeat.Interval == "" {
 		c.Heartbeat.Interval = "2m"
 	}
@@ -190,6 +803,9 @@ func (c *AppConfig) Validate() error {
 	if c.Writable.LogLevel == "" {
 		c.Writable.LogLevel = "INFO"
 	}
+	if c.Writable.LogSourceDepth <= 0 {
+		c.Writable.LogSourceDepth = 2
+	}
 
 	// 为服务设置默认值
 	if c.Service.Host == "" {
@@ -198,10 +814,53 @@ func (c *AppConfig) Validate() error {
 	if c.Service.Port <= 0 {
 		c.Service.Port = 59711
 	}
+	if c.SelfTest.SampleSize <= 0 {
+		c.SelfTest.SampleSize = 10
+	}
+	if c.Service.ForwardLogFailureThreshold <= 0 {
+		c.Service.ForwardLogFailureThreshold = DefaultForwardLogFailureThreshold
+	}
+	if c.Service.ForwardLogMaxQueueSize == 0 {
+		c.Service.ForwardLogMaxQueueSize = DefaultForwardLogMaxQueueSize
+	}
+	if c.Service.ForwardLogSignificantFigures < 0 {
+		return errors.New("Service ForwardLogSignificantFigures cannot be negative")
+	}
 
 	return nil
 }
 
+// validateNodeUnitIDs 检查额外节点的单元标识符：只能分配给 NodeIDs 中的节点，
+// 不能是广播地址0或主节点的从站地址，且互不相同
+func (c *AppConfig) validateNodeUnitIDs() error {
+	extra := make(map[string]bool, len(c.NodeIDs))
+	for _, id := range c.NodeIDs {
+		extra[id] = true
+	}
+	owners := make(map[byte]string, len(c.Modbus.NodeUnitIDs))
+	for nodeID, unitID := range c.Modbus.NodeUnitIDs {
+		if !extra[nodeID] {
+			return fmt.Errorf("Modbus NodeUnitIDs node %s is not listed in NodeIDs", nodeID)
+		}
+		if unitID == 0 {
+			return fmt.Errorf("Modbus NodeUnitIDs node %s cannot use broadcast unit ID 0", nodeID)
+		}
+		if unitID == c.Modbus.SlaveID() {
+			return fmt.Errorf("Modbus NodeUnitIDs node %s cannot use the primary SlaveID %d", nodeID, unitID)
+		}
+		if other, ok := owners[unitID]; ok {
+			return fmt.Errorf("Modbus NodeUnitIDs unit ID %d is assigned to both %s and %s", unitID, other, nodeID)
+		}
+		owners[unitID] = nodeID
+	}
+	return nil
+}
+
+// GetNodeIDs 返回本进程服务的全部节点ID，主节点NodeID在首位
+func (c *AppConfig) GetNodeIDs() []string {
+	return append([]string{c.NodeID}, c.NodeIDs...)
+}
+
 // LoadConfig 从YAML文件加载配置
 func LoadConfig(path string) (*AppConfig, error) {
 	data, err := os.ReadFile(path)
@@ -210,9 +869,11 @@ func LoadConfig(path string) (*AppConfig, error) {
 	}
 
 	var config AppConfig
+	config.Modbus.TCP.Port = unsetPort
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	config.Modbus.TCP.autoPort = config.Modbus.TCP.Port == 0
 
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
@@ -225,7 +886,8 @@ func LoadConfig(path string) (*AppConfig, error) {
 func DefaultConfig() *AppConfig {
 	return &AppConfig{
 		Writable: WritableConfig{
-			LogLevel: "DEBUG",
+			LogLevel:       "DEBUG",
+			LogSourceDepth: 2,
 		},
 		Service: ServiceConfig{
 			Host: "localhost",
@@ -251,6 +913,9 @@ func DefaultConfig() *AppConfig {
 			DefaultTTL:      "30s",
 			CleanupInterval: "5m",
 		},
+		Mapping: MappingConfig{
+			MaxMappings: 10000,
+		},
 		Heartbeat: HeartbeatConfig{
 			Interval: "2m",
 			Timeout:  "10s",
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -12,6 +14,7 @@ func TestCacheConfig_GetDefaultTTL(t *testing.T) {
 	tests := []struct {
 		name       string
 		defaultTTL string
+		minTTL     string
 		want       time.Duration
 	}{
 		{
@@ -39,11 +42,28 @@ func TestCacheConfig_GetDefaultTTL(t *testing.T) {
 			defaultTTL: "",
 			want:       30 * time.Second, // default
 		},
+		{
+			name:       "below default floor",
+			defaultTTL: "1ms",
+			want:       DefaultMinTTL,
+		},
+		{
+			name:       "below configured floor",
+			defaultTTL: "1ms",
+			minTTL:     "1s",
+			want:       time.Second,
+		},
+		{
+			name:       "above configured floor",
+			defaultTTL: "5s",
+			minTTL:     "1s",
+			want:       5 * time.Second,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := &CacheConfig{DefaultTTL: tt.defaultTTL}
+			c := &CacheConfig{DefaultTTL: tt.defaultTTL, MinTTL: tt.minTTL}
 			got := c.GetDefaultTTL()
 			assert.Equal(t, tt.want, got)
 		})
@@ -174,12 +194,309 @@ func TestHeartbeatConfig_GetTimeout(t *testing.T) {
 	}
 }
 
+// TestHeartbeatConfig_GetInitialDelay tests the GetInitialDelay method
+func TestHeartbeatConfig_GetInitialDelay(t *testing.T) {
+	tests := []struct {
+		name         string
+		initialDelay string
+		want         time.Duration
+	}{
+		{name: "valid duration", initialDelay: "5s", want: 5 * time.Second},
+		{name: "empty duration", initialDelay: "", want: 0},
+		{name: "invalid duration", initialDelay: "invalid", want: 0},
+		{name: "negative duration", initialDelay: "-1s", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &HeartbeatConfig{InitialDelay: tt.initialDelay}
+			assert.Equal(t, tt.want, h.GetInitialDelay())
+		})
+	}
+}
+
+// TestMqttConfig_GetCleanSession tests that clean session defaults to true when unset
+func TestMqttConfig_GetCleanSession(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name         string
+		cleanSession *bool
+		want         bool
+	}{
+		{name: "unset", cleanSession: nil, want: true},
+		{name: "enabled", cleanSession: &enabled, want: true},
+		{name: "disabled", cleanSession: &disabled, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &MqttConfig{CleanSession: tt.cleanSession}
+			assert.Equal(t, tt.want, m.GetCleanSession())
+		})
+	}
+}
+
+// TestMqttConfig_ResponseRetries tests that response retries default when unset, including after Validate
+func TestMqttConfig_ResponseRetries(t *testing.T) {
+	zero, five, negative := 0, 5, -1
+	tests := []struct {
+		name    string
+		retries *int
+		want    int
+		wantErr bool
+	}{
+		{name: "unset", retries: nil, want: DefaultResponseRetries},
+		{name: "disabled", retries: &zero, want: 0},
+		{name: "configured", retries: &five, want: 5},
+		{name: "negative", retries: &negative, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Mqtt.ResponseRetries = tt.retries
+			err := cfg.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if assert.NotNil(t, cfg.Mqtt.ResponseRetries) {
+				assert.Equal(t, tt.want, *cfg.Mqtt.ResponseRetries)
+			}
+			assert.Equal(t, tt.want, cfg.Mqtt.GetResponseRetries())
+		})
+	}
+}
+
+func TestMqttConfig_GetReconnectJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter string
+		want   time.Duration
+	}{
+		{name: "unset", jitter: "", want: 0},
+		{name: "configured", jitter: "5s", want: 5 * time.Second},
+		{name: "invalid", jitter: "soon", want: 0},
+		{name: "negative", jitter: "-1s", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &MqttConfig{ReconnectJitter: tt.jitter}
+			assert.Equal(t, tt.want, m.GetReconnectJitter())
+		})
+	}
+}
+
+// TestOrderProbeConfig_GetTimeout tests the order probe wait default and parsing
+func TestOrderProbeConfig_GetTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout string
+		want    time.Duration
+	}{
+		{name: "unset", timeout: "", want: DefaultOrderProbeTimeout},
+		{name: "configured", timeout: "3s", want: 3 * time.Second},
+		{name: "invalid", timeout: "soon", want: DefaultOrderProbeTimeout},
+		{name: "negative", timeout: "-1s", want: DefaultOrderProbeTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &OrderProbeConfig{Timeout: tt.timeout}
+			assert.Equal(t, tt.want, p.GetTimeout())
+		})
+	}
+}
+
+// TestCacheConfig_GetRequeryInterval tests the re-query interval default and parsing
+func TestCacheConfig_GetRequeryInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval string
+		want     time.Duration
+	}{
+		{name: "unset", interval: "", want: DefaultRequeryInterval},
+		{name: "configured", interval: "30s", want: 30 * time.Second},
+		{name: "invalid", interval: "often", want: DefaultRequeryInterval},
+		{name: "zero", interval: "0s", want: DefaultRequeryInterval},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &CacheConfig{RequeryInterval: tt.interval}
+			assert.Equal(t, tt.want, c.GetRequeryInterval())
+		})
+	}
+}
+
+// TestHeartbeatConfig_GetReconnectGrace tests the heartbeat reconnect grace default and the explicit off switch
+func TestHeartbeatConfig_GetReconnectGrace(t *testing.T) {
+	tests := []struct {
+		name  string
+		grace string
+		want  time.Duration
+	}{
+		{name: "unset", grace: "", want: DefaultHeartbeatReconnectGrace},
+		{name: "configured", grace: "30s", want: 30 * time.Second},
+		{name: "invalid", grace: "soon", want: DefaultHeartbeatReconnectGrace},
+		{name: "disabled", grace: "0s", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &HeartbeatConfig{ReconnectGrace: tt.grace}
+			assert.Equal(t, tt.want, h.GetReconnectGrace())
+		})
+	}
+}
+
+// TestMqttConfig_GetCommandDedupWindow tests the command dedup window default and the explicit off switch
+func TestMqttConfig_GetCommandDedupWindow(t *testing.T) {
+	tests := []struct {
+		name   string
+		window string
+		want   time.Duration
+	}{
+		{name: "unset", window: "", want: DefaultCommandDedupWindow},
+		{name: "configured", window: "1m", want: time.Minute},
+		{name: "invalid", window: "forever", want: DefaultCommandDedupWindow},
+		{name: "disabled", window: "0s", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &MqttConfig{CommandDedupWindow: tt.window}
+			assert.Equal(t, tt.want, c.GetCommandDedupWindow())
+		})
+	}
+}
+
+// TestServiceConfig_GetTimeFormat tests named and custom timestamp layouts
+func TestServiceConfig_GetTimeFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeFormat string
+		want       string
+	}{
+		{name: "unset", timeFormat: "", want: time.RFC3339},
+		{name: "RFC3339", timeFormat: "RFC3339", want: time.RFC3339},
+		{name: "RFC3339Nano", timeFormat: "RFC3339Nano", want: time.RFC3339Nano},
+		{name: "custom layout", timeFormat: "2006-01-02 15:04:05", want: "2006-01-02 15:04:05"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ServiceConfig{TimeFormat: tt.timeFormat}
+			assert.Equal(t, tt.want, c.GetTimeFormat())
+		})
+	}
+}
+
+// TestAddressOffsetConfig tests request keys and resource keys per object type table
+func TestAddressOffsetConfig(t *testing.T) {
+	offsets := &AddressOffsetConfig{
+		Coils:            1,
+		DiscreteInputs:   10001,
+		InputRegisters:   30001,
+		HoldingRegisters: 40001,
+	}
+
+	resources := []struct {
+		name       string
+		objectType string
+		addr       uint16
+		key        AddressKey
+		ok         bool
+	}{
+		{"holding register", ObjectHoldingRegister, 40010, NewAddressKey(ObjectHoldingRegister, 9), true},
+		{"holding register base", ObjectHoldingRegister, 40001, NewAddressKey(ObjectHoldingRegister, 0), true},
+		{"holding register top", ObjectHoldingRegister, 65535, NewAddressKey(ObjectHoldingRegister, 25534), true},
+		{"input register", ObjectInputRegister, 30005, NewAddressKey(ObjectInputRegister, 4), true},
+		{"discrete input", ObjectDiscreteInput, 10002, NewAddressKey(ObjectDiscreteInput, 1), true},
+		{"coil base", ObjectCoil, 1, NewAddressKey(ObjectCoil, 0), true},
+		{"coil", ObjectCoil, 2, NewAddressKey(ObjectCoil, 1), true},
+		{"holding address below base", ObjectHoldingRegister, 9, 0, false},
+		{"coil address below base", ObjectCoil, 0, 0, false},
+		{"untyped address in holding range", "", 40010, NewAddressKey(ObjectHoldingRegister, 9), true},
+		{"untyped address in coil range", "", 9, NewAddressKey(ObjectCoil, 8), true},
+		{"untyped address below all bases", "", 0, AddressKey(0), true},
+	}
+
+	for _, tt := range resources {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := offsets.ResourceKey(tt.objectType, tt.addr)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.key, key)
+		})
+	}
+
+	// PDU地址总是表内地址：线圈PDU 0 和 1 是两个不同的键，分别对应资源地址 1 和 2
+	coil0, coil1 := offsets.Key(ObjectCoil, 0), offsets.Key(ObjectCoil, 1)
+	assert.NotEqual(t, coil0, coil1)
+	res1, _ := offsets.ResourceKey(ObjectCoil, 1)
+	res2, _ := offsets.ResourceKey(ObjectCoil, 2)
+	assert.Equal(t, res1, coil0)
+	assert.Equal(t, res2, coil1)
+
+	// 保持寄存器PDU 9 对应资源地址 40010，PDU 40010 是另一个地址
+	res40010, _ := offsets.ResourceKey(ObjectHoldingRegister, 40010)
+	assert.Equal(t, res40010, offsets.Key(ObjectHoldingRegister, 9))
+	assert.NotEqual(t, res40010, offsets.Key(ObjectHoldingRegister, 40010))
+
+	// 表内任意PDU地址都有键，不会因基地址溢出
+	assert.Equal(t, uint16(30000), offsets.Key(ObjectHoldingRegister, 30000).Addr())
+	assert.Equal(t, ObjectHoldingRegister, offsets.Key(ObjectHoldingRegister, 65535).ObjectType())
+
+	// 同一PDU地址的线圈与离散输入互不冲突
+	assert.NotEqual(t, offsets.Key(ObjectCoil, 5), offsets.Key(ObjectDiscreteInput, 5))
+
+	// 未配置偏移时所有对象类型共用表0，键与地址相同
+	none := &AddressOffsetConfig{}
+	assert.Equal(t, AddressKey(40010), none.Key(ObjectHoldingRegister, 40010))
+	key, ok := none.ResourceKey(ObjectHoldingRegister, 40010)
+	assert.True(t, ok)
+	assert.Equal(t, AddressKey(40010), key)
+	var unset *AddressOffsetConfig
+	assert.Equal(t, AddressKey(7), unset.Key(ObjectCoil, 7))
+}
+
+// TestAddressKey tests table-bounded address arithmetic and formatting of address keys
+func TestAddressKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    AddressKey
+		n      int
+		want   AddressKey
+		ok     bool
+		format string
+	}{
+		{"shared table", AddressKey(10), 2, AddressKey(12), true, "10"},
+		{"shared table end", AddressKey(65535), 1, 0, false, "65535"},
+		{"holding register", NewAddressKey(ObjectHoldingRegister, 9), 1, NewAddressKey(ObjectHoldingRegister, 10), true, "HoldingRegister:9"},
+		{"coil table end", NewAddressKey(ObjectCoil, 65535), 1, 0, false, "Coil:65535"},
+		{"before table start", NewAddressKey(ObjectDiscreteInput, 0), -1, 0, false, "DiscreteInput:0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.key.Add(tt.n)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.format, tt.key.String())
+		})
+	}
+}
+
 // TestDefaultConfig tests the DefaultConfig function
 func TestDefaultConfig(t *testing.T) {
 	cfg := DefaultConfig()
 
 	assert.NotNil(t, cfg)
 	assert.Equal(t, "DEBUG", cfg.Writable.LogLevel)
+	assert.Equal(t, 2, cfg.Writable.LogSourceDepth)
+	assert.False(t, cfg.Writable.LogCallerDisabled)
 	assert.Equal(t, "localhost", cfg.Service.Host)
 	assert.Equal(t, 59711, cfg.Service.Port)
 	assert.Equal(t, "modbus-node-001", cfg.NodeID)
@@ -194,6 +511,7 @@ func TestDefaultConfig(t *testing.T) {
 	assert.Equal(t, byte(1), cfg.Modbus.TCP.SlaveID)
 	assert.Equal(t, "30s", cfg.Cache.DefaultTTL)
 	assert.Equal(t, "5m", cfg.Cache.CleanupInterval)
+	assert.Equal(t, 10000, cfg.Mapping.MaxMappings)
 	assert.Equal(t, "2m", cfg.Heartbeat.Interval)
 	assert.Equal(t, "10s", cfg.Heartbeat.Timeout)
 }
@@ -213,6 +531,195 @@ func TestAppConfig_Validate(t *testing.T) {
 		assert.Contains(t, err.Error(), "NodeID cannot be empty")
 	})
 
+	t.Run("additional node IDs", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			nodeIDs []string
+			wantErr string
+		}{
+			{name: "none"},
+			{name: "distinct nodes", nodeIDs: []string{"node-b", "node-c"}},
+			{name: "empty entry", nodeIDs: []string{""}, wantErr: "NodeIDs entry cannot be empty"},
+			{name: "duplicate entry", nodeIDs: []string{"node-b", "node-b"}, wantErr: "duplicate node node-b"},
+			{name: "repeats NodeID", nodeIDs: []string{"modbus-node-001"}, wantErr: "duplicate node modbus-node-001"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := DefaultConfig()
+				cfg.NodeIDs = tt.nodeIDs
+				err := cfg.Validate()
+				if tt.wantErr == "" {
+					assert.NoError(t, err)
+					assert.Equal(t, append([]string{cfg.NodeID}, tt.nodeIDs...), cfg.GetNodeIDs())
+				} else {
+					assert.Error(t, err)
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("node unit IDs", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			unitIDs map[string]byte
+			wantErr string
+		}{
+			{name: "none"},
+			{name: "distinct units", unitIDs: map[string]byte{"node-b": 2, "node-c": 3}},
+			{name: "unknown node", unitIDs: map[string]byte{"node-x": 2}, wantErr: "not listed in NodeIDs"},
+			{name: "broadcast unit", unitIDs: map[string]byte{"node-b": 0}, wantErr: "broadcast unit ID 0"},
+			{name: "primary slave ID", unitIDs: map[string]byte{"node-b": 1}, wantErr: "primary SlaveID 1"},
+			{name: "shared unit", unitIDs: map[string]byte{"node-b": 2, "node-c": 2}, wantErr: "unit ID 2 is assigned to both"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := DefaultConfig()
+				cfg.NodeIDs = []string{"node-b", "node-c"}
+				cfg.Modbus.NodeUnitIDs = tt.unitIDs
+				err := cfg.Validate()
+				if tt.wantErr == "" {
+					assert.NoError(t, err)
+				} else {
+					assert.Error(t, err)
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("multi-coil write policy", func(t *testing.T) {
+		tests := []struct {
+			policy  string
+			want    string
+			wantErr bool
+		}{
+			{policy: "", want: CoilWritePolicyAllOrNothing},
+			{policy: CoilWritePolicyAllOrNothing, want: CoilWritePolicyAllOrNothing},
+			{policy: CoilWritePolicySkipReadOnly, want: CoilWritePolicySkipReadOnly},
+			{policy: "partial", wantErr: true},
+		}
+		for _, tt := range tests {
+			cfg := DefaultConfig()
+			cfg.Modbus.MultiCoilWritePolicy = tt.policy
+			err := cfg.Validate()
+			if tt.wantErr {
+				assert.Error(t, err, tt.policy)
+				continue
+			}
+			assert.NoError(t, err, tt.policy)
+			assert.Equal(t, tt.want, cfg.Modbus.MultiCoilWritePolicy)
+		}
+	})
+
+	t.Run("order probe", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			probe   OrderProbeConfig
+			wantErr bool
+		}{
+			{name: "disabled ignores magic", probe: OrderProbeConfig{}},
+			{name: "enabled with magic", probe: OrderProbeConfig{Enabled: true, Address: 500, Magic: 0x1234}},
+			{name: "enabled without magic", probe: OrderProbeConfig{Enabled: true, Address: 500}, wantErr: true},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := DefaultConfig()
+				cfg.Modbus.OrderProbe = tt.probe
+				err := cfg.Validate()
+				if tt.wantErr {
+					assert.Error(t, err)
+					assert.Contains(t, err.Error(), "OrderProbe Magic")
+					return
+				}
+				assert.NoError(t, err)
+			})
+		}
+	})
+
+	t.Run("shared subscription group", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			shared   MqttSharedSubscriptionConfig
+			clientID string
+			wantErr  string
+		}{
+			{name: "disabled ignores group", shared: MqttSharedSubscriptionConfig{Group: "a/b"}},
+			{name: "valid group", shared: MqttSharedSubscriptionConfig{Enabled: true, Group: "modbus"}},
+			{name: "empty group", shared: MqttSharedSubscriptionConfig{Enabled: true}, wantErr: "Group cannot be empty"},
+			{name: "wildcard group", shared: MqttSharedSubscriptionConfig{Enabled: true, Group: "g+"}, wantErr: "must not contain"},
+			{name: "slash group", shared: MqttSharedSubscriptionConfig{Enabled: true, Group: "a/b"}, wantErr: "must not contain"},
+			{name: "slash client ID", shared: MqttSharedSubscriptionConfig{Enabled: true, Group: "modbus"}, clientID: "site/1", wantErr: "ClientID"},
+			{name: "slash client ID without sharing", shared: MqttSharedSubscriptionConfig{Group: "modbus"}, clientID: "site/1"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := DefaultConfig()
+				cfg.Mqtt.SharedSubscription = tt.shared
+				if tt.clientID != "" {
+					cfg.Mqtt.ClientID = tt.clientID
+				}
+				err := cfg.Validate()
+				if tt.wantErr == "" {
+					assert.NoError(t, err)
+				} else {
+					assert.Error(t, err)
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("one-based addressing", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			offsets AddressOffsetConfig
+			wantErr string
+		}{
+			{name: "without offsets", offsets: AddressOffsetConfig{}},
+			{name: "with offsets", offsets: AddressOffsetConfig{HoldingRegisters: 40001}, wantErr: "cannot be combined"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := DefaultConfig()
+				cfg.Modbus.OneBased = true
+				cfg.Modbus.AddressOffsets = tt.offsets
+				err := cfg.Validate()
+				if tt.wantErr == "" {
+					assert.NoError(t, err)
+				} else {
+					assert.Error(t, err)
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("quality registers", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			regs    []QualityRegisterConfig
+			wantErr string
+		}{
+			{name: "valid", regs: []QualityRegisterConfig{{Address: 900, DataAddress: 100}, {Address: 901, DataAddress: 101}}},
+			{name: "self reference", regs: []QualityRegisterConfig{{Address: 100, DataAddress: 100}}, wantErr: "cannot monitor itself"},
+			{name: "duplicate address", regs: []QualityRegisterConfig{{Address: 900, DataAddress: 100}, {Address: 900, DataAddress: 101}}, wantErr: "more than once"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := DefaultConfig()
+				cfg.Modbus.QualityRegisters = tt.regs
+				err := cfg.Validate()
+				if tt.wantErr == "" {
+					assert.NoError(t, err)
+				} else {
+					assert.Error(t, err)
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+			})
+		}
+	})
+
 	t.Run("missing MQTT Broker", func(t *testing.T) {
 		cfg := &AppConfig{
 			NodeID: "node1",
@@ -296,4 +803,157 @@ func TestAppConfig_Validate(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, 60, cfg.Mqtt.KeepAlive)
 	})
+
+	t.Run("sets default Mapping MaxMappings", func(t *testing.T) {
+		cfg := &AppConfig{
+			NodeID: "node1",
+			Mqtt: MqttConfig{
+				Broker:   "tcp://localhost:1883",
+				ClientID: "test-client",
+				QoS:      1,
+			},
+		}
+		err := cfg.Validate()
+		assert.NoError(t, err)
+		assert.Equal(t, 10000, cfg.Mapping.MaxMappings)
+	})
+}
+
+// TestLoadConfig_ModbusTCPPort tests that an omitted port defaults to 502 while an explicit 0 is kept
+func TestLoadConfig_ModbusTCPPort(t *testing.T) {
+	tests := []struct {
+		name string
+		port string
+		want int
+	}{
+		{name: "omitted port", port: "", want: 502},
+		{name: "explicit auto port", port: "    Port: 0\n", want: 0},
+		{name: "explicit port", port: "    Port: 1502\n", want: 1502},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yaml := "NodeID: node1\n" +
+				"Mqtt:\n  Broker: tcp://localhost:1883\n  ClientID: test-client\n" +
+				"Modbus:\n  Type: TCP\n  TCP:\n    Host: 127.0.0.1\n" + tt.port
+			path := filepath.Join(t.TempDir(), "configuration.yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+
+			cfg, err := LoadConfig(path)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.Modbus.TCP.Port)
+
+			// Re-validating the loaded config (as preflight does) keeps the port
+			assert.NoError(t, cfg.Validate())
+			assert.Equal(t, tt.want, cfg.Modbus.TCP.Port)
+		})
+	}
+}
+
+// TestValidate_ModbusTCPPort tests that a config built in code with Port 0 defaults to 502
+// rather than auto-assigning; only an explicit 0 in the config file selects a free port
+func TestValidate_ModbusTCPPort(t *testing.T) {
+	tests := []struct {
+		name string
+		port int
+		want int
+	}{
+		{name: "zero value", port: 0, want: 502},
+		{name: "negative", port: -1, want: 502},
+		{name: "explicit port", port: 1502, want: 1502},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &AppConfig{
+				NodeID: "node1",
+				Mqtt:   MqttConfig{Broker: "tcp://localhost:1883", ClientID: "test-client"},
+				Modbus: ModbusConfig{Type: "TCP", TCP: ModbusTcpConfig{Port: tt.port}},
+			}
+			assert.NoError(t, cfg.Validate())
+			assert.Equal(t, tt.want, cfg.Modbus.TCP.Port)
+		})
+	}
+}
+
+// TestDiffConfig tests that a config reload plan only lists the subsystems whose settings changed
+func TestDiffConfig(t *testing.T) {
+	floatPrecision := func(digits int) func(c *AppConfig) {
+		return func(c *AppConfig) { c.Service.FloatPrecision = &digits }
+	}
+
+	tests := []struct {
+		name        string
+		setup       func(c *AppConfig) // applied to both the old and the updated config
+		modify      func(c *AppConfig)
+		wantReload  []Subsystem
+		wantRestart []string
+	}{
+		{name: "no changes", modify: func(c *AppConfig) {}},
+		{name: "same float precision", setup: floatPrecision(2), modify: func(c *AppConfig) {}},
+		{name: "float precision", setup: floatPrecision(2), modify: floatPrecision(3), wantRestart: []string{"Service"}},
+		{name: "log level", modify: func(c *AppConfig) { c.Writable.LogLevel = "ERROR" }, wantReload: []Subsystem{SubsystemLogger}},
+		{name: "log source depth", modify: func(c *AppConfig) { c.Writable.LogSourceDepth = 5 }, wantRestart: []string{"Writable"}},
+		{name: "cache TTL", modify: func(c *AppConfig) { c.Cache.DefaultTTL = "1m" }, wantReload: []Subsystem{SubsystemCache}},
+		{name: "cache cleanup interval", modify: func(c *AppConfig) { c.Cache.CleanupInterval = "1m" }, wantRestart: []string{"Cache.CleanupInterval"}},
+		{name: "heartbeat", modify: func(c *AppConfig) { c.Heartbeat.Interval = "10s" }, wantReload: []Subsystem{SubsystemHeartbeat}},
+		{name: "modbus", modify: func(c *AppConfig) { c.Modbus.TCP.Port = 1502 }, wantReload: []Subsystem{SubsystemModbus}},
+		{name: "modbus address offsets", modify: func(c *AppConfig) { c.Modbus.AddressOffsets.HoldingRegisters = 40001 }, wantRestart: []string{"Modbus.AddressOffsets"}},
+		{name: "modbus node unit IDs", modify: func(c *AppConfig) { c.Modbus.NodeUnitIDs = map[string]byte{"node-b": 2} }, wantRestart: []string{"Modbus.NodeUnitIDs"}},
+		{name: "mqtt sequence field", modify: func(c *AppConfig) { c.Mqtt.SequenceField = "seq" }, wantReload: []Subsystem{SubsystemMQTT}},
+		{name: "mqtt dead letter", modify: func(c *AppConfig) { c.Mqtt.DeadLetter.File = "dead.log" }, wantRestart: []string{"Mqtt.DeadLetter"}},
+		{
+			name: "mixed",
+			modify: func(c *AppConfig) {
+				c.Writable.LogLevel = "INFO"
+				c.Mqtt.QoS = 2
+				c.Service.Port = 8080
+				c.NodeIDs = []string{"n2"}
+			},
+			wantReload:  []Subsystem{SubsystemLogger, SubsystemMQTT},
+			wantRestart: []string{"NodeID", "Service"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, updated := DefaultConfig(), DefaultConfig()
+			if tt.setup != nil {
+				tt.setup(old)
+				tt.setup(updated)
+			}
+			tt.modify(updated)
+
+			plan := DiffConfig(old, updated)
+			assert.Equal(t, tt.wantReload, plan.Subsystems)
+			assert.Equal(t, tt.wantRestart, plan.RestartRequired)
+			assert.Equal(t, tt.wantReload == nil && tt.wantRestart == nil, plan.Empty())
+		})
+	}
+}
+
+// TestValidate_ForwardLogMaxQueueSize tests that 0 selects the default queue cap and a negative size is kept as unbounded
+func TestValidate_ForwardLogMaxQueueSize(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		want int
+	}{
+		{name: "unset", size: 0, want: DefaultForwardLogMaxQueueSize},
+		{name: "unbounded", size: -1, want: -1},
+		{name: "explicit", size: 500, want: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &AppConfig{
+				NodeID:  "node1",
+				Mqtt:    MqttConfig{Broker: "tcp://localhost:1883", ClientID: "test-client"},
+				Modbus:  ModbusConfig{Type: "TCP"},
+				Service: ServiceConfig{ForwardLogMaxQueueSize: tt.size},
+			}
+			assert.NoError(t, cfg.Validate())
+			assert.Equal(t, tt.want, cfg.Service.ForwardLogMaxQueueSize)
+		})
+	}
 }
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Subsystem 是配置热重载时可单独重新初始化的子系统
+type Subsystem string
+
+const (
+	SubsystemLogger    Subsystem = "logger"    // Writable.LogLevel
+	SubsystemCache     Subsystem = "cache"     // Cache 中除 CleanupInterval 外的设置（TTL、宽限期等）
+	SubsystemHeartbeat Subsystem = "heartbeat" // Heartbeat
+	SubsystemModbus    Subsystem = "modbus"    // Modbus 中除 AddressOffsets 和 NodeUnitIDs 外的设置，重启监听器
+	SubsystemMQTT      Subsystem = "mqtt"      // Mqtt，重新连接Broker
+)
+
+// ReloadPlan 是新旧配置的差异：需要重新初始化的子系统，以及变化了但只能重启服务才生效的配置项
+type ReloadPlan struct {
+	Subsystems      []Subsystem
+	RestartRequired []string
+}
+
+// Has 判断子系统是否需要重新初始化
+func (p *ReloadPlan) Has(subsystem Subsystem) bool {
+	for _, s := range p.Subsystems {
+		if s == subsystem {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty 判断配置是否没有任何变化
+func (p *ReloadPlan) Empty() bool {
+	return len(p.Subsystems) == 0 && len(p.RestartRequired) == 0
+}
+
+// String 返回用于日志的重载计划描述
+func (p *ReloadPlan) String() string {
+	if p.Empty() {
+		return "no changes"
+	}
+	names := make([]string, len(p.Subsystems))
+	for i, s := range p.Subsystems {
+		names[i] = string(s)
+	}
+	desc := fmt.Sprintf("reload [%s]", strings.Join(names, ", "))
+	if len(p.RestartRequired) > 0 {
+		desc += fmt.Sprintf(", restart required for [%s]", strings.Join(p.RestartRequired, ", "))
+	}
+	return desc
+}
+
+// DiffConfig 比较新旧配置，返回受影响的子系统
+// Service、Mapping、SelfTest、Preflight、节点ID及其单元标识符、日志source设置、缓存清理间隔、地址偏移和MQTT死信文件不支持热重载，列入 RestartRequired
+func DiffConfig(old, updated *AppConfig) *ReloadPlan {
+	plan := &ReloadPlan{}
+	restart := func(changed bool, name string) {
+		if changed {
+			plan.RestartRequired = append(plan.RestartRequired, name)
+		}
+	}
+	reload := func(changed bool, subsystem Subsystem) {
+		if changed {
+			plan.Subsystems = append(plan.Subsystems, subsystem)
+		}
+	}
+
+	reload(old.Writable.LogLevel != updated.Writable.LogLevel, SubsystemLogger)
+	restart(old.Writable.LogCallerDisabled != updated.Writable.LogCallerDisabled ||
+		old.Writable.LogSourceDepth != updated.Writable.LogSourceDepth, "Writable")
+
+	oldCache, newCache := old.Cache, updated.Cache
+	restart(oldCache.CleanupInterval != newCache.CleanupInterval, "Cache.CleanupInterval")
+	oldCache.CleanupInterval = newCache.CleanupInterval
+	reload(oldCache != newCache, SubsystemCache)
+
+	reload(old.Heartbeat != updated.Heartbeat, SubsystemHeartbeat)
+
+	oldModbus, newModbus := old.Modbus, updated.Modbus
+	restart(oldModbus.AddressOffsets != newModbus.AddressOffsets, "Modbus.AddressOffsets")
+	oldModbus.AddressOffsets = newModbus.AddressOffsets
+	restart(!reflect.DeepEqual(oldModbus.NodeUnitIDs, newModbus.NodeUnitIDs), "Modbus.NodeUnitIDs")
+	oldModbus.NodeUnitIDs = newModbus.NodeUnitIDs
+	reload(!reflect.DeepEqual(oldModbus, newModbus), SubsystemModbus)
+
+	oldMqtt, newMqtt := old.Mqtt, updated.Mqtt
+	restart(oldMqtt.DeadLetter != newMqtt.DeadLetter, "Mqtt.DeadLetter")
+	oldMqtt.DeadLetter = newMqtt.DeadLetter
+	reload(!reflect.DeepEqual(oldMqtt, newMqtt), SubsystemMQTT)
+
+	restart(old.NodeID != updated.NodeID || !reflect.DeepEqual(old.NodeIDs, updated.NodeIDs), "NodeID")
+	restart(!reflect.DeepEqual(old.Service, updated.Service), "Service")
+	restart(!reflect.DeepEqual(old.Mapping, updated.Mapping), "Mapping")
+	restart(!reflect.DeepEqual(old.SelfTest, updated.SelfTest), "SelfTest")
+	restart(!reflect.DeepEqual(old.Preflight, updated.Preflight), "Preflight")
+	return plan
+}
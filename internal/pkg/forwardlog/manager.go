@@ -1,29 +1,56 @@
 package forwardlog
 
 import (
+	"app-modbus-go/internal/pkg/config"
 	"app-modbus-go/internal/pkg/logger"
 	"app-modbus-go/internal/pkg/mqtt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// 前向日志条目来源
+const (
+	SourceModbus          = ""                // Modbus主站读取（默认，不随消息发送）
+	SourceCommand         = "command"         // 数据中心下发的PUT命令，用于审计
+	SourceConversionError = "conversionError" // 读取时类型转换失败，Data为资源的累计失败次数
+)
+
 // LogEntry 表示前向日志条目
 type LogEntry struct {
 	Status          int
 	NorthDeviceName string
 	Data            map[string]interface{}
-	Timestamp       time.Time
+	Timestamp       time.Time // 条目入队时间
+	ReadTime        time.Time // Modbus客户端实际读取数据的时间
+	Source          string    // 条目来源，见 SourceModbus/SourceCommand/SourceConversionError
+}
+
+// SendStats 是前向日志发送结果的统计
+type SendStats struct {
+	Failures            uint64 // 重试耗尽后仍发送失败的条目数
+	ConsecutiveFailures uint64 // 自上次发送成功以来连续失败的条目数
+	Dropped             uint64 // 队列已满时被丢弃的最旧条目数
 }
 
 // Manager 用批处理和重试管理前向日志报告
 type Manager struct {
 	mqttClient *mqtt.ClientManager
+	publish    func(*mqtt.MQTTMessage) error
 	lc         logger.LoggingClient
 
-	queue      []*LogEntry
-	batchSize  int
-	flushDelay time.Duration
-	maxRetries int
+	queue        entryQueue
+	maxQueueSize int // 队列上限，达到后丢弃最旧的条目；<=0 表示不限制
+	sigFigs      int // 条目中浮点值保留的有效数字位数；0 表示不舍入
+	batchSize    int
+	flushDelay   time.Duration
+	maxRetries   int
+	retryDelay   time.Duration // 重试间隔基数，第n次重试等待 n*retryDelay
+
+	failures            atomic.Uint64
+	consecutiveFailures atomic.Uint64
+	dropped             atomic.Uint64
 
 	mu      sync.Mutex
 	stopCh  chan struct{}
@@ -33,17 +60,41 @@ type Manager struct {
 
 // NewManager 创建新的前向日志管理器
 func NewManager(mqttClient *mqtt.ClientManager, lc logger.LoggingClient) *Manager {
-	return &Manager{
-		mqttClient: mqttClient,
-		lc:         lc,
-		queue:      make([]*LogEntry, 0),
-		batchSize:  10,
-		flushDelay: 5 * time.Second,
-		maxRetries: 3,
-		stopCh:     make(chan struct{}),
-		flushCh:    make(chan struct{}, 1),
-		doneCh:     make(chan struct{}),
+	m := &Manager{
+		mqttClient:   mqttClient,
+		lc:           lc,
+		maxQueueSize: config.DefaultForwardLogMaxQueueSize,
+		batchSize:    10,
+		flushDelay:   5 * time.Second,
+		maxRetries:   3,
+		retryDelay:   time.Second,
+		stopCh:       make(chan struct{}),
+		flushCh:      make(chan struct{}, 1),
+		doneCh:       make(chan struct{}),
+	}
+	if mqttClient != nil {
+		m.publish = mqttClient.Publish
 	}
+	return m
+}
+
+// SetMaxQueueSize 设置队列中等待发送的条目数上限，0 或负数表示不限制
+// MQTT不可用导致发送停滞时，超出上限的最旧条目被丢弃并计入 Stats().Dropped
+func (m *Manager) SetMaxQueueSize(size int) {
+	m.mu.Lock()
+	m.maxQueueSize = size
+	m.mu.Unlock()
+}
+
+// SetSignificantFigures 设置条目中浮点值保留的有效数字位数，0 表示不舍入
+// 只影响前向日志中的数值，Modbus寄存器和缓存中的值保持原始精度
+func (m *Manager) SetSignificantFigures(n int) {
+	if n < 0 {
+		n = 0
+	}
+	m.mu.Lock()
+	m.sigFigs = n
+	m.mu.Unlock()
 }
 
 // Start 启动前向日志管理器
@@ -61,25 +112,94 @@ func (m *Manager) Stop() {
 
 // LogSuccess 记录成功的数据转发
 func (m *Manager) LogSuccess(northDeviceName string, data map[string]interface{}) {
-	m.addEntry(1, northDeviceName, data)
+	m.addEntry(1, northDeviceName, data, time.Now())
+}
+
+// LogSuccessAt 记录成功的数据转发，并携带实际读取时间
+func (m *Manager) LogSuccessAt(northDeviceName string, data map[string]interface{}, readTime time.Time) {
+	m.addEntry(1, northDeviceName, data, readTime)
 }
 
 // LogFailure 记录失败的数据转发
 func (m *Manager) LogFailure(northDeviceName string, data map[string]interface{}) {
-	m.addEntry(0, northDeviceName, data)
+	m.addEntry(0, northDeviceName, data, time.Now())
+}
+
+// LogCommand 记录数据中心命令触发的写入，与Modbus主站的读写分开审计
+func (m *Manager) LogCommand(northDeviceName string, data map[string]interface{}, success bool) {
+	status := 0
+	if success {
+		status = 1
+	}
+	m.enqueue(&LogEntry{
+		Status:          status,
+		NorthDeviceName: northDeviceName,
+		Data:            m.roundData(data),
+		Timestamp:       time.Now(),
+		Source:          SourceCommand,
+	})
+}
+
+// LogConversionErrors 上报设备资源在读取时的类型转换累计失败次数，让数据中心发现系统性的配置问题
+func (m *Manager) LogConversionErrors(northDeviceName string, counts map[string]interface{}) {
+	m.enqueue(&LogEntry{
+		Status:          0,
+		NorthDeviceName: northDeviceName,
+		Data:            counts,
+		Timestamp:       time.Now(),
+		Source:          SourceConversionError,
+	})
 }
 
-func (m *Manager) addEntry(status int, northDeviceName string, data map[string]interface{}) {
-	entry := &LogEntry{
+func (m *Manager) addEntry(status int, northDeviceName string, data map[string]interface{}, readTime time.Time) {
+	m.enqueue(&LogEntry{
 		Status:          status,
 		NorthDeviceName: northDeviceName,
-		Data:            data,
+		Data:            m.roundData(data),
 		Timestamp:       time.Now(),
+		ReadTime:        readTime,
+	})
+}
+
+// roundData 返回浮点值按有效数字舍入后的数据副本，调用方的数据不被修改
+func (m *Manager) roundData(data map[string]interface{}) map[string]interface{} {
+	m.mu.Lock()
+	n := m.sigFigs
+	m.mu.Unlock()
+	if n == 0 || data == nil {
+		return data
 	}
 
+	rounded := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		switch f := v.(type) {
+		case float32:
+			rounded[k] = roundSignificant(float64(f), n, 32)
+		case float64:
+			rounded[k] = roundSignificant(f, n, 64)
+		default:
+			rounded[k] = v
+		}
+	}
+	return rounded
+}
+
+// roundSignificant 将浮点值舍入到n位有效数字，bitSize 为原始值的精度
+// 经十进制文本往返，结果没有二进制舍入残留（25.500000001 -> 25.5）
+func roundSignificant(v float64, n, bitSize int) float64 {
+	r, err := strconv.ParseFloat(strconv.FormatFloat(v, 'g', n, bitSize), 64)
+	if err != nil {
+		return v
+	}
+	return r
+}
+
+func (m *Manager) enqueue(entry *LogEntry) {
 	m.mu.Lock()
-	m.queue = append(m.queue, entry)
-	shouldFlush := len(m.queue) >= m.batchSize
+	if dropped := m.queue.push(entry, m.maxQueueSize); dropped > 0 {
+		m.dropped.Add(uint64(dropped))
+	}
+	shouldFlush := m.queue.len() >= m.batchSize
 	m.mu.Unlock()
 
 	if shouldFlush {
@@ -90,6 +210,41 @@ func (m *Manager) addEntry(status int, northDeviceName string, data map[string]i
 	}
 }
 
+// Peek 返回当前队列中条目的副本，不会修改或清空队列
+func (m *Manager) Peek() []LogEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]LogEntry, m.queue.len())
+	for i := range entries {
+		entry := m.queue.at(i)
+		entries[i] = *entry
+		if entry.Data != nil {
+			entries[i].Data = make(map[string]interface{}, len(entry.Data))
+			for k, v := range entry.Data {
+				entries[i].Data[k] = v
+			}
+		}
+	}
+	return entries
+}
+
+// QueueDepth 返回当前队列中等待发送的条目数
+func (m *Manager) QueueDepth() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.queue.len()
+}
+
+// Stats 返回前向日志发送失败统计
+func (m *Manager) Stats() SendStats {
+	return SendStats{
+		Failures:            m.failures.Load(),
+		ConsecutiveFailures: m.consecutiveFailures.Load(),
+		Dropped:             m.dropped.Load(),
+	}
+}
+
 func (m *Manager) run() {
 	defer close(m.doneCh)
 
@@ -111,12 +266,11 @@ func (m *Manager) run() {
 
 func (m *Manager) flush() {
 	m.mu.Lock()
-	if len(m.queue) == 0 {
+	if m.queue.len() == 0 {
 		m.mu.Unlock()
 		return
 	}
-	entries := m.queue
-	m.queue = make([]*LogEntry, 0)
+	entries := m.queue.drain()
 	m.mu.Unlock()
 
 	for _, entry := range entries {
@@ -125,8 +279,8 @@ func (m *Manager) flush() {
 }
 
 func (m *Manager) sendLogEntry(entry *LogEntry) {
-	// Skip sending if mqttClient is nil (for testing)
-	if m.mqttClient == nil {
+	// Skip sending if no publisher is configured (for testing)
+	if m.publish == nil {
 		return
 	}
 
@@ -134,16 +288,23 @@ func (m *Manager) sendLogEntry(entry *LogEntry) {
 		Status:          entry.Status,
 		NorthDeviceName: entry.NorthDeviceName,
 		Data:            entry.Data,
+		Source:          entry.Source,
+	}
+	if !entry.ReadTime.IsZero() {
+		payload.ReadTimestamp = entry.ReadTime.UnixMilli()
 	}
 	msg := mqtt.NewMessage(mqtt.TypeForwardLog, payload)
 
 	for attempt := 0; attempt < m.maxRetries; attempt++ {
-		if err := m.mqttClient.Publish(msg); err != nil {
+		if err := m.publish(msg); err != nil {
 			m.lc.Warn("Failed to send forward log (attempt %d): %s", attempt+1, err.Error())
-			time.Sleep(time.Second * time.Duration(attempt+1))
+			time.Sleep(m.retryDelay * time.Duration(attempt+1))
 			continue
 		}
+		m.consecutiveFailures.Store(0)
 		return
 	}
+	m.failures.Add(1)
+	m.consecutiveFailures.Add(1)
 	m.lc.Error("Failed to send forward log after %d attempts", m.maxRetries)
 }
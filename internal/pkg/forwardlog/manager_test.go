@@ -3,6 +3,7 @@ package forwardlog
 import (
 	"app-modbus-go/internal/pkg/logger"
 	"app-modbus-go/internal/pkg/mqtt"
+	"errors"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -51,7 +52,6 @@ func createTestManager(t *testing.T) (*Manager, *MockMQTTClient) {
 	manager := &Manager{
 		mqttClient: (*mqtt.ClientManager)(nil), // We'll use mock
 		lc:         lc,
-		queue:      make([]*LogEntry, 0),
 		batchSize:  10,
 		flushDelay: 5 * time.Second,
 		maxRetries: 3,
@@ -82,8 +82,8 @@ func TestNewManager(t *testing.T) {
 	if manager.maxRetries != 3 {
 		t.Errorf("expected maxRetries 3, got %d", manager.maxRetries)
 	}
-	if len(manager.queue) != 0 {
-		t.Errorf("expected empty queue, got %d items", len(manager.queue))
+	if manager.queue.len() != 0 {
+		t.Errorf("expected empty queue, got %d items", manager.queue.len())
 	}
 }
 
@@ -97,14 +97,14 @@ func TestLogSuccess(t *testing.T) {
 	manager.LogSuccess("device1", data)
 
 	manager.mu.Lock()
-	if len(manager.queue) != 1 {
-		t.Errorf("expected 1 entry in queue, got %d", len(manager.queue))
+	if manager.queue.len() != 1 {
+		t.Errorf("expected 1 entry in queue, got %d", manager.queue.len())
 	}
-	if manager.queue[0].Status != 1 {
-		t.Errorf("expected status 1 (success), got %d", manager.queue[0].Status)
+	if manager.queue.at(0).Status != 1 {
+		t.Errorf("expected status 1 (success), got %d", manager.queue.at(0).Status)
 	}
-	if manager.queue[0].NorthDeviceName != "device1" {
-		t.Errorf("expected device 'device1', got %s", manager.queue[0].NorthDeviceName)
+	if manager.queue.at(0).NorthDeviceName != "device1" {
+		t.Errorf("expected device 'device1', got %s", manager.queue.at(0).NorthDeviceName)
 	}
 	manager.mu.Unlock()
 }
@@ -119,11 +119,11 @@ func TestLogFailure(t *testing.T) {
 	manager.LogFailure("device1", data)
 
 	manager.mu.Lock()
-	if len(manager.queue) != 1 {
-		t.Errorf("expected 1 entry in queue, got %d", len(manager.queue))
+	if manager.queue.len() != 1 {
+		t.Errorf("expected 1 entry in queue, got %d", manager.queue.len())
 	}
-	if manager.queue[0].Status != 0 {
-		t.Errorf("expected status 0 (failure), got %d", manager.queue[0].Status)
+	if manager.queue.at(0).Status != 0 {
+		t.Errorf("expected status 0 (failure), got %d", manager.queue.at(0).Status)
 	}
 	manager.mu.Unlock()
 }
@@ -139,7 +139,7 @@ func TestBatchFlushOnSize(t *testing.T) {
 
 	// Check if flush was triggered
 	manager.mu.Lock()
-	queueSize := len(manager.queue)
+	queueSize := manager.queue.len()
 	manager.mu.Unlock()
 
 	// After batch size is reached, flush should be triggered
@@ -156,14 +156,14 @@ func TestAddEntry(t *testing.T) {
 		"temp": 20.0,
 	}
 
-	manager.addEntry(1, "device1", data)
+	manager.addEntry(1, "device1", data, time.Now())
 
 	manager.mu.Lock()
-	if len(manager.queue) != 1 {
-		t.Errorf("expected 1 entry, got %d", len(manager.queue))
+	if manager.queue.len() != 1 {
+		t.Errorf("expected 1 entry, got %d", manager.queue.len())
 	}
 
-	entry := manager.queue[0]
+	entry := manager.queue.at(0)
 	if entry.Status != 1 {
 		t.Errorf("expected status 1, got %d", entry.Status)
 	}
@@ -185,8 +185,8 @@ func TestMultipleLogEntries(t *testing.T) {
 	}
 
 	manager.mu.Lock()
-	if len(manager.queue) != 5 {
-		t.Errorf("expected 5 entries, got %d", len(manager.queue))
+	if manager.queue.len() != 5 {
+		t.Errorf("expected 5 entries, got %d", manager.queue.len())
 	}
 	manager.mu.Unlock()
 }
@@ -199,7 +199,7 @@ func TestLogEntryTimestamp(t *testing.T) {
 	after := time.Now()
 
 	manager.mu.Lock()
-	entry := manager.queue[0]
+	entry := manager.queue.at(0)
 	manager.mu.Unlock()
 
 	if entry.Timestamp.Before(before) || entry.Timestamp.After(after) {
@@ -207,6 +207,24 @@ func TestLogEntryTimestamp(t *testing.T) {
 	}
 }
 
+func TestLogSuccessAtReadTime(t *testing.T) {
+	manager, _ := createTestManager(t)
+
+	readTime := time.Now().Add(-2 * time.Second)
+	manager.LogSuccessAt("device1", map[string]interface{}{}, readTime)
+
+	manager.mu.Lock()
+	entry := manager.queue.at(0)
+	manager.mu.Unlock()
+
+	if !entry.ReadTime.Equal(readTime) {
+		t.Errorf("expected read time %v, got %v", readTime, entry.ReadTime)
+	}
+	if !entry.Timestamp.After(entry.ReadTime) {
+		t.Error("expected enqueue timestamp to be after read time")
+	}
+}
+
 func TestConcurrentLogging(t *testing.T) {
 	manager, _ := createTestManager(t)
 	numGoroutines := 10
@@ -228,8 +246,8 @@ func TestConcurrentLogging(t *testing.T) {
 
 	manager.mu.Lock()
 	expectedCount := numGoroutines * entriesPerGoroutine
-	if len(manager.queue) != expectedCount {
-		t.Errorf("expected %d entries, got %d", expectedCount, len(manager.queue))
+	if manager.queue.len() != expectedCount {
+		t.Errorf("expected %d entries, got %d", expectedCount, manager.queue.len())
 	}
 	manager.mu.Unlock()
 }
@@ -241,8 +259,8 @@ func TestFlushEmptyQueue(t *testing.T) {
 	manager.flush()
 
 	manager.mu.Lock()
-	if len(manager.queue) != 0 {
-		t.Errorf("expected empty queue after flush, got %d", len(manager.queue))
+	if manager.queue.len() != 0 {
+		t.Errorf("expected empty queue after flush, got %d", manager.queue.len())
 	}
 	manager.mu.Unlock()
 }
@@ -256,8 +274,8 @@ func TestFlushClearsQueue(t *testing.T) {
 	}
 
 	manager.mu.Lock()
-	if len(manager.queue) != 5 {
-		t.Errorf("expected 5 entries before flush, got %d", len(manager.queue))
+	if manager.queue.len() != 5 {
+		t.Errorf("expected 5 entries before flush, got %d", manager.queue.len())
 	}
 	manager.mu.Unlock()
 
@@ -265,8 +283,8 @@ func TestFlushClearsQueue(t *testing.T) {
 	manager.flush()
 
 	manager.mu.Lock()
-	if len(manager.queue) != 0 {
-		t.Errorf("expected empty queue after flush, got %d", len(manager.queue))
+	if manager.queue.len() != 0 {
+		t.Errorf("expected empty queue after flush, got %d", manager.queue.len())
 	}
 	manager.mu.Unlock()
 }
@@ -283,7 +301,7 @@ func TestLogEntryData(t *testing.T) {
 	manager.LogSuccess("device1", data)
 
 	manager.mu.Lock()
-	entry := manager.queue[0]
+	entry := manager.queue.at(0)
 	manager.mu.Unlock()
 
 	if entry.Data["temperature"] != 25.5 {
@@ -307,8 +325,8 @@ func TestQueueOrdering(t *testing.T) {
 
 	manager.mu.Lock()
 	for i := 0; i < 5; i++ {
-		if manager.queue[i].Data["index"] != i {
-			t.Errorf("expected index %d at position %d, got %v", i, i, manager.queue[i].Data["index"])
+		if manager.queue.at(i).Data["index"] != i {
+			t.Errorf("expected index %d at position %d, got %v", i, i, manager.queue.at(i).Data["index"])
 		}
 	}
 	manager.mu.Unlock()
@@ -322,17 +340,17 @@ func TestMixedSuccessAndFailure(t *testing.T) {
 	manager.LogSuccess("device2", map[string]interface{}{})
 
 	manager.mu.Lock()
-	if len(manager.queue) != 3 {
-		t.Errorf("expected 3 entries, got %d", len(manager.queue))
+	if manager.queue.len() != 3 {
+		t.Errorf("expected 3 entries, got %d", manager.queue.len())
 	}
 
-	if manager.queue[0].Status != 1 {
+	if manager.queue.at(0).Status != 1 {
 		t.Error("expected first entry to be success")
 	}
-	if manager.queue[1].Status != 0 {
+	if manager.queue.at(1).Status != 0 {
 		t.Error("expected second entry to be failure")
 	}
-	if manager.queue[2].Status != 1 {
+	if manager.queue.at(2).Status != 1 {
 		t.Error("expected third entry to be success")
 	}
 	manager.mu.Unlock()
@@ -366,13 +384,13 @@ func TestMultipleDevices(t *testing.T) {
 	}
 
 	manager.mu.Lock()
-	if len(manager.queue) != 3 {
-		t.Errorf("expected 3 entries, got %d", len(manager.queue))
+	if manager.queue.len() != 3 {
+		t.Errorf("expected 3 entries, got %d", manager.queue.len())
 	}
 
 	for i, dev := range devices {
-		if manager.queue[i].NorthDeviceName != dev {
-			t.Errorf("expected device %s at position %d, got %s", dev, i, manager.queue[i].NorthDeviceName)
+		if manager.queue.at(i).NorthDeviceName != dev {
+			t.Errorf("expected device %s at position %d, got %s", dev, i, manager.queue.at(i).NorthDeviceName)
 		}
 	}
 	manager.mu.Unlock()
@@ -390,11 +408,167 @@ func TestLargeDataPayload(t *testing.T) {
 	manager.LogSuccess("device1", largeData)
 
 	manager.mu.Lock()
-	if len(manager.queue) != 1 {
-		t.Errorf("expected 1 entry, got %d", len(manager.queue))
+	if manager.queue.len() != 1 {
+		t.Errorf("expected 1 entry, got %d", manager.queue.len())
+	}
+	if len(manager.queue.at(0).Data) != 100 {
+		t.Errorf("expected 100 data items, got %d", len(manager.queue.at(0).Data))
+	}
+	manager.mu.Unlock()
+}
+
+func TestPeekAndQueueDepth(t *testing.T) {
+	manager, _ := createTestManager(t)
+
+	if manager.QueueDepth() != 0 {
+		t.Errorf("expected empty queue depth, got %d", manager.QueueDepth())
+	}
+
+	manager.LogSuccess("device1", map[string]interface{}{"temp": 20.0})
+	manager.LogFailure("device2", map[string]interface{}{"humidity": 55})
+
+	if depth := manager.QueueDepth(); depth != 2 {
+		t.Errorf("expected queue depth 2, got %d", depth)
+	}
+
+	entries := manager.Peek()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 peeked entries, got %d", len(entries))
+	}
+	if entries[0].NorthDeviceName != "device1" || entries[0].Status != 1 {
+		t.Errorf("unexpected first entry: %+v", entries[0])
 	}
-	if len(manager.queue[0].Data) != 100 {
-		t.Errorf("expected 100 data items, got %d", len(manager.queue[0].Data))
+	if entries[1].NorthDeviceName != "device2" || entries[1].Status != 0 {
+		t.Errorf("unexpected second entry: %+v", entries[1])
+	}
+
+	// Mutating the peeked copy must not affect the queue
+	entries[0].Data["temp"] = 99.0
+	entries[0].NorthDeviceName = "changed"
+
+	if depth := manager.QueueDepth(); depth != 2 {
+		t.Errorf("expected queue depth to remain 2 after peek, got %d", depth)
+	}
+	manager.mu.Lock()
+	if manager.queue.at(0).Data["temp"] != 20.0 || manager.queue.at(0).NorthDeviceName != "device1" {
+		t.Error("peek returned entries sharing state with the queue")
 	}
 	manager.mu.Unlock()
 }
+
+func TestSendFailureStats(t *testing.T) {
+	manager, mockClient := createTestManager(t)
+	manager.publish = mockClient.Publish
+	manager.retryDelay = time.Millisecond
+
+	// Every attempt for the first two entries fails
+	sendErr := errors.New("broker unavailable")
+	for i := 0; i < 2*manager.maxRetries; i++ {
+		mockClient.publishErrors = append(mockClient.publishErrors, sendErr)
+	}
+
+	manager.LogSuccess("device1", map[string]interface{}{"temp": 1})
+	manager.LogSuccess("device1", map[string]interface{}{"temp": 2})
+	manager.flush()
+
+	stats := manager.Stats()
+	if stats.Failures != 2 || stats.ConsecutiveFailures != 2 {
+		t.Fatalf("stats after failures = %+v, want 2 failures and 2 consecutive", stats)
+	}
+
+	// A successful send resets the consecutive count but keeps the total
+	manager.LogSuccess("device1", map[string]interface{}{"temp": 3})
+	manager.flush()
+
+	stats = manager.Stats()
+	if stats.Failures != 2 || stats.ConsecutiveFailures != 0 {
+		t.Errorf("stats after success = %+v, want 2 failures and 0 consecutive", stats)
+	}
+	if got := len(mockClient.GetPublishedMessages()); got != 1 {
+		t.Errorf("expected 1 published message, got %d", got)
+	}
+}
+
+func TestMaxQueueSizeDropsOldest(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSize     int
+		entries     int
+		wantQueued  []int
+		wantDropped uint64
+	}{
+		{"under cap", 5, 3, []int{0, 1, 2}, 0},
+		{"at cap", 3, 3, []int{0, 1, 2}, 0},
+		{"over cap", 3, 7, []int{4, 5, 6}, 4},
+		{"wraps around", 4, 23, []int{19, 20, 21, 22}, 19},
+		{"unbounded", 0, 7, []int{0, 1, 2, 3, 4, 5, 6}, 0},
+		{"negative unbounded", -1, 40, func() []int {
+			seqs := make([]int, 40)
+			for i := range seqs {
+				seqs[i] = i
+			}
+			return seqs
+		}(), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, _ := createTestManager(t)
+			manager.batchSize = 100
+			manager.SetMaxQueueSize(tt.maxSize)
+
+			for i := 0; i < tt.entries; i++ {
+				manager.LogSuccess("device1", map[string]interface{}{"seq": i})
+			}
+
+			entries := manager.Peek()
+			if len(entries) != len(tt.wantQueued) {
+				t.Fatalf("expected %d queued entries, got %d", len(tt.wantQueued), len(entries))
+			}
+			for i, entry := range entries {
+				if entry.Data["seq"] != tt.wantQueued[i] {
+					t.Errorf("entry %d seq = %v, want %d", i, entry.Data["seq"], tt.wantQueued[i])
+				}
+			}
+			if got := manager.Stats().Dropped; got != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", got, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestSignificantFigures(t *testing.T) {
+	tests := []struct {
+		name    string
+		sigFigs int
+		value   interface{}
+		want    interface{}
+	}{
+		{"rounds float64", 4, 25.500000001, 25.5},
+		{"rounds to fewer figures", 3, 1234.5678, 1230.0},
+		{"rounds float32", 3, float32(0.123456), 0.123},
+		{"disabled keeps value", 0, 25.500000001, 25.500000001},
+		{"non-float untouched", 2, uint16(1234), uint16(1234)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, _ := createTestManager(t)
+			manager.SetSignificantFigures(tt.sigFigs)
+
+			data := map[string]interface{}{"temp": tt.value}
+			manager.LogSuccess("device1", data)
+
+			entries := manager.Peek()
+			if len(entries) != 1 {
+				t.Fatalf("expected 1 entry, got %d", len(entries))
+			}
+			if got := entries[0].Data["temp"]; got != tt.want {
+				t.Errorf("expected %v (%T), got %v (%T)", tt.want, tt.want, got, got)
+			}
+			if data["temp"] != tt.value {
+				t.Errorf("caller data was modified: %v", data["temp"])
+			}
+		})
+	}
+}
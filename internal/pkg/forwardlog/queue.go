@@ -0,0 +1,61 @@
+package forwardlog
+
+// entryQueue 是等待发送条目的环形队列，按入队顺序保存
+// 有上限时写满后覆盖最旧的条目，入队和丢弃都是 O(1)；不限制时按需倍增容量
+type entryQueue struct {
+	buf  []*LogEntry
+	head int // 最旧条目在 buf 中的下标
+	n    int
+}
+
+// minQueueCapacity 是队列首次分配的容量
+const minQueueCapacity = 16
+
+func (q *entryQueue) len() int {
+	return q.n
+}
+
+// at 返回第 i 个条目，0 为最旧的条目
+func (q *entryQueue) at(i int) *LogEntry {
+	return q.buf[(q.head+i)%len(q.buf)]
+}
+
+// push 追加条目；limit > 0 时最多保留 limit 个条目，返回被丢弃的最旧条目数
+func (q *entryQueue) push(entry *LogEntry, limit int) int {
+	dropped := 0
+	for limit > 0 && q.n >= limit {
+		q.buf[q.head] = nil
+		q.head = (q.head + 1) % len(q.buf)
+		q.n--
+		dropped++
+	}
+	if q.n == len(q.buf) {
+		q.grow(limit)
+	}
+	q.buf[(q.head+q.n)%len(q.buf)] = entry
+	q.n++
+	return dropped
+}
+
+// grow 按入队顺序把条目复制到更大的缓冲区，有上限时容量不超过 limit
+func (q *entryQueue) grow(limit int) {
+	size := max(2*len(q.buf), minQueueCapacity)
+	if limit > 0 {
+		size = max(min(size, limit), q.n+1)
+	}
+	buf := make([]*LogEntry, size)
+	for i := 0; i < q.n; i++ {
+		buf[i] = q.at(i)
+	}
+	q.buf, q.head = buf, 0
+}
+
+// drain 按入队顺序取出所有条目并清空队列，释放缓冲区
+func (q *entryQueue) drain() []*LogEntry {
+	entries := make([]*LogEntry, q.n)
+	for i := range entries {
+		entries[i] = q.at(i)
+	}
+	*q = entryQueue{}
+	return entries
+}
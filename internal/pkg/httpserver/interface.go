@@ -0,0 +1,15 @@
+package httpserver
+
+import "net/http"
+
+// HTTPServerInterface defines the HTTP server operations
+type HTTPServerInterface interface {
+	// Start starts the HTTP server
+	Start() error
+
+	// Stop stops the HTTP server
+	Stop() error
+
+	// Handler returns the HTTP handler serving all endpoints
+	Handler() http.Handler
+}
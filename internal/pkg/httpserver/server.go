@@ -0,0 +1,647 @@
+package httpserver
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"app-modbus-go/internal/pkg/forwardlog"
+	"app-modbus-go/internal/pkg/logger"
+	"app-modbus-go/internal/pkg/mappingmanager"
+	"app-modbus-go/internal/pkg/modbusserver"
+	"app-modbus-go/internal/pkg/mqtt"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// rawConverter 用于计算寄存器原始值，原始值与字节/字顺序无关
+var rawConverter = modbusserver.NewConverter(modbusserver.BigEndian)
+
+// ReadResponse 是 /read 接口的响应体
+type ReadResponse struct {
+	Device     string      `json:"device"`
+	Resource   string      `json:"resource"`
+	Address    uint16      `json:"address"`              // 对象类型表内的地址
+	ObjectType string      `json:"objectType,omitempty"` // 配置了基地址偏移时资源所在的对象类型表
+	Value      interface{} `json:"value"`
+	ValueType  string      `json:"valueType"`
+	Scale      float64     `json:"scale"`
+	Offset     float64     `json:"offset"`
+	Unit       string      `json:"unit,omitempty"`  // 工程单位
+	Timestamp  string      `json:"timestamp"`       // 缓存时间，按配置的TimeFormat格式化
+	Age        string      `json:"age"`             // 缓存值距今的时长，例如 "1.5s"
+	AgeMs      int64       `json:"ageMs"`           // 缓存值距今的毫秒数
+	Stale      bool        `json:"stale,omitempty"` // 已过期但仍在宽限期内
+
+	// raw=true 时返回：寄存器原始值及缩放后的工程值，用于核对缩放配置
+	Raw    interface{} `json:"raw,omitempty"`
+	Scaled interface{} `json:"scaled,omitempty"`
+}
+
+// HistoryResponse 是 /history 接口的响应体
+type HistoryResponse struct {
+	Device     string                        `json:"device"`
+	Resource   string                        `json:"resource"`
+	Address    uint16                        `json:"address"`              // 对象类型表内的地址
+	ObjectType string                        `json:"objectType,omitempty"` // 配置了基地址偏移时资源所在的对象类型表
+	Entries    []mappingmanager.HistoryEntry `json:"entries"`              // 旧到新，未启用历史时为空
+}
+
+// MappingIssuesResponse 是 /mapping-issues 接口的响应体
+type MappingIssuesResponse struct {
+	Count  int                           `json:"count"`
+	Issues []mappingmanager.MappingIssue `json:"issues"` // 按地址排序
+}
+
+// BitsResponse 是 /bits 接口的响应体
+type BitsResponse struct {
+	Table    string   `json:"table"` // coils 或 discreteInputs
+	Start    uint16   `json:"start"`
+	Quantity uint16   `json:"quantity"`
+	Values   []bool   `json:"values"`
+	Cached   []bool   `json:"cached"`  // 每个位是否有缓存数据支撑
+	Missing  []uint16 `json:"missing"` // 无缓存数据（按默认false返回）的地址
+}
+
+// MappingReloadResponse 是 POST /mappings 接口的响应体
+type MappingReloadResponse struct {
+	Devices   int `json:"devices"`   // 设备数
+	Resources int `json:"resources"` // 提交的资源数
+	Mapped    int `json:"mapped"`    // 通过校验并已映射的资源数
+}
+
+// maxMappingBodySize 映射文件请求体的最大字节数
+const maxMappingBodySize = 4 << 20
+
+// CacheImportResponse 是 POST /cache/import 接口的响应体
+type CacheImportResponse struct {
+	Imported int `json:"imported"` // 写入缓存的条目数，未重置TTL时已过期的条目不计入
+}
+
+// maxCacheImportBodySize 缓存导入请求体的最大字节数
+const maxCacheImportBodySize = 16 << 20
+
+// 健康状态取值
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+)
+
+// HealthStatus 是 /health 接口的响应体
+type HealthStatus struct {
+	Status     string                       `json:"status"` // ok 或 degraded
+	ForwardLog *ForwardLogHealth            `json:"forwardLog,omitempty"`
+	Heartbeat  *HeartbeatHealth             `json:"heartbeat,omitempty"`
+	Mappings   *mappingmanager.MappingStats `json:"mappings,omitempty"` // 最近一次映射更新的结果，跳过的资源不影响健康状态
+	Cache      *CacheHealth                 `json:"cache,omitempty"`    // 配置了 EmptyCacheWindow 时返回
+}
+
+// CacheHealth 报告缓存是否有数据
+type CacheHealth struct {
+	Entries  int  `json:"entries"`  // 真实数据条目数，不含映射加载时写入的资源默认值
+	Degraded bool `json:"degraded"` // 启动窗口已过而仍未收到任何真实数据，Modbus读取只能返回零值或默认值
+}
+
+// ForwardLogHealth 报告前向日志的发送情况
+type ForwardLogHealth struct {
+	QueueDepth          int    `json:"queueDepth"`
+	SendFailures        uint64 `json:"sendFailures"`
+	ConsecutiveFailures uint64 `json:"consecutiveFailures"`
+	Dropped             uint64 `json:"dropped"`  // 队列满时丢弃的条目数
+	Degraded            bool   `json:"degraded"` // 连续失败次数达到阈值
+}
+
+// HeartbeatHealth 报告MQTT心跳的发送情况
+type HeartbeatHealth struct {
+	ConsecutiveFailures uint64 `json:"consecutiveFailures"` // 重连宽限期外连续发送失败的心跳数
+	Degraded            bool   `json:"degraded"`            // 有心跳在宽限期外发送失败，数据中心可能认为节点离线
+}
+
+// HeartbeatStats 提供心跳的发送统计
+type HeartbeatStats interface {
+	HeartbeatFailures() uint64
+}
+
+// ForwardLogStats 提供前向日志的发送统计
+type ForwardLogStats interface {
+	Stats() forwardlog.SendStats
+	QueueDepth() int
+}
+
+// BitReader 读取线圈和离散输入
+type BitReader interface {
+	ReadCoils(startAddr uint16, quantity uint16) (*modbusserver.ReadResult, error)
+	ReadDiscreteInputs(startAddr uint16, quantity uint16) (*modbusserver.ReadResult, error)
+}
+
+// ErrorResponse 是错误响应体
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server 提供服务的HTTP接口
+type Server struct {
+	config         *config.ServiceConfig
+	mappingManager mappingmanager.MappingManagerInterface
+	lc             logger.LoggingClient
+	bitReader      BitReader
+	forwardLog     ForwardLogStats
+	heartbeat      HeartbeatStats
+	startedAt      time.Time // 空缓存启动窗口的起点
+	mux            *http.ServeMux
+	server         *http.Server
+}
+
+// NewServer 创建新的HTTP服务器
+func NewServer(
+	cfg *config.ServiceConfig,
+	mappingManager mappingmanager.MappingManagerInterface,
+	lc logger.LoggingClient,
+) *Server {
+	s := &Server{
+		config:         cfg,
+		mappingManager: mappingManager,
+		lc:             lc,
+		startedAt:      time.Now(),
+		mux:            http.NewServeMux(),
+	}
+	s.registerRoutes()
+	return s
+}
+
+// registerRoutes 注册所有HTTP路由
+func (s *Server) registerRoutes() {
+	s.mux.HandleFunc("/read", s.handleRead)
+	s.mux.HandleFunc("/bits", s.handleBits)
+	s.mux.HandleFunc("/mappings", s.handleMappings)
+	s.mux.HandleFunc("/health", s.handleHealth)
+	s.mux.HandleFunc("/layout", s.handleLayout)
+	s.mux.HandleFunc("/history", s.handleHistory)
+	s.mux.HandleFunc("/mapping-issues", s.handleMappingIssues)
+	s.mux.HandleFunc("/cache/export", s.handleCacheExport)
+	s.mux.HandleFunc("/cache/import", s.handleCacheImport)
+}
+
+// SetBitReader 设置 /bits 接口使用的位读取器
+func (s *Server) SetBitReader(reader BitReader) {
+	s.bitReader = reader
+}
+
+// SetForwardLogStats 设置 /health 接口使用的前向日志统计来源
+func (s *Server) SetForwardLogStats(stats ForwardLogStats) {
+	s.forwardLog = stats
+}
+
+// SetHeartbeatStats 设置 /health 接口使用的心跳统计来源
+func (s *Server) SetHeartbeatStats(stats HeartbeatStats) {
+	s.heartbeat = stats
+}
+
+// Handler 返回HTTP处理器
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start 启动HTTP服务器
+func (s *Server) Start() error {
+	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start HTTP listener: %w", err)
+	}
+
+	s.server = &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.lc.Error(fmt.Sprintf("HTTP server error: %s", err.Error()))
+		}
+	}()
+
+	s.lc.Info(fmt.Sprintf("HTTP server started on %s", addr))
+	return nil
+}
+
+// Stop 停止HTTP服务器
+func (s *Server) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to stop HTTP server: %w", err)
+	}
+
+	s.lc.Info("HTTP server stopped")
+	return nil
+}
+
+// handleRead 处理 GET /read?device=X&resource=Y[&raw=true]
+func (s *Server) handleRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	device := r.URL.Query().Get("device")
+	resource := r.URL.Query().Get("resource")
+	if device == "" || resource == "" {
+		s.writeError(w, http.StatusBadRequest, "device and resource are required")
+		return
+	}
+
+	addr, ok := s.mappingManager.GetAddressByResource(device, resource)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("unknown resource %s/%s", device, resource))
+		return
+	}
+
+	value, ok := s.mappingManager.GetCachedValueTyped(addr)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("no cached value for %s/%s", device, resource))
+		return
+	}
+
+	precision := mappingmanager.ResolvePrecision(value.Precision, s.config.FloatPrecision)
+	age := value.Age()
+	resp := &ReadResponse{
+		Device:     device,
+		Resource:   resource,
+		Address:    addr.Addr(),
+		ObjectType: addr.ObjectType(),
+		Value:      mappingmanager.RoundValue(value.Value, precision),
+		ValueType:  value.ValueType,
+		Scale:      value.Scale,
+		Offset:     value.Offset,
+		Unit:       value.Unit,
+		Timestamp:  value.Timestamp.Format(s.config.GetTimeFormat()),
+		Age:        age.String(),
+		AgeMs:      age.Milliseconds(),
+		Stale:      value.Stale,
+	}
+	if r.URL.Query().Get("raw") == "true" {
+		if err := s.fillRawValue(resp, addr, precision); err != nil {
+			s.writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// fillRawValue 通过转换器计算缓存值对应的寄存器原始值，并填入缩放后的工程值
+func (s *Server) fillRawValue(resp *ReadResponse, addr config.AddressKey, precision int) error {
+	data, ok := s.mappingManager.GetCachedValue(addr)
+	if !ok {
+		return fmt.Errorf("no cached value at address %v", addr)
+	}
+	encoding, err := modbusserver.ParseSignedEncoding(data.SignedEncoding)
+	if err != nil {
+		return err
+	}
+	raw, err := rawConverter.RawValue(data.Value, data.ValueType, data.Scale, data.Offset, encoding)
+	if err != nil {
+		return fmt.Errorf("convert %s/%s to registers: %w", resp.Device, resp.Resource, err)
+	}
+	resp.Raw = raw
+	resp.Scaled = mappingmanager.RoundValue(data.Value, precision)
+	return nil
+}
+
+// handleBits 处理 GET /bits?start=N&quantity=M[&table=coils|discreteInputs]
+// 返回位值及每个位的缓存质量，用于区分真实的false和缺失数据
+func (s *Server) handleBits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.bitReader == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "bit reader not configured")
+		return
+	}
+
+	start, err := strconv.ParseUint(r.URL.Query().Get("start"), 10, 16)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "start must be an address between 0 and 65535")
+		return
+	}
+	quantity, err := strconv.ParseUint(r.URL.Query().Get("quantity"), 10, 16)
+	if err != nil || quantity < 1 || quantity > 2000 {
+		s.writeError(w, http.StatusBadRequest, "quantity must be between 1 and 2000")
+		return
+	}
+
+	table := r.URL.Query().Get("table")
+	var result *modbusserver.ReadResult
+	switch table {
+	case "", "coils":
+		table = "coils"
+		result, err = s.bitReader.ReadCoils(uint16(start), uint16(quantity))
+	case "discreteInputs":
+		result, err = s.bitReader.ReadDiscreteInputs(uint16(start), uint16(quantity))
+	default:
+		s.writeError(w, http.StatusBadRequest, "table must be coils or discreteInputs")
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := &BitsResponse{
+		Table:    table,
+		Start:    uint16(start),
+		Quantity: uint16(quantity),
+		Values:   make([]bool, quantity),
+		Cached:   result.Quality,
+		Missing:  []uint16{},
+	}
+	for i := uint16(0); i < uint16(quantity); i++ {
+		resp.Values[i] = result.Data[1+i/8]&(1<<(i%8)) != 0
+		if !result.Quality[i] {
+			resp.Missing = append(resp.Missing, uint16(start)+i)
+		}
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleHealth 处理 GET /health
+// 前向日志连续发送失败达到阈值、心跳在重连宽限期外发送失败，或启动窗口过后缓存仍为空时报告 degraded
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	status := &HealthStatus{Status: HealthOK}
+	if s.forwardLog != nil {
+		threshold := s.config.ForwardLogFailureThreshold
+		if threshold <= 0 {
+			threshold = config.DefaultForwardLogFailureThreshold
+		}
+		stats := s.forwardLog.Stats()
+		status.ForwardLog = &ForwardLogHealth{
+			QueueDepth:          s.forwardLog.QueueDepth(),
+			SendFailures:        stats.Failures,
+			ConsecutiveFailures: stats.ConsecutiveFailures,
+			Dropped:             stats.Dropped,
+			Degraded:            stats.ConsecutiveFailures >= uint64(threshold),
+		}
+		if status.ForwardLog.Degraded {
+			status.Status = HealthDegraded
+		}
+	}
+	if s.heartbeat != nil {
+		failures := s.heartbeat.HeartbeatFailures()
+		status.Heartbeat = &HeartbeatHealth{ConsecutiveFailures: failures, Degraded: failures > 0}
+		if status.Heartbeat.Degraded {
+			status.Status = HealthDegraded
+		}
+	}
+	mappingStats := s.mappingManager.Stats()
+	status.Mappings = &mappingStats
+	if window := s.config.GetEmptyCacheWindow(); window > 0 {
+		entries := 0
+		for _, data := range s.mappingManager.GetAllCachedValues() {
+			if !data.Default {
+				entries++
+			}
+		}
+		status.Cache = &CacheHealth{
+			Entries:  entries,
+			Degraded: entries == 0 && time.Since(s.startedAt) >= window,
+		}
+		if status.Cache.Degraded {
+			status.Status = HealthDegraded
+		}
+	}
+	s.writeJSON(w, http.StatusOK, status)
+}
+
+// handleHistory 处理 GET /history?device=X&resource=Y[&n=N]，返回资源最近的N条历史值（默认全部）
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	device := r.URL.Query().Get("device")
+	resource := r.URL.Query().Get("resource")
+	if device == "" || resource == "" {
+		s.writeError(w, http.StatusBadRequest, "device and resource are required")
+		return
+	}
+	n := 0
+	if raw := r.URL.Query().Get("n"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			s.writeError(w, http.StatusBadRequest, "n must be a positive integer")
+			return
+		}
+		n = parsed
+	}
+
+	addr, ok := s.mappingManager.GetAddressByResource(device, resource)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("unknown resource %s/%s", device, resource))
+		return
+	}
+
+	entries := s.mappingManager.GetHistory(addr, n)
+	if entries == nil {
+		entries = []mappingmanager.HistoryEntry{}
+	}
+	s.writeJSON(w, http.StatusOK, &HistoryResponse{
+		Device:     device,
+		Resource:   resource,
+		Address:    addr.Addr(),
+		ObjectType: addr.ObjectType(),
+		Entries:    entries,
+	})
+}
+
+// handleMappingIssues 处理 GET /mapping-issues，返回最近一次映射更新检测到的问题（重复、重叠、名称/类型不一致等）
+func (s *Server) handleMappingIssues(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	issues := s.mappingManager.MappingIssues()
+	s.writeJSON(w, http.StatusOK, &MappingIssuesResponse{Count: len(issues), Issues: issues})
+}
+
+// handleLayout 处理 GET /layout[?format=json|csv]，导出当前寄存器地址表
+func (s *Server) handleLayout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	layout := s.mappingManager.ExportLayout()
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		s.writeJSON(w, http.StatusOK, layout)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="layout.csv"`)
+		w.WriteHeader(http.StatusOK)
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"address", "registerCount", "device", "resource", "valueType", "scale", "offset", "readWrite"})
+		for _, e := range layout {
+			_ = cw.Write([]string{
+				strconv.Itoa(int(e.Address)),
+				strconv.Itoa(e.RegisterCount),
+				e.Device,
+				e.Resource,
+				e.ValueType,
+				strconv.FormatFloat(e.Scale, 'f', -1, 64),
+				strconv.FormatFloat(e.Offset, 'f', -1, 64),
+				e.ReadWrite,
+			})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			s.lc.Error(fmt.Sprintf("Failed to write layout CSV: %s", err.Error()))
+		}
+	default:
+		s.writeError(w, http.StatusBadRequest, "format must be json or csv")
+	}
+}
+
+// handleMappings 处理 POST /mappings，请求体为映射JSON数组（与数据中心 result 字段格式相同）
+// 仅在配置 AllowMappingReload 时可用，用于数据中心不可达时推送已知可用的映射
+func (s *Server) handleMappings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.config.AllowMappingReload {
+		s.writeError(w, http.StatusForbidden, "mapping reload is disabled")
+		return
+	}
+
+	var mappings []*mqtt.DeviceMapping
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMappingBodySize)).Decode(&mappings); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid mapping JSON: %s", err.Error()))
+		return
+	}
+	if err := validateMappings(mappings); err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.mappingManager.UpdateMappings(mappings); err != nil {
+		s.writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	resp := &MappingReloadResponse{Devices: len(mappings)}
+	for _, dm := range mappings {
+		for _, rm := range dm.Resources {
+			resp.Resources++
+			if rm != nil && rm.NorthResource != nil {
+				if _, ok := s.mappingManager.GetAddressByResource(dm.NorthDeviceName, rm.NorthResource.Name); ok {
+					resp.Mapped++
+				}
+			}
+		}
+	}
+	s.lc.Info(fmt.Sprintf("Mappings reloaded via HTTP: %d devices, %d/%d resources mapped",
+		resp.Devices, resp.Mapped, resp.Resources))
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleCacheExport 以快照文件格式返回未过期的缓存数据，用于迁移和调试
+func (s *Server) handleCacheExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	payload, count, err := s.mappingManager.ExportCache()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.lc.Info(fmt.Sprintf("Exported %d cache entries via HTTP", count))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(payload); err != nil {
+		s.lc.Error(fmt.Sprintf("Failed to write HTTP response: %s", err.Error()))
+	}
+}
+
+// handleCacheImport 从 /cache/export 导出的数据恢复缓存，resetTTL=true 时TTL从导入时刻重新计算
+func (s *Server) handleCacheImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.config.AllowCacheImport {
+		s.writeError(w, http.StatusForbidden, "cache import is disabled")
+		return
+	}
+
+	resetTTL := false
+	if raw := r.URL.Query().Get("resetTTL"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "resetTTL must be true or false")
+			return
+		}
+		resetTTL = v
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCacheImportBodySize))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to read request body: %s", err.Error()))
+		return
+	}
+	imported, err := s.mappingManager.ImportCache(payload, resetTTL)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, &CacheImportResponse{Imported: imported})
+}
+
+// validateMappings 检查映射文件的基本结构，资源级校验由 UpdateMappings 完成
+func validateMappings(mappings []*mqtt.DeviceMapping) error {
+	if len(mappings) == 0 {
+		return fmt.Errorf("mapping list is empty")
+	}
+	seen := make(map[string]bool, len(mappings))
+	for i, dm := range mappings {
+		if dm == nil || dm.NorthDeviceName == "" {
+			return fmt.Errorf("mapping %d: northDeviceName is required", i)
+		}
+		if seen[dm.NorthDeviceName] {
+			return fmt.Errorf("mapping %d: duplicate device %s", i, dm.NorthDeviceName)
+		}
+		seen[dm.NorthDeviceName] = true
+	}
+	return nil
+}
+
+// writeJSON 写入JSON响应
+func (s *Server) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.lc.Error(fmt.Sprintf("Failed to write HTTP response: %s", err.Error()))
+	}
+}
+
+// writeError 写入JSON错误响应
+func (s *Server) writeError(w http.ResponseWriter, status int, msg string) {
+	s.writeJSON(w, status, &ErrorResponse{Error: msg})
+}
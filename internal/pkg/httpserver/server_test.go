@@ -0,0 +1,645 @@
+package httpserver
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"app-modbus-go/internal/pkg/forwardlog"
+	"app-modbus-go/internal/pkg/logger"
+	"app-modbus-go/internal/pkg/mappingmanager"
+	"app-modbus-go/internal/pkg/modbusserver"
+	"app-modbus-go/internal/pkg/mqtt"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestServer(t *testing.T) (*Server, *mappingmanager.MappingManager) {
+	lc := logger.NewClient("ERROR")
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, lc)
+	cacheConfig := &config.CacheConfig{
+		DefaultTTL:      "30s",
+		CleanupInterval: "5m",
+	}
+	mm := mappingmanager.NewMappingManager(mqttClient, lc, cacheConfig)
+
+	nr := &mqtt.NorthResource{
+		Name:      "temperature",
+		ValueType: "int16",
+		Scale:     0.1,
+		Unit:      "°C",
+	}
+	nr.OtherParameters.Modbus.Address = 100
+
+	err := mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{
+					NorthResource: nr,
+					SouthResource: &mqtt.SouthResource{Name: "temperature"},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	return NewServer(&config.ServiceConfig{Host: "localhost", Port: 0}, mm, lc), mm
+}
+
+// TestHandleRead_Found tests reading a known resource with a cached value
+func TestHandleRead_Found(t *testing.T) {
+	s, mm := createTestServer(t)
+	assert.NoError(t, mm.UpdateCache("device1", map[string]interface{}{"temperature": 25.0}))
+
+	req := httptest.NewRequest(http.MethodGet, "/read?device=device1&resource=temperature", nil)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var resp ReadResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "device1", resp.Device)
+	assert.Equal(t, "temperature", resp.Resource)
+	assert.Equal(t, uint16(100), resp.Address)
+	assert.Equal(t, float64(25), resp.Value)
+	assert.Equal(t, "int16", resp.ValueType)
+	assert.Equal(t, 0.1, resp.Scale)
+	assert.Equal(t, "°C", resp.Unit)
+	assert.GreaterOrEqual(t, resp.AgeMs, int64(0))
+}
+
+// TestHandleRead_Timestamp tests that the cached timestamp is formatted per config and the age is reported
+func TestHandleRead_Timestamp(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeFormat string
+		layout     string
+	}{
+		{name: "default", timeFormat: "", layout: time.RFC3339},
+		{name: "named", timeFormat: "RFC3339Nano", layout: time.RFC3339Nano},
+		{name: "custom layout", timeFormat: "2006-01-02 15:04:05", layout: "2006-01-02 15:04:05"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mm := createTestServer(t)
+			s.config.TimeFormat = tt.timeFormat
+			before := time.Now().Truncate(time.Second)
+			assert.NoError(t, mm.UpdateCache("device1", map[string]interface{}{"temperature": 25.0}))
+			time.Sleep(5 * time.Millisecond)
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/read?device=device1&resource=temperature", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var resp ReadResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			ts, err := time.ParseInLocation(tt.layout, resp.Timestamp, time.Local)
+			assert.NoError(t, err)
+			assert.False(t, ts.Before(before), "timestamp %s before cache update", resp.Timestamp)
+
+			age, err := time.ParseDuration(resp.Age)
+			assert.NoError(t, err)
+			assert.Greater(t, age, time.Duration(0))
+		})
+	}
+}
+
+// TestHandleRead_UnknownResource tests reading an unmapped resource
+func TestHandleRead_UnknownResource(t *testing.T) {
+	s, _ := createTestServer(t)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"unknown resource", "device=device1&resource=humidity"},
+		{"unknown device", "device=device9&resource=temperature"},
+		{"no cached value", "device=device1&resource=temperature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/read?"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+			var resp ErrorResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.NotEmpty(t, resp.Error)
+		})
+	}
+}
+
+// TestHandleRead_BadRequest tests missing query parameters and wrong methods
+func TestHandleRead_BadRequest(t *testing.T) {
+	s, _ := createTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/read?device=device1", nil)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/read?device=device1&resource=temperature", nil)
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+// TestHandleBits_Quality tests the quality report for a mix of cached and uncached coils
+func TestHandleBits_Quality(t *testing.T) {
+	s, mm := createTestServer(t)
+
+	pump := &mqtt.NorthResource{Name: "pumpOn", ValueType: "bool"}
+	pump.OtherParameters.Modbus.Address = 10
+	valve := &mqtt.NorthResource{Name: "valveOpen", ValueType: "bool"}
+	valve.OtherParameters.Modbus.Address = 12
+	assert.NoError(t, mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "station1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: pump, SouthResource: &mqtt.SouthResource{Name: "pumpOn"}},
+				{NorthResource: valve, SouthResource: &mqtt.SouthResource{Name: "valveOpen"}},
+			},
+		},
+	}))
+	assert.NoError(t, mm.UpdateCache("station1", map[string]interface{}{"pumpOn": true, "valveOpen": false}))
+
+	// Without a reader the endpoint is unavailable
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/bits?start=10&quantity=4", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	s.SetBitReader(modbusserver.NewRegisterReader(mm, modbusserver.NewConverter(modbusserver.BigEndian), logger.NewClient("ERROR")))
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/bits?start=10&quantity=4", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp BitsResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "coils", resp.Table)
+	assert.Equal(t, []bool{true, false, false, false}, resp.Values)
+	assert.Equal(t, []bool{true, false, true, false}, resp.Cached)
+	assert.Equal(t, []uint16{11, 13}, resp.Missing)
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/bits?start=10&quantity=0", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// TestHandleMappings tests reloading mappings from a posted mapping file
+func TestHandleMappings(t *testing.T) {
+	s, mm := createTestServer(t)
+
+	// Disabled unless AllowMappingReload is set
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mappings", strings.NewReader("[]")))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	s.config.AllowMappingReload = true
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name: "valid mapping",
+			body: `[{"northDeviceName":"device2","resources":[
+				{"northResource":{"name":"pressure","valueType":"int16","otherParameters":{"modbus":{"address":200}}},
+				 "southResource":{"name":"pressure","valueType":"int16"}},
+				{"northResource":{"name":"broken","valueType":"int16"}}]}]`,
+			wantStatus: http.StatusOK,
+		},
+		{name: "malformed JSON", body: `[{"northDeviceName":`, wantStatus: http.StatusBadRequest},
+		{name: "empty list", body: `[]`, wantStatus: http.StatusBadRequest},
+		{name: "missing device name", body: `[{"resources":[]}]`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mappings", strings.NewReader(tt.body)))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusOK {
+				var resp MappingReloadResponse
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, MappingReloadResponse{Devices: 1, Resources: 2, Mapped: 1}, resp)
+			}
+		})
+	}
+
+	// The valid mapping replaced the previous one; invalid posts left it in place
+	addr, ok := mm.GetAddressByResource("device2", "pressure")
+	assert.True(t, ok)
+	assert.Equal(t, config.AddressKey(200), addr)
+	_, ok = mm.GetAddressByResource("device1", "temperature")
+	assert.False(t, ok)
+}
+
+// TestHandleRead_Precision tests that float values are rounded to the configured decimals
+func TestHandleRead_Precision(t *testing.T) {
+	s, mm := createTestServer(t)
+	one := 1
+	s.config.FloatPrecision = &one
+
+	nr := &mqtt.NorthResource{Name: "flow", ValueType: "float64"}
+	nr.OtherParameters.Modbus.Address = 300
+	assert.NoError(t, mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "meter1",
+			Resources:       []*mqtt.ResourceMapping{{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "flow"}}},
+		},
+	}))
+	assert.NoError(t, mm.UpdateCache("meter1", map[string]interface{}{"flow": 12.3456}))
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/read?device=meter1&resource=flow", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp ReadResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 12.3, resp.Value)
+}
+
+// TestHandleRead_Raw tests that raw=true returns the raw register value alongside the scaled value
+func TestHandleRead_Raw(t *testing.T) {
+	s, mm := createTestServer(t)
+	two := 2
+	nr := &mqtt.NorthResource{Name: "pressure", ValueType: "uint16", Scale: 0.01, Precision: &two}
+	nr.OtherParameters.Modbus.Address = 400
+	assert.NoError(t, mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "meter1",
+			Resources:       []*mqtt.ResourceMapping{{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "pressure"}}},
+		},
+	}))
+	assert.NoError(t, mm.UpdateCache("meter1", map[string]interface{}{"pressure": 12.34}))
+
+	tests := []struct {
+		name       string
+		query      string
+		wantRaw    interface{}
+		wantScaled interface{}
+	}{
+		{name: "without raw", query: "", wantRaw: nil, wantScaled: nil},
+		{name: "with raw", query: "&raw=true", wantRaw: float64(1234), wantScaled: 12.34},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/read?device=meter1&resource=pressure"+tt.query, nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var resp ReadResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantRaw, resp.Raw)
+			assert.Equal(t, tt.wantScaled, resp.Scaled)
+		})
+	}
+}
+
+// TestHandleHistory tests retrieving recent values of a resource in order
+func TestHandleHistory(t *testing.T) {
+	lc := logger.NewClient("ERROR")
+	mm := mappingmanager.NewMappingManager(mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, lc), lc, &config.CacheConfig{
+		DefaultTTL:  "30s",
+		HistorySize: 5,
+	})
+	nr := &mqtt.NorthResource{Name: "temperature", ValueType: "float32"}
+	nr.OtherParameters.Modbus.Address = 100
+	assert.NoError(t, mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources:       []*mqtt.ResourceMapping{{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature"}}},
+		},
+	}))
+	for _, v := range []float64{20.5, 21.0, 21.5} {
+		assert.NoError(t, mm.UpdateCache("device1", map[string]interface{}{"temperature": v}))
+	}
+	s := NewServer(&config.ServiceConfig{Host: "localhost", Port: 0}, mm, lc)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantValues []interface{}
+	}{
+		{name: "all", query: "device=device1&resource=temperature", wantStatus: http.StatusOK, wantValues: []interface{}{20.5, 21.0, 21.5}},
+		{name: "last two", query: "device=device1&resource=temperature&n=2", wantStatus: http.StatusOK, wantValues: []interface{}{21.0, 21.5}},
+		{name: "invalid n", query: "device=device1&resource=temperature&n=0", wantStatus: http.StatusBadRequest},
+		{name: "unknown resource", query: "device=device1&resource=pressure", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history?"+tt.query, nil))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp HistoryResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, uint16(100), resp.Address)
+			values := make([]interface{}, len(resp.Entries))
+			for i, e := range resp.Entries {
+				values[i] = e.Value
+			}
+			assert.Equal(t, tt.wantValues, values)
+		})
+	}
+}
+
+// stubForwardLogStats reports fixed forward-log statistics
+type stubForwardLogStats struct {
+	stats forwardlog.SendStats
+}
+
+func (s *stubForwardLogStats) Stats() forwardlog.SendStats { return s.stats }
+func (s *stubForwardLogStats) QueueDepth() int             { return 5 }
+
+// TestHandleHealth tests that persistent forward-log failures degrade health
+func TestHandleHealth(t *testing.T) {
+	s, _ := createTestServer(t)
+	s.config.ForwardLogFailureThreshold = 3
+
+	tests := []struct {
+		name       string
+		stats      *stubForwardLogStats
+		wantStatus string
+	}{
+		{"no forward log", nil, HealthOK},
+		{"intermittent failures", &stubForwardLogStats{forwardlog.SendStats{Failures: 7, ConsecutiveFailures: 2}}, HealthOK},
+		{"persistent failures", &stubForwardLogStats{forwardlog.SendStats{Failures: 9, ConsecutiveFailures: 3}}, HealthDegraded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.forwardLog = nil
+			if tt.stats != nil {
+				s.SetForwardLogStats(tt.stats)
+			}
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var resp HealthStatus
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantStatus, resp.Status)
+			assert.NotNil(t, resp.Mappings)
+			assert.Equal(t, 1, resp.Mappings.Mapped)
+			if tt.stats == nil {
+				assert.Nil(t, resp.ForwardLog)
+				return
+			}
+			assert.Equal(t, tt.stats.stats.Failures, resp.ForwardLog.SendFailures)
+			assert.Equal(t, tt.stats.stats.ConsecutiveFailures, resp.ForwardLog.ConsecutiveFailures)
+			assert.Equal(t, 5, resp.ForwardLog.QueueDepth)
+		})
+	}
+}
+
+// stubHeartbeatStats reports a fixed heartbeat failure count
+type stubHeartbeatStats uint64
+
+func (s stubHeartbeatStats) HeartbeatFailures() uint64 { return uint64(s) }
+
+// TestHandleHealthHeartbeat tests that heartbeats failing outside the reconnect grace degrade health
+func TestHandleHealthHeartbeat(t *testing.T) {
+	s, _ := createTestServer(t)
+
+	tests := []struct {
+		name       string
+		failures   uint64
+		wantStatus string
+	}{
+		{"heartbeats sent", 0, HealthOK},
+		{"heartbeat failing", 2, HealthDegraded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.SetHeartbeatStats(stubHeartbeatStats(tt.failures))
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var resp HealthStatus
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantStatus, resp.Status)
+			if assert.NotNil(t, resp.Heartbeat) {
+				assert.Equal(t, tt.failures, resp.Heartbeat.ConsecutiveFailures)
+				assert.Equal(t, tt.failures > 0, resp.Heartbeat.Degraded)
+			}
+		})
+	}
+}
+
+// TestHandleHealthEmptyCache tests that health degrades when no data arrives within the startup window
+func TestHandleHealthEmptyCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		window       string
+		elapsed      time.Duration
+		data         bool
+		defaults     bool // a resource default value is cached
+		wantStatus   string
+		wantCache    bool
+		wantDegraded bool
+	}{
+		{name: "check disabled", window: "", elapsed: time.Hour, wantStatus: HealthOK},
+		{name: "within window", window: "1m", elapsed: 10 * time.Second, wantStatus: HealthOK, wantCache: true},
+		{name: "no data past window", window: "1m", elapsed: 2 * time.Minute, wantStatus: HealthDegraded, wantCache: true, wantDegraded: true},
+		{name: "data past window", window: "1m", elapsed: 2 * time.Minute, data: true, wantStatus: HealthOK, wantCache: true},
+		{name: "only defaults past window", window: "1m", elapsed: 2 * time.Minute, defaults: true, wantStatus: HealthDegraded, wantCache: true, wantDegraded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mm := createTestServer(t)
+			s.config.EmptyCacheWindow = tt.window
+			s.startedAt = time.Now().Add(-tt.elapsed)
+			if tt.defaults {
+				nr := &mqtt.NorthResource{Name: "setpoint", ValueType: "int16"}
+				nr.OtherParameters.Modbus.Address = 101
+				nr.OtherParameters.Modbus.DefaultValue = 20
+				assert.NoError(t, mm.UpdateMappings([]*mqtt.DeviceMapping{{
+					NorthDeviceName: "device1",
+					Resources:       []*mqtt.ResourceMapping{{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "setpoint"}}},
+				}}))
+			}
+			if tt.data {
+				assert.NoError(t, mm.UpdateCache("device1", map[string]interface{}{"temperature": 21.5}))
+			}
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var resp HealthStatus
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantStatus, resp.Status)
+			if !tt.wantCache {
+				assert.Nil(t, resp.Cache)
+				return
+			}
+			if assert.NotNil(t, resp.Cache) {
+				assert.Equal(t, tt.wantDegraded, resp.Cache.Degraded)
+				if tt.data {
+					assert.Equal(t, 1, resp.Cache.Entries)
+				}
+			}
+		})
+	}
+}
+
+// TestHandleMappingIssues tests reporting overlapping, renamed and duplicate mappings
+func TestHandleMappingIssues(t *testing.T) {
+	s, mm := createTestServer(t)
+
+	wide := &mqtt.NorthResource{Name: "energy", ValueType: "float32"}
+	wide.OtherParameters.Modbus.Address = 200
+	next := &mqtt.NorthResource{Name: "status", ValueType: "uint16"}
+	next.OtherParameters.Modbus.Address = 201
+	dup := &mqtt.NorthResource{Name: "alarm", ValueType: "uint16"}
+	dup.OtherParameters.Modbus.Address = 201
+	assert.NoError(t, mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "meter",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: wide, SouthResource: &mqtt.SouthResource{Name: "energy", ValueType: "float32"}},
+				{NorthResource: next, SouthResource: &mqtt.SouthResource{Name: "state", ValueType: "uint16"}},
+				{NorthResource: dup, SouthResource: &mqtt.SouthResource{Name: "alarm", ValueType: "int16"}},
+			},
+		},
+	}))
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/mapping-issues", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp MappingIssuesResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 3, resp.Count)
+	got := make([]mappingmanager.MappingIssueKind, 0, len(resp.Issues))
+	for _, issue := range resp.Issues {
+		got = append(got, issue.Kind)
+		assert.Equal(t, "meter", issue.Device)
+	}
+	assert.Equal(t, []mappingmanager.MappingIssueKind{
+		mappingmanager.IssueOverlap,          // 200: float32 spans 200-201
+		mappingmanager.IssueNameMismatch,     // 201: status vs state
+		mappingmanager.IssueDuplicateAddress, // 201: alarm skipped
+	}, got)
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mapping-issues", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+// TestHandleLayout tests exporting the register layout as JSON and CSV
+func TestHandleLayout(t *testing.T) {
+	s, _ := createTestServer(t)
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/layout", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var layout []mappingmanager.RegisterLayoutEntry
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &layout))
+	assert.Equal(t, []mappingmanager.RegisterLayoutEntry{
+		{Address: 100, RegisterCount: 1, Device: "device1", Resource: "temperature", ValueType: "int16", Scale: 0.1},
+	}, layout)
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/layout?format=csv", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "address,registerCount,device,resource,valueType,scale,offset,readWrite\n"+
+		"100,1,device1,temperature,int16,0.1,0,\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/layout?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleCacheExportImport(t *testing.T) {
+	src, srcMM := createTestServer(t)
+	assert.NoError(t, srcMM.UpdateCache("device1", map[string]interface{}{"temperature": 25.5}))
+	exported, ok := srcMM.GetCachedValue(100)
+	assert.True(t, ok)
+
+	rec := httptest.NewRecorder()
+	src.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cache/export", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	payload := rec.Body.String()
+
+	dst, dstMM := createTestServer(t)
+
+	// Disabled unless AllowCacheImport is set
+	rec = httptest.NewRecorder()
+	dst.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/cache/import", strings.NewReader(payload)))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	dst.config.AllowCacheImport = true
+
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{name: "malformed JSON", target: "/cache/import", body: `{"100":`, wantStatus: http.StatusBadRequest},
+		{name: "unmapped device", target: "/cache/import", body: `{"100":{"Value":1,"NorthDevName":"ghost"}}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid resetTTL", target: "/cache/import?resetTTL=maybe", body: payload, wantStatus: http.StatusBadRequest},
+		{name: "round trip", target: "/cache/import", body: payload, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			dst.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				_, ok := dstMM.GetCachedValue(100)
+				assert.False(t, ok, "rejected import must not touch the cache")
+			}
+		})
+	}
+
+	imported, ok := dstMM.GetCachedValue(100)
+	assert.True(t, ok)
+	assert.Equal(t, 25.5, imported.Value)
+	assert.Equal(t, "temperature", imported.ResourceName)
+	assert.Equal(t, 0.1, imported.Scale)
+	assert.True(t, imported.Timestamp.Equal(exported.Timestamp), "timestamp kept without resetTTL")
+
+	// resetTTL restarts the TTL from the time of import
+	old := strings.Replace(payload, exported.Timestamp.Format(time.RFC3339Nano),
+		exported.Timestamp.Add(-time.Hour).Format(time.RFC3339Nano), 1)
+	rec = httptest.NewRecorder()
+	dst.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/cache/import", strings.NewReader(old)))
+	var resp CacheImportResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, CacheImportResponse{Imported: 0}, resp, "expired entries are skipped without resetTTL")
+
+	rec = httptest.NewRecorder()
+	dst.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/cache/import?resetTTL=true", strings.NewReader(old)))
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, CacheImportResponse{Imported: 1}, resp)
+	imported, ok = dstMM.GetCachedValue(100)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now(), imported.Timestamp, time.Second)
+}
@@ -42,20 +42,27 @@ const (
 	ErrorLog = "ERROR"
 )
 
+// defaultSourceDepth 是source字段默认保留的路径层级数
+const defaultSourceDepth = 2
+
 type edgeXLogger struct {
-	logLevel   string
-	writer     io.Writer
-	mu         sync.RWMutex // 保护 logLevel
-	fileHandle *os.File     // 文件句柄
-	filePath   string       // 日志文件路径
+	logLevel      string
+	writer        io.Writer
+	mu            sync.RWMutex // 保护 logLevel
+	fileHandle    *os.File     // 文件句柄
+	filePath      string       // 日志文件路径
+	disableCaller bool         // 是否跳过调用者查找
+	sourceDepth   int          // source字段保留的路径层级数
 }
 
 // LoggerConfig 保持日志记录器创建的配置
 type LoggerConfig struct {
-	LogLevel      string // 日志级别(TRACE, DEBUG, INFO, WARN, ERROR)
-	FilePath      string // 日志文件路径(空表示仅stdout)
-	FileMaxSizeMB int    // 轮转前的最大文件大小(MB)(0=无轮转)
-	EnableConsole bool   // 是否也输出到控制台
+	LogLevel        string // 日志级别(TRACE, DEBUG, INFO, WARN, ERROR)
+	FilePath        string // 日志文件路径(空表示仅stdout)
+	FileMaxSizeMB   int    // 轮转前的最大文件大小(MB)(0=无轮转)
+	EnableConsole   bool   // 是否也输出到控制台
+	DisableCaller   bool   // 是否禁用调用者(source)查找，高日志量时可降低开销
+	SourcePathDepth int    // source字段保留的路径层级数(0=默认2级)
 }
 
 // NewClient 创建具有默认设置的LoggingClient实例(仅stdout)
@@ -82,9 +89,16 @@ func NewClientWithConfig(config LoggerConfig) LoggingClient {
 		upper = InfoLog
 	}
 
+	sourceDepth := config.SourcePathDepth
+	if sourceDepth <= 0 {
+		sourceDepth = defaultSourceDepth
+	}
+
 	logger := &edgeXLogger{
-		logLevel: upper,
-		filePath: config.FilePath,
+		logLevel:      upper,
+		filePath:      config.FilePath,
+		disableCaller: config.DisableCaller,
+		sourceDepth:   sourceDepth,
 	}
 
 	var writers []io.Writer
@@ -178,13 +192,13 @@ func (l *edgeXLogger) enabled(target string) bool {
 	return levelOrder[target] >= levelOrder[cur]
 }
 
-func caller(skip int) string {
+func caller(skip int, depth int) string {
 	// 跳过若干层调用，获得文件:行号
 	if _, file, line, ok := runtime.Caller(skip); ok {
-		// 截断文件路径到最后两级
+		// 截断文件路径到最后depth级
 		parts := strings.Split(file, "/")
-		if len(parts) > 2 {
-			file = strings.Join(parts[len(parts)-2:], "/")
+		if len(parts) > depth {
+			file = strings.Join(parts[len(parts)-depth:], "/")
 		}
 		return fmt.Sprintf("%s:%d", file, line)
 	}
@@ -208,10 +222,13 @@ func (l *edgeXLogger) output(level string, formatted bool, msg string, args ...i
 
 	icon := logLevelIconMap[level]
 	ts := time.Now().Format(timeLayout)
-	src := caller(4)
-	// 截断 source 只保留末尾
-	if len(src) > sourceWidth {
-		src = src[len(src)-sourceWidth:]
+	src := "-"
+	if !l.disableCaller {
+		src = caller(4, l.sourceDepth)
+		// 截断 source 只保留末尾
+		if len(src) > sourceWidth {
+			src = src[len(src)-sourceWidth:]
+		}
 	}
 
 	renderedMsg := msg
@@ -279,3 +296,106 @@ func (lc *edgeXLogger) Tracef(msg string, args ...interface{}) { lc.log(TraceLog
 func (lc *edgeXLogger) Debugf(msg string, args ...interface{}) { lc.log(DebugLog, true, msg, args...) }
 func (lc *edgeXLogger) Warnf(msg string, args ...interface{})  { lc.log(WarnLog, true, msg, args...) }
 func (lc *edgeXLogger) Errorf(msg string, args ...interface{}) { lc.log(ErrorLog, true, msg, args...) }
+
+// WithPrefix 返回在每条消息前添加前缀的LoggingClient，用于按请求关联ID等上下文分组日志
+// 底层为本包的记录器时直接输出，source仍指向实际调用方
+func WithPrefix(lc LoggingClient, prefix string) LoggingClient {
+	p := &prefixLogger{LoggingClient: lc, prefix: prefix, fmtPrefix: strings.ReplaceAll(prefix, "%", "%%")}
+	if base, ok := lc.(*edgeXLogger); ok {
+		p.base = base
+	}
+	return p
+}
+
+// prefixLogger 为消息添加固定前缀，其余行为委托给底层记录器
+type prefixLogger struct {
+	LoggingClient
+	base      *edgeXLogger
+	prefix    string
+	fmtPrefix string // 转义%后的前缀，用于格式化方法
+}
+
+func (p *prefixLogger) Info(msg string, args ...interface{}) {
+	if p.base != nil {
+		p.base.log(InfoLog, false, p.prefix+msg, args...)
+		return
+	}
+	p.LoggingClient.Info(p.prefix+msg, args...)
+}
+
+func (p *prefixLogger) Trace(msg string, args ...interface{}) {
+	if p.base != nil {
+		p.base.log(TraceLog, false, p.prefix+msg, args...)
+		return
+	}
+	p.LoggingClient.Trace(p.prefix+msg, args...)
+}
+
+func (p *prefixLogger) Debug(msg string, args ...interface{}) {
+	if p.base != nil {
+		p.base.log(DebugLog, false, p.prefix+msg, args...)
+		return
+	}
+	p.LoggingClient.Debug(p.prefix+msg, args...)
+}
+
+func (p *prefixLogger) Warn(msg string, args ...interface{}) {
+	if p.base != nil {
+		p.base.log(WarnLog, false, p.prefix+msg, args...)
+		return
+	}
+	p.LoggingClient.Warn(p.prefix+msg, args...)
+}
+
+func (p *prefixLogger) Error(msg string, args ...interface{}) {
+	if p.base != nil {
+		p.base.log(ErrorLog, false, p.prefix+msg, args...)
+		return
+	}
+	p.LoggingClient.Error(p.prefix+msg, args...)
+}
+
+func (p *prefixLogger) Infof(msg string, args ...interface{}) {
+	if p.base != nil {
+		p.base.log(InfoLog, true, p.fmtPrefix+msg, args...)
+		return
+	}
+	p.LoggingClient.Infof(p.fmtPrefix+msg, args...)
+}
+
+func (p *prefixLogger) Tracef(msg string, args ...interface{}) {
+	if p.base != nil {
+		p.base.log(TraceLog, true, p.fmtPrefix+msg, args...)
+		return
+	}
+	p.LoggingClient.Tracef(p.fmtPrefix+msg, args...)
+}
+
+func (p *prefixLogger) Debugf(msg string, args ...interface{}) {
+	if p.base != nil {
+		p.base.log(DebugLog, true, p.fmtPrefix+msg, args...)
+		return
+	}
+	p.LoggingClient.Debugf(p.fmtPrefix+msg, args...)
+}
+
+func (p *prefixLogger) Warnf(msg string, args ...interface{}) {
+	if p.base != nil {
+		p.base.log(WarnLog, true, p.fmtPrefix+msg, args...)
+		return
+	}
+	p.LoggingClient.Warnf(p.fmtPrefix+msg, args...)
+}
+
+func (p *prefixLogger) Errorf(msg string, args ...interface{}) {
+	if p.base != nil {
+		p.base.log(ErrorLog, true, p.fmtPrefix+msg, args...)
+		return
+	}
+	p.LoggingClient.Errorf(p.fmtPrefix+msg, args...)
+}
+
+// Close 不关闭底层记录器，前缀记录器与其共享输出
+func (p *prefixLogger) Close() error {
+	return nil
+}
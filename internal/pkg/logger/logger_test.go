@@ -1,6 +1,9 @@
 package logger
 
 import (
+	"bytes"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -240,3 +243,75 @@ func TestNewClientWithConfig(t *testing.T) {
 		assert.NotNil(t, lc)
 	})
 }
+
+// TestCallerCapture tests the DisableCaller and SourcePathDepth options
+func TestCallerCapture(t *testing.T) {
+	newLogger := func(cfg LoggerConfig) (*edgeXLogger, *bytes.Buffer) {
+		buf := &bytes.Buffer{}
+		l := NewClientWithConfig(cfg).(*edgeXLogger)
+		l.writer = buf
+		return l, buf
+	}
+
+	t.Run("caller enabled by default", func(t *testing.T) {
+		l, buf := newLogger(LoggerConfig{LogLevel: "INFO", EnableConsole: true})
+		l.Info("hello")
+		assert.Contains(t, buf.String(), "source=logger/logger_test.go:")
+	})
+
+	t.Run("caller disabled", func(t *testing.T) {
+		l, buf := newLogger(LoggerConfig{LogLevel: "INFO", EnableConsole: true, DisableCaller: true})
+		l.Info("hello")
+		assert.Contains(t, buf.String(), "(source=- ")
+		assert.NotContains(t, buf.String(), "logger_test.go")
+	})
+
+	t.Run("custom path depth", func(t *testing.T) {
+		l, buf := newLogger(LoggerConfig{LogLevel: "INFO", EnableConsole: true, SourcePathDepth: 1})
+		l.Info("hello")
+		assert.Contains(t, buf.String(), "source=logger_test.go:")
+	})
+}
+
+// TestWithPrefix tests that prefixed loggers tag every message and keep the caller source
+func TestWithPrefix(t *testing.T) {
+	buf := &bytes.Buffer{}
+	base := NewClientWithConfig(LoggerConfig{LogLevel: "DEBUG", EnableConsole: true}).(*edgeXLogger)
+	base.writer = buf
+	lc := WithPrefix(base, "[req=42] ")
+
+	lc.Debug("plain message")
+	lc.Warnf("formatted %d%%", 50)
+	base.Info("unprefixed")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[0], `msg="[req=42] plain message"`)
+	assert.Contains(t, lines[1], `msg="[req=42] formatted 50%"`)
+	assert.NotContains(t, lines[2], "req=42")
+	for _, line := range lines[:2] {
+		assert.Contains(t, line, "source=logger/logger_test.go:")
+	}
+}
+
+// BenchmarkLogWithCaller benchmarks logging with caller lookup
+func BenchmarkLogWithCaller(b *testing.B) {
+	l := NewClientWithConfig(LoggerConfig{LogLevel: "INFO", EnableConsole: true}).(*edgeXLogger)
+	l.writer = io.Discard
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("benchmark message")
+	}
+}
+
+// BenchmarkLogWithoutCaller benchmarks logging with caller lookup disabled
+func BenchmarkLogWithoutCaller(b *testing.B) {
+	l := NewClientWithConfig(LoggerConfig{LogLevel: "INFO", EnableConsole: true, DisableCaller: true}).(*edgeXLogger)
+	l.writer = io.Discard
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("benchmark message")
+	}
+}
@@ -0,0 +1,44 @@
+package mappingmanager
+
+import (
+	"strings"
+)
+
+// AccessMode 是南向资源 ReadWrite 字段的规范化读写权限
+type AccessMode string
+
+const (
+	AccessRead      AccessMode = "R"
+	AccessWrite     AccessMode = "W"
+	AccessReadWrite AccessMode = "RW"
+)
+
+// accessModes 将规范化（小写、去掉分隔符）后的 ReadWrite 写法映射到读写权限
+var accessModes = map[string]AccessMode{
+	"r": AccessRead, "ro": AccessRead, "read": AccessRead, "readonly": AccessRead,
+	"w": AccessWrite, "wo": AccessWrite, "write": AccessWrite, "writeonly": AccessWrite,
+	"rw": AccessReadWrite, "wr": AccessReadWrite, "readwrite": AccessReadWrite,
+}
+
+// ParseReadWrite 解析 ReadWrite 字段，不区分大小写，忽略空白、"-"、"_" 和 "/"（如 "read-only"、"R/W"）
+// 空值按可读写处理；无法识别时返回 false
+func ParseReadWrite(readWrite string) (AccessMode, bool) {
+	key := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '-', '_', '/':
+			return -1
+		}
+		return r
+	}, strings.ToLower(readWrite))
+	if key == "" {
+		return AccessReadWrite, true
+	}
+	mode, ok := accessModes[key]
+	return mode, ok
+}
+
+// Writable 判断 ReadWrite 字段是否允许写入，无法识别的值按只读处理
+func Writable(readWrite string) bool {
+	mode, ok := ParseReadWrite(readWrite)
+	return ok && mode != AccessRead
+}
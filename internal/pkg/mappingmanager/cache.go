@@ -1,6 +1,7 @@
 package mappingmanager
 
 import (
+	"app-modbus-go/internal/pkg/config"
 	"sync"
 	"time"
 )
@@ -15,66 +16,314 @@ type CachedData struct {
 	ValueType     string // 数据类型 (int16, float32, etc.)
 	Scale         float64
 	Offset        float64
-	ModbusAddress uint16 // Modbus寄存器地址
+	Unit          string            // 工程单位
+	Precision     *int              // 浮点值输出的小数位数（nil表示使用全局配置）
+	ModbusAddress config.AddressKey // Modbus寄存器地址
+
+	SignedFlagAddr *config.AddressKey // 动态符号模式标志地址（nil表示使用ValueType的静态符号性）
+	SignedEncoding string             // 有符号整数的寄存器表示（空表示二进制补码）
+	WordOrder      string             // 多寄存器值的字顺序（空表示使用全局顺序）
+	HoldLastValue  bool               // 过期后继续返回最后的值（标记为Stale），不被清理
+	MaxAge         time.Duration      // 超过该时长的数据读取时标记为Stale并通知重新查询，0表示不检查
+	WordPart       int                // 32位值拆分到两个地址时该地址提供的字：1为第一个字，2为第二个字，0表示不拆分
+
+	Stale     bool // 已过期但仍在宽限期内返回的值
+	WriteBack bool // 由写操作回写的值，而非传感器数据
+	Default   bool // 映射加载时写入的资源默认值，不会过期，被首个真实数据覆盖
 }
 
 // IsExpired 检查缓存的数据是否已过期
 func (c *CachedData) IsExpired() bool {
-	return time.Since(c.Timestamp) > c.TTL
+	return c.IsExpiredAt(time.Now())
+}
+
+// IsExpiredAt 检查缓存的数据在指定时间是否已过期
+func (c *CachedData) IsExpiredAt(now time.Time) bool {
+	if c.Default {
+		return false
+	}
+	return now.Sub(c.Timestamp) > c.TTL
 }
 
+// Clock 提供当前时间，测试中可替换以确定性地推进时间
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock 使用系统时间
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// compactRatio 当条目数低于峰值的 1/compactRatio 时触发map重建
+const compactRatio = 4
+
 // Cache 提供线程安全的缓存操作
 type Cache struct {
-	data       map[uint16]*CachedData
+	data       map[config.AddressKey]*CachedData
 	mu         sync.RWMutex
 	defaultTTL time.Duration
+	minTTL     time.Duration // TTL下限，0表示不限制
 	stopCh     chan struct{}
+	clock      Clock
+
+	compact  bool // 清理后是否压缩map
+	peakSize int  // 自上次重建以来的最大条目数
+
+	staleGrace time.Duration // 过期后仍返回旧值（标记为Stale）的宽限期
+
+	writeBackMaxAge time.Duration // 回写值的最长保留时间，0表示仅受TTL限制
+
+	historySize int                                // 每个地址保留的历史值数量，0表示不记录
+	history     map[config.AddressKey]*historyRing // 每个地址的历史值环形缓冲区
+
+	onOverAge func(data *CachedData) // 读到超过MaxAge的数据时调用，在读锁内调用，不能阻塞
+}
+
+// HistoryEntry 是地址的一条历史值
+type HistoryEntry struct {
+	Value     interface{} `json:"value"`
+	Timestamp time.Time   `json:"timestamp"`
+	WriteBack bool        `json:"writeBack,omitempty"` // 由写操作回写的值
+}
+
+// historyRing 是固定容量的历史值环形缓冲区
+type historyRing struct {
+	entries []HistoryEntry
+	next    int // 下一次写入的位置
+	full    bool
+}
+
+// add 写入一条历史值，缓冲区满时覆盖最旧的值
+func (r *historyRing) add(entry HistoryEntry) {
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// last 按时间顺序（旧到新）返回最近的n条历史值，n<=0表示全部
+func (r *historyRing) last(n int) []HistoryEntry {
+	count := r.next
+	if r.full {
+		count = len(r.entries)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+	result := make([]HistoryEntry, n)
+	for i := 0; i < n; i++ {
+		idx := (r.next - n + i + len(r.entries)) % len(r.entries)
+		result[i] = r.entries[idx]
+	}
+	return result
 }
 
 // NewCache 创建新的缓存实例
 func NewCache(defaultTTL time.Duration) *Cache {
+	return NewCacheWithClock(defaultTTL, realClock{})
+}
+
+// NewCacheWithClock 使用指定时钟创建新的缓存实例
+func NewCacheWithClock(defaultTTL time.Duration, clock Clock) *Cache {
+	if clock == nil {
+		clock = realClock{}
+	}
 	return &Cache{
-		data:       make(map[uint16]*CachedData),
+		data:       make(map[config.AddressKey]*CachedData),
 		defaultTTL: defaultTTL,
 		stopCh:     make(chan struct{}),
+		clock:      clock,
 	}
 }
 
+// SetCompaction 启用或禁用清理后的map压缩
+func (c *Cache) SetCompaction(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.compact = enabled
+}
+
+// SetDefaultTTL 设置之后写入的数据使用的默认TTL，低于TTL下限时提升到下限；已缓存的数据保留原TTL
+func (c *Cache) SetDefaultTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ttl < c.minTTL {
+		ttl = c.minTTL
+	}
+	c.defaultTTL = ttl
+}
+
+// SetOverAgeHandler 设置读到超过MaxAge的数据时的回调，回调在读锁内同步调用，必须立即返回
+func (c *Cache) SetOverAgeHandler(fn func(data *CachedData)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onOverAge = fn
+}
+
+// SetMinTTL 设置TTL下限，之后写入的更小TTL（包括默认TTL）被提升到该值
+func (c *Cache) SetMinTTL(minTTL time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.minTTL = minTTL
+	if c.defaultTTL < minTTL {
+		c.defaultTTL = minTTL
+	}
+}
+
+// SetStaleGracePeriod 设置过期后的宽限期，宽限期内Get返回标记为Stale的旧值
+func (c *Cache) SetStaleGracePeriod(grace time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.staleGrace = grace
+}
+
+// SetWriteBackMaxAge 设置回写值的最长保留时间，超时后不再返回，避免掩盖失败的南向写入
+func (c *Cache) SetWriteBackMaxAge(maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeBackMaxAge = maxAge
+}
+
+// SetHistorySize 设置每个地址保留的历史值数量，0表示不记录；修改容量会丢弃已有历史
+func (c *Cache) SetHistorySize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if size < 0 {
+		size = 0
+	}
+	if size == c.historySize && (size == 0 || c.history != nil) {
+		return
+	}
+	c.historySize = size
+	c.history = nil
+	if size > 0 {
+		c.history = make(map[config.AddressKey]*historyRing)
+	}
+}
+
+// recordHistoryLocked 将写入的值追加到地址的历史（调用方需持有写锁）
+func (c *Cache) recordHistoryLocked(addr config.AddressKey, data *CachedData) {
+	if c.historySize == 0 {
+		return
+	}
+	ring, ok := c.history[addr]
+	if !ok {
+		ring = &historyRing{entries: make([]HistoryEntry, c.historySize)}
+		c.history[addr] = ring
+	}
+	ring.add(HistoryEntry{Value: data.Value, Timestamp: data.Timestamp, WriteBack: data.WriteBack})
+}
+
+// GetHistory 按时间顺序（旧到新）返回地址最近的n条历史值，n<=0表示全部；未启用或无历史时返回nil
+func (c *Cache) GetHistory(addr config.AddressKey, n int) []HistoryEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ring, ok := c.history[addr]
+	if !ok {
+		return nil
+	}
+	return ring.last(n)
+}
+
+// writeBackExpiredLocked 检查回写值在指定时间是否已超过最长保留时间（调用方需持有锁）
+func (c *Cache) writeBackExpiredLocked(data *CachedData, now time.Time) bool {
+	return data.WriteBack && c.writeBackMaxAge > 0 && now.Sub(data.Timestamp) > c.writeBackMaxAge
+}
+
+// lookupLocked 返回地址在指定时间可读的值，宽限期内或保持最后值的过期值以副本形式返回并标记Stale（调用方需持有锁）
+func (c *Cache) lookupLocked(addr config.AddressKey, now time.Time) (*CachedData, bool) {
+	data, ok := c.data[addr]
+	if !ok || c.writeBackExpiredLocked(data, now) {
+		return nil, false
+	}
+	if !data.IsExpiredAt(now) {
+		if c.overAgeLocked(data, now) {
+			stale := *data
+			stale.Stale = true
+			return &stale, true
+		}
+		return data, true
+	}
+	if data.HoldLastValue || (c.staleGrace > 0 && now.Sub(data.Timestamp) <= data.TTL+c.staleGrace) {
+		c.overAgeLocked(data, now)
+		stale := *data
+		stale.Stale = true
+		return &stale, true
+	}
+	return nil, false
+}
+
+// overAgeLocked 检查数据是否超过其MaxAge，超过时通知回调（调用方需持有锁）
+func (c *Cache) overAgeLocked(data *CachedData, now time.Time) bool {
+	if data.MaxAge <= 0 || now.Sub(data.Timestamp) <= data.MaxAge {
+		return false
+	}
+	if c.onOverAge != nil {
+		c.onOverAge(data)
+	}
+	return true
+}
+
 // Set 将值存储在缓存中
-func (c *Cache) Set(addr uint16, data *CachedData) {
+func (c *Cache) Set(addr config.AddressKey, data *CachedData) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if data.TTL == 0 {
 		data.TTL = c.defaultTTL
 	}
-	data.Timestamp = time.Now()
+	if data.TTL < c.minTTL {
+		data.TTL = c.minTTL
+	}
+	data.Timestamp = c.clock.Now()
 	c.data[addr] = data
+	c.recordHistoryLocked(addr, data)
+	if len(c.data) > c.peakSize {
+		c.peakSize = len(c.data)
+	}
+}
+
+// SetDefault 以默认值优先级存储值：地址已有真实数据时不写入，已有的默认值被替换
+// 返回是否写入
+func (c *Cache) SetDefault(addr config.AddressKey, data *CachedData) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.data[addr]; ok && !existing.Default {
+		return false
+	}
+	data.Default = true
+	if data.TTL == 0 {
+		data.TTL = c.defaultTTL
+	}
+	data.Timestamp = c.clock.Now()
+	c.data[addr] = data
+	if len(c.data) > c.peakSize {
+		c.peakSize = len(c.data)
+	}
+	return true
 }
 
 // Get 从缓存中检索值
-func (c *Cache) Get(addr uint16) (*CachedData, bool) {
+func (c *Cache) Get(addr config.AddressKey) (*CachedData, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	data, ok := c.data[addr]
-	if !ok {
-		return nil, false
-	}
-	if data.IsExpired() {
-		return nil, false
-	}
-	return data, true
+	return c.lookupLocked(addr, c.clock.Now())
 }
 
-// GetRange 从缓存中检索多个连续的值
-func (c *Cache) GetRange(startAddr uint16, quantity uint16) ([]*CachedData, error) {
+// GetRange 从缓存中检索多个连续的值，超出起始地址所在地址表的部分没有数据
+func (c *Cache) GetRange(startAddr config.AddressKey, quantity uint16) ([]*CachedData, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
+	now := c.clock.Now()
 	result := make([]*CachedData, quantity)
 	for i := uint16(0); i < quantity; i++ {
-		addr := startAddr + i
-		data, ok := c.data[addr]
-		if ok && !data.IsExpired() {
+		addr, ok := startAddr.Add(int(i))
+		if !ok {
+			break
+		}
+		if data, ok := c.lookupLocked(addr, now); ok {
 			result[i] = data
 		} else {
 			result[i] = nil // 此地址没有数据
@@ -83,18 +332,93 @@ func (c *Cache) GetRange(startAddr uint16, quantity uint16) ([]*CachedData, erro
 	return result, nil
 }
 
+// Snapshot 在同一把锁内读取多个地址，返回同一时刻的一致视图
+// 返回的条目是副本，之后的写入不会影响快照；没有可读数据的地址不出现在结果中
+func (c *Cache) Snapshot(addrs []config.AddressKey) map[config.AddressKey]*CachedData {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.clock.Now()
+	result := make(map[config.AddressKey]*CachedData, len(addrs))
+	for _, addr := range addrs {
+		if data, ok := c.lookupLocked(addr, now); ok {
+			cp := *data
+			result[addr] = &cp
+		}
+	}
+	return result
+}
+
+// Modify 在同一把锁内读取当前值、应用转换函数并写回新值
+// 如果地址没有未过期的缓存数据，fn 收到 nil，新条目基于 template 创建
+// fn 返回错误时缓存保持不变并返回该错误
+// 写回的条目标记为WriteBack，之后的传感器数据会覆盖它
+func (c *Cache) Modify(addr config.AddressKey, template *CachedData, fn func(old interface{}) (interface{}, error)) (*CachedData, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var updated CachedData
+	var old interface{}
+	now := c.clock.Now()
+	if existing, ok := c.data[addr]; ok && !existing.IsExpiredAt(now) && !c.writeBackExpiredLocked(existing, now) {
+		updated = *existing
+		old = existing.Value
+	} else if template != nil {
+		updated = *template
+	}
+
+	value, err := fn(old)
+	if err != nil {
+		return nil, err
+	}
+	// 存储副本，避免修改读取方持有的旧条目
+	updated.Value = value
+	updated.WriteBack = true
+	updated.Default = false
+	if updated.TTL == 0 {
+		updated.TTL = c.defaultTTL
+	}
+	updated.Timestamp = now
+	c.data[addr] = &updated
+	c.recordHistoryLocked(addr, &updated)
+	if len(c.data) > c.peakSize {
+		c.peakSize = len(c.data)
+	}
+	return &updated, nil
+}
+
+// DeleteDefaultsExcept 删除地址不在 keep 中的默认值条目，真实数据不受影响，返回删除的条目数
+func (c *Cache) DeleteDefaultsExcept(keep map[config.AddressKey]bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for addr, data := range c.data {
+		if data.Default && !keep[addr] {
+			delete(c.data, addr)
+			delete(c.history, addr)
+			removed++
+		}
+	}
+	return removed
+}
+
 // Delete 从缓存中删除值
-func (c *Cache) Delete(addr uint16) {
+func (c *Cache) Delete(addr config.AddressKey) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	delete(c.data, addr)
+	delete(c.history, addr)
 }
 
 // Clear 从缓存中删除所有值
 func (c *Cache) Clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.data = make(map[uint16]*CachedData)
+	c.data = make(map[config.AddressKey]*CachedData)
+	c.peakSize = 0
+	if c.history != nil {
+		c.history = make(map[config.AddressKey]*historyRing)
+	}
 }
 
 // Cleanup 从缓存中删除过期条目
@@ -102,16 +426,33 @@ func (c *Cache) Cleanup() int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	// 宽限期内和保持最后值的条目保留，以便Get继续返回旧值
+	now := c.clock.Now()
+	graceNow := now.Add(-c.staleGrace)
 	count := 0
 	for addr, data := range c.data {
-		if data.IsExpired() {
+		if (data.IsExpiredAt(graceNow) && !data.HoldLastValue) || c.writeBackExpiredLocked(data, now) {
 			delete(c.data, addr)
 			count++
 		}
 	}
+
+	if c.compact && len(c.data) < c.peakSize/compactRatio {
+		c.compactLocked()
+	}
 	return count
 }
 
+// compactLocked 将剩余条目复制到新map，释放旧map的底层存储（调用方需持有写锁）
+func (c *Cache) compactLocked() {
+	compacted := make(map[config.AddressKey]*CachedData, len(c.data))
+	for addr, data := range c.data {
+		compacted[addr] = data
+	}
+	c.data = compacted
+	c.peakSize = len(compacted)
+}
+
 // StartPeriodicCleanup 启动一个goroutine，定期清理过期条目
 func (c *Cache) StartPeriodicCleanup(interval time.Duration, callback func(int)) {
 	go func() {
@@ -145,11 +486,11 @@ func (c *Cache) Size() int {
 }
 
 // GetAll 返回所有缓存数据（包括过期的）
-func (c *Cache) GetAll() map[uint16]*CachedData {
+func (c *Cache) GetAll() map[config.AddressKey]*CachedData {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	result := make(map[uint16]*CachedData, len(c.data))
+	result := make(map[config.AddressKey]*CachedData, len(c.data))
 	for k, v := range c.data {
 		result[k] = v
 	}
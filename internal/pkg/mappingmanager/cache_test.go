@@ -1,11 +1,36 @@
 package mappingmanager
 
 import (
+	"app-modbus-go/internal/pkg/config"
+	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
 )
 
+// fakeClock is a manually advanced Clock for deterministic TTL tests
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
 func TestNewCache(t *testing.T) {
 	ttl := 30 * time.Second
 	c := NewCache(ttl)
@@ -35,14 +60,14 @@ func TestCachedDataIsExpired(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
 			data := &CachedData{
 				Value:     "test",
-				Timestamp: time.Now(),
+				Timestamp: now,
 				TTL:       tt.ttl,
 			}
-			time.Sleep(tt.delay)
-			if data.IsExpired() != tt.expected {
-				t.Errorf("IsExpired() = %v, want %v", data.IsExpired(), tt.expected)
+			if got := data.IsExpiredAt(now.Add(tt.delay)); got != tt.expected {
+				t.Errorf("IsExpiredAt() = %v, want %v", got, tt.expected)
 			}
 		})
 	}
@@ -125,12 +150,13 @@ func TestCacheGet(t *testing.T) {
 }
 
 func TestCacheGetExpired(t *testing.T) {
-	c := NewCache(10 * time.Millisecond)
+	clock := newFakeClock()
+	c := NewCacheWithClock(10*time.Millisecond, clock)
 	data := &CachedData{Value: "test"}
 	c.Set(1000, data)
 
-	// Wait for expiration
-	time.Sleep(20 * time.Millisecond)
+	// Advance past expiration
+	clock.Advance(20 * time.Millisecond)
 
 	_, ok := c.Get(1000)
 	if ok {
@@ -142,7 +168,7 @@ func TestCacheGetRange(t *testing.T) {
 	c := NewCache(30 * time.Second)
 
 	// Set multiple values
-	for i := uint16(1000); i < 1005; i++ {
+	for i := config.AddressKey(1000); i < 1005; i++ {
 		data := &CachedData{Value: i}
 		c.Set(i, data)
 	}
@@ -216,7 +242,7 @@ func TestCacheClear(t *testing.T) {
 	c := NewCache(30 * time.Second)
 
 	// Add multiple items
-	for i := uint16(1000); i < 1010; i++ {
+	for i := config.AddressKey(1000); i < 1010; i++ {
 		c.Set(i, &CachedData{Value: i})
 	}
 
@@ -231,11 +257,33 @@ func TestCacheClear(t *testing.T) {
 	}
 }
 
+func TestCacheFakeClockExpiry(t *testing.T) {
+	clock := newFakeClock()
+	c := NewCacheWithClock(time.Minute, clock)
+	c.Set(1000, &CachedData{Value: "test"})
+
+	// Exactly at TTL the entry is still valid
+	clock.Advance(time.Minute)
+	if _, ok := c.Get(1000); !ok {
+		t.Error("expected entry to be valid at exactly TTL")
+	}
+
+	// Just past TTL the entry expires without any real waiting
+	clock.Advance(time.Nanosecond)
+	if _, ok := c.Get(1000); ok {
+		t.Error("expected entry to expire after advancing past TTL")
+	}
+	if count := c.Cleanup(); count != 1 {
+		t.Errorf("expected cleanup to remove 1 item, got %d", count)
+	}
+}
+
 func TestCacheCleanup(t *testing.T) {
-	c := NewCache(10 * time.Millisecond)
+	clock := newFakeClock()
+	c := NewCacheWithClock(10*time.Millisecond, clock)
 
 	// Add items
-	for i := uint16(1000); i < 1005; i++ {
+	for i := config.AddressKey(1000); i < 1005; i++ {
 		c.Set(i, &CachedData{Value: i})
 	}
 
@@ -243,8 +291,8 @@ func TestCacheCleanup(t *testing.T) {
 		t.Errorf("expected size 5, got %d", c.Size())
 	}
 
-	// Wait for expiration
-	time.Sleep(20 * time.Millisecond)
+	// Advance past expiration
+	clock.Advance(20 * time.Millisecond)
 
 	// Cleanup
 	count := c.Cleanup()
@@ -259,18 +307,19 @@ func TestCacheCleanup(t *testing.T) {
 }
 
 func TestCacheCleanupPartial(t *testing.T) {
-	c := NewCache(10 * time.Millisecond)
+	clock := newFakeClock()
+	c := NewCacheWithClock(10*time.Millisecond, clock)
 
 	// Add first batch
-	for i := uint16(1000); i < 1003; i++ {
+	for i := config.AddressKey(1000); i < 1003; i++ {
 		c.Set(i, &CachedData{Value: i})
 	}
 
-	// Wait for first batch to expire
-	time.Sleep(20 * time.Millisecond)
+	// Advance until the first batch expires
+	clock.Advance(20 * time.Millisecond)
 
 	// Add second batch (fresh)
-	for i := uint16(1003); i < 1005; i++ {
+	for i := config.AddressKey(1003); i < 1005; i++ {
 		c.Set(i, &CachedData{Value: i})
 	}
 
@@ -286,13 +335,70 @@ func TestCacheCleanupPartial(t *testing.T) {
 	}
 }
 
+func TestCacheCleanupCompaction(t *testing.T) {
+	tests := []struct {
+		name        string
+		compact     bool
+		wantRebuilt bool
+	}{
+		{"compaction enabled", true, true},
+		{"compaction disabled", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			c := NewCacheWithClock(10*time.Millisecond, clock)
+			c.SetCompaction(tt.compact)
+
+			// Spike of short-lived entries plus a few long-lived ones
+			for i := config.AddressKey(0); i < 1000; i++ {
+				c.Set(i, &CachedData{Value: i})
+			}
+			for i := config.AddressKey(5000); i < 5010; i++ {
+				c.Set(i, &CachedData{Value: i, TTL: time.Minute})
+			}
+
+			c.mu.RLock()
+			before := reflect.ValueOf(c.data).Pointer()
+			c.mu.RUnlock()
+
+			clock.Advance(20 * time.Millisecond)
+
+			if count := c.Cleanup(); count != 1000 {
+				t.Errorf("expected cleanup to remove 1000 items, got %d", count)
+			}
+			if c.Size() != 10 {
+				t.Errorf("expected size 10 after cleanup, got %d", c.Size())
+			}
+
+			c.mu.RLock()
+			after := reflect.ValueOf(c.data).Pointer()
+			peak := c.peakSize
+			c.mu.RUnlock()
+
+			if rebuilt := before != after; rebuilt != tt.wantRebuilt {
+				t.Errorf("map rebuilt = %v, want %v", rebuilt, tt.wantRebuilt)
+			}
+			if tt.wantRebuilt && peak != 10 {
+				t.Errorf("expected peak size reset to 10, got %d", peak)
+			}
+
+			// Surviving entries remain readable
+			if _, ok := c.Get(5000); !ok {
+				t.Error("expected long-lived entry to survive cleanup")
+			}
+		})
+	}
+}
+
 func TestCacheStartPeriodicCleanup(t *testing.T) {
 	c := NewCache(10 * time.Millisecond)
 	cleanupCount := 0
 	var mu sync.Mutex
 
 	// Add items
-	for i := uint16(1000); i < 1005; i++ {
+	for i := config.AddressKey(1000); i < 1005; i++ {
 		c.Set(i, &CachedData{Value: i})
 	}
 
@@ -322,7 +428,7 @@ func TestCacheSize(t *testing.T) {
 		t.Errorf("expected initial size 0, got %d", c.Size())
 	}
 
-	for i := uint16(1000); i < 1010; i++ {
+	for i := config.AddressKey(1000); i < 1010; i++ {
 		c.Set(i, &CachedData{Value: i})
 	}
 
@@ -335,7 +441,7 @@ func TestCacheGetAll(t *testing.T) {
 	c := NewCache(30 * time.Second)
 
 	// Add items
-	for i := uint16(1000); i < 1005; i++ {
+	for i := config.AddressKey(1000); i < 1005; i++ {
 		c.Set(i, &CachedData{Value: i})
 	}
 
@@ -345,7 +451,7 @@ func TestCacheGetAll(t *testing.T) {
 		t.Errorf("expected 5 items in GetAll, got %d", len(all))
 	}
 
-	for i := uint16(1000); i < 1005; i++ {
+	for i := config.AddressKey(1000); i < 1005; i++ {
 		if _, ok := all[i]; !ok {
 			t.Errorf("expected key %d in GetAll result", i)
 		}
@@ -365,7 +471,7 @@ func TestCacheConcurrentAccess(t *testing.T) {
 		go func(goroutineID int) {
 			defer wg.Done()
 			for i := 0; i < itemsPerGoroutine; i++ {
-				addr := uint16(goroutineID*itemsPerGoroutine + i)
+				addr := config.AddressKey(goroutineID*itemsPerGoroutine + i)
 				c.Set(addr, &CachedData{Value: addr})
 			}
 		}(g)
@@ -377,7 +483,7 @@ func TestCacheConcurrentAccess(t *testing.T) {
 		go func(goroutineID int) {
 			defer wg.Done()
 			for i := 0; i < itemsPerGoroutine; i++ {
-				addr := uint16(goroutineID*itemsPerGoroutine + i)
+				addr := config.AddressKey(goroutineID*itemsPerGoroutine + i)
 				c.Get(addr)
 			}
 		}(g)
@@ -430,12 +536,12 @@ func TestCacheMultipleAddressesWithSameValue(t *testing.T) {
 	value := "shared_value"
 
 	// Add same value to multiple addresses
-	for i := uint16(1000); i < 1005; i++ {
+	for i := config.AddressKey(1000); i < 1005; i++ {
 		c.Set(i, &CachedData{Value: value})
 	}
 
 	// Verify all addresses have the value
-	for i := uint16(1000); i < 1005; i++ {
+	for i := config.AddressKey(1000); i < 1005; i++ {
 		data, ok := c.Get(i)
 		if !ok || data.Value != value {
 			t.Errorf("expected value %s at address %d", value, i)
@@ -487,3 +593,326 @@ func TestCacheMetadata(t *testing.T) {
 		t.Errorf("expected ModbusAddress 1000, got %d", retrieved.ModbusAddress)
 	}
 }
+
+func TestCacheSnapshotRoundTrip(t *testing.T) {
+	clock := newFakeClock()
+	c := NewCacheWithClock(30*time.Second, clock)
+	c.Set(100, &CachedData{Value: 25.5, NorthDevName: "device1", ResourceName: "temperature", ValueType: "float32", Unit: "°C"})
+	c.Set(200, &CachedData{Value: 1, TTL: time.Second})
+
+	// Entry at 200 expires before the snapshot is written
+	clock.Advance(2 * time.Second)
+
+	path := filepath.Join(t.TempDir(), "cache.json")
+	saved, err := c.SaveSnapshot(path)
+	if err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	if saved != 1 {
+		t.Errorf("expected 1 saved entry, got %d", saved)
+	}
+
+	restoredCache := NewCacheWithClock(30*time.Second, clock)
+	restored, err := restoredCache.LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if restored != 1 {
+		t.Errorf("expected 1 restored entry, got %d", restored)
+	}
+
+	data, ok := restoredCache.Get(100)
+	if !ok {
+		t.Fatal("expected restored entry at address 100")
+	}
+	if data.Value != 25.5 || data.ResourceName != "temperature" || data.Unit != "°C" {
+		t.Errorf("unexpected restored entry: %+v", data)
+	}
+	if !data.Timestamp.Equal(clock.Now().Add(-2 * time.Second)) {
+		t.Errorf("expected original timestamp to be kept, got %v", data.Timestamp)
+	}
+	if _, ok := restoredCache.Get(200); ok {
+		t.Error("expired entry should not be restored")
+	}
+}
+
+func TestCacheStaleGracePeriod(t *testing.T) {
+	clock := newFakeClock()
+	c := NewCacheWithClock(10*time.Second, clock)
+	c.SetStaleGracePeriod(5 * time.Second)
+	c.Set(100, &CachedData{Value: 42})
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		wantFound bool
+		wantStale bool
+	}{
+		{"fresh", 5 * time.Second, true, false},
+		{"within grace", 7 * time.Second, true, true},
+		{"end of grace", 3 * time.Second, true, true},
+		{"beyond grace", time.Second, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Advance(tt.advance)
+			data, ok := c.Get(100)
+			if ok != tt.wantFound {
+				t.Fatalf("Get found = %v, want %v", ok, tt.wantFound)
+			}
+			if !ok {
+				return
+			}
+			if data.Value != 42 {
+				t.Errorf("expected value 42, got %v", data.Value)
+			}
+			if data.Stale != tt.wantStale {
+				t.Errorf("Stale = %v, want %v", data.Stale, tt.wantStale)
+			}
+		})
+	}
+}
+
+func TestCacheCleanupKeepsGraceEntries(t *testing.T) {
+	clock := newFakeClock()
+	c := NewCacheWithClock(10*time.Second, clock)
+	c.SetStaleGracePeriod(5 * time.Second)
+	c.Set(100, &CachedData{Value: 1})
+
+	clock.Advance(12 * time.Second)
+	if removed := c.Cleanup(); removed != 0 {
+		t.Errorf("expected entry within grace to be kept, removed %d", removed)
+	}
+	if data, ok := c.Get(100); !ok || !data.Stale {
+		t.Error("expected stale value within grace after cleanup")
+	}
+
+	clock.Advance(5 * time.Second)
+	if removed := c.Cleanup(); removed != 1 {
+		t.Errorf("expected entry beyond grace to be removed, removed %d", removed)
+	}
+}
+
+func TestCacheHoldLastValue(t *testing.T) {
+	clock := newFakeClock()
+	c := NewCacheWithClock(10*time.Second, clock)
+	c.Set(100, &CachedData{Value: 55.5, HoldLastValue: true})
+	c.Set(101, &CachedData{Value: 1})
+
+	tests := []struct {
+		name      string
+		addr      config.AddressKey
+		advance   time.Duration
+		wantFound bool
+		wantStale bool
+	}{
+		{"held fresh", 100, 5 * time.Second, true, false},
+		{"held expired", 100, 10 * time.Second, true, true},
+		{"held long expired", 100, time.Hour, true, true},
+		{"regular expired", 101, 0, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Advance(tt.advance)
+			data, ok := c.Get(tt.addr)
+			if ok != tt.wantFound {
+				t.Fatalf("Get found = %v, want %v", ok, tt.wantFound)
+			}
+			if !ok {
+				return
+			}
+			if data.Value != 55.5 {
+				t.Errorf("expected last value 55.5, got %v", data.Value)
+			}
+			if data.Stale != tt.wantStale {
+				t.Errorf("Stale = %v, want %v", data.Stale, tt.wantStale)
+			}
+		})
+	}
+
+	if removed := c.Cleanup(); removed != 1 {
+		t.Errorf("expected only the regular entry to be removed, removed %d", removed)
+	}
+	if _, ok := c.Get(100); !ok {
+		t.Error("expected held value to survive cleanup")
+	}
+
+	c.Set(100, &CachedData{Value: 60.0, HoldLastValue: true})
+	if data, ok := c.Get(100); !ok || data.Stale || data.Value != 60.0 {
+		t.Errorf("expected fresh value 60 after update, got %+v", data)
+	}
+}
+
+func TestCacheHistory(t *testing.T) {
+	clock := newFakeClock()
+	c := NewCacheWithClock(time.Minute, clock)
+	c.SetHistorySize(3)
+
+	for i := 1; i <= 4; i++ {
+		c.Set(100, &CachedData{Value: i})
+		clock.Advance(time.Second)
+	}
+	c.Modify(100, nil, func(old interface{}) (interface{}, error) { return old.(int) * 10, nil })
+
+	tests := []struct {
+		name string
+		n    int
+		want []interface{}
+	}{
+		{"all", 0, []interface{}{3, 4, 40}},
+		{"last two", 2, []interface{}{4, 40}},
+		{"more than kept", 10, []interface{}{3, 4, 40}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := c.GetHistory(100, tt.n)
+			if len(history) != len(tt.want) {
+				t.Fatalf("expected %d entries, got %d", len(tt.want), len(history))
+			}
+			for i, entry := range history {
+				if entry.Value != tt.want[i] {
+					t.Errorf("entry %d = %v, want %v", i, entry.Value, tt.want[i])
+				}
+				if i > 0 && entry.Timestamp.Before(history[i-1].Timestamp) {
+					t.Errorf("entry %d is older than entry %d", i, i-1)
+				}
+			}
+			if !history[len(history)-1].WriteBack {
+				t.Error("expected latest entry to be marked as write-back")
+			}
+		})
+	}
+
+	if got := c.GetHistory(101, 0); got != nil {
+		t.Errorf("expected no history for untouched address, got %v", got)
+	}
+	c.Delete(100)
+	if got := c.GetHistory(100, 0); got != nil {
+		t.Errorf("expected history removed with entry, got %v", got)
+	}
+
+	disabled := NewCacheWithClock(time.Minute, clock)
+	disabled.Set(100, &CachedData{Value: 1})
+	if got := disabled.GetHistory(100, 0); got != nil {
+		t.Errorf("expected no history when disabled, got %v", got)
+	}
+}
+
+func TestCacheWriteBackMaxAge(t *testing.T) {
+	clock := newFakeClock()
+	c := NewCacheWithClock(time.Minute, clock)
+	c.SetWriteBackMaxAge(5 * time.Second)
+	setOne := func(interface{}) (interface{}, error) { return 1, nil }
+
+	// Fresher sensor data supersedes the written-back value
+	c.Modify(100, &CachedData{}, setOne)
+	clock.Advance(time.Second)
+	c.Set(100, &CachedData{Value: 2})
+	clock.Advance(10 * time.Second)
+	data, ok := c.Get(100)
+	if !ok || data.Value != 2 || data.WriteBack {
+		t.Fatalf("expected sensor value 2 to replace write-back, got %+v (found=%v)", data, ok)
+	}
+
+	// Without sensor data the written-back value expires after the max age
+	c.Modify(200, &CachedData{}, setOne)
+	clock.Advance(5 * time.Second)
+	if data, ok := c.Get(200); !ok || !data.WriteBack {
+		t.Fatalf("expected write-back value within max age, got %+v (found=%v)", data, ok)
+	}
+	clock.Advance(time.Second)
+	if _, ok := c.Get(200); ok {
+		t.Error("expected write-back value to expire after max age")
+	}
+	if removed := c.Cleanup(); removed != 1 {
+		t.Errorf("expected expired write-back entry to be removed, removed %d", removed)
+	}
+}
+
+func TestCacheSnapshotConsistent(t *testing.T) {
+	c := NewCache(time.Minute)
+	addrs := []config.AddressKey{1, 2, 3, 4, 5, 6, 7, 8}
+	for _, addr := range addrs {
+		c.Set(addr, &CachedData{Value: 0})
+	}
+
+	// The writer sets every address to round k in address order before starting round k+1,
+	// so at any instant the values are non-increasing by address and differ by at most one
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for k := 1; ; k++ {
+			for _, addr := range addrs {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				c.Set(addr, &CachedData{Value: k})
+			}
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		snap := c.Snapshot(addrs)
+		if len(snap) != len(addrs) {
+			t.Fatalf("snapshot has %d entries, want %d", len(snap), len(addrs))
+		}
+		first := snap[addrs[0]].Value.(int)
+		prev := first
+		for _, addr := range addrs[1:] {
+			v := snap[addr].Value.(int)
+			if v > prev || first-v > 1 {
+				close(stop)
+				<-done
+				t.Fatalf("inconsistent snapshot at iteration %d: address %d = %d after %d (first %d)", i, addr, v, prev, first)
+			}
+			prev = v
+		}
+	}
+	close(stop)
+	<-done
+
+	c.Set(100, &CachedData{Value: 1})
+	snap := c.Snapshot([]config.AddressKey{100, 200})
+	if _, ok := snap[200]; ok {
+		t.Error("expected address without data to be omitted")
+	}
+	c.Set(100, &CachedData{Value: 2})
+	if snap[100].Value != 1 {
+		t.Errorf("snapshot changed after later write: got %v", snap[100].Value)
+	}
+}
+
+func TestCacheMinTTL(t *testing.T) {
+	c := NewCache(time.Millisecond)
+	c.SetMinTTL(time.Second)
+
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{"default TTL below floor", 0, time.Second},
+		{"entry TTL below floor", 5 * time.Millisecond, time.Second},
+		{"entry TTL above floor", 5 * time.Second, 5 * time.Second},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := config.AddressKey(100 + i)
+			c.Set(addr, &CachedData{Value: 1, TTL: tt.ttl})
+			got, ok := c.Get(addr)
+			if !ok {
+				t.Fatal("expected cached value")
+			}
+			if got.TTL != tt.want {
+				t.Errorf("TTL = %s, want %s", got.TTL, tt.want)
+			}
+		})
+	}
+}
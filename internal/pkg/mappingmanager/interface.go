@@ -1,7 +1,9 @@
 package mappingmanager
 
 import (
+	"app-modbus-go/internal/pkg/config"
 	"app-modbus-go/internal/pkg/mqtt"
+	"time"
 )
 
 // MappingManagerInterface defines the mapping manager operations
@@ -12,20 +14,54 @@ type MappingManagerInterface interface {
 	// UpdateMappings updates the device-to-Modbus mappings
 	UpdateMappings(mappings []*mqtt.DeviceMapping) error
 
+	// Stats returns mapped and per-reason skipped resource counts of the last mapping update
+	Stats() MappingStats
+
+	// MappingIssues returns the problems detected by the most recent accepted UpdateMappings call
+	MappingIssues() []MappingIssue
+
+	// MappingGeneration returns the mapping update counter (odd while an update is in progress)
+	MappingGeneration() uint64
+
 	// GetMappingByAddress returns the resource mapping for a Modbus address
-	GetMappingByAddress(addr uint16) (*mqtt.ResourceMapping, bool)
+	GetMappingByAddress(addr config.AddressKey) (*mqtt.ResourceMapping, bool)
+
+	// GetDeviceNameByAddress returns the north device owning the resource at a Modbus address
+	GetDeviceNameByAddress(addr config.AddressKey) (string, bool)
 
 	// GetDeviceMapping returns the device mapping by north device name
 	GetDeviceMapping(northDeviceName string) (*mqtt.DeviceMapping, bool)
 
+	// GetAddressByResource returns the Modbus address for a north device resource
+	GetAddressByResource(northDeviceName string, resourceName string) (config.AddressKey, bool)
+
+	// ExportLayout returns the current register layout sorted by address
+	ExportLayout() []RegisterLayoutEntry
+
 	// UpdateCache updates the data cache from sensor data
 	UpdateCache(northDevName string, data map[string]interface{}) error
 
 	// GetCachedValue returns the cached value for a Modbus address
-	GetCachedValue(addr uint16) (*CachedData, bool)
+	GetCachedValue(addr config.AddressKey) (*CachedData, bool)
+
+	// GetHistory returns up to n recent values written to a Modbus address, oldest first
+	GetHistory(addr config.AddressKey, n int) []HistoryEntry
+
+	// GetAllCachedValues returns all cached entries keyed by Modbus address
+	GetAllCachedValues() map[config.AddressKey]*CachedData
+
+	// GetCachedValueTyped returns the cached value converted to its declared value type
+	GetCachedValueTyped(addr config.AddressKey) (*TypedValue, bool)
+
+	// ReadModifyWrite atomically reads, transforms and writes back the cached value for a Modbus address,
+	// returning the value written
+	ReadModifyWrite(addr config.AddressKey, fn func(old interface{}) (interface{}, error)) (interface{}, error)
+
+	// GetCachedSnapshot returns the cached values of several addresses as read at one instant
+	GetCachedSnapshot(addrs []config.AddressKey) map[config.AddressKey]*CachedData
 
 	// GetCachedRegisters reads multiple consecutive registers
-	GetCachedRegisters(startAddr uint16, quantity uint16) ([]*CachedData, error)
+	GetCachedRegisters(startAddr config.AddressKey, quantity uint16) ([]*CachedData, error)
 
 	// HandleSensorData processes incoming sensor data (type=4)
 	HandleSensorData(msg *mqtt.MQTTMessage) error
@@ -38,7 +74,26 @@ type MappingManagerInterface interface {
 
 	// LogDataForward 记录数据转发日志（当Modbus客户端读取数据时调用）
 	// forwardedData: map[deviceName]map[resourceName]value
-	LogDataForward(forwardedData map[string]map[string]interface{})
+	// readTime: Modbus客户端实际读取数据的时间
+	LogDataForward(forwardedData map[string]map[string]interface{}, readTime time.Time)
+
+	// Subscribe returns a channel receiving each cache update for addr (dropped when full)
+	Subscribe(addr config.AddressKey) <-chan CachedData
+
+	// Unsubscribe removes a subscription and closes its channel
+	Unsubscribe(addr config.AddressKey, sub <-chan CachedData)
+
+	// SaveSnapshot writes the unexpired cache entries to a snapshot file
+	SaveSnapshot(path string) (int, error)
+
+	// LoadSnapshot restores cache entries from a snapshot file
+	LoadSnapshot(path string) (int, error)
+
+	// ExportCache returns the unexpired cache entries encoded in the snapshot format
+	ExportCache() ([]byte, int, error)
+
+	// ImportCache validates and restores cache entries from a snapshot-format payload
+	ImportCache(payload []byte, resetTTL bool) (int, error)
 
 	// StartCleanup starts periodic cache cleanup
 	StartCleanup()
@@ -0,0 +1,86 @@
+package mappingmanager
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"fmt"
+	"sort"
+)
+
+// MappingIssueKind categorizes a problem detected while applying a mapping update
+type MappingIssueKind string
+
+const (
+	IssueIncompleteResource MappingIssueKind = "incompleteResource" // resource lacks a north or south definition (skipped)
+	IssueDuplicateAddress   MappingIssueKind = "duplicateAddress"   // address already taken by an earlier resource (skipped)
+	IssueOverlap            MappingIssueKind = "overlap"            // multi-register span runs into the next mapped address
+	IssueNameMismatch       MappingIssueKind = "nameMismatch"       // north and south resource names differ
+	IssueTypeMismatch       MappingIssueKind = "typeMismatch"       // north and south value types differ
+	IssueUnknownValueType   MappingIssueKind = "unknownValueType"   // north value type is not supported by the converter
+	IssueUnknownReadWrite   MappingIssueKind = "unknownReadWrite"   // south readWrite is not recognized, resource treated as read-only
+	IssueInvalidTarget      MappingIssueKind = "invalidTarget"      // additional target address is invalid or already mapped (target skipped)
+	IssueInvalidSplitWord   MappingIssueKind = "invalidSplitWord"   // second word address is invalid or already mapped (resource skipped)
+	IssueInvalidAddress     MappingIssueKind = "invalidAddress"     // object type is unknown or the address is below its base offset (resource skipped)
+)
+
+// MappingIssue describes one problem found by the most recent UpdateMappings call.
+// Address is relative to the table of ObjectType, which is empty for the shared table
+// used by object types without a base offset.
+type MappingIssue struct {
+	Kind       MappingIssueKind `json:"kind"`
+	Address    uint16           `json:"address"`
+	ObjectType string           `json:"objectType,omitempty"`
+	Device     string           `json:"device"`
+	Resource   string           `json:"resource,omitempty"`
+	Message    string           `json:"message"`
+}
+
+// issueAt returns an issue located at the table address of key
+func issueAt(kind MappingIssueKind, key config.AddressKey, device, resource, message string) MappingIssue {
+	return MappingIssue{Kind: kind, Address: key.Addr(), ObjectType: key.ObjectType(),
+		Device: device, Resource: resource, Message: message}
+}
+
+// key returns the address key the issue is located at
+func (i MappingIssue) key() config.AddressKey {
+	return config.NewAddressKey(i.ObjectType, i.Address)
+}
+
+// MappingIssues returns the problems detected by the most recent accepted UpdateMappings call,
+// sorted by address. Rejected updates keep the issues of the previous mappings.
+func (m *MappingManager) MappingIssues() []MappingIssue {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	issues := make([]MappingIssue, len(m.issues))
+	copy(issues, m.issues)
+	return issues
+}
+
+// findOverlaps reports resources whose register span covers the address of the next mapped resource
+// in the same address table
+func findOverlaps(mappings map[config.AddressKey]*addressIndex) []MappingIssue {
+	addrs := make([]config.AddressKey, 0, len(mappings))
+	for addr := range mappings {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+	var issues []MappingIssue
+	for i := 0; i+1 < len(addrs); i++ {
+		idx := mappings[addrs[i]]
+		nr := idx.ResourceMapping.NorthResource
+		span := registerSpan(nr)
+		next := mappings[addrs[i+1]]
+		if addrs[i].ObjectType() == addrs[i+1].ObjectType() && int(addrs[i].Addr())+span > int(addrs[i+1].Addr()) {
+			issues = append(issues, issueAt(IssueOverlap, addrs[i], idx.DeviceName, nr.Name,
+				fmt.Sprintf("%s spans %d registers and overlaps %s/%s at address %v",
+					nr.ValueType, span, next.DeviceName, next.ResourceMapping.NorthResource.Name, addrs[i+1])))
+		}
+	}
+	return issues
+}
+
+// sortIssues orders issues by address, keeping detection order for the same address
+func sortIssues(issues []MappingIssue) {
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].key() < issues[j].key() })
+}
@@ -0,0 +1,74 @@
+package mappingmanager
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"app-modbus-go/internal/pkg/mqtt"
+	"sort"
+	"strings"
+)
+
+// RegisterLayoutEntry describes the register span occupied by one mapped resource.
+// Address is relative to the table of ObjectType, which is empty for the shared table
+// used by object types without a base offset.
+type RegisterLayoutEntry struct {
+	Address       uint16  `json:"address"`
+	ObjectType    string  `json:"objectType,omitempty"`
+	RegisterCount int     `json:"registerCount"` // registers spanned, including all array elements; 1 for each word of a split value
+	Device        string  `json:"device"`
+	Resource      string  `json:"resource"`
+	ValueType     string  `json:"valueType"`
+	Scale         float64 `json:"scale"`     // calibration applied when the register is read
+	Offset        float64 `json:"offset"`    // calibration applied when the register is read
+	ReadWrite     string  `json:"readWrite"` // R/W/RW from the south resource
+}
+
+// ExportLayout returns the current address map sorted by address table and Modbus address.
+// Only resources that passed validation in UpdateMappings are included.
+func (m *MappingManager) ExportLayout() []RegisterLayoutEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	layout := make([]RegisterLayoutEntry, 0, len(m.addressMappings))
+	for addr, idx := range m.addressMappings {
+		nr := idx.ResourceMapping.NorthResource
+		count := registerSpan(nr)
+		scale, offset := nr.ReadCalibration()
+		entry := RegisterLayoutEntry{
+			Address:       addr.Addr(),
+			ObjectType:    addr.ObjectType(),
+			RegisterCount: count,
+			Device:        idx.DeviceName,
+			Resource:      nr.Name,
+			ValueType:     nr.ValueType,
+			Scale:         scale,
+			Offset:        offset,
+		}
+		if sr := idx.ResourceMapping.SouthResource; sr != nil {
+			entry.ReadWrite = sr.ReadWrite
+		}
+		layout = append(layout, entry)
+	}
+
+	sort.Slice(layout, func(i, j int) bool {
+		return config.NewAddressKey(layout[i].ObjectType, layout[i].Address) <
+			config.NewAddressKey(layout[j].ObjectType, layout[j].Address)
+	})
+	return layout
+}
+
+// registerSpan returns the number of consecutive registers a resource occupies at each of its addresses.
+// A 32-bit value split across two addresses occupies a single register at each; a string occupies its
+// configured stringLength.
+func registerSpan(nr *mqtt.NorthResource) int {
+	if nr.OtherParameters.Modbus.SecondWordAddress != nil {
+		return 1
+	}
+	if n := nr.OtherParameters.Modbus.StringLength; n > 0 && strings.EqualFold(nr.ValueType, "string") {
+		return int(n)
+	}
+	span := int(registerWidth(nr.ValueType))
+	if nr.ArrayLength > 0 {
+		span *= nr.ArrayLength
+	}
+	return span
+}
@@ -4,14 +4,21 @@ import (
 	"app-modbus-go/internal/pkg/config"
 	"app-modbus-go/internal/pkg/logger"
 	"app-modbus-go/internal/pkg/mqtt"
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // ForwardLogHandler defines the interface for forward log handling
 type ForwardLogHandler interface {
 	LogSuccess(northDeviceName string, data map[string]interface{})
+	LogSuccessAt(northDeviceName string, data map[string]interface{}, readTime time.Time)
 	LogFailure(northDeviceName string, data map[string]interface{})
 }
 
@@ -21,16 +28,102 @@ type MappingManager struct {
 	deviceMappings map[string]*mqtt.DeviceMapping
 
 	// Resource mappings indexed by Modbus address
-	addressMappings map[uint16]*addressIndex
+	addressMappings map[config.AddressKey]*addressIndex
 
 	// Data cache
 	cache *Cache
 
+	// Maximum number of resource mappings accepted in one update (0 = unlimited)
+	maxMappings int
+
+	// Whether to acknowledge sensor data with applied/skipped counts
+	sensorDataAck bool
+
+	// Whether sensor data keys matching no resource are reported as errors
+	strictSensorKeys bool
+
+	// Whether resources with a value type the converter does not support are skipped
+	skipUnknownValueTypes bool
+
+	// Total sensor data keys that matched no resource
+	unmatchedKeys atomic.Uint64
+
+	// Per-object-type base offsets used to normalize flat resource addresses
+	addressOffsets *config.AddressOffsetConfig
+
 	mqttClient        *mqtt.ClientManager
+	publishAndWait    func(*mqtt.MQTTMessage, time.Duration) (*mqtt.MQTTResponse, error)
+	publishResponse   func(*mqtt.MQTTResponse) error
 	forwardLogHandler ForwardLogHandler
 	lc                logger.LoggingClient
 	config            *config.CacheConfig
 	mu                sync.RWMutex
+
+	// In-flight attribute query shared by concurrent callers
+	queryMu   sync.Mutex
+	queryCall *queryCall
+
+	// Value update subscriptions keyed by Modbus address
+	subMu       sync.Mutex
+	subscribers map[config.AddressKey][]chan CachedData
+
+	// Mapping generation, odd while UpdateMappings is rebuilding the maps (seqlock style)
+	generation atomic.Uint64
+
+	// Outcome of the most recent accepted UpdateMappings call
+	stats  MappingStats
+	issues []MappingIssue
+
+	// Re-query of resources read past their maxAge, rate-limited per resource. requeryMu also
+	// guards config, which ApplyCacheConfig replaces on reload
+	requery     RequeryFunc
+	requeryMu   sync.Mutex
+	lastRequery map[string]time.Time
+}
+
+// RequeryFunc asks the data center to report the current value of a resource again
+type RequeryFunc func(northDeviceName, resourceName string) error
+
+// ErrUnmatchedSensorKeys is returned by UpdateCache in strict mode when sensor data contains
+// keys that match no resource of the device
+var ErrUnmatchedSensorKeys = errors.New("sensor data keys match no resource")
+
+// SkipReason categorizes why UpdateMappings skipped a resource
+type SkipReason string
+
+const (
+	SkipNilNorthResource SkipReason = "nilNorthResource" // resource has no north definition
+	SkipNilSouthResource SkipReason = "nilSouthResource" // resource has no south definition
+	SkipDuplicateAddress SkipReason = "duplicateAddress" // address already taken by an earlier resource
+	SkipDisabledDevice   SkipReason = "disabledDevice"   // device is switched off via its enabled flag
+	SkipUnknownValueType SkipReason = "unknownValueType" // value type not supported by the converter (skip mode only)
+	SkipSplitWord        SkipReason = "splitWord"        // second word address of a split 32-bit value is invalid or taken
+	SkipInvalidAddress   SkipReason = "invalidAddress"   // object type is unknown or the address is below its base offset
+)
+
+// MappingStats summarizes the most recent accepted mapping update
+type MappingStats struct {
+	Devices int                `json:"devices"`
+	Mapped  int                `json:"mapped"`  // resources that passed validation
+	Skipped map[SkipReason]int `json:"skipped"` // skipped resources per reason
+}
+
+// TotalSkipped returns the number of skipped resources across all reasons
+func (s MappingStats) TotalSkipped() int {
+	total := 0
+	for _, n := range s.Skipped {
+		total += n
+	}
+	return total
+}
+
+// subscriberBuffer is the channel capacity of a value subscription; updates beyond it are dropped
+const subscriberBuffer = 16
+
+// queryCall tracks an in-flight QueryDeviceAttributes call
+type queryCall struct {
+	done chan struct{}
+	err  error
 }
 
 // addressIndex maps a Modbus address to its resource mapping and device name
@@ -41,17 +134,47 @@ type addressIndex struct {
 
 // NewMappingManager creates a new MappingManager
 func NewMappingManager(mqttClient *mqtt.ClientManager, lc logger.LoggingClient, cacheConfig *config.CacheConfig) *MappingManager {
+	cache := NewCache(cacheConfig.GetDefaultTTL())
+	configureCache(cache, cacheConfig, lc)
+
 	return &MappingManager{
 		deviceMappings:    make(map[string]*mqtt.DeviceMapping),
-		addressMappings:   make(map[uint16]*addressIndex),
-		cache:             NewCache(cacheConfig.GetDefaultTTL()),
+		addressMappings:   make(map[config.AddressKey]*addressIndex),
+		subscribers:       make(map[config.AddressKey][]chan CachedData),
+		cache:             cache,
 		mqttClient:        mqttClient,
+		publishAndWait:    mqttClient.PublishAndWait,
+		publishResponse:   mqttClient.PublishResponse,
 		forwardLogHandler: nil, // Optional, can be set later
 		lc:                lc,
 		config:            cacheConfig,
 	}
 }
 
+// configureCache applies the TTL, grace period, write-back and history settings of cacheConfig
+func configureCache(cache *Cache, cacheConfig *config.CacheConfig, lc logger.LoggingClient) {
+	cache.SetMinTTL(cacheConfig.GetMinTTL())
+	cache.SetDefaultTTL(cacheConfig.GetDefaultTTL())
+	if ttl, err := time.ParseDuration(cacheConfig.DefaultTTL); err == nil && ttl < cacheConfig.GetMinTTL() {
+		lc.Warn(fmt.Sprintf("Cache DefaultTTL %s is below the minimum TTL, clamped to %s", ttl, cacheConfig.GetMinTTL()))
+	}
+	cache.SetCompaction(cacheConfig.CompactOnCleanup)
+	cache.SetStaleGracePeriod(cacheConfig.GetStaleGracePeriod())
+	cache.SetWriteBackMaxAge(cacheConfig.GetWriteBackMaxAge())
+	cache.SetHistorySize(cacheConfig.HistorySize)
+}
+
+// ApplyCacheConfig re-applies the cache settings after a config reload. New TTLs only affect
+// data cached afterwards, a changed HistorySize discards the recorded history, and the cleanup
+// interval keeps the value the cleanup was started with. cacheConfig replaces the config the
+// manager reads and must not be modified afterwards.
+func (m *MappingManager) ApplyCacheConfig(cacheConfig *config.CacheConfig) {
+	configureCache(m.cache, cacheConfig, m.lc)
+	m.requeryMu.Lock()
+	m.config = cacheConfig
+	m.requeryMu.Unlock()
+}
+
 // SetForwardLogHandler sets the forward log handler
 func (m *MappingManager) SetForwardLogHandler(handler ForwardLogHandler) {
 	m.mu.Lock()
@@ -59,14 +182,166 @@ func (m *MappingManager) SetForwardLogHandler(handler ForwardLogHandler) {
 	m.forwardLogHandler = handler
 }
 
-// QueryDeviceAttributes sends a type=2 query to data center and waits for response
+// SetMaxMappings sets the maximum number of resource mappings accepted in one update
+func (m *MappingManager) SetMaxMappings(max int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxMappings = max
+}
+
+// SetSensorDataAck enables or disables acknowledgements for sensor data messages
+func (m *MappingManager) SetSensorDataAck(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sensorDataAck = enabled
+}
+
+// SetStrictSensorKeys enables or disables strict mode, in which UpdateCache warns about and
+// returns ErrUnmatchedSensorKeys for incoming data keys that match no resource of the device.
+// Matched keys are still applied.
+func (m *MappingManager) SetStrictSensorKeys(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.strictSensorKeys = enabled
+}
+
+// SetSkipUnknownValueTypes controls whether UpdateMappings skips resources whose ValueType the
+// converter does not support. Such resources are always warned about and reported as issues;
+// when kept they are read as uint16.
+func (m *MappingManager) SetSkipUnknownValueTypes(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.skipUnknownValueTypes = enabled
+}
+
+// SetRequeryFunc sets the function used to re-query resources whose cached data is read after
+// their maxAge has passed. Re-queries are only sent while Cache.RequeryEnabled is set; maxAge alone
+// just flags over-age values stale. The stale value is still served; the re-query runs asynchronously
+// and at most once per resource per Cache.RequeryInterval. nil disables re-queries.
+func (m *MappingManager) SetRequeryFunc(fn RequeryFunc) {
+	m.requeryMu.Lock()
+	m.requery = fn
+	m.lastRequery = make(map[string]time.Time)
+	m.requeryMu.Unlock()
+
+	if fn == nil {
+		m.cache.SetOverAgeHandler(nil)
+		return
+	}
+	m.cache.SetOverAgeHandler(m.requestRequery)
+}
+
+// requestRequery starts an asynchronous re-query of the resource of an over-age cache entry
+// unless one was started within the requery interval. Called with the cache read lock held.
+func (m *MappingManager) requestRequery(data *CachedData) {
+	// Array elements are cached as "<resource>[i]"; the data center knows the resource
+	resourceName, _, _ := strings.Cut(data.ResourceName, "[")
+	key := data.NorthDevName + "/" + resourceName
+
+	m.requeryMu.Lock()
+	fn := m.requery
+	now := time.Now()
+	if fn == nil || !m.config.RequeryEnabled || now.Sub(m.lastRequery[key]) < m.config.GetRequeryInterval() {
+		m.requeryMu.Unlock()
+		return
+	}
+	m.lastRequery[key] = now
+	m.requeryMu.Unlock()
+
+	deviceName, age, maxAge := data.NorthDevName, now.Sub(data.Timestamp).Round(time.Millisecond), data.MaxAge
+	go func() {
+		m.lc.Debug(fmt.Sprintf("Re-querying %s: cached data is %v old (maxAge %v)", key, age, maxAge))
+		if err := fn(deviceName, resourceName); err != nil {
+			m.lc.Warn(fmt.Sprintf("Failed to re-query %s: %s", key, err.Error()))
+		}
+	}()
+}
+
+// UnmatchedKeyCount returns the total number of sensor data keys that matched no resource
+func (m *MappingManager) UnmatchedKeyCount() uint64 {
+	return m.unmatchedKeys.Load()
+}
+
+// SetAddressOffsets sets the per-object-type base offsets used to normalize resource addresses.
+// Must be set before mappings are loaded.
+func (m *MappingManager) SetAddressOffsets(offsets *config.AddressOffsetConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addressOffsets = offsets
+}
+
+// resourceAddress returns the cache key of a north resource's address in its object type table.
+// UpdateMappings skips resources whose address is below the base offset of their object type, so
+// the fallback to the raw address in the shared table is only used to report them.
+func (m *MappingManager) resourceAddress(nr *mqtt.NorthResource) config.AddressKey {
+	if key, ok := m.addressKey(nr.OtherParameters.Modbus.ObjectType, nr.OtherParameters.Modbus.Address); ok {
+		return key
+	}
+	return config.AddressKey(nr.OtherParameters.Modbus.Address)
+}
+
+// addressKey converts a resource address of an object type to its cache key, so that the same
+// table-relative address of different object types never collides (see AddressOffsetConfig.ResourceKey).
+// Returns false when the address is below the base offset of the object type.
+func (m *MappingManager) addressKey(objectType string, addr uint16) (config.AddressKey, bool) {
+	return m.addressOffsets.ResourceKey(objectType, addr)
+}
+
+// resourceMaxAge returns the maxAge of a north resource, or 0 when unset or invalid
+func resourceMaxAge(nr *mqtt.NorthResource) time.Duration {
+	d, err := time.ParseDuration(nr.OtherParameters.Modbus.MaxAge)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// signedFlagAddress returns the cache key of the signedness flag of a north resource, or nil.
+// The flag address is read in the resource's object type table.
+func (m *MappingManager) signedFlagAddress(nr *mqtt.NorthResource) *config.AddressKey {
+	flag := nr.OtherParameters.Modbus.SignedFlagAddress
+	if flag == nil {
+		return nil
+	}
+	addr, ok := m.addressKey(nr.OtherParameters.Modbus.ObjectType, *flag)
+	if !ok {
+		return nil
+	}
+	return &addr
+}
+
+// QueryDeviceAttributes sends a type=2 query to data center and waits for response.
+// Concurrent callers share the result of a single in-flight query.
 func (m *MappingManager) QueryDeviceAttributes() error {
+	m.queryMu.Lock()
+	if call := m.queryCall; call != nil {
+		m.queryMu.Unlock()
+		m.lc.Debug("Device attribute query already in flight, waiting for its result")
+		<-call.done
+		return call.err
+	}
+	call := &queryCall{done: make(chan struct{})}
+	m.queryCall = call
+	m.queryMu.Unlock()
+
+	call.err = m.queryDeviceAttributes()
+
+	m.queryMu.Lock()
+	m.queryCall = nil
+	m.queryMu.Unlock()
+	close(call.done)
+
+	return call.err
+}
+
+// queryDeviceAttributes performs a single attribute query round trip
+func (m *MappingManager) queryDeviceAttributes() error {
 	m.lc.Info("Querying device attributes from data center...")
 
 	payload := &mqtt.QueryDevicePayload{Cmd: "0101"}
 	msg := mqtt.NewMessage(mqtt.TypeQueryDevice, payload)
 
-	resp, err := m.mqttClient.PublishAndWait(msg, 30*time.Second)
+	resp, err := m.publishAndWait(msg, 30*time.Second)
 	if err != nil {
 		return fmt.Errorf("query device attributes failed: %w", err)
 	}
@@ -105,58 +380,134 @@ func (m *MappingManager) UpdateMappings(mappings []*mqtt.DeviceMapping) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Clear existing mappings
-	m.deviceMappings = make(map[string]*mqtt.DeviceMapping)
-	newAddressMappings := make(map[uint16]*addressIndex)
+	// Reject oversized updates before touching existing mappings
+	if m.maxMappings > 0 {
+		total := 0
+		for _, dm := range mappings {
+			total += len(dm.Resources)
+		}
+		if total > m.maxMappings {
+			m.lc.Error(fmt.Sprintf("Rejected mapping update: %d resources across %d devices exceeds limit %d (keeping previous mappings)",
+				total, len(mappings), m.maxMappings))
+			return fmt.Errorf("mapping update rejected: %d resources exceeds limit %d", total, m.maxMappings)
+		}
+	}
+
+	// Build the new maps aside and swap them in together, so readers see either the old or the new view
+	m.generation.Add(1)
+	defer m.generation.Add(1)
+	newDeviceMappings := make(map[string]*mqtt.DeviceMapping)
+	newAddressMappings := make(map[config.AddressKey]*addressIndex)
 
 	validResourceCount := 0
-	skippedResourceCount := 0
+	skipped := make(map[SkipReason]int)
+	var issues []MappingIssue
+	var targeted []*addressIndex // mapped resources with additional target addresses
+	var split []*addressIndex    // mapped resources whose two words sit at separate addresses
 
 	for _, dm := range mappings {
-		m.deviceMappings[dm.NorthDeviceName] = dm
+		newDeviceMappings[dm.NorthDeviceName] = dm
+
+		// Disabled devices stay known but expose no addresses
+		if !dm.IsEnabled() {
+			m.lc.Info(fmt.Sprintf("Device %s is disabled, skipping its %d resources", dm.NorthDeviceName, len(dm.Resources)))
+			skipped[SkipDisabledDevice] += len(dm.Resources)
+			continue
+		}
 
 		for _, rm := range dm.Resources {
 			// Validate resource completeness
 			if rm.NorthResource == nil {
 				m.lc.Warn(fmt.Sprintf("Skipping resource in device %s: NorthResource is nil", dm.NorthDeviceName))
-				skippedResourceCount++
+				skipped[SkipNilNorthResource]++
+				issues = append(issues, MappingIssue{Kind: IssueIncompleteResource, Device: dm.NorthDeviceName,
+					Message: "northResource is missing"})
 				continue
 			}
 			if rm.SouthResource == nil {
 				m.lc.Warn(fmt.Sprintf("Skipping resource %s in device %s: SouthResource is nil",
 					rm.NorthResource.Name, dm.NorthDeviceName))
-				skippedResourceCount++
+				skipped[SkipNilSouthResource]++
+				issues = append(issues, issueAt(IssueIncompleteResource, m.resourceAddress(rm.NorthResource), dm.NorthDeviceName, rm.NorthResource.Name,
+					"southResource is missing"))
+				continue
+			}
+
+			addr := m.resourceAddress(rm.NorthResource)
+
+			// The object type decides the cache key when address offsets are configured
+			if reason := m.invalidAddress(rm.NorthResource); reason != "" {
+				m.lc.Warn(fmt.Sprintf("Skipping resource %s/%s at address %v: %s",
+					dm.NorthDeviceName, rm.NorthResource.Name, addr, reason))
+				skipped[SkipInvalidAddress]++
+				issues = append(issues, issueAt(IssueInvalidAddress, addr, dm.NorthDeviceName, rm.NorthResource.Name,
+					reason))
 				continue
 			}
 
-			addr := rm.NorthResource.OtherParameters.Modbus.Address
+			// Unknown value types would otherwise fall back to uint16 silently at read time
+			if !KnownValueType(rm.NorthResource.ValueType) {
+				action := "reading as uint16"
+				if m.skipUnknownValueTypes {
+					action = "skipping"
+				}
+				m.lc.Warn(fmt.Sprintf("Unknown value type %q for resource %s/%s at address %v (%s)",
+					rm.NorthResource.ValueType, dm.NorthDeviceName, rm.NorthResource.Name, addr, action))
+				issues = append(issues, issueAt(IssueUnknownValueType, addr, dm.NorthDeviceName, rm.NorthResource.Name,
+					fmt.Sprintf("value type %q is not supported, %s", rm.NorthResource.ValueType, action)))
+				if m.skipUnknownValueTypes {
+					skipped[SkipUnknownValueType]++
+					continue
+				}
+			}
+
+			// Unrecognized access modes fail closed: Modbus writes to the resource are rejected
+			if _, ok := ParseReadWrite(rm.SouthResource.ReadWrite); !ok {
+				m.lc.Warn(fmt.Sprintf("Unknown readWrite %q for resource %s/%s at address %v (treating as read-only)",
+					rm.SouthResource.ReadWrite, dm.NorthDeviceName, rm.NorthResource.Name, addr))
+				issues = append(issues, issueAt(IssueUnknownReadWrite, addr, dm.NorthDeviceName, rm.NorthResource.Name,
+					fmt.Sprintf("readWrite %q is not recognized, treated as read-only", rm.SouthResource.ReadWrite)))
+			}
 
 			// Check for duplicate address mapping - keep first, skip duplicates
 			if existing, ok := newAddressMappings[addr]; ok {
-				m.lc.Warn(fmt.Sprintf("Duplicate Modbus address %d detected: %s/%s conflicts with %s/%s (keeping first, skipping duplicate)",
+				m.lc.Warn(fmt.Sprintf("Duplicate Modbus address %v detected: %s/%s conflicts with %s/%s (keeping first, skipping duplicate)",
 					addr, dm.NorthDeviceName, rm.NorthResource.Name,
 					existing.DeviceName, existing.ResourceMapping.NorthResource.Name))
-				skippedResourceCount++
+				skipped[SkipDuplicateAddress]++
+				issues = append(issues, issueAt(IssueDuplicateAddress, addr, dm.NorthDeviceName, rm.NorthResource.Name,
+					fmt.Sprintf("address already mapped to %s/%s, resource skipped",
+						existing.DeviceName, existing.ResourceMapping.NorthResource.Name)))
 				continue
 			}
 
 			// Warn about name mismatches
 			if rm.NorthResource.Name != rm.SouthResource.Name {
-				m.lc.Warn(fmt.Sprintf("Resource name mismatch for address %d: northName=%s, southName=%s (will match by both names)",
+				m.lc.Warn(fmt.Sprintf("Resource name mismatch for address %v: northName=%s, southName=%s (will match by both names)",
 					addr, rm.NorthResource.Name, rm.SouthResource.Name))
+				issues = append(issues, issueAt(IssueNameMismatch, addr, dm.NorthDeviceName, rm.NorthResource.Name,
+					fmt.Sprintf("south resource is named %s", rm.SouthResource.Name)))
 			}
 
 			// Warn about type mismatches
 			if rm.NorthResource.ValueType != rm.SouthResource.ValueType {
-				m.lc.Warn(fmt.Sprintf("Value type mismatch for resource %s at address %d: northType=%s, southType=%s (may cause conversion issues)",
+				m.lc.Warn(fmt.Sprintf("Value type mismatch for resource %s at address %v: northType=%s, southType=%s (may cause conversion issues)",
 					rm.NorthResource.Name, addr, rm.NorthResource.ValueType, rm.SouthResource.ValueType))
+				issues = append(issues, issueAt(IssueTypeMismatch, addr, dm.NorthDeviceName, rm.NorthResource.Name,
+					fmt.Sprintf("north type %s, south type %s", rm.NorthResource.ValueType, rm.SouthResource.ValueType)))
 			}
 
 			newAddressMappings[addr] = &addressIndex{
 				DeviceName:      dm.NorthDeviceName,
 				ResourceMapping: rm,
 			}
-			m.lc.Debug(fmt.Sprintf("Mapped address %d -> %s/%s (northName=%s, southName=%s, northType=%s, southType=%s)",
+			if len(rm.NorthResource.OtherParameters.Modbus.Targets) > 0 {
+				targeted = append(targeted, newAddressMappings[addr])
+			}
+			if rm.NorthResource.OtherParameters.Modbus.SecondWordAddress != nil {
+				split = append(split, newAddressMappings[addr])
+			}
+			m.lc.Debug(fmt.Sprintf("Mapped address %v -> %s/%s (northName=%s, southName=%s, northType=%s, southType=%s)",
 				addr, dm.NorthDeviceName, rm.NorthResource.Name,
 				rm.NorthResource.Name, rm.SouthResource.Name,
 				rm.NorthResource.ValueType, rm.SouthResource.ValueType))
@@ -164,14 +515,297 @@ func (m *MappingManager) UpdateMappings(mappings []*mqtt.DeviceMapping) error {
 		}
 	}
 
+	splitIssues := m.mapSplitWords(newAddressMappings, split)
+	validResourceCount -= len(splitIssues)
+	if len(splitIssues) > 0 {
+		skipped[SkipSplitWord] += len(splitIssues)
+	}
+	issues = append(issues, splitIssues...)
+	issues = append(issues, m.mapTargets(newAddressMappings, targeted)...)
+	issues = append(issues, findOverlaps(newAddressMappings)...)
+	sortIssues(issues)
+
+	added, removed, changed := diffAddressMappings(m.addressMappings, newAddressMappings)
+	if len(added) > 0 || len(removed) > 0 || len(changed) > 0 {
+		m.lc.Info(fmt.Sprintf("Mapping diff: added=%v removed=%v changed=%v", added, removed, changed))
+	} else {
+		m.lc.Debug("Mapping diff: no address changes")
+	}
+
+	m.deviceMappings = newDeviceMappings
 	m.addressMappings = newAddressMappings
-	m.lc.Info(fmt.Sprintf("Updated mappings: %d devices, %d addresses (valid: %d, skipped: %d)",
-		len(m.deviceMappings), len(m.addressMappings), validResourceCount, skippedResourceCount))
+	m.stats = MappingStats{Devices: len(newDeviceMappings), Mapped: validResourceCount, Skipped: skipped}
+	m.issues = issues
+	m.lc.Info(fmt.Sprintf("Updated mappings: %d devices, %d addresses (valid: %d, skipped: %d %v)",
+		len(m.deviceMappings), len(m.addressMappings), validResourceCount, m.stats.TotalSkipped(), skipped))
+	if n := m.cacheDefaults(); n > 0 {
+		m.lc.Info(fmt.Sprintf("Cached default values for %d resources", n))
+	}
 	return nil
 }
 
+// cacheDefaults caches the configured default value of every mapped resource whose address has no
+// real data yet. Defaults never expire and are replaced by the first sensor update; array resources
+// are not supported. Defaults left from a previous mapping at addresses that are no longer mapped or
+// no longer carry a default are removed. Returns the number of resources whose default was cached.
+// Caller must hold m.mu.
+func (m *MappingManager) cacheDefaults() int {
+	count := 0
+	keep := make(map[config.AddressKey]bool)
+	for addr, idx := range m.addressMappings {
+		rm := idx.ResourceMapping
+		nr := rm.NorthResource
+		if nr.OtherParameters.Modbus.DefaultValue == nil || addr != m.resourceAddress(nr) {
+			continue
+		}
+		if nr.ArrayLength > 0 {
+			m.lc.Warn(fmt.Sprintf("Ignoring default value of array resource %s/%s", idx.DeviceName, nr.Name))
+			continue
+		}
+		scale, offset := nr.ReadCalibration()
+		entry := &CachedData{
+			Value:         nr.OtherParameters.Modbus.DefaultValue,
+			NorthDevName:  idx.DeviceName,
+			ResourceName:  nr.Name,
+			ValueType:     nr.ValueType,
+			Scale:         scale,
+			Offset:        offset,
+			Unit:          nr.Unit,
+			Precision:     nr.Precision,
+			ModbusAddress: addr,
+
+			SignedFlagAddr: m.signedFlagAddress(nr),
+			SignedEncoding: nr.OtherParameters.Modbus.SignedEncoding,
+			WordOrder:      nr.OtherParameters.Modbus.WordOrder,
+		}
+		if secondAddr, ok := m.splitWordAddress(rm); ok {
+			entry.WordPart = 1
+			second := *entry
+			second.ModbusAddress = secondAddr
+			second.WordPart = 2
+			m.cache.SetDefault(secondAddr, &second)
+			keep[secondAddr] = true
+		}
+		keep[addr] = true
+		if m.cache.SetDefault(addr, entry) {
+			m.lc.Debug(fmt.Sprintf("Cached default value %v at address %v for %s/%s", entry.Value, addr, idx.DeviceName, nr.Name))
+			count++
+		}
+	}
+	if n := m.cache.DeleteDefaultsExcept(keep); n > 0 {
+		m.lc.Info(fmt.Sprintf("Removed %d default values no longer configured", n))
+	}
+	return count
+}
+
+// mapTargets registers the additional target addresses of mapped resources. Targets are mapped
+// after all primary addresses so they never displace another resource's own address.
+func (m *MappingManager) mapTargets(mappings map[config.AddressKey]*addressIndex, targeted []*addressIndex) []MappingIssue {
+	var issues []MappingIssue
+	for _, idx := range targeted {
+		nr := idx.ResourceMapping.NorthResource
+		if mappings[m.resourceAddress(nr)] != idx {
+			continue // dropped after mapping, e.g. for an invalid split word
+		}
+		for _, target := range nr.OtherParameters.Modbus.Targets {
+			addr, err := m.targetAddress(target)
+			reason := ""
+			if err != nil {
+				reason = err.Error()
+			} else if nr.ArrayLength > 0 {
+				reason = "targets are not supported for array resources"
+			} else if existing, ok := mappings[addr]; ok {
+				reason = fmt.Sprintf("address %v already mapped to %s/%s",
+					addr, existing.DeviceName, existing.ResourceMapping.NorthResource.Name)
+			}
+			if reason != "" {
+				m.lc.Warn(fmt.Sprintf("Skipping target %s %d of %s/%s: %s",
+					target.ObjectType, target.Address, idx.DeviceName, nr.Name, reason))
+				issues = append(issues, issueAt(IssueInvalidTarget, m.resourceAddress(nr), idx.DeviceName, nr.Name,
+					fmt.Sprintf("target %s %d skipped: %s", target.ObjectType, target.Address, reason)))
+				continue
+			}
+			mappings[addr] = &addressIndex{DeviceName: idx.DeviceName, ResourceMapping: idx.ResourceMapping}
+			m.lc.Debug(fmt.Sprintf("Mapped target address %v -> %s/%s", addr, idx.DeviceName, nr.Name))
+		}
+	}
+	return issues
+}
+
+// mapSplitWords registers the second word address of 32-bit values split across two registers.
+// The second word must not collide with a primary address; a resource whose second word is invalid
+// is removed from mappings, since its first address alone cannot serve the whole value.
+// Returns one issue per removed resource.
+func (m *MappingManager) mapSplitWords(mappings map[config.AddressKey]*addressIndex, split []*addressIndex) []MappingIssue {
+	var issues []MappingIssue
+	for _, idx := range split {
+		nr := idx.ResourceMapping.NorthResource
+		primary := m.resourceAddress(nr)
+		addr, inRange := m.addressKey(nr.OtherParameters.Modbus.ObjectType, *nr.OtherParameters.Modbus.SecondWordAddress)
+		reason := ""
+		if !inRange {
+			reason = "address below the configured base offset"
+		} else if nr.ArrayLength > 0 {
+			reason = "split words are not supported for array resources"
+		} else if width := registerWidth(nr.ValueType); width != 2 {
+			reason = fmt.Sprintf("%s spans %d registers, split words need a 32-bit type", nr.ValueType, width)
+		} else if existing, ok := mappings[addr]; ok {
+			reason = fmt.Sprintf("address %v already mapped to %s/%s",
+				addr, existing.DeviceName, existing.ResourceMapping.NorthResource.Name)
+		}
+		if reason != "" {
+			m.lc.Warn(fmt.Sprintf("Skipping resource %s/%s with second word at %d: %s",
+				idx.DeviceName, nr.Name, *nr.OtherParameters.Modbus.SecondWordAddress, reason))
+			issues = append(issues, issueAt(IssueInvalidSplitWord, primary, idx.DeviceName, nr.Name,
+				fmt.Sprintf("second word %d: %s", *nr.OtherParameters.Modbus.SecondWordAddress, reason)))
+			delete(mappings, primary)
+			continue
+		}
+		mappings[addr] = &addressIndex{DeviceName: idx.DeviceName, ResourceMapping: idx.ResourceMapping}
+		m.lc.Debug(fmt.Sprintf("Mapped second word address %v -> %s/%s", addr, idx.DeviceName, nr.Name))
+	}
+	return issues
+}
+
+// splitWordAddress returns the second word address of rm when it passed validation in UpdateMappings.
+// Caller must hold m.mu.
+func (m *MappingManager) splitWordAddress(rm *mqtt.ResourceMapping) (config.AddressKey, bool) {
+	second := rm.NorthResource.OtherParameters.Modbus.SecondWordAddress
+	if second == nil {
+		return 0, false
+	}
+	addr, ok := m.addressKey(rm.NorthResource.OtherParameters.Modbus.ObjectType, *second)
+	if !ok {
+		return 0, false
+	}
+	idx, ok := m.addressMappings[addr]
+	return addr, ok && idx.ResourceMapping == rm
+}
+
+// targetAddress returns the cache key of an additional target address.
+// Targets without an object type are keyed like untyped resource addresses.
+func (m *MappingManager) targetAddress(target mqtt.ModbusTarget) (config.AddressKey, error) {
+	if !config.ValidObjectType(target.ObjectType) {
+		return 0, fmt.Errorf("unknown object type %q", target.ObjectType)
+	}
+	addr, ok := m.addressKey(target.ObjectType, target.Address)
+	if !ok {
+		return 0, fmt.Errorf("address %d below the %s base offset", target.Address, target.ObjectType)
+	}
+	return addr, nil
+}
+
+// invalidAddress returns why the object type or address of a north resource cannot be mapped,
+// or "" when it can
+func (m *MappingManager) invalidAddress(nr *mqtt.NorthResource) string {
+	objectType := nr.OtherParameters.Modbus.ObjectType
+	if !config.ValidObjectType(objectType) {
+		return fmt.Sprintf("unknown object type %q", objectType)
+	}
+	if _, ok := m.addressKey(objectType, nr.OtherParameters.Modbus.Address); !ok {
+		return fmt.Sprintf("address below the %s base offset", objectType)
+	}
+	return ""
+}
+
+// cacheTargets caches entry at each target address of rm that passed validation in UpdateMappings.
+// A bool value at a register target is cached as uint16 0/1 so the register reads as bit 0 set or clear;
+// other values are cached unchanged. Caller must hold m.mu.
+func (m *MappingManager) cacheTargets(rm *mqtt.ResourceMapping, entry *CachedData) {
+	for _, t := range rm.NorthResource.OtherParameters.Modbus.Targets {
+		addr, err := m.targetAddress(t)
+		if err != nil {
+			continue
+		}
+		if idx, ok := m.addressMappings[addr]; !ok || idx.ResourceMapping != rm {
+			continue
+		}
+
+		target := *entry
+		target.ModbusAddress = addr
+		isRegister := t.ObjectType == config.ObjectHoldingRegister || t.ObjectType == config.ObjectInputRegister
+		if on, ok := coerceValue(entry.Value, "bool").(bool); ok && isRegister && strings.EqualFold(entry.ValueType, "bool") {
+			target.Value = uint16(0)
+			if on {
+				target.Value = uint16(1)
+			}
+			target.ValueType = "uint16"
+			target.Scale, target.Offset = 0, 0
+		}
+		m.cache.Set(addr, &target)
+		m.notifySubscribers(addr, &target)
+	}
+}
+
+// Stats returns the device, mapped and per-reason skip counts of the most recent accepted UpdateMappings call
+func (m *MappingManager) Stats() MappingStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := m.stats
+	stats.Skipped = make(map[SkipReason]int, len(m.stats.Skipped))
+	for reason, n := range m.stats.Skipped {
+		stats.Skipped[reason] = n
+	}
+	return stats
+}
+
+// MappingGeneration returns a counter that changes on every mapping update.
+// An odd value means an update is in progress; a reader that sees the same even
+// value before and after a sequence of lookups observed a single consistent mapping.
+func (m *MappingManager) MappingGeneration() uint64 {
+	return m.generation.Load()
+}
+
+// diffAddressMappings compares two address indexes and returns sorted added, removed and changed addresses
+func diffAddressMappings(oldMappings, newMappings map[config.AddressKey]*addressIndex) (added, removed, changed []config.AddressKey) {
+	for addr, newIdx := range newMappings {
+		oldIdx, ok := oldMappings[addr]
+		if !ok {
+			added = append(added, addr)
+		} else if !sameAddressIndex(oldIdx, newIdx) {
+			changed = append(changed, addr)
+		}
+	}
+	for addr := range oldMappings {
+		if _, ok := newMappings[addr]; !ok {
+			removed = append(removed, addr)
+		}
+	}
+
+	for _, addrs := range [][]config.AddressKey{added, removed, changed} {
+		sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	}
+	return added, removed, changed
+}
+
+// sameAddressIndex reports whether two address entries map to the same resource definition
+func sameAddressIndex(a, b *addressIndex) bool {
+	if a.DeviceName != b.DeviceName {
+		return false
+	}
+	an, bn := a.ResourceMapping.NorthResource, b.ResourceMapping.NorthResource
+	as, bs := a.ResourceMapping.SouthResource, b.ResourceMapping.SouthResource
+	return an.Name == bn.Name &&
+		an.ValueType == bn.ValueType &&
+		an.Scale == bn.Scale &&
+		an.OffsetValue == bn.OffsetValue &&
+		sameCalibration(an, bn) &&
+		as.Name == bs.Name &&
+		as.ReadWrite == bs.ReadWrite
+}
+
+// sameCalibration reports whether two resources use the same read and write calibration
+func sameCalibration(a, b *mqtt.NorthResource) bool {
+	ars, aro := a.ReadCalibration()
+	brs, bro := b.ReadCalibration()
+	aws, awo := a.WriteCalibration()
+	bws, bwo := b.WriteCalibration()
+	return ars == brs && aro == bro && aws == bws && awo == bwo
+}
+
 // GetMappingByAddress returns the resource mapping for a Modbus address
-func (m *MappingManager) GetMappingByAddress(addr uint16) (*mqtt.ResourceMapping, bool) {
+func (m *MappingManager) GetMappingByAddress(addr config.AddressKey) (*mqtt.ResourceMapping, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -182,6 +816,18 @@ func (m *MappingManager) GetMappingByAddress(addr uint16) (*mqtt.ResourceMapping
 	return idx.ResourceMapping, true
 }
 
+// GetDeviceNameByAddress returns the north device owning the resource at a Modbus address
+func (m *MappingManager) GetDeviceNameByAddress(addr config.AddressKey) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx, ok := m.addressMappings[addr]
+	if !ok {
+		return "", false
+	}
+	return idx.DeviceName, true
+}
+
 // GetDeviceMapping returns the device mapping by north device name
 func (m *MappingManager) GetDeviceMapping(northDeviceName string) (*mqtt.DeviceMapping, bool) {
 	m.mu.RLock()
@@ -191,16 +837,51 @@ func (m *MappingManager) GetDeviceMapping(northDeviceName string) (*mqtt.DeviceM
 	return dm, ok
 }
 
+// GetAddressByResource returns the Modbus address of a resource by north device and resource name
+func (m *MappingManager) GetAddressByResource(northDeviceName string, resourceName string) (config.AddressKey, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dm, ok := m.deviceMappings[northDeviceName]
+	if !ok {
+		return 0, false
+	}
+	for _, rm := range dm.Resources {
+		if rm.NorthResource == nil || rm.NorthResource.Name != resourceName {
+			continue
+		}
+		addr := m.resourceAddress(rm.NorthResource)
+		// Only report addresses that passed validation in UpdateMappings
+		if idx, ok := m.addressMappings[addr]; ok && idx.ResourceMapping == rm {
+			return addr, true
+		}
+	}
+	return 0, false
+}
+
 // UpdateCache updates the data cache from sensor data
 func (m *MappingManager) UpdateCache(northDevName string, data map[string]interface{}) error {
+	_, err := m.updateCache(northDevName, data)
+	return err
+}
+
+// updateCache updates the data cache and returns the number of data keys applied to a resource
+func (m *MappingManager) updateCache(northDevName string, data map[string]interface{}) (int, error) {
 	m.mu.RLock()
 	dm, ok := m.deviceMappings[northDevName]
 	m.mu.RUnlock()
 
 	if !ok {
-		return fmt.Errorf("unknown north device: %s", northDevName)
+		return 0, fmt.Errorf("unknown north device: %s", northDevName)
+	}
+	if !dm.IsEnabled() {
+		m.lc.Debug(fmt.Sprintf("Ignoring data for disabled device %s", northDevName))
+		return 0, nil
 	}
 
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	// Log incoming data keys for debugging
 	dataKeys := make([]string, 0, len(data))
 	for k := range data {
@@ -209,6 +890,7 @@ func (m *MappingManager) UpdateCache(northDevName string, data map[string]interf
 	m.lc.Debug(fmt.Sprintf("UpdateCache for device %s: incoming data keys=%v", northDevName, dataKeys))
 
 	updatedCount := 0
+	appliedKeys := make(map[string]bool)
 	for _, rm := range dm.Resources {
 		if rm.NorthResource == nil || rm.SouthResource == nil {
 			m.lc.Debug("Skipping resource: NorthResource or SouthResource is nil")
@@ -216,14 +898,16 @@ func (m *MappingManager) UpdateCache(northDevName string, data map[string]interf
 		}
 
 		// Log what we're looking for
-		m.lc.Debug(fmt.Sprintf("Looking for resource: southName=%s, northName=%s, modbusAddr=%d",
-			rm.SouthResource.Name, rm.NorthResource.Name, rm.NorthResource.OtherParameters.Modbus.Address))
+		m.lc.Debug(fmt.Sprintf("Looking for resource: southName=%s, northName=%s, modbusAddr=%v",
+			rm.SouthResource.Name, rm.NorthResource.Name, m.resourceAddress(rm.NorthResource)))
 
 		// Try to find the value by south resource name
-		val, ok := data[rm.SouthResource.Name]
+		key := rm.SouthResource.Name
+		val, ok := data[key]
 		if !ok {
 			// Also try north resource name
-			val, ok = data[rm.NorthResource.Name]
+			key = rm.NorthResource.Name
+			val, ok = data[key]
 			if !ok {
 				m.lc.Debug(fmt.Sprintf("No match found for resource: tried southName=%s and northName=%s",
 					rm.SouthResource.Name, rm.NorthResource.Name))
@@ -233,31 +917,252 @@ func (m *MappingManager) UpdateCache(northDevName string, data map[string]interf
 		} else {
 			m.lc.Debug(fmt.Sprintf("Matched by southName=%s, value=%v", rm.SouthResource.Name, val))
 		}
+		appliedKeys[key] = true
 
-		addr := rm.NorthResource.OtherParameters.Modbus.Address
-		m.cache.Set(addr, &CachedData{
+		addr := m.resourceAddress(rm.NorthResource)
+		if rm.NorthResource.ArrayLength > 0 {
+			updatedCount += m.cacheArray(northDevName, rm.NorthResource, addr, val)
+			continue
+		}
+		scale, offset := rm.NorthResource.ReadCalibration()
+		secondAddr, isSplit := m.splitWordAddress(rm)
+		entry := &CachedData{
 			Value:         val,
 			NorthDevName:  northDevName,
 			ResourceName:  rm.NorthResource.Name,
 			ValueType:     rm.NorthResource.ValueType,
-			Scale:         rm.NorthResource.Scale,
-			Offset:        rm.NorthResource.OffsetValue,
+			Scale:         scale,
+			Offset:        offset,
+			Unit:          rm.NorthResource.Unit,
+			Precision:     rm.NorthResource.Precision,
 			ModbusAddress: addr,
-		})
+
+			SignedFlagAddr: m.signedFlagAddress(rm.NorthResource),
+			SignedEncoding: rm.NorthResource.OtherParameters.Modbus.SignedEncoding,
+			WordOrder:      rm.NorthResource.OtherParameters.Modbus.WordOrder,
+			HoldLastValue:  rm.NorthResource.OtherParameters.Modbus.HoldLastValue,
+			MaxAge:         resourceMaxAge(rm.NorthResource),
+		}
+		if isSplit {
+			// Each address serves one word of the value: the first at the resource address, the second at secondAddr
+			entry.WordPart = 1
+			second := *entry
+			second.ModbusAddress = secondAddr
+			second.WordPart = 2
+			m.cache.Set(secondAddr, &second)
+			m.notifySubscribers(secondAddr, &second)
+		}
+		m.cache.Set(addr, entry)
+		m.notifySubscribers(addr, entry)
+		// Additional targets serve the same value, e.g. a coil and a holding register bit
+		m.cacheTargets(rm, entry)
 		updatedCount++
 	}
 
 	m.lc.Debug(fmt.Sprintf("Updated cache for device %s: %d values", northDevName, updatedCount))
-	return nil
+
+	if len(appliedKeys) < len(data) {
+		unmatched := make([]string, 0, len(data)-len(appliedKeys))
+		for k := range data {
+			if !appliedKeys[k] {
+				unmatched = append(unmatched, k)
+			}
+		}
+		sort.Strings(unmatched)
+		m.unmatchedKeys.Add(uint64(len(unmatched)))
+		if m.strictSensorKeys {
+			m.lc.Warn(fmt.Sprintf("Sensor data for device %s has %d keys matching no resource: %v",
+				northDevName, len(unmatched), unmatched))
+			return len(appliedKeys), fmt.Errorf("device %s: %d %w: %v", northDevName, len(unmatched), ErrUnmatchedSensorKeys, unmatched)
+		}
+	}
+	return len(appliedKeys), nil
+}
+
+// cacheArray stores each element of an array resource at consecutive Modbus addresses.
+// Elements are named "<resource>[i]" and advance by the register width of the element type.
+// Returns the number of elements cached.
+func (m *MappingManager) cacheArray(northDevName string, nr *mqtt.NorthResource, addr config.AddressKey, val interface{}) int {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		m.lc.Warn(fmt.Sprintf("Array resource %s/%s expects a list value, got %T", northDevName, nr.Name, val))
+		return 0
+	}
+
+	count := rv.Len()
+	if count != nr.ArrayLength {
+		m.lc.Warn(fmt.Sprintf("Array resource %s/%s expects %d elements, got %d",
+			northDevName, nr.Name, nr.ArrayLength, count))
+		if count > nr.ArrayLength {
+			count = nr.ArrayLength
+		}
+	}
+
+	width := registerWidth(nr.ValueType)
+	signedFlag := m.signedFlagAddress(nr)
+	scale, offset := nr.ReadCalibration()
+	for i := 0; i < count; i++ {
+		elemAddr, ok := addr.Add(i * int(width))
+		if !ok {
+			m.lc.Warn(fmt.Sprintf("Array resource %s/%s: element %d beyond the end of the address table", northDevName, nr.Name, i))
+			return i
+		}
+		entry := &CachedData{
+			Value:         rv.Index(i).Interface(),
+			NorthDevName:  northDevName,
+			ResourceName:  fmt.Sprintf("%s[%d]", nr.Name, i),
+			ValueType:     nr.ValueType,
+			Scale:         scale,
+			Offset:        offset,
+			Unit:          nr.Unit,
+			Precision:     nr.Precision,
+			ModbusAddress: elemAddr,
+
+			SignedFlagAddr: signedFlag,
+			SignedEncoding: nr.OtherParameters.Modbus.SignedEncoding,
+			WordOrder:      nr.OtherParameters.Modbus.WordOrder,
+			HoldLastValue:  nr.OtherParameters.Modbus.HoldLastValue,
+			MaxAge:         resourceMaxAge(nr),
+		}
+		m.cache.Set(elemAddr, entry)
+		m.notifySubscribers(elemAddr, entry)
+	}
+	return count
+}
+
+// Subscribe returns a channel that receives a copy of the cached data on each UpdateCache for addr.
+// Delivery is non-blocking: updates are dropped when the subscriber's buffer is full.
+func (m *MappingManager) Subscribe(addr config.AddressKey) <-chan CachedData {
+	ch := make(chan CachedData, subscriberBuffer)
+
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+	m.subscribers[addr] = append(m.subscribers[addr], ch)
+	return ch
+}
+
+// Unsubscribe removes a subscription created by Subscribe and closes its channel
+func (m *MappingManager) Unsubscribe(addr config.AddressKey, sub <-chan CachedData) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	subs := m.subscribers[addr]
+	for i, ch := range subs {
+		if ch == sub {
+			close(ch)
+			subs = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(subs) == 0 {
+		delete(m.subscribers, addr)
+	} else {
+		m.subscribers[addr] = subs
+	}
+}
+
+// notifySubscribers delivers an updated entry to the subscribers of addr without blocking
+func (m *MappingManager) notifySubscribers(addr config.AddressKey, data *CachedData) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	for _, ch := range m.subscribers[addr] {
+		select {
+		case ch <- *data:
+		default:
+			m.lc.Debug(fmt.Sprintf("Dropped update for address %v: subscriber buffer full", addr))
+		}
+	}
 }
 
 // GetCachedValue returns the cached value for a Modbus address
-func (m *MappingManager) GetCachedValue(addr uint16) (*CachedData, bool) {
+func (m *MappingManager) GetCachedValue(addr config.AddressKey) (*CachedData, bool) {
 	return m.cache.Get(addr)
 }
 
+// GetHistory returns up to n recent values written to addr, oldest first (n <= 0 returns all).
+// Returns nil when history is disabled or the address has no history.
+func (m *MappingManager) GetHistory(addr config.AddressKey, n int) []HistoryEntry {
+	return m.cache.GetHistory(addr, n)
+}
+
+// GetAllCachedValues returns all cached entries keyed by Modbus address, including expired ones
+func (m *MappingManager) GetAllCachedValues() map[config.AddressKey]*CachedData {
+	return m.cache.GetAll()
+}
+
+// ReadModifyWrite atomically reads the cached value at addr, applies fn and writes the result back
+// as a write-back entry, returning the value written. fn receives nil when there is no unexpired
+// cached value for the address; when fn fails the cache is left unchanged and its error is returned.
+func (m *MappingManager) ReadModifyWrite(addr config.AddressKey, fn func(old interface{}) (interface{}, error)) (interface{}, error) {
+	if fn == nil {
+		return nil, fmt.Errorf("read-modify-write on address %v: nil transform", addr)
+	}
+
+	m.mu.RLock()
+	idx, ok := m.addressMappings[addr]
+	var signedFlag *config.AddressKey
+	if ok {
+		signedFlag = m.signedFlagAddress(idx.ResourceMapping.NorthResource)
+	}
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no mapping for address %v", addr)
+	}
+
+	nr := idx.ResourceMapping.NorthResource
+	scale, offset := nr.ReadCalibration()
+	updated, err := m.cache.Modify(addr, &CachedData{
+		NorthDevName:  idx.DeviceName,
+		ResourceName:  nr.Name,
+		ValueType:     nr.ValueType,
+		Scale:         scale,
+		Offset:        offset,
+		Unit:          nr.Unit,
+		Precision:     nr.Precision,
+		ModbusAddress: addr,
+
+		SignedFlagAddr: signedFlag,
+		SignedEncoding: nr.OtherParameters.Modbus.SignedEncoding,
+		WordOrder:      nr.OtherParameters.Modbus.WordOrder,
+		HoldLastValue:  nr.OtherParameters.Modbus.HoldLastValue,
+		MaxAge:         resourceMaxAge(nr),
+	}, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	m.lc.Debug(fmt.Sprintf("Read-modify-write address %v -> %v", addr, updated.Value))
+	return updated.Value, nil
+}
+
+// GetCachedValueTyped returns the cached value for a Modbus address converted to its declared value type
+func (m *MappingManager) GetCachedValueTyped(addr config.AddressKey) (*TypedValue, bool) {
+	data, ok := m.cache.Get(addr)
+	if !ok {
+		return nil, false
+	}
+	return &TypedValue{
+		Value:     coerceValue(data.Value, data.ValueType),
+		ValueType: data.ValueType,
+		Scale:     data.Scale,
+		Offset:    data.Offset,
+		Unit:      data.Unit,
+		Precision: data.Precision,
+		Timestamp: data.Timestamp,
+		Stale:     data.Stale,
+	}, true
+}
+
+// GetCachedSnapshot returns copies of the cached values of addrs read under a single cache lock,
+// so a dashboard reading many addresses sees them as of one instant. Addresses without data are omitted.
+func (m *MappingManager) GetCachedSnapshot(addrs []config.AddressKey) map[config.AddressKey]*CachedData {
+	return m.cache.Snapshot(addrs)
+}
+
 // GetCachedRegisters reads multiple consecutive registers
-func (m *MappingManager) GetCachedRegisters(startAddr uint16, quantity uint16) ([]*CachedData, error) {
+func (m *MappingManager) GetCachedRegisters(startAddr config.AddressKey, quantity uint16) ([]*CachedData, error) {
 	return m.cache.GetRange(startAddr, quantity)
 }
 
@@ -272,12 +1177,37 @@ func (m *MappingManager) HandleSensorData(msg *mqtt.MQTTMessage) error {
 
 	// 只更新缓存，不立即记录转发日志
 	// 转发日志应该在Modbus客户端实际读取数据时才记录
-	return m.UpdateCache(payload.NorthDeviceName, payload.Data)
+	applied, err := m.updateCache(payload.NorthDeviceName, payload.Data)
+
+	m.mu.RLock()
+	ack := m.sensorDataAck
+	m.mu.RUnlock()
+	if ack {
+		m.publishSensorDataAck(msg.RequestID, payload.NorthDeviceName, applied, len(payload.Data)-applied, err)
+	}
+	return err
+}
+
+// publishSensorDataAck replies to a sensor data message with the applied/skipped counts
+func (m *MappingManager) publishSensorDataAck(requestID, northDevName string, applied, skipped int, updateErr error) {
+	code, text := 200, "OK"
+	if updateErr != nil {
+		code, text = 404, updateErr.Error()
+	}
+	resp := mqtt.NewResponse(requestID, mqtt.TypeSensorData, code, text, &mqtt.SensorDataAckPayload{
+		NorthDeviceName: northDevName,
+		Applied:         applied,
+		Skipped:         skipped,
+	})
+	if err := m.publishResponse(resp); err != nil {
+		m.lc.Warn(fmt.Sprintf("Failed to publish sensor data ack for %s: %s", requestID, err.Error()))
+	}
 }
 
 // LogDataForward 记录数据转发日志（当Modbus客户端读取数据时调用）
 // forwardedData: map[deviceName]map[resourceName]value
-func (m *MappingManager) LogDataForward(forwardedData map[string]map[string]interface{}) {
+// readTime: Modbus客户端实际读取数据的时间
+func (m *MappingManager) LogDataForward(forwardedData map[string]map[string]interface{}, readTime time.Time) {
 	if len(forwardedData) == 0 {
 		return
 	}
@@ -307,13 +1237,16 @@ func (m *MappingManager) LogDataForward(forwardedData map[string]map[string]inte
 			}
 		}
 		
-		handler.LogSuccess(primaryDevice, mergedData)
+		handler.LogSuccessAt(primaryDevice, mergedData, readTime)
 	}
 }
 
 // StartCleanup starts periodic cache cleanup
 func (m *MappingManager) StartCleanup() {
-	m.cache.StartPeriodicCleanup(m.config.GetCleanupInterval(), func(count int) {
+	m.requeryMu.Lock()
+	interval := m.config.GetCleanupInterval()
+	m.requeryMu.Unlock()
+	m.cache.StartPeriodicCleanup(interval, func(count int) {
 		m.lc.Debug(fmt.Sprintf("Cache cleanup: removed %d expired entries", count))
 	})
 	m.lc.Info("Cache cleanup started")
@@ -323,3 +1256,77 @@ func (m *MappingManager) StartCleanup() {
 func (m *MappingManager) Stop() {
 	m.cache.Stop()
 }
+
+// SaveSnapshot writes the unexpired cache entries to a snapshot file
+func (m *MappingManager) SaveSnapshot(path string) (int, error) {
+	return m.cache.SaveSnapshot(path)
+}
+
+// checkImportEntry reports why an imported cache entry does not match the resource mapped
+// at its address. Array element i is cached as "<resource>[i]" i register widths past the
+// resource address. Called with m.mu held.
+func (m *MappingManager) checkImportEntry(addr config.AddressKey, data *CachedData) error {
+	resourceName, element, isElement := strings.Cut(data.ResourceName, "[")
+	mapped := addr
+	if isElement {
+		i, err := strconv.Atoi(strings.TrimSuffix(element, "]"))
+		var inTable bool
+		if err == nil && i >= 0 {
+			mapped, inTable = addr.Add(-i * int(registerWidth(data.ValueType)))
+		}
+		if !inTable {
+			return fmt.Errorf("address %v: invalid array element %q", addr, data.ResourceName)
+		}
+	}
+
+	idx, ok := m.addressMappings[mapped]
+	if !ok {
+		return fmt.Errorf("address %v is not mapped", addr)
+	}
+	nr := idx.ResourceMapping.NorthResource
+	switch {
+	case idx.DeviceName != data.NorthDevName:
+		return fmt.Errorf("address %v: mapped to device %s, not %s", addr, idx.DeviceName, data.NorthDevName)
+	case nr.Name != resourceName || isElement != (nr.ArrayLength > 0):
+		return fmt.Errorf("address %v: mapped to resource %s/%s, not %s", addr, idx.DeviceName, nr.Name, data.ResourceName)
+	case nr.ValueType != data.ValueType:
+		return fmt.Errorf("address %v: resource %s/%s has value type %s, not %s", addr, idx.DeviceName, nr.Name, nr.ValueType, data.ValueType)
+	case isElement && int(addr.Addr()-mapped.Addr())/int(registerWidth(nr.ValueType)) >= nr.ArrayLength:
+		return fmt.Errorf("address %v: resource %s/%s has %d elements, not %s", addr, idx.DeviceName, nr.Name, nr.ArrayLength, data.ResourceName)
+	}
+	return nil
+}
+
+// LoadSnapshot restores cache entries from a snapshot file
+func (m *MappingManager) LoadSnapshot(path string) (int, error) {
+	return m.cache.LoadSnapshot(path)
+}
+
+// ExportCache returns the unexpired cache entries encoded in the snapshot format and their count
+func (m *MappingManager) ExportCache() ([]byte, int, error) {
+	return m.cache.ExportSnapshot()
+}
+
+// ImportCache restores cache entries from a snapshot-format payload.
+// Every entry must be at a currently mapped address and belong to the device and resource
+// mapped there, with the same value type; otherwise nothing is imported.
+// resetTTL restarts each entry's TTL from now instead of keeping the exported timestamps.
+func (m *MappingManager) ImportCache(payload []byte, resetTTL bool) (int, error) {
+	entries, err := decodeSnapshot(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.RLock()
+	for addr, data := range entries {
+		if err := m.checkImportEntry(addr, data); err != nil {
+			m.mu.RUnlock()
+			return 0, err
+		}
+	}
+	m.mu.RUnlock()
+
+	restored := m.cache.restore(entries, resetTTL)
+	m.lc.Info(fmt.Sprintf("Imported %d of %d cache entries", restored, len(entries)))
+	return restored, nil
+}
@@ -4,7 +4,13 @@ import (
 	"app-modbus-go/internal/pkg/config"
 	"app-modbus-go/internal/pkg/logger"
 	"app-modbus-go/internal/pkg/mqtt"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // MockForwardLogHandler for testing
@@ -13,6 +19,7 @@ type MockForwardLogHandler struct {
 	failureCalls int
 	lastDevice   string
 	lastData     map[string]interface{}
+	lastReadTime time.Time
 }
 
 func (m *MockForwardLogHandler) LogSuccess(northDeviceName string, data map[string]interface{}) {
@@ -21,12 +28,41 @@ func (m *MockForwardLogHandler) LogSuccess(northDeviceName string, data map[stri
 	m.lastData = data
 }
 
+func (m *MockForwardLogHandler) LogSuccessAt(northDeviceName string, data map[string]interface{}, readTime time.Time) {
+	m.LogSuccess(northDeviceName, data)
+	m.lastReadTime = readTime
+}
+
 func (m *MockForwardLogHandler) LogFailure(northDeviceName string, data map[string]interface{}) {
 	m.failureCalls++
 	m.lastDevice = northDeviceName
 	m.lastData = data
 }
 
+// captureLogger records Info messages for assertions
+type captureLogger struct {
+	logger.LoggingClient
+	mu    sync.Mutex
+	infos []string
+}
+
+func (c *captureLogger) Info(msg string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.infos = append(c.infos, msg)
+}
+
+func (c *captureLogger) findInfo(prefix string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, msg := range c.infos {
+		if strings.HasPrefix(msg, prefix) {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
 func createTestMappingManager(t *testing.T) (*MappingManager, *mqtt.ClientManager, logger.LoggingClient) {
 	lc := logger.NewClient("DEBUG")
 	mqttCfg := mqtt.ClientConfig{
@@ -146,6 +182,105 @@ func TestUpdateMappingsDuplicateAddress(t *testing.T) {
 	}
 }
 
+func TestUpdateMappingsExceedsMaxMappings(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+	mm.SetMaxMappings(2)
+
+	newResource := func(name string, addr uint16) *mqtt.ResourceMapping {
+		nr := &mqtt.NorthResource{Name: name}
+		nr.OtherParameters.Modbus.Address = addr
+		return &mqtt.ResourceMapping{
+			NorthResource: nr,
+			SouthResource: &mqtt.SouthResource{Name: name},
+		}
+	}
+
+	initial := []*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources:       []*mqtt.ResourceMapping{newResource("temperature", 1000)},
+		},
+	}
+	if err := mm.UpdateMappings(initial); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+
+	oversized := []*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device2",
+			Resources: []*mqtt.ResourceMapping{
+				newResource("a", 2000),
+				newResource("b", 2001),
+				newResource("c", 2002),
+			},
+		},
+	}
+	if err := mm.UpdateMappings(oversized); err == nil {
+		t.Fatal("expected oversized mapping update to be rejected")
+	}
+
+	if _, ok := mm.GetDeviceMapping("device1"); !ok {
+		t.Error("expected previous device mapping to be retained")
+	}
+	if _, ok := mm.GetDeviceMapping("device2"); ok {
+		t.Error("expected rejected device mapping not to be applied")
+	}
+	if _, ok := mm.GetMappingByAddress(1000); !ok {
+		t.Error("expected previous address mapping to be retained")
+	}
+}
+
+func TestUpdateMappingsLogsDiff(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+	lc := &captureLogger{LoggingClient: logger.NewClient("ERROR")}
+	mm.lc = lc
+
+	newResource := func(name, valueType string, addr uint16) *mqtt.ResourceMapping {
+		nr := &mqtt.NorthResource{Name: name, ValueType: valueType}
+		nr.OtherParameters.Modbus.Address = addr
+		return &mqtt.ResourceMapping{
+			NorthResource: nr,
+			SouthResource: &mqtt.SouthResource{Name: name, ValueType: valueType},
+		}
+	}
+
+	mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				newResource("temperature", "int16", 1000),
+				newResource("humidity", "int16", 1001),
+				newResource("pressure", "int16", 1002),
+			},
+		},
+	})
+
+	lc.mu.Lock()
+	lc.infos = nil
+	lc.mu.Unlock()
+
+	// Replace humidity with voltage, change pressure type, keep temperature
+	mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				newResource("temperature", "int16", 1000),
+				newResource("pressure", "float32", 1002),
+				newResource("voltage", "int16", 1003),
+			},
+		},
+	})
+
+	msg, ok := lc.findInfo("Mapping diff:")
+	if !ok {
+		t.Fatal("expected mapping diff to be logged at info level")
+	}
+	expected := "Mapping diff: added=[1003] removed=[1001] changed=[1002]"
+	if msg != expected {
+		t.Errorf("diff log = %q, want %q", msg, expected)
+	}
+}
+
 func TestGetMappingByAddress(t *testing.T) {
 	mm, _, _ := createTestMappingManager(t)
 
@@ -252,6 +387,268 @@ func TestUpdateCache(t *testing.T) {
 	}
 }
 
+func TestReadModifyWriteConcurrent(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+
+	nr := &mqtt.NorthResource{
+		Name:      "counter",
+		ValueType: "uint16",
+	}
+	nr.OtherParameters.Modbus.Address = 1000
+
+	mappings := []*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{
+					NorthResource: nr,
+					SouthResource: &mqtt.SouthResource{Name: "counter"},
+				},
+			},
+		},
+	}
+	mm.UpdateMappings(mappings)
+
+	increment := func(old interface{}) (interface{}, error) {
+		if v, ok := old.(int); ok {
+			return v + 1, nil
+		}
+		return 1, nil
+	}
+
+	const workers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := mm.ReadModifyWrite(1000, increment); err != nil {
+				t.Errorf("ReadModifyWrite failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cached, ok := mm.GetCachedValue(1000)
+	if !ok {
+		t.Fatal("expected cached value at address 1000")
+	}
+	if cached.Value != workers {
+		t.Errorf("expected value %d after concurrent RMW, got %v", workers, cached.Value)
+	}
+	if cached.NorthDevName != "device1" || cached.ResourceName != "counter" {
+		t.Errorf("unexpected metadata: device=%s resource=%s", cached.NorthDevName, cached.ResourceName)
+	}
+
+	if _, err := mm.ReadModifyWrite(9999, increment); err == nil {
+		t.Error("expected error for unmapped address")
+	}
+
+	// A failing transform leaves the cached value untouched
+	failing := func(interface{}) (interface{}, error) { return nil, fmt.Errorf("rejected") }
+	if _, err := mm.ReadModifyWrite(1000, failing); err == nil {
+		t.Error("expected transform error to be returned")
+	}
+	if cached, _ := mm.GetCachedValue(1000); cached.Value != workers {
+		t.Errorf("expected value %d after failed RMW, got %v", workers, cached.Value)
+	}
+	if value, err := mm.ReadModifyWrite(1000, increment); err != nil || value != workers+1 {
+		t.Errorf("expected RMW to return %d, got %v (err=%v)", workers+1, value, err)
+	}
+}
+
+func TestQueryDeviceAttributesDedup(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+
+	var (
+		mu        sync.Mutex
+		publishes int
+	)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mm.publishAndWait = func(msg *mqtt.MQTTMessage, timeout time.Duration) (*mqtt.MQTTResponse, error) {
+		mu.Lock()
+		publishes++
+		first := publishes == 1
+		mu.Unlock()
+		if first {
+			close(started)
+		}
+		<-release
+		return &mqtt.MQTTResponse{
+			Type:    mqtt.TypeQueryDevice,
+			Code:    200,
+			Payload: map[string]interface{}{"cmd": "0101", "result": []interface{}{}},
+		}, nil
+	}
+
+	const callers = 10
+	errs := make(chan error, callers)
+	var wg sync.WaitGroup
+	query := func() {
+		defer wg.Done()
+		errs <- mm.QueryDeviceAttributes()
+	}
+
+	wg.Add(1)
+	go query()
+	<-started
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go query()
+	}
+	// Give the remaining callers time to join the in-flight query
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("QueryDeviceAttributes failed: %v", err)
+		}
+	}
+	if publishes != 1 {
+		t.Errorf("expected 1 MQTT publish for %d concurrent queries, got %d", callers, publishes)
+	}
+
+	// A query after the shared one completes must publish again
+	mm.QueryDeviceAttributes()
+	if publishes != 2 {
+		t.Errorf("expected a fresh publish after completion, got %d publishes", publishes)
+	}
+}
+
+func TestSubscribeDeliversUpdates(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+
+	nr := &mqtt.NorthResource{Name: "temperature", ValueType: "float32"}
+	nr.OtherParameters.Modbus.Address = 1000
+	mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature"}},
+			},
+		},
+	})
+
+	sub := mm.Subscribe(1000)
+	other := mm.Subscribe(2000)
+
+	if err := mm.UpdateCache("device1", map[string]interface{}{"temperature": 25.5}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	select {
+	case data := <-sub:
+		if data.Value != 25.5 || data.ResourceName != "temperature" || data.ModbusAddress != 1000 {
+			t.Errorf("unexpected update: %+v", data)
+		}
+		if data.Timestamp.IsZero() {
+			t.Error("expected update to carry the cache timestamp")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected update on subscription channel")
+	}
+
+	select {
+	case data := <-other:
+		t.Errorf("unexpected update for unrelated address: %+v", data)
+	default:
+	}
+
+	// Updates beyond the buffer are dropped instead of blocking UpdateCache
+	for i := 0; i < subscriberBuffer+5; i++ {
+		mm.UpdateCache("device1", map[string]interface{}{"temperature": float64(i)})
+	}
+	if len(sub) != subscriberBuffer {
+		t.Errorf("expected full buffer of %d, got %d", subscriberBuffer, len(sub))
+	}
+
+	mm.Unsubscribe(1000, sub)
+	for range sub {
+	}
+	mm.UpdateCache("device1", map[string]interface{}{"temperature": 30.0})
+	if _, ok := <-sub; ok {
+		t.Error("expected closed channel after Unsubscribe")
+	}
+}
+
+func TestHandleSensorDataAck(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+	mm.SetSensorDataAck(true)
+
+	var acks []*mqtt.MQTTResponse
+	mm.publishResponse = func(resp *mqtt.MQTTResponse) error {
+		acks = append(acks, resp)
+		return nil
+	}
+
+	temp := &mqtt.NorthResource{Name: "temperature"}
+	temp.OtherParameters.Modbus.Address = 1000
+	hum := &mqtt.NorthResource{Name: "humidity"}
+	hum.OtherParameters.Modbus.Address = 1001
+	mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: temp, SouthResource: &mqtt.SouthResource{Name: "temp"}},
+				{NorthResource: hum, SouthResource: &mqtt.SouthResource{Name: "humidity"}},
+			},
+		},
+	})
+
+	msg := &mqtt.MQTTMessage{
+		RequestID: "req-42",
+		Type:      mqtt.TypeSensorData,
+		Payload: &mqtt.SensorDataPayload{
+			NorthDeviceName: "device1",
+			Data: map[string]interface{}{
+				"temp":     25.5,
+				"humidity": 60,
+				"pressure": 101.3,
+				"voltage":  3.3,
+			},
+		},
+	}
+	if err := mm.HandleSensorData(msg); err != nil {
+		t.Fatalf("HandleSensorData failed: %v", err)
+	}
+
+	if len(acks) != 1 {
+		t.Fatalf("expected 1 ack, got %d", len(acks))
+	}
+	ack := acks[0]
+	if ack.RequestID != "req-42" || ack.Type != mqtt.TypeSensorData || ack.Code != 200 {
+		t.Errorf("unexpected ack header: requestId=%s type=%d code=%d", ack.RequestID, ack.Type, ack.Code)
+	}
+	payload, ok := ack.Payload.(*mqtt.SensorDataAckPayload)
+	if !ok {
+		t.Fatalf("unexpected ack payload type %T", ack.Payload)
+	}
+	if payload.NorthDeviceName != "device1" || payload.Applied != 2 || payload.Skipped != 2 {
+		t.Errorf("ack payload = %+v, want device1 applied=2 skipped=2", payload)
+	}
+
+	// Unknown devices are acknowledged with every value skipped
+	msg.Payload = &mqtt.SensorDataPayload{NorthDeviceName: "ghost", Data: map[string]interface{}{"temp": 1}}
+	mm.HandleSensorData(msg)
+	if len(acks) != 2 {
+		t.Fatalf("expected 2 acks, got %d", len(acks))
+	}
+	if acks[1].Code != 404 || acks[1].Payload.(*mqtt.SensorDataAckPayload).Skipped != 1 {
+		t.Errorf("unexpected ack for unknown device: code=%d payload=%+v", acks[1].Code, acks[1].Payload)
+	}
+
+	// Disabled acks publish nothing
+	mm.SetSensorDataAck(false)
+	mm.HandleSensorData(msg)
+	if len(acks) != 2 {
+		t.Errorf("expected no ack when disabled, got %d acks", len(acks))
+	}
+}
+
 func TestUpdateCacheUnknownDevice(t *testing.T) {
 	mm, _, _ := createTestMappingManager(t)
 
@@ -265,6 +662,58 @@ func TestUpdateCacheUnknownDevice(t *testing.T) {
 	}
 }
 
+func TestUpdateMappingsDisabledDevice(t *testing.T) {
+	disabled := false
+	enabled := true
+	newDevice := func(name string, addr uint16, flag *bool) *mqtt.DeviceMapping {
+		nr := &mqtt.NorthResource{Name: "temp", ValueType: "int16", Scale: 1.0}
+		nr.OtherParameters.Modbus.Address = addr
+		return &mqtt.DeviceMapping{
+			NorthDeviceName: name,
+			Enabled:         flag,
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temp"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		flag       *bool
+		wantMapped bool
+	}{
+		{"flag absent", nil, true},
+		{"enabled", &enabled, true},
+		{"disabled", &disabled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mm, _, _ := createTestMappingManager(t)
+			mm.UpdateMappings([]*mqtt.DeviceMapping{newDevice("device1", 100, tt.flag)})
+
+			if _, ok := mm.GetMappingByAddress(100); ok != tt.wantMapped {
+				t.Errorf("address 100 mapped = %v, want %v", ok, tt.wantMapped)
+			}
+
+			if err := mm.UpdateCache("device1", map[string]interface{}{"temp": 7}); err != nil {
+				t.Fatalf("UpdateCache failed: %v", err)
+			}
+			if _, ok := mm.GetCachedValue(100); ok != tt.wantMapped {
+				t.Errorf("address 100 cached = %v, want %v", ok, tt.wantMapped)
+			}
+
+			wantSkipped := 0
+			if !tt.wantMapped {
+				wantSkipped = 1
+			}
+			if got := mm.Stats().Skipped[SkipDisabledDevice]; got != wantSkipped {
+				t.Errorf("Skipped[%s] = %d, want %d", SkipDisabledDevice, got, wantSkipped)
+			}
+		})
+	}
+}
+
 func TestHandleSensorDataWithHandler(t *testing.T) {
 	mm, _, _ := createTestMappingManager(t)
 	handler := &MockForwardLogHandler{}
@@ -372,3 +821,665 @@ func TestConcurrentMappingAccess(t *testing.T) {
 		<-done
 	}
 }
+
+func TestExportLayout(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+
+	setpoint := &mqtt.NorthResource{Name: "setpoint", ValueType: "int16", Scale: 0.1}
+	setpoint.OtherParameters.Modbus.Address = 10
+	voltage := &mqtt.NorthResource{Name: "voltage", ValueType: "float32", OffsetValue: -5}
+	voltage.OtherParameters.Modbus.Address = 0
+	energy := &mqtt.NorthResource{Name: "energy", ValueType: "uint64"}
+	energy.OtherParameters.Modbus.Address = 2
+	phases := &mqtt.NorthResource{Name: "phases", ValueType: "float32", ArrayLength: 3}
+	phases.OtherParameters.Modbus.Address = 20
+	label := &mqtt.NorthResource{Name: "label", ValueType: "string"}
+	label.OtherParameters.Modbus.Address = 30
+	label.OtherParameters.Modbus.StringLength = 8
+
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "meter1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: setpoint, SouthResource: &mqtt.SouthResource{Name: "setpoint", ReadWrite: "RW"}},
+				{NorthResource: voltage, SouthResource: &mqtt.SouthResource{Name: "voltage", ReadWrite: "R"}},
+				{NorthResource: energy, SouthResource: &mqtt.SouthResource{Name: "energy", ReadWrite: "R"}},
+				{NorthResource: phases, SouthResource: &mqtt.SouthResource{Name: "phases", ReadWrite: "R"}},
+				{NorthResource: label, SouthResource: &mqtt.SouthResource{Name: "label", ReadWrite: "RW"}},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+
+	want := []RegisterLayoutEntry{
+		{Address: 0, RegisterCount: 2, Device: "meter1", Resource: "voltage", ValueType: "float32", Offset: -5, ReadWrite: "R"},
+		{Address: 2, RegisterCount: 4, Device: "meter1", Resource: "energy", ValueType: "uint64", ReadWrite: "R"},
+		{Address: 10, RegisterCount: 1, Device: "meter1", Resource: "setpoint", ValueType: "int16", Scale: 0.1, ReadWrite: "RW"},
+		{Address: 20, RegisterCount: 6, Device: "meter1", Resource: "phases", ValueType: "float32", ReadWrite: "R"},
+		{Address: 30, RegisterCount: 8, Device: "meter1", Resource: "label", ValueType: "string", ReadWrite: "RW"},
+	}
+
+	got := mm.ExportLayout()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d layout entries, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestValuesEqual(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      interface{}
+		tolerance float64
+		want      bool
+	}{
+		{"float within tolerance", 25.5, 25.500001, 0.001, true},
+		{"float beyond tolerance", 25.5, 25.6, 0.001, false},
+		{"float exact without tolerance", 25.5, 25.5, 0, true},
+		{"float32 vs float64 within tolerance", float32(25.5), 25.500001, 0.001, true},
+		{"int vs float", 42, 42.0, 0, true},
+		{"int16 vs uint32", int16(7), uint32(7), 0, true},
+		{"int vs different float", 42, 42.5, 0.1, false},
+		{"numeric string vs float", "25.5", 25.5, 0, true},
+		{"string equal", "on", "on", 0, true},
+		{"string different", "on", "off", 0, false},
+		{"string vs number", "on", 1, 0, false},
+		{"bool equal", true, true, 0, true},
+		{"bool different", true, false, 0, false},
+		{"bool vs command string", true, "true", 0, true},
+		{"bool vs different string", false, "true", 0, false},
+		{"bool vs number", true, 1, 0, false},
+		{"both nil", nil, nil, 0, true},
+		{"nil vs value", nil, 0, 0, false},
+		{"NaN vs NaN", math.NaN(), math.NaN(), 0, true},
+		{"NaN vs number", math.NaN(), 1.0, 1, false},
+		{"negative tolerance", 1.0, 1.0000001, -1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValuesEqual(tt.a, tt.b, tt.tolerance); got != tt.want {
+				t.Errorf("ValuesEqual(%v, %v, %v) = %v, want %v", tt.a, tt.b, tt.tolerance, got, tt.want)
+			}
+			if got := ValuesEqual(tt.b, tt.a, tt.tolerance); got != tt.want {
+				t.Errorf("ValuesEqual(%v, %v, %v) = %v, want %v (reversed)", tt.b, tt.a, tt.tolerance, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMappingStatsSkipReasons(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+
+	first := &mqtt.NorthResource{Name: "first"}
+	first.OtherParameters.Modbus.Address = 100
+	duplicate := &mqtt.NorthResource{Name: "duplicate"}
+	duplicate.OtherParameters.Modbus.Address = 100
+	noSouth := &mqtt.NorthResource{Name: "noSouth"}
+	noSouth.OtherParameters.Modbus.Address = 101
+	second := &mqtt.NorthResource{Name: "second"}
+	second.OtherParameters.Modbus.Address = 102
+
+	mappings := []*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: first, SouthResource: &mqtt.SouthResource{Name: "first"}},
+				{NorthResource: duplicate, SouthResource: &mqtt.SouthResource{Name: "duplicate"}},
+				{NorthResource: noSouth},
+				{SouthResource: &mqtt.SouthResource{Name: "noNorth"}},
+			},
+		},
+		{
+			NorthDeviceName: "device2",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: second, SouthResource: &mqtt.SouthResource{Name: "second"}},
+				{SouthResource: &mqtt.SouthResource{Name: "noNorth"}},
+			},
+		},
+	}
+	if err := mm.UpdateMappings(mappings); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+
+	stats := mm.Stats()
+	if stats.Devices != 2 {
+		t.Errorf("Devices = %d, want 2", stats.Devices)
+	}
+	if stats.Mapped != 2 {
+		t.Errorf("Mapped = %d, want 2", stats.Mapped)
+	}
+
+	tests := []struct {
+		reason SkipReason
+		want   int
+	}{
+		{SkipNilNorthResource, 2},
+		{SkipNilSouthResource, 1},
+		{SkipDuplicateAddress, 1},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.reason), func(t *testing.T) {
+			if got := stats.Skipped[tt.reason]; got != tt.want {
+				t.Errorf("Skipped[%s] = %d, want %d", tt.reason, got, tt.want)
+			}
+		})
+	}
+	if stats.TotalSkipped() != 4 {
+		t.Errorf("TotalSkipped = %d, want 4", stats.TotalSkipped())
+	}
+
+	// Stats returns a copy that callers cannot use to mutate the manager
+	stats.Skipped[SkipDuplicateAddress] = 99
+	if got := mm.Stats().Skipped[SkipDuplicateAddress]; got != 1 {
+		t.Errorf("Stats copy mutated manager state: got %d", got)
+	}
+}
+
+func TestUpdateCacheStrictSensorKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		strict  bool
+		wantErr bool
+	}{
+		{"lenient ignores unmatched keys", false, false},
+		{"strict reports unmatched keys", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mm, _, _ := createTestMappingManager(t)
+			mm.SetStrictSensorKeys(tt.strict)
+
+			nr := &mqtt.NorthResource{Name: "temperature", ValueType: "float32"}
+			nr.OtherParameters.Modbus.Address = 100
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{
+				{
+					NorthDeviceName: "device1",
+					Resources: []*mqtt.ResourceMapping{
+						{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature"}},
+					},
+				},
+			}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+
+			err := mm.UpdateCache("device1", map[string]interface{}{"temperature": 21.5, "temp_renamed": 22.0})
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnmatchedSensorKeys) {
+					t.Fatalf("expected ErrUnmatchedSensorKeys, got %v", err)
+				}
+				if !strings.Contains(err.Error(), "temp_renamed") {
+					t.Errorf("expected error to name the unmatched key, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Matched keys are applied in both modes
+			data, ok := mm.GetCachedValue(100)
+			if !ok || data.Value != 21.5 {
+				t.Errorf("expected matched value 21.5 to be cached, got %+v", data)
+			}
+			if got := mm.UnmatchedKeyCount(); got != 1 {
+				t.Errorf("UnmatchedKeyCount = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestUpdateMappingsUnknownValueType(t *testing.T) {
+	tests := []struct {
+		name       string
+		skip       bool
+		wantMapped bool
+	}{
+		{"warn only", false, true},
+		{"skip unknown", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mm, _, _ := createTestMappingManager(t)
+			mm.SetSkipUnknownValueTypes(tt.skip)
+
+			var resources []*mqtt.ResourceMapping
+			for i, valueType := range []string{"nonsense", "Float32", "", "string"} {
+				name := fmt.Sprintf("r%d", i)
+				nr := &mqtt.NorthResource{Name: name, ValueType: valueType}
+				nr.OtherParameters.Modbus.Address = uint16(100 + 10*i)
+				resources = append(resources, &mqtt.ResourceMapping{
+					NorthResource: nr,
+					SouthResource: &mqtt.SouthResource{Name: name, ValueType: valueType},
+				})
+			}
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{NorthDeviceName: "device1", Resources: resources}}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+
+			if _, ok := mm.GetMappingByAddress(100); ok != tt.wantMapped {
+				t.Errorf("nonsense resource mapped = %v, want %v", ok, tt.wantMapped)
+			}
+			for _, addr := range []config.AddressKey{110, 120, 130} {
+				if _, ok := mm.GetMappingByAddress(addr); !ok {
+					t.Errorf("known type at address %d not mapped", addr)
+				}
+			}
+
+			var flagged []MappingIssue
+			for _, issue := range mm.MappingIssues() {
+				if issue.Kind == IssueUnknownValueType {
+					flagged = append(flagged, issue)
+				}
+			}
+			if len(flagged) != 1 || flagged[0].Address != 100 || flagged[0].Resource != "r0" {
+				t.Errorf("unknown value type issues = %+v, want one for r0 at 100", flagged)
+			}
+
+			wantSkipped := 0
+			if tt.skip {
+				wantSkipped = 1
+			}
+			if got := mm.Stats().Skipped[SkipUnknownValueType]; got != wantSkipped {
+				t.Errorf("skipped unknown value types = %d, want %d", got, wantSkipped)
+			}
+		})
+	}
+}
+
+func TestMaxAgeRequery(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+	mm.config.RequeryInterval = "1h"
+	mm.config.RequeryEnabled = true
+
+	type call struct{ device, resource string }
+	calls := make(chan call, 4)
+	mm.SetRequeryFunc(func(northDeviceName, resourceName string) error {
+		calls <- call{northDeviceName, resourceName}
+		return nil
+	})
+
+	setpoint := &mqtt.NorthResource{Name: "setpoint", ValueType: "int16"}
+	setpoint.OtherParameters.Modbus.Address = 100
+	setpoint.OtherParameters.Modbus.MaxAge = "20ms"
+	plain := &mqtt.NorthResource{Name: "plain", ValueType: "int16"}
+	plain.OtherParameters.Modbus.Address = 101
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: setpoint, SouthResource: &mqtt.SouthResource{Name: "setpoint"}},
+			{NorthResource: plain, SouthResource: &mqtt.SouthResource{Name: "plain"}},
+		},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if err := mm.UpdateCache("device1", map[string]interface{}{"setpoint": 42, "plain": 7}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	// Within maxAge: fresh value, no re-query
+	if cached, ok := mm.GetCachedValue(100); !ok || cached.Stale {
+		t.Fatalf("fresh read = %+v, want unflagged value", cached)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	cached, ok := mm.GetCachedValue(100)
+	if !ok || cached.Value != 42 || !cached.Stale {
+		t.Fatalf("over-age read = %+v, want stale-flagged 42", cached)
+	}
+	select {
+	case c := <-calls:
+		if c != (call{"device1", "setpoint"}) {
+			t.Errorf("re-query = %+v, want device1/setpoint", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("over-age read did not trigger a re-query")
+	}
+
+	// Rate-limited: further over-age reads and resources without maxAge do not re-query
+	if _, err := mm.GetCachedRegisters(100, 2); err != nil {
+		t.Fatalf("GetCachedRegisters failed: %v", err)
+	}
+	if cached, _ := mm.GetCachedValue(101); cached.Stale {
+		t.Errorf("resource without maxAge flagged stale")
+	}
+	select {
+	case c := <-calls:
+		t.Errorf("unexpected re-query %+v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMaxAgeRequeryDisabled(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+
+	calls := make(chan string, 1)
+	mm.SetRequeryFunc(func(northDeviceName, resourceName string) error {
+		calls <- resourceName
+		return nil
+	})
+
+	setpoint := &mqtt.NorthResource{Name: "setpoint", ValueType: "int16"}
+	setpoint.OtherParameters.Modbus.Address = 100
+	setpoint.OtherParameters.Modbus.MaxAge = "10ms"
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources:       []*mqtt.ResourceMapping{{NorthResource: setpoint, SouthResource: &mqtt.SouthResource{Name: "setpoint"}}},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if err := mm.UpdateCache("device1", map[string]interface{}{"setpoint": 42}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	// maxAge alone flags the value stale; the re-query needs Cache.RequeryEnabled
+	time.Sleep(30 * time.Millisecond)
+	if cached, ok := mm.GetCachedValue(100); !ok || !cached.Stale {
+		t.Fatalf("over-age read = %+v, want stale-flagged value", cached)
+	}
+	select {
+	case r := <-calls:
+		t.Errorf("unexpected re-query of %s with RequeryEnabled unset", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestUpdateCacheTargets(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+
+	pump := &mqtt.NorthResource{Name: "pumpRunning", ValueType: "bool"}
+	pump.OtherParameters.Modbus.Address = 1
+	pump.OtherParameters.Modbus.Targets = []mqtt.ModbusTarget{
+		{ObjectType: "HoldingRegister", Address: 100},
+		{ObjectType: "HoldingRegister", Address: 200}, // taken by level
+		{ObjectType: "Register", Address: 300},
+	}
+	level := &mqtt.NorthResource{Name: "level", ValueType: "uint16"}
+	level.OtherParameters.Modbus.Address = 200
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: pump, SouthResource: &mqtt.SouthResource{Name: "pumpRunning"}},
+			{NorthResource: level, SouthResource: &mqtt.SouthResource{Name: "level"}},
+		},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+
+	if rm, ok := mm.GetMappingByAddress(100); !ok || rm.NorthResource != pump {
+		t.Fatalf("target address 100 not mapped to pumpRunning")
+	}
+	if rm, _ := mm.GetMappingByAddress(200); rm.NorthResource != level {
+		t.Errorf("target must not displace the resource mapped at 200")
+	}
+	var flagged int
+	for _, issue := range mm.MappingIssues() {
+		if issue.Kind == IssueInvalidTarget {
+			flagged++
+		}
+	}
+	if flagged != 2 {
+		t.Errorf("invalid target issues = %d, want 2", flagged)
+	}
+
+	if err := mm.UpdateCache("device1", map[string]interface{}{"pumpRunning": true}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+	// The register target carries the bool as bit 0
+	for addr, want := range map[config.AddressKey]interface{}{1: true, 100: uint16(1)} {
+		cached, ok := mm.GetCachedValue(addr)
+		if !ok || cached.Value != want || cached.ModbusAddress != addr {
+			t.Errorf("address %d cached = %+v, want %v", addr, cached, want)
+		}
+	}
+	if cached, ok := mm.GetCachedValue(200); ok {
+		t.Errorf("address 200 should not receive the pump value, got %+v", cached)
+	}
+}
+
+func TestDefaultValue(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+	clock := newFakeClock()
+	mm.cache = NewCacheWithClock(30*time.Second, clock)
+
+	setpoint := &mqtt.NorthResource{Name: "setpoint", ValueType: "float32"}
+	setpoint.OtherParameters.Modbus.Address = 10
+	setpoint.OtherParameters.Modbus.DefaultValue = 21.5
+	level := &mqtt.NorthResource{Name: "level", ValueType: "uint16"}
+	level.OtherParameters.Modbus.Address = 11
+	mappings := []*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: setpoint, SouthResource: &mqtt.SouthResource{Name: "setpoint"}},
+			{NorthResource: level, SouthResource: &mqtt.SouthResource{Name: "level"}},
+		},
+	}}
+	if err := mm.UpdateMappings(mappings); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+
+	// The default is served before any data arrives and does not expire
+	clock.Advance(time.Hour)
+	cached, ok := mm.GetCachedValue(10)
+	if !ok || cached.Value != 21.5 || !cached.Default {
+		t.Fatalf("address 10 cached = %+v, want default 21.5", cached)
+	}
+	if cached, ok := mm.GetCachedValue(11); ok {
+		t.Errorf("address 11 has no default, got %+v", cached)
+	}
+
+	// The first real update replaces the default
+	if err := mm.UpdateCache("device1", map[string]interface{}{"setpoint": 23.0}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+	cached, ok = mm.GetCachedValue(10)
+	if !ok || cached.Value != 23.0 || cached.Default {
+		t.Fatalf("address 10 cached = %+v, want real value 23", cached)
+	}
+
+	// Reloading the mappings must not put the default back over real data
+	if err := mm.UpdateMappings(mappings); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if cached, ok := mm.GetCachedValue(10); !ok || cached.Value != 23.0 {
+		t.Errorf("address 10 cached = %+v after reload, want real value 23", cached)
+	}
+
+	// Real data expires like any other value instead of falling back to the default
+	clock.Advance(time.Minute)
+	if cached, ok := mm.GetCachedValue(10); ok {
+		t.Errorf("expired real value should not be served, got %+v", cached)
+	}
+}
+
+func TestDefaultValueRemap(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+
+	resource := func(name string, addr uint16, def interface{}) *mqtt.ResourceMapping {
+		nr := &mqtt.NorthResource{Name: name, ValueType: "uint16"}
+		nr.OtherParameters.Modbus.Address = addr
+		nr.OtherParameters.Modbus.DefaultValue = def
+		return &mqtt.ResourceMapping{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: name}}
+	}
+	load := func(resources ...*mqtt.ResourceMapping) {
+		t.Helper()
+		if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{NorthDeviceName: "device1", Resources: resources}}); err != nil {
+			t.Fatalf("UpdateMappings failed: %v", err)
+		}
+	}
+
+	load(resource("setpoint", 10, 50), resource("limit", 11, 80), resource("mode", 12, 1))
+	if err := mm.UpdateCache("device1", map[string]interface{}{"mode": 3}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	// setpoint keeps its default, limit loses it, mode moves and is no longer mapped at 12
+	load(resource("setpoint", 10, 50), resource("limit", 11, nil), resource("mode", 13, 1))
+
+	tests := []struct {
+		addr      config.AddressKey
+		wantFound bool
+		want      interface{}
+	}{
+		{10, true, 50},
+		{11, false, nil},
+		{12, true, 3}, // real data is never removed by a remap
+		{13, true, 1},
+	}
+	for _, tt := range tests {
+		cached, ok := mm.GetCachedValue(tt.addr)
+		if ok != tt.wantFound || (ok && cached.Value != tt.want) {
+			t.Errorf("address %d cached = %+v (found=%v), want %v (found=%v)", tt.addr, cached, ok, tt.want, tt.wantFound)
+		}
+	}
+}
+
+func TestParseReadWrite(t *testing.T) {
+	tests := []struct {
+		readWrite    string
+		want         AccessMode
+		wantOK       bool
+		wantWritable bool
+	}{
+		{"R", AccessRead, true, false},
+		{"RO", AccessRead, true, false},
+		{"read", AccessRead, true, false},
+		{"Read-Only", AccessRead, true, false},
+		{"rw", AccessReadWrite, true, true},
+		{"R/W", AccessReadWrite, true, true},
+		{"W", AccessWrite, true, true},
+		{"", AccessReadWrite, true, true},
+		{"maybe", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.readWrite, func(t *testing.T) {
+			got, ok := ParseReadWrite(tt.readWrite)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ParseReadWrite(%q) = %q, %v, want %q, %v", tt.readWrite, got, ok, tt.want, tt.wantOK)
+			}
+			if w := Writable(tt.readWrite); w != tt.wantWritable {
+				t.Errorf("Writable(%q) = %v, want %v", tt.readWrite, w, tt.wantWritable)
+			}
+		})
+	}
+}
+
+func TestUpdateMappingsUnknownReadWrite(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+
+	var resources []*mqtt.ResourceMapping
+	for i, rw := range []string{"RO", "sometimes", "", "rw"} {
+		name := fmt.Sprintf("r%d", i)
+		nr := &mqtt.NorthResource{Name: name, ValueType: "int16"}
+		nr.OtherParameters.Modbus.Address = uint16(100 + i)
+		resources = append(resources, &mqtt.ResourceMapping{
+			NorthResource: nr,
+			SouthResource: &mqtt.SouthResource{Name: name, ValueType: "int16", ReadWrite: rw},
+		})
+	}
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{NorthDeviceName: "device1", Resources: resources}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+
+	if _, ok := mm.GetMappingByAddress(101); !ok {
+		t.Error("resource with unknown readWrite should still be mapped")
+	}
+	var flagged []MappingIssue
+	for _, issue := range mm.MappingIssues() {
+		if issue.Kind == IssueUnknownReadWrite {
+			flagged = append(flagged, issue)
+		}
+	}
+	if len(flagged) != 1 || flagged[0].Address != 101 || flagged[0].Resource != "r1" {
+		t.Errorf("unknown readWrite issues = %+v, want one for r1 at 101", flagged)
+	}
+}
+
+func TestParseQFormat(t *testing.T) {
+	tests := []struct {
+		valueType string
+		want      QFormat
+		wantOK    bool
+	}{
+		{"q15", QFormat{Bits: 16, FracBits: 15}, true},
+		{"Q31", QFormat{Bits: 32, FracBits: 31}, true},
+		{"q16.16", QFormat{Bits: 32, FracBits: 16}, true},
+		{"q8.8", QFormat{Bits: 16, FracBits: 8}, true},
+		{"q32.32", QFormat{Bits: 64, FracBits: 32}, true},
+		{"q16", QFormat{}, false},    // 17 bits
+		{"q12.12", QFormat{}, false}, // 24 bits
+		{"q0.16", QFormat{}, false},  // no sign bit
+		{"q", QFormat{}, false},
+		{"qword", QFormat{}, false},
+		{"int16", QFormat{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseQFormat(tt.valueType)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("ParseQFormat(%q) = %+v, %v, want %+v, %v", tt.valueType, got, ok, tt.want, tt.wantOK)
+		}
+		if KnownValueType(tt.valueType) != (tt.wantOK || tt.valueType == "int16") {
+			t.Errorf("KnownValueType(%q) = %v", tt.valueType, KnownValueType(tt.valueType))
+		}
+		if tt.wantOK && registerWidth(tt.valueType) != uint16(tt.want.Bits/16) {
+			t.Errorf("registerWidth(%q) = %d, want %d", tt.valueType, registerWidth(tt.valueType), tt.want.Bits/16)
+		}
+	}
+}
+
+func TestImportCacheValidation(t *testing.T) {
+	mm, _, _ := createTestMappingManager(t)
+	temp := &mqtt.NorthResource{Name: "temperature", ValueType: "float32"}
+	temp.OtherParameters.Modbus.Address = 100
+	levels := &mqtt.NorthResource{Name: "levels", ValueType: "uint16", ArrayLength: 2}
+	levels.OtherParameters.Modbus.Address = 200
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{NorthDeviceName: "device1", Resources: []*mqtt.ResourceMapping{
+			{NorthResource: temp, SouthResource: &mqtt.SouthResource{Name: "temperature"}},
+			{NorthResource: levels, SouthResource: &mqtt.SouthResource{Name: "levels"}},
+		}},
+		{NorthDeviceName: "device2"},
+	}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		wantErr string
+	}{
+		{"unmapped address", `{"300":{"Value":1,"NorthDevName":"device1","ResourceName":"temperature","ValueType":"float32"}}`, "not mapped"},
+		{"other device", `{"100":{"Value":1,"NorthDevName":"device2","ResourceName":"temperature","ValueType":"float32"}}`, "device device1"},
+		{"other resource", `{"100":{"Value":1,"NorthDevName":"device1","ResourceName":"humidity","ValueType":"float32"}}`, "resource device1/temperature"},
+		{"other value type", `{"100":{"Value":1,"NorthDevName":"device1","ResourceName":"temperature","ValueType":"int16"}}`, "value type float32"},
+		{"element past array", `{"202":{"Value":1,"NorthDevName":"device1","ResourceName":"levels[2]","ValueType":"uint16"}}`, "has 2 elements"},
+		{"array without element", `{"200":{"Value":1,"NorthDevName":"device1","ResourceName":"levels","ValueType":"uint16"}}`, "resource device1/levels"},
+		{"valid", `{"100":{"Value":1.5,"NorthDevName":"device1","ResourceName":"temperature","ValueType":"float32"},` +
+			`"201":{"Value":7,"NorthDevName":"device1","ResourceName":"levels[1]","ValueType":"uint16"}}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := mm.ImportCache([]byte(tt.payload), true)
+			if tt.wantErr == "" {
+				if err != nil || n != 2 {
+					t.Fatalf("ImportCache = %d, %v, want 2 entries", n, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ImportCache error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if _, ok := mm.GetCachedValue(100); ok {
+				t.Error("rejected import must not touch the cache")
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package mappingmanager
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ExportSnapshot 将未过期的缓存数据编码为快照JSON，返回数据和条目数
+func (c *Cache) ExportSnapshot() ([]byte, int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.clock.Now()
+	entries := make(map[config.AddressKey]*CachedData, len(c.data))
+	for addr, data := range c.data {
+		if !data.IsExpiredAt(now) {
+			entries[addr] = data
+		}
+	}
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to encode cache snapshot: %w", err)
+	}
+	return payload, len(entries), nil
+}
+
+// SaveSnapshot 将未过期的缓存数据以JSON格式写入文件
+// 先写入临时文件再重命名，避免中断时留下不完整的快照
+func (c *Cache) SaveSnapshot(path string) (int, error) {
+	payload, count, err := c.ExportSnapshot()
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create cache snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(payload); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write cache snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write cache snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("failed to replace cache snapshot: %w", err)
+	}
+	return count, nil
+}
+
+// LoadSnapshot 从快照文件恢复缓存数据，保留原始时间戳，已过期的条目被忽略
+func (c *Cache) LoadSnapshot(path string) (int, error) {
+	payload, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := decodeSnapshot(payload)
+	if err != nil {
+		return 0, err
+	}
+	return c.restore(entries, false), nil
+}
+
+// decodeSnapshot 解析快照JSON，空条目被丢弃
+func decodeSnapshot(payload []byte) (map[config.AddressKey]*CachedData, error) {
+	var entries map[config.AddressKey]*CachedData
+	if err := json.Unmarshal(payload, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode cache snapshot: %w", err)
+	}
+	for addr, data := range entries {
+		if data == nil {
+			delete(entries, addr)
+		}
+	}
+	return entries, nil
+}
+
+// restore 将快照条目写入缓存，返回恢复的条目数
+// resetTTL 为true时以当前时间重新开始计算TTL并清除过期标记，否则保留原始时间戳并忽略已过期的条目
+func (c *Cache) restore(entries map[config.AddressKey]*CachedData, resetTTL bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	restored := 0
+	for addr, data := range entries {
+		if resetTTL {
+			data.Timestamp = now
+			data.Stale = false
+		} else if data.IsExpiredAt(now) {
+			continue
+		}
+		c.data[addr] = data
+		restored++
+	}
+	if len(c.data) > c.peakSize {
+		c.peakSize = len(c.data)
+	}
+	return restored
+}
@@ -0,0 +1,274 @@
+package mappingmanager
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypedValue 表示按资源声明类型转换后的缓存值
+type TypedValue struct {
+	Value     interface{} // 按ValueType转换后的值
+	ValueType string      // 资源声明的数据类型
+	Scale     float64
+	Offset    float64
+	Unit      string    // 工程单位
+	Precision *int      // 浮点值输出的小数位数（nil表示使用全局配置）
+	Timestamp time.Time // 数据被缓存的时间
+	Stale     bool      // 已过期但仍在宽限期内
+}
+
+// Age 返回缓存值距今的时长
+func (v *TypedValue) Age() time.Duration {
+	return time.Since(v.Timestamp)
+}
+
+// ResolvePrecision 返回生效的小数位数：资源配置优先，其次全局配置，均未配置时返回-1（不限制）
+func ResolvePrecision(resource *int, global *int) int {
+	if resource != nil && *resource >= 0 {
+		return *resource
+	}
+	if global != nil && *global >= 0 {
+		return *global
+	}
+	return -1
+}
+
+// FormatValue 将值格式化为字符串，precision>=0时浮点值以固定小数位数输出（不使用科学计数法）
+func FormatValue(v interface{}, precision int) string {
+	switch f := v.(type) {
+	case float64:
+		return strconv.FormatFloat(f, 'f', precision, 64)
+	case float32:
+		return strconv.FormatFloat(float64(f), 'f', precision, 32)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// RoundValue 将浮点值四舍五入到precision位小数，precision<0或非浮点值原样返回
+func RoundValue(v interface{}, precision int) interface{} {
+	if precision < 0 {
+		return v
+	}
+	var f float64
+	switch n := v.(type) {
+	case float64:
+		f = n
+	case float32:
+		f = float64(n)
+	default:
+		return v
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return v
+	}
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(f, 'f', precision, 64), 64)
+	if err != nil {
+		return v
+	}
+	return rounded
+}
+
+// QFormat 描述有符号定点数（Q格式）的总位数和小数位数，值 = 原始整数 / 2^FracBits
+type QFormat struct {
+	Bits     uint // 总位数（含符号位）：16、32或64，即整数个寄存器
+	FracBits uint // 小数位数
+}
+
+// Scale 返回 2^FracBits
+func (q QFormat) Scale() float64 {
+	return math.Ldexp(1, int(q.FracBits))
+}
+
+// ParseQFormat 解析Q格式值类型名称，不区分大小写
+// "qN" 为1位符号位加N位小数（q15占16位），"qM.N" 为M位整数（含符号位）加N位小数（q16.16占32位）
+func ParseQFormat(valueType string) (QFormat, bool) {
+	name := strings.ToLower(valueType)
+	if len(name) < 2 || name[0] != 'q' {
+		return QFormat{}, false
+	}
+	intPart, fracPart, dotted := strings.Cut(name[1:], ".")
+	intBits, fracBits := uint64(1), uint64(0)
+	var err error
+	if dotted {
+		if intBits, err = strconv.ParseUint(intPart, 10, 8); err != nil || intBits == 0 {
+			return QFormat{}, false
+		}
+		if fracBits, err = strconv.ParseUint(fracPart, 10, 8); err != nil {
+			return QFormat{}, false
+		}
+	} else if fracBits, err = strconv.ParseUint(intPart, 10, 8); err != nil {
+		return QFormat{}, false
+	}
+	switch bits := intBits + fracBits; bits {
+	case 16, 32, 64:
+		return QFormat{Bits: uint(bits), FracBits: uint(fracBits)}, true
+	default:
+		return QFormat{}, false
+	}
+}
+
+// registerWidth 返回值类型占用的寄存器数量，与 modbusserver.Converter.GetRegisterCount 一致
+func registerWidth(valueType string) uint16 {
+	if q, ok := ParseQFormat(valueType); ok {
+		return uint16(q.Bits / 16)
+	}
+	switch strings.ToLower(valueType) {
+	case "int32", "uint32", "float32":
+		return 2
+	case "float64", "int64", "uint64":
+		return 4
+	default:
+		return 1
+	}
+}
+
+// knownValueTypes 是 modbusserver.Converter 支持的值类型（小写），string 仅用于写入
+var knownValueTypes = map[string]bool{
+	"bool": true, "int16": true, "uint16": true, "int32": true, "uint32": true,
+	"float32": true, "float64": true, "int64": true, "uint64": true, "string": true,
+}
+
+// KnownValueType 判断值类型是否受转换器支持（包括Q格式定点类型），不区分大小写；空类型按默认的uint16处理，视为已知
+func KnownValueType(valueType string) bool {
+	if _, ok := ParseQFormat(valueType); ok {
+		return true
+	}
+	return valueType == "" || knownValueTypes[strings.ToLower(valueType)]
+}
+
+// coerceValue 将缓存的原始值转换为valueType对应的Go类型
+// 无法转换时返回原始值
+func coerceValue(value interface{}, valueType string) interface{} {
+	valueType = strings.ToLower(valueType)
+
+	if valueType == "bool" {
+		switch v := value.(type) {
+		case bool:
+			return v
+		case string:
+			return v == "true" || v == "1" || v == "on"
+		}
+		if f, ok := toFloat64(value); ok {
+			return f != 0
+		}
+		return value
+	}
+
+	f, ok := toFloat64(value)
+	if !ok {
+		return value
+	}
+
+	if _, ok := ParseQFormat(valueType); ok {
+		return f
+	}
+
+	switch valueType {
+	case "int16":
+		return int16(f)
+	case "uint16":
+		return uint16(f)
+	case "int32":
+		return int32(f)
+	case "uint32":
+		return uint32(f)
+	case "int64":
+		return int64(f)
+	case "uint64":
+		return uint64(f)
+	case "float32":
+		return float32(f)
+	case "float64":
+		return f
+	default:
+		return value
+	}
+}
+
+// ValuesEqual 按数据类型比较两个值，供变化检测、死区判断和写入确认使用
+// 数值（包括不同数值类型及数字字符串）按差值不超过tolerance视为相等，NaN与NaN相等；
+// 布尔值与可解析为布尔值的字符串（如命令中的 "true"）等价；其他类型按值比较
+func ValuesEqual(a, b interface{}, tolerance float64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if v, ok := a.(bool); ok {
+		return boolEquals(v, b)
+	}
+	if v, ok := b.(bool); ok {
+		return boolEquals(v, a)
+	}
+	fa, okA := numericValue(a)
+	fb, okB := numericValue(b)
+	if okA && okB {
+		if math.IsNaN(fa) || math.IsNaN(fb) {
+			return math.IsNaN(fa) && math.IsNaN(fb)
+		}
+		if fa == fb {
+			return true
+		}
+		return math.Abs(fa-fb) <= math.Max(tolerance, 0)
+	}
+	if okA != okB {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// boolEquals 比较布尔值与另一个值，另一个值可以是布尔值或可解析为布尔值的字符串
+func boolEquals(v bool, other interface{}) bool {
+	switch o := other.(type) {
+	case bool:
+		return o == v
+	case string:
+		parsed, err := strconv.ParseBool(strings.TrimSpace(o))
+		return err == nil && parsed == v
+	default:
+		return false
+	}
+}
+
+// numericValue 将数值或数字字符串转换为float64，比较时数字字符串与数值等价
+func numericValue(value interface{}) (float64, bool) {
+	if s, ok := value.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return f, err == nil
+	}
+	return toFloat64(value)
+}
+
+// toFloat64 将数值类型转换为float64
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
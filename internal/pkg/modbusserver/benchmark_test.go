@@ -136,7 +136,7 @@ func BenchmarkCacheSet(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		cache.Set(uint16(i%1000), data)
+		cache.Set(config.AddressKey(i%1000), data)
 	}
 }
 
@@ -152,7 +152,7 @@ func BenchmarkCacheGet(b *testing.B) {
 
 func BenchmarkCacheGetRange(b *testing.B) {
 	cache := mappingmanager.NewCache(30 * time.Second)
-	for i := uint16(1000); i < 1100; i++ {
+	for i := config.AddressKey(1000); i < 1100; i++ {
 		cache.Set(i, &mappingmanager.CachedData{Value: i})
 	}
 
@@ -164,7 +164,7 @@ func BenchmarkCacheGetRange(b *testing.B) {
 
 func BenchmarkCacheCleanup(b *testing.B) {
 	cache := mappingmanager.NewCache(10 * time.Millisecond)
-	for i := uint16(1000); i < 1100; i++ {
+	for i := config.AddressKey(1000); i < 1100; i++ {
 		cache.Set(i, &mappingmanager.CachedData{Value: i})
 	}
 
@@ -314,7 +314,7 @@ func BenchmarkCacheConcurrentSetGet(b *testing.B) {
 	b.RunParallel(func(pb *testing.PB) {
 		i := 0
 		for pb.Next() {
-			addr := uint16(i % 1000)
+			addr := config.AddressKey(i % 1000)
 			cache.Set(addr, &mappingmanager.CachedData{Value: i})
 			cache.Get(addr)
 			i++
@@ -414,3 +414,91 @@ func BenchmarkLittleEndianConversion(b *testing.B) {
 		c.uint32ToBytes(value)
 	}
 }
+
+func BenchmarkEncodeWindowPerValue(b *testing.B) {
+	c := NewConverter(BigEndian)
+	values := make([]interface{}, 60)
+	for i := range values {
+		values[i] = float64(i) * 1.5
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result := make([]byte, 0, len(values)*4)
+		for _, v := range values {
+			bytes, _ := c.ToRegisters(v, "float32", 0.1, 0)
+			result = append(result, bytes...)
+		}
+	}
+}
+
+// repetitiveBlock 返回一块大多为零、少数重复值的寄存器值
+func repetitiveBlock() []interface{} {
+	values := make([]interface{}, 120)
+	for i := range values {
+		values[i] = 0.0
+		if i%10 == 0 {
+			values[i] = 42.5
+		}
+	}
+	return values
+}
+
+func BenchmarkToRegistersRepetitive(b *testing.B) {
+	c := NewConverter(BigEndian)
+	values := repetitiveBlock()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, v := range values {
+			c.ToRegisters(v, "float64", 0.1, 0)
+		}
+	}
+}
+
+func BenchmarkToRegistersRepetitiveMemo(b *testing.B) {
+	c := NewConverter(BigEndian)
+	c.SetMemoSize(256)
+	values := repetitiveBlock()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, v := range values {
+			c.ToRegisters(v, "float64", 0.1, 0)
+		}
+	}
+}
+
+func BenchmarkEncodeWindow(b *testing.B) {
+	c := NewConverter(BigEndian)
+	values := make([]interface{}, 60)
+	for i := range values {
+		values[i] = float64(i) * 1.5
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.EncodeWindow(values, "float32", 0.1, 0)
+	}
+}
+
+func BenchmarkEncodeWindowRepetitive(b *testing.B) {
+	c := NewConverter(BigEndian)
+	values := repetitiveBlock()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.EncodeWindow(values, "float64", 0.1, 0)
+	}
+}
+
+func BenchmarkEncodeWindowRepetitiveMemo(b *testing.B) {
+	c := NewConverter(BigEndian)
+	c.SetMemoSize(256)
+	values := repetitiveBlock()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.EncodeWindow(values, "float64", 0.1, 0)
+	}
+}
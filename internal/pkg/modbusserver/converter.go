@@ -1,10 +1,12 @@
 package modbusserver
 
 import (
+	"app-modbus-go/internal/pkg/mappingmanager"
 	"encoding/binary"
 	"fmt"
 	"math"
 	"strings"
+	"sync"
 )
 
 // ByteOrder 定义多字节值的字节顺序
@@ -15,53 +17,369 @@ const (
 	LittleEndian
 )
 
+// WordOrder 定义多寄存器值的寄存器(字)顺序
+type WordOrder int
+
+const (
+	HighWordFirst WordOrder = iota // 高位字在前 (ABCD)
+	LowWordFirst                   // 低位字在前 (CDAB)
+)
+
+// String 返回字节顺序名称
+func (o ByteOrder) String() string {
+	if o == LittleEndian {
+		return "littleEndian"
+	}
+	return "bigEndian"
+}
+
+// String 返回字顺序名称，与 ParseWordOrder 接受的名称一致
+func (o WordOrder) String() string {
+	if o == LowWordFirst {
+		return "lowWordFirst"
+	}
+	return "highWordFirst"
+}
+
+// ParseWordOrder 解析资源配置中的字顺序名称
+func ParseWordOrder(name string) (WordOrder, error) {
+	switch strings.ToLower(name) {
+	case "highwordfirst", "abcd":
+		return HighWordFirst, nil
+	case "lowwordfirst", "cdab":
+		return LowWordFirst, nil
+	default:
+		return HighWordFirst, fmt.Errorf("unknown word order %q", name)
+	}
+}
+
+// SignedEncoding 定义有符号整数在寄存器中的表示方式
+type SignedEncoding int
+
+const (
+	TwosComplement SignedEncoding = iota // 二进制补码（默认）
+	OffsetBinary                         // 偏移二进制：寄存器值 = 值 + 2^(n-1)
+	SignMagnitude                        // 原码：最高位为符号位，其余位为绝对值
+)
+
+// ParseSignedEncoding 解析资源配置中的有符号编码名称，空字符串表示二进制补码
+func ParseSignedEncoding(name string) (SignedEncoding, error) {
+	switch strings.ToLower(name) {
+	case "", "twoscomplement":
+		return TwosComplement, nil
+	case "offsetbinary":
+		return OffsetBinary, nil
+	case "signmagnitude":
+		return SignMagnitude, nil
+	default:
+		return TwosComplement, fmt.Errorf("unknown signed encoding %q", name)
+	}
+}
+
 // Converter 处理Go类型和Modbus寄存器之间的数据类型转换
 type Converter struct {
+	byteOrder ByteOrder   // 寄存器内的字节顺序
+	wordOrder WordOrder   // 寄存器之间的字顺序
+	memo      *encodeMemo // 编码结果缓存，容量为0时不缓存
+}
+
+// encodeKey 标识一次寄存器编码的全部输入
+type encodeKey struct {
+	value     interface{}
+	valueType string
+	scale     float64
+	offset    float64
+	encoding  SignedEncoding
 	byteOrder ByteOrder
+	wordOrder WordOrder
+}
+
+// encodeMemo 缓存相同输入的编码结果；编码是纯函数，缓存无需失效，满时整体清空
+// 容量和条目都受 mu 保护，可在转换器使用中调整容量
+type encodeMemo struct {
+	mu      sync.Mutex
+	size    int
+	entries map[encodeKey][]byte
+}
+
+// get 返回key的缓存结果，未启用或未命中时返回false；返回的切片归缓存所有，调用方只能复制
+func (m *encodeMemo) get(key encodeKey) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.size <= 0 {
+		return nil, false
+	}
+	cached, ok := m.entries[key]
+	return cached, ok
+}
+
+// put 保存data的副本，缓存已满时先清空
+func (m *encodeMemo) put(key encodeKey, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.size <= 0 {
+		return
+	}
+	if len(m.entries) >= m.size {
+		clear(m.entries)
+	}
+	m.entries[key] = append([]byte(nil), data...)
+}
+
+// resize 设置缓存容量并清空已有条目
+func (m *encodeMemo) resize(size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if size <= 0 {
+		m.size, m.entries = 0, nil
+		return
+	}
+	m.size, m.entries = size, make(map[encodeKey][]byte, size)
 }
 
 // NewConverter 使用指定的字节顺序创建新的转换器
+// 字顺序与字节顺序保持一致：BigEndian 对应高位字在前，LittleEndian 对应低位字在前
 func NewConverter(order ByteOrder) *Converter {
-	return &Converter{byteOrder: order}
+	wordOrder := HighWordFirst
+	if order == LittleEndian {
+		wordOrder = LowWordFirst
+	}
+	return NewConverterWithWordOrder(order, wordOrder)
+}
+
+// NewConverterWithWordOrder 使用独立的字节顺序和字顺序创建新的转换器
+func NewConverterWithWordOrder(byteOrder ByteOrder, wordOrder WordOrder) *Converter {
+	return &Converter{byteOrder: byteOrder, wordOrder: wordOrder, memo: &encodeMemo{}}
 }
 
-// ToRegisters 根据值类型将值转换为Modbus寄存器字节
+// DetectOrder 比较探测寄存器的原始字节与设备写入的已知魔数，返回能解码出魔数的转换器
+// 单个寄存器的魔数（如0x1234）只能确定字节顺序，字顺序按 NewConverter 的约定；
+// 两个寄存器的魔数（如0x12345678）可同时确定字节顺序和字顺序。
+// 没有顺序能解码出魔数，或多种顺序解码结果相同（如0x1212）时返回错误
+func DetectOrder(data []byte, magic uint32) (*Converter, error) {
+	var candidates []*Converter
+	switch len(data) {
+	case 2:
+		if magic > math.MaxUint16 {
+			return nil, fmt.Errorf("magic 0x%X does not fit in one register", magic)
+		}
+		for _, order := range []ByteOrder{BigEndian, LittleEndian} {
+			if c := NewConverter(order); uint32(c.getUint16(data)) == magic {
+				candidates = append(candidates, c)
+			}
+		}
+	case 4:
+		for _, byteOrder := range []ByteOrder{BigEndian, LittleEndian} {
+			for _, wordOrder := range []WordOrder{HighWordFirst, LowWordFirst} {
+				if c := NewConverterWithWordOrder(byteOrder, wordOrder); c.getUint32(data) == magic {
+					candidates = append(candidates, c)
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("probe data must be 1 or 2 registers, got %d bytes", len(data))
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("no byte/word order decodes % X as magic 0x%X", data, magic)
+	case 1:
+		return candidates[0], nil
+	default:
+		return nil, fmt.Errorf("magic 0x%X is ambiguous: it reads the same in %d orders", magic, len(candidates))
+	}
+}
+
+// ByteOrder 返回转换器的字节顺序
+func (c *Converter) ByteOrder() ByteOrder {
+	return c.byteOrder
+}
+
+// WordOrder 返回转换器的字顺序
+func (c *Converter) WordOrder() WordOrder {
+	return c.wordOrder
+}
+
+// WithWordOrder 返回字节顺序相同、使用指定字顺序的转换器，用于按资源覆盖字顺序
+func (c *Converter) WithWordOrder(order WordOrder) *Converter {
+	if order == c.wordOrder {
+		return c
+	}
+	derived := NewConverterWithWordOrder(c.byteOrder, order)
+	derived.memo = c.memo
+	return derived
+}
+
+// SetMemoSize 启用最多缓存size个编码结果的转换缓存，size<=0时关闭
+// 大量地址共享相同值（如一块全零寄存器）时可避免重复编码；按资源覆盖字顺序的派生转换器共享该缓存。
+// 可在读取进行中调用（如重载配置），调整容量会清空已有条目
+func (c *Converter) SetMemoSize(size int) {
+	c.memo.resize(size)
+}
+
+// memoKey 返回一次编码的缓存键，值不可作为缓存键时返回false
+// 不可比较的类型（切片、映射）不缓存；NaN 与自身不相等，作为键永远不会命中，也不缓存
+func (c *Converter) memoKey(value interface{}, valueType string, scale, offset float64, encoding SignedEncoding) (encodeKey, bool) {
+	if math.IsNaN(scale) || math.IsNaN(offset) {
+		return encodeKey{}, false
+	}
+	switch v := value.(type) {
+	case float32:
+		if math.IsNaN(float64(v)) {
+			return encodeKey{}, false
+		}
+	case float64:
+		if math.IsNaN(v) {
+			return encodeKey{}, false
+		}
+	case bool, string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+	default:
+		return encodeKey{}, false
+	}
+	return encodeKey{value, valueType, scale, offset, encoding, c.byteOrder, c.wordOrder}, true
+}
+
+// ToRegisters 根据值类型将值转换为Modbus寄存器字节，有符号整数使用二进制补码
 func (c *Converter) ToRegisters(value interface{}, valueType string, scale, offset float64) ([]byte, error) {
+	return c.ToRegistersWithEncoding(value, valueType, scale, offset, TwosComplement)
+}
+
+// ToRegistersWithEncoding 根据值类型将值转换为Modbus寄存器字节
+// encoding 仅作用于 int16/int32，其他类型忽略
+func (c *Converter) ToRegistersWithEncoding(value interface{}, valueType string, scale, offset float64, encoding SignedEncoding) ([]byte, error) {
+	key, ok := c.memoKey(value, valueType, scale, offset, encoding)
+	if !ok {
+		return c.encode(value, valueType, scale, offset, encoding)
+	}
+	if cached, hit := c.memo.get(key); hit {
+		return append([]byte(nil), cached...), nil
+	}
+
+	result, err := c.encode(value, valueType, scale, offset, encoding)
+	if err != nil {
+		return nil, err
+	}
+	c.memo.put(key, result)
+	return result, nil
+}
+
+// encode 执行 ToRegistersWithEncoding 的实际编码
+func (c *Converter) encode(value interface{}, valueType string, scale, offset float64, encoding SignedEncoding) ([]byte, error) {
 	// 对数值应用缩放和偏移
 	scaledValue := c.applyScaleOffset(value, scale, offset)
 
 	// 统一转换为小写进行比较，支持"Uint64"和"uint64"等不同写法
 	valueType = strings.ToLower(valueType)
 
+	if encoding != TwosComplement {
+		switch valueType {
+		case "int16":
+			return c.encodedSignedToBytes(scaledValue, 16, encoding)
+		case "int32":
+			return c.encodedSignedToBytes(scaledValue, 32, encoding)
+		}
+	}
+
+	size, encode := c.encoderFor(valueType)
+	return c.newBytes(size, scaledValue, encode)
+}
+
+// EncodeWindow 将同一类型、缩放和偏移的一组值依次编码为连续的寄存器字节
+// 只分配一次缓冲区；无法转换的值以全零寄存器填充
+func (c *Converter) EncodeWindow(values []interface{}, valueType string, scale, offset float64) []byte {
+	result, _ := c.EncodeWindowFailures(values, valueType, scale, offset)
+	return result
+}
+
+// EncodeWindowFailures 与 EncodeWindow 相同，同时返回无法转换的值的下标
+// 与 ToRegisters 共用编码缓存，连续的相同值（如一块全零寄存器）只编码一次
+func (c *Converter) EncodeWindowFailures(values []interface{}, valueType string, scale, offset float64) ([]byte, []int) {
+	size, encode := c.encoderFor(strings.ToLower(valueType))
+	result := make([]byte, len(values)*size)
+	var failed []int
+	for i, value := range values {
+		slot := result[i*size : (i+1)*size]
+		key, memoizable := c.memoKey(value, valueType, scale, offset, TwosComplement)
+		if memoizable {
+			if cached, hit := c.memo.get(key); hit {
+				copy(slot, cached)
+				continue
+			}
+		}
+		// 失败时encode不写入，该位置保持零值
+		if err := encode(slot, c.applyScaleOffset(value, scale, offset)); err != nil {
+			failed = append(failed, i)
+			continue
+		}
+		if memoizable {
+			c.memo.put(key, slot)
+		}
+	}
+	return result, failed
+}
+
+// encoderFor 返回值类型（小写）的编码字节数和编码函数
+func (c *Converter) encoderFor(valueType string) (int, func([]byte, interface{}) error) {
+	if q, ok := mappingmanager.ParseQFormat(valueType); ok {
+		return int(q.Bits / 8), func(result []byte, value interface{}) error {
+			return c.qFormatInto(result, value, q)
+		}
+	}
 	switch valueType {
 	case "bool":
-		return c.boolToBytes(scaledValue)
+		return 2, c.boolInto
 	case "int16":
-		return c.int16ToBytes(scaledValue)
+		return 2, c.int16Into
 	case "uint16":
-		return c.uint16ToBytes(scaledValue)
+		return 2, c.uint16Into
 	case "int32":
-		return c.int32ToBytes(scaledValue)
+		return 4, c.int32Into
 	case "uint32":
-		return c.uint32ToBytes(scaledValue)
+		return 4, c.uint32Into
 	case "float32":
-		return c.float32ToBytes(scaledValue)
+		return 4, c.float32Into
 	case "float64":
-		return c.float64ToBytes(scaledValue)
+		return 8, c.float64Into
 	case "int64":
-		return c.int64ToBytes(scaledValue)
+		return 8, c.int64Into
 	case "uint64":
-		return c.uint64ToBytes(scaledValue)
+		return 8, c.uint64Into
 	default:
 		// 默认为uint16
-		return c.uint16ToBytes(scaledValue)
+		return 2, c.uint16Into
+	}
+}
+
+// newBytes 分配 size 字节并用 encode 写入值
+func (c *Converter) newBytes(size int, value interface{}, encode func([]byte, interface{}) error) ([]byte, error) {
+	result := make([]byte, size)
+	if err := encode(result, value); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DecodeString 将寄存器字节解码为ASCII字符串，每个寄存器两个字符，末尾的NUL和空格填充被去除
+// 大端序时寄存器高字节为前一个字符，小端序时低字节在前
+func (c *Converter) DecodeString(data []byte) string {
+	chars := make([]byte, 0, len(data))
+	for i := 0; i+1 < len(data); i += 2 {
+		if c.byteOrder == BigEndian {
+			chars = append(chars, data[i], data[i+1])
+		} else {
+			chars = append(chars, data[i+1], data[i])
+		}
 	}
+	return strings.TrimRight(string(chars), "\x00 ")
 }
 
 // GetRegisterCount 返回值类型所需的寄存器数量
 func (c *Converter) GetRegisterCount(valueType string) int {
 	// 统一转换为小写进行比较
 	valueType = strings.ToLower(valueType)
+	if q, ok := mappingmanager.ParseQFormat(valueType); ok {
+		return int(q.Bits / 16)
+	}
 
 	switch valueType {
 	case "bool", "int16", "uint16":
@@ -75,6 +393,30 @@ func (c *Converter) GetRegisterCount(valueType string) int {
 	}
 }
 
+// WithSignedness 返回与valueType宽度相同、具有指定符号性的整数类型
+// 非整数类型原样返回
+func WithSignedness(valueType string, signed bool) string {
+	switch strings.ToLower(valueType) {
+	case "int16", "uint16":
+		if signed {
+			return "int16"
+		}
+		return "uint16"
+	case "int32", "uint32":
+		if signed {
+			return "int32"
+		}
+		return "uint32"
+	case "int64", "uint64":
+		if signed {
+			return "int64"
+		}
+		return "uint64"
+	default:
+		return valueType
+	}
+}
+
 // applyScaleOffset 对值应用缩放和偏移
 func (c *Converter) applyScaleOffset(value interface{}, scale, offset float64) interface{} {
 	if scale == 0 {
@@ -125,21 +467,25 @@ func (c *Converter) putUint16(result []byte, v uint16) {
 	}
 }
 
-// putUint32 使用配置的字节顺序将uint32值写入字节
+// putUint32 使用配置的字节顺序和字顺序将uint32值写入字节
 func (c *Converter) putUint32(result []byte, v uint32) {
-	if c.byteOrder == BigEndian {
-		binary.BigEndian.PutUint32(result, v)
-	} else {
-		binary.LittleEndian.PutUint32(result, v)
-	}
+	c.putWords(result, []uint16{uint16(v >> 16), uint16(v)})
 }
 
-// putUint64 使用配置的字节顺序将uint64值写入字节
+// putUint64 使用配置的字节顺序和字顺序将uint64值写入字节
 func (c *Converter) putUint64(result []byte, v uint64) {
-	if c.byteOrder == BigEndian {
-		binary.BigEndian.PutUint64(result, v)
-	} else {
-		binary.LittleEndian.PutUint64(result, v)
+	c.putWords(result, []uint16{uint16(v >> 48), uint16(v >> 32), uint16(v >> 16), uint16(v)})
+}
+
+// putWords 按字顺序写入寄存器，words 按从高位到低位排列
+func (c *Converter) putWords(result []byte, words []uint16) {
+	n := len(words)
+	for i, w := range words {
+		pos := i
+		if c.wordOrder == LowWordFirst {
+			pos = n - 1 - i
+		}
+		c.putUint16(result[pos*2:], w)
 	}
 }
 
@@ -151,23 +497,42 @@ func (c *Converter) getUint16(data []byte) uint16 {
 	return binary.LittleEndian.Uint16(data)
 }
 
-// getUint32 使用配置的字节顺序从字节读取uint32值
+// getUint32 使用配置的字节顺序和字顺序从字节读取uint32值
 func (c *Converter) getUint32(data []byte) uint32 {
-	if c.byteOrder == BigEndian {
-		return binary.BigEndian.Uint32(data)
+	var v uint32
+	for _, w := range c.getWords(data, 2) {
+		v = v<<16 | uint32(w)
 	}
-	return binary.LittleEndian.Uint32(data)
+	return v
 }
 
-// getUint64 使用配置的字节顺序从字节读取uint64值
+// getUint64 使用配置的字节顺序和字顺序从字节读取uint64值
 func (c *Converter) getUint64(data []byte) uint64 {
-	if c.byteOrder == BigEndian {
-		return binary.BigEndian.Uint64(data)
+	var v uint64
+	for _, w := range c.getWords(data, 4) {
+		v = v<<16 | uint64(w)
 	}
-	return binary.LittleEndian.Uint64(data)
+	return v
+}
+
+// getWords 按字顺序读取 n 个寄存器，返回从高位到低位排列的字
+func (c *Converter) getWords(data []byte, n int) []uint16 {
+	words := make([]uint16, n)
+	for i := 0; i < n; i++ {
+		pos := i
+		if c.wordOrder == LowWordFirst {
+			pos = n - 1 - i
+		}
+		words[i] = c.getUint16(data[pos*2:])
+	}
+	return words
 }
 
 func (c *Converter) boolToBytes(value interface{}) ([]byte, error) {
+	return c.newBytes(2, value, c.boolInto)
+}
+
+func (c *Converter) boolInto(result []byte, value interface{}) error {
 	var v bool
 	switch val := value.(type) {
 	case bool:
@@ -179,18 +544,21 @@ func (c *Converter) boolToBytes(value interface{}) ([]byte, error) {
 	case float64:
 		v = val != 0
 	default:
-		return nil, fmt.Errorf("cannot convert %T to bool", value)
+		return fmt.Errorf("cannot convert %T to bool", value)
 	}
 
-	result := make([]byte, 2)
+	result[0], result[1] = 0x00, 0x00
 	if v {
 		result[0] = 0xFF
-		result[1] = 0x00
 	}
-	return result, nil
+	return nil
 }
 
 func (c *Converter) int16ToBytes(value interface{}) ([]byte, error) {
+	return c.newBytes(2, value, c.int16Into)
+}
+
+func (c *Converter) int16Into(result []byte, value interface{}) error {
 	var v int16
 	switch val := value.(type) {
 	case int16:
@@ -206,15 +574,18 @@ func (c *Converter) int16ToBytes(value interface{}) ([]byte, error) {
 	case uint16:
 		v = int16(val)
 	default:
-		return nil, fmt.Errorf("cannot convert %T to int16", value)
+		return fmt.Errorf("cannot convert %T to int16", value)
 	}
 
-	result := make([]byte, 2)
 	c.putUint16(result, uint16(v))
-	return result, nil
+	return nil
 }
 
 func (c *Converter) uint16ToBytes(value interface{}) ([]byte, error) {
+	return c.newBytes(2, value, c.uint16Into)
+}
+
+func (c *Converter) uint16Into(result []byte, value interface{}) error {
 	var v uint16
 	switch val := value.(type) {
 	case uint16:
@@ -236,15 +607,18 @@ func (c *Converter) uint16ToBytes(value interface{}) ([]byte, error) {
 	case float64:
 		v = uint16(val)
 	default:
-		return nil, fmt.Errorf("cannot convert %T to uint16", value)
+		return fmt.Errorf("cannot convert %T to uint16", value)
 	}
 
-	result := make([]byte, 2)
 	c.putUint16(result, v)
-	return result, nil
+	return nil
 }
 
 func (c *Converter) int32ToBytes(value interface{}) ([]byte, error) {
+	return c.newBytes(4, value, c.int32Into)
+}
+
+func (c *Converter) int32Into(result []byte, value interface{}) error {
 	var v int32
 	switch val := value.(type) {
 	case int32:
@@ -258,15 +632,18 @@ func (c *Converter) int32ToBytes(value interface{}) ([]byte, error) {
 	case float64:
 		v = int32(val)
 	default:
-		return nil, fmt.Errorf("cannot convert %T to int32", value)
+		return fmt.Errorf("cannot convert %T to int32", value)
 	}
 
-	result := make([]byte, 4)
 	c.putUint32(result, uint32(v))
-	return result, nil
+	return nil
 }
 
 func (c *Converter) uint32ToBytes(value interface{}) ([]byte, error) {
+	return c.newBytes(4, value, c.uint32Into)
+}
+
+func (c *Converter) uint32Into(result []byte, value interface{}) error {
 	var v uint32
 	switch val := value.(type) {
 	case uint32:
@@ -284,15 +661,18 @@ func (c *Converter) uint32ToBytes(value interface{}) ([]byte, error) {
 	case float64:
 		v = uint32(val)
 	default:
-		return nil, fmt.Errorf("cannot convert %T to uint32", value)
+		return fmt.Errorf("cannot convert %T to uint32", value)
 	}
 
-	result := make([]byte, 4)
 	c.putUint32(result, v)
-	return result, nil
+	return nil
 }
 
 func (c *Converter) float32ToBytes(value interface{}) ([]byte, error) {
+	return c.newBytes(4, value, c.float32Into)
+}
+
+func (c *Converter) float32Into(result []byte, value interface{}) error {
 	var v float32
 	switch val := value.(type) {
 	case float32:
@@ -306,16 +686,19 @@ func (c *Converter) float32ToBytes(value interface{}) ([]byte, error) {
 	case int64:
 		v = float32(val)
 	default:
-		return nil, fmt.Errorf("cannot convert %T to float32", value)
+		return fmt.Errorf("cannot convert %T to float32", value)
 	}
 
-	result := make([]byte, 4)
 	bits := math.Float32bits(v)
 	c.putUint32(result, bits)
-	return result, nil
+	return nil
 }
 
 func (c *Converter) float64ToBytes(value interface{}) ([]byte, error) {
+	return c.newBytes(8, value, c.float64Into)
+}
+
+func (c *Converter) float64Into(result []byte, value interface{}) error {
 	var v float64
 	switch val := value.(type) {
 	case float64:
@@ -327,16 +710,19 @@ func (c *Converter) float64ToBytes(value interface{}) ([]byte, error) {
 	case int64:
 		v = float64(val)
 	default:
-		return nil, fmt.Errorf("cannot convert %T to float64", value)
+		return fmt.Errorf("cannot convert %T to float64", value)
 	}
 
-	result := make([]byte, 8)
 	bits := math.Float64bits(v)
 	c.putUint64(result, bits)
-	return result, nil
+	return nil
 }
 
 func (c *Converter) int64ToBytes(value interface{}) ([]byte, error) {
+	return c.newBytes(8, value, c.int64Into)
+}
+
+func (c *Converter) int64Into(result []byte, value interface{}) error {
 	var v int64
 	switch val := value.(type) {
 	case int64:
@@ -348,15 +734,18 @@ func (c *Converter) int64ToBytes(value interface{}) ([]byte, error) {
 	case float64:
 		v = int64(val)
 	default:
-		return nil, fmt.Errorf("cannot convert %T to int64", value)
+		return fmt.Errorf("cannot convert %T to int64", value)
 	}
 
-	result := make([]byte, 8)
 	c.putUint64(result, uint64(v))
-	return result, nil
+	return nil
 }
 
 func (c *Converter) uint64ToBytes(value interface{}) ([]byte, error) {
+	return c.newBytes(8, value, c.uint64Into)
+}
+
+func (c *Converter) uint64Into(result []byte, value interface{}) error {
 	var v uint64
 	switch val := value.(type) {
 	case uint64:
@@ -372,16 +761,183 @@ func (c *Converter) uint64ToBytes(value interface{}) ([]byte, error) {
 	case float64:
 		v = uint64(val)
 	default:
-		return nil, fmt.Errorf("cannot convert %T to uint64", value)
+		return fmt.Errorf("cannot convert %T to uint64", value)
 	}
 
-	result := make([]byte, 8)
 	c.putUint64(result, v)
+	return nil
+}
+
+// qFormatInto 将值按Q格式编码：乘以2^FracBits后四舍五入为二进制补码整数，超出位宽时返回错误
+func (c *Converter) qFormatInto(result []byte, value interface{}, q mappingmanager.QFormat) error {
+	var v float64
+	switch val := value.(type) {
+	case float64:
+		v = val
+	case float32:
+		v = float64(val)
+	case int:
+		v = float64(val)
+	case int16:
+		v = float64(val)
+	default:
+		return fmt.Errorf("cannot convert %T to q%d.%d", value, q.Bits-q.FracBits, q.FracBits)
+	}
+
+	raw := math.Round(v * q.Scale())
+	limit := math.Ldexp(1, int(q.Bits)-1)
+	if math.IsNaN(raw) || raw < -limit || raw >= limit {
+		return fmt.Errorf("value %v out of range for q%d.%d", v, q.Bits-q.FracBits, q.FracBits)
+	}
+
+	switch q.Bits {
+	case 16:
+		c.putUint16(result, uint16(int16(raw)))
+	case 32:
+		c.putUint32(result, uint32(int32(raw)))
+	default:
+		c.putUint64(result, uint64(int64(raw)))
+	}
+	return nil
+}
+
+// encodedSignedToBytes 按偏移二进制或原码编码 bits 位有符号整数
+func (c *Converter) encodedSignedToBytes(value interface{}, bits uint, encoding SignedEncoding) ([]byte, error) {
+	var v int64
+	switch val := value.(type) {
+	case float64:
+		v = int64(val)
+	case int16:
+		v = int64(val)
+	case int:
+		v = int64(val)
+	case int32:
+		v = int64(val)
+	case int64:
+		v = val
+	case uint16:
+		v = int64(val)
+	default:
+		return nil, fmt.Errorf("cannot convert %T to int%d", value, bits)
+	}
+
+	limit := int64(1) << (bits - 1)
+	if v < -limit || v >= limit || (encoding == SignMagnitude && v == -limit) {
+		return nil, fmt.Errorf("value %d out of range for int%d", v, bits)
+	}
+
+	var raw uint64
+	switch encoding {
+	case OffsetBinary:
+		raw = uint64(v + limit)
+	case SignMagnitude:
+		if v < 0 {
+			raw = uint64(limit) | uint64(-v)
+		} else {
+			raw = uint64(v)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signed encoding %d", encoding)
+	}
+
+	result := make([]byte, bits/8)
+	if bits == 16 {
+		c.putUint16(result, uint16(raw))
+	} else {
+		c.putUint32(result, uint32(raw))
+	}
 	return result, nil
 }
 
-// FromBytes 根据值类型将Modbus寄存器字节转换回值
+// decodeSigned 将 bits 位寄存器原始值按编码方式解码为有符号整数
+func decodeSigned(raw uint64, bits uint, encoding SignedEncoding) int64 {
+	limit := int64(1) << (bits - 1)
+	switch encoding {
+	case OffsetBinary:
+		return int64(raw) - limit
+	case SignMagnitude:
+		magnitude := int64(raw) & (limit - 1)
+		if int64(raw)&limit != 0 {
+			return -magnitude
+		}
+		return magnitude
+	default:
+		if int64(raw)&limit != 0 {
+			return int64(raw) - 2*limit
+		}
+		return int64(raw)
+	}
+}
+
+// FromBytes 根据值类型将Modbus寄存器字节转换回值，有符号整数使用二进制补码
 func (c *Converter) FromBytes(data []byte, valueType string, scale, offset float64) (interface{}, error) {
+	return c.FromBytesWithEncoding(data, valueType, scale, offset, TwosComplement)
+}
+
+// RawValue 返回工程值写入寄存器后的原始寄存器值（未缩放），用于核对缩放配置
+// 整数类型返回int64，浮点类型返回float64，bool原样返回
+func (c *Converter) RawValue(value interface{}, valueType string, scale, offset float64, encoding SignedEncoding) (interface{}, error) {
+	data, err := c.ToRegistersWithEncoding(value, valueType, scale, offset, encoding)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := c.FromBytesWithEncoding(data, valueType, 1, 0, encoding)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(valueType) {
+	case "float32", "float64", "bool":
+		return raw, nil
+	}
+	if q, ok := mappingmanager.ParseQFormat(valueType); ok {
+		return c.qFormatRaw(data, q), nil
+	}
+	if f, ok := raw.(float64); ok {
+		return int64(f), nil
+	}
+	return raw, nil
+}
+
+// qFormatRaw 读取Q格式的二进制补码原始整数
+func (c *Converter) qFormatRaw(data []byte, q mappingmanager.QFormat) int64 {
+	switch q.Bits {
+	case 16:
+		return int64(int16(c.getUint16(data)))
+	case 32:
+		return int64(int32(c.getUint32(data)))
+	default:
+		return int64(c.getUint64(data))
+	}
+}
+
+// FromBytesWithPrecision 与 FromBytesWithEncoding 相同，precision>=0 时将结果四舍五入到该小数位数，
+// 以消除缩放引入的浮点误差（例如原始值1234、缩放0.01返回12.34而非12.340000000000002）
+func (c *Converter) FromBytesWithPrecision(data []byte, valueType string, scale, offset float64, encoding SignedEncoding, precision int) (interface{}, error) {
+	value, err := c.FromBytesWithEncoding(data, valueType, scale, offset, encoding)
+	if err != nil || precision < 0 {
+		return value, err
+	}
+	if f, ok := value.(float64); ok {
+		return roundToPrecision(f, precision), nil
+	}
+	return value, nil
+}
+
+// roundToPrecision 将浮点值四舍五入到precision位小数，NaN/Inf及溢出时原样返回
+func roundToPrecision(v float64, precision int) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return v
+	}
+	pow := math.Pow10(precision)
+	scaled := v * pow
+	if math.IsInf(scaled, 0) {
+		return v
+	}
+	return math.Round(scaled) / pow
+}
+
+// FromBytesWithEncoding 根据值类型和有符号编码将Modbus寄存器字节转换回值
+func (c *Converter) FromBytesWithEncoding(data []byte, valueType string, scale, offset float64, encoding SignedEncoding) (interface{}, error) {
 	if scale == 0 {
 		scale = 1
 	}
@@ -398,69 +954,55 @@ func (c *Converter) FromBytes(data []byte, valueType string, scale, offset float
 		if len(data) < 2 {
 			return nil, fmt.Errorf("insufficient data for int16")
 		}
-		var v int16
-		if c.byteOrder == BigEndian {
-			v = int16(binary.BigEndian.Uint16(data))
-		} else {
-			v = int16(binary.LittleEndian.Uint16(data))
-		}
-		rawValue = float64(v)
+		rawValue = float64(decodeSigned(uint64(c.getUint16(data)), 16, encoding))
 	case "uint16":
 		if len(data) < 2 {
 			return nil, fmt.Errorf("insufficient data for uint16")
 		}
-		var v uint16
-		if c.byteOrder == BigEndian {
-			v = binary.BigEndian.Uint16(data)
-		} else {
-			v = binary.LittleEndian.Uint16(data)
-		}
-		rawValue = float64(v)
+		rawValue = float64(c.getUint16(data))
 	case "int32":
 		if len(data) < 4 {
 			return nil, fmt.Errorf("insufficient data for int32")
 		}
-		var v int32
-		if c.byteOrder == BigEndian {
-			v = int32(binary.BigEndian.Uint32(data))
-		} else {
-			v = int32(binary.LittleEndian.Uint32(data))
-		}
-		rawValue = float64(v)
+		rawValue = float64(decodeSigned(uint64(c.getUint32(data)), 32, encoding))
 	case "uint32":
 		if len(data) < 4 {
 			return nil, fmt.Errorf("insufficient data for uint32")
 		}
-		var v uint32
-		if c.byteOrder == BigEndian {
-			v = binary.BigEndian.Uint32(data)
-		} else {
-			v = binary.LittleEndian.Uint32(data)
-		}
-		rawValue = float64(v)
+		rawValue = float64(c.getUint32(data))
 	case "float32":
 		if len(data) < 4 {
 			return nil, fmt.Errorf("insufficient data for float32")
 		}
-		var bits uint32
-		if c.byteOrder == BigEndian {
-			bits = binary.BigEndian.Uint32(data)
-		} else {
-			bits = binary.LittleEndian.Uint32(data)
+		rawValue = float64(math.Float32frombits(c.getUint32(data)))
+	case "int64":
+		if len(data) < 8 {
+			return nil, fmt.Errorf("insufficient data for int64")
 		}
-		rawValue = float64(math.Float32frombits(bits))
+		rawValue = float64(int64(c.getUint64(data)))
+	case "uint64":
+		if len(data) < 8 {
+			return nil, fmt.Errorf("insufficient data for uint64")
+		}
+		rawValue = float64(c.getUint64(data))
+	case "float64":
+		if len(data) < 8 {
+			return nil, fmt.Errorf("insufficient data for float64")
+		}
+		rawValue = math.Float64frombits(c.getUint64(data))
 	default:
+		if q, ok := mappingmanager.ParseQFormat(valueType); ok {
+			if len(data) < int(q.Bits/8) {
+				return nil, fmt.Errorf("insufficient data for %s", valueType)
+			}
+			rawValue = float64(c.qFormatRaw(data, q)) / q.Scale()
+			break
+		}
 		// 默认为uint16
 		if len(data) < 2 {
 			return nil, fmt.Errorf("insufficient data")
 		}
-		var v uint16
-		if c.byteOrder == BigEndian {
-			v = binary.BigEndian.Uint16(data)
-		} else {
-			v = binary.LittleEndian.Uint16(data)
-		}
-		rawValue = float64(v)
+		rawValue = float64(c.getUint16(data))
 	}
 
 	// 应用逆运算: value = raw * scale + offset
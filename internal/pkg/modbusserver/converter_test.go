@@ -287,6 +287,42 @@ func TestFloat32ToBytes(t *testing.T) {
 	}
 }
 
+func TestFloat32ByteAndWordOrder(t *testing.T) {
+	// 123.456 = 0x42F6E979
+	tests := []struct {
+		name      string
+		byteOrder ByteOrder
+		wordOrder WordOrder
+		expected  []byte
+	}{
+		{"BigEndian HighWordFirst (ABCD)", BigEndian, HighWordFirst, []byte{0x42, 0xF6, 0xE9, 0x79}},
+		{"BigEndian LowWordFirst (CDAB)", BigEndian, LowWordFirst, []byte{0xE9, 0x79, 0x42, 0xF6}},
+		{"LittleEndian HighWordFirst (BADC)", LittleEndian, HighWordFirst, []byte{0xF6, 0x42, 0x79, 0xE9}},
+		{"LittleEndian LowWordFirst (DCBA)", LittleEndian, LowWordFirst, []byte{0x79, 0xE9, 0xF6, 0x42}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConverterWithWordOrder(tt.byteOrder, tt.wordOrder)
+			result, err := c.ToRegisters(float32(123.456), "float32", 1.0, 0)
+			if err != nil {
+				t.Fatalf("ToRegisters() error = %v", err)
+			}
+			if !bytesEqual(result, tt.expected) {
+				t.Errorf("ToRegisters() = % X, want % X", result, tt.expected)
+			}
+
+			value, err := c.FromBytes(result, "float32", 1.0, 0)
+			if err != nil {
+				t.Fatalf("FromBytes() error = %v", err)
+			}
+			if math.Abs(value.(float64)-123.456) > 0.001 {
+				t.Errorf("FromBytes() = %v, want 123.456", value)
+			}
+		})
+	}
+}
+
 func TestFloat64ToBytes(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -557,3 +593,564 @@ func bytesEqual(a, b []byte) bool {
 	}
 	return true
 }
+
+func TestSignedEncodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		encoding  SignedEncoding
+		valueType string
+		value     float64
+		want      []byte
+	}{
+		{"offset-binary int16 negative", OffsetBinary, "int16", -1000, []byte{0x7C, 0x18}},
+		{"offset-binary int16 min", OffsetBinary, "int16", -32768, []byte{0x00, 0x00}},
+		{"offset-binary int16 positive", OffsetBinary, "int16", 1000, []byte{0x83, 0xE8}},
+		{"sign-magnitude int16 negative", SignMagnitude, "int16", -1000, []byte{0x83, 0xE8}},
+		{"sign-magnitude int16 positive", SignMagnitude, "int16", 1000, []byte{0x03, 0xE8}},
+		{"offset-binary int32 negative", OffsetBinary, "int32", -100000, []byte{0x7F, 0xFE, 0x79, 0x60}},
+		{"sign-magnitude int32 negative", SignMagnitude, "int32", -100000, []byte{0x80, 0x01, 0x86, 0xA0}},
+		{"two's complement int16 negative", TwosComplement, "int16", -1000, []byte{0xFC, 0x18}},
+	}
+
+	c := NewConverter(BigEndian)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bytes, err := c.ToRegistersWithEncoding(tt.value, tt.valueType, 1.0, 0, tt.encoding)
+			if err != nil {
+				t.Fatalf("ToRegistersWithEncoding() error = %v", err)
+			}
+			if !bytesEqual(bytes, tt.want) {
+				t.Errorf("ToRegistersWithEncoding() = % X, want % X", bytes, tt.want)
+			}
+
+			result, err := c.FromBytesWithEncoding(bytes, tt.valueType, 1.0, 0, tt.encoding)
+			if err != nil {
+				t.Fatalf("FromBytesWithEncoding() error = %v", err)
+			}
+			if result != tt.value {
+				t.Errorf("round trip = %v, want %v", result, tt.value)
+			}
+		})
+	}
+}
+
+func TestSignedEncodingIntegerInputs(t *testing.T) {
+	tests := []struct {
+		name      string
+		encoding  SignedEncoding
+		valueType string
+		bits      uint
+		value     interface{}
+		want      float64
+	}{
+		{"offset-binary int32 from int32", OffsetBinary, "int32", 32, int32(-100000), -100000},
+		{"sign-magnitude int32 from int32", SignMagnitude, "int32", 32, int32(-100000), -100000},
+		{"offset-binary int32 from int64", OffsetBinary, "int32", 32, int64(-100000), -100000},
+		{"sign-magnitude int16 from int32", SignMagnitude, "int16", 16, int32(-1000), -1000},
+		{"offset-binary int16 from uint16", OffsetBinary, "int16", 16, uint16(1000), 1000},
+	}
+
+	c := NewConverter(BigEndian)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 绕过 applyScaleOffset，直接以整数类型编码
+			bytes, err := c.encodedSignedToBytes(tt.value, tt.bits, tt.encoding)
+			if err != nil {
+				t.Fatalf("encodedSignedToBytes() error = %v", err)
+			}
+			want, err := c.ToRegistersWithEncoding(tt.want, tt.valueType, 1.0, 0, tt.encoding)
+			if err != nil {
+				t.Fatalf("ToRegistersWithEncoding() error = %v", err)
+			}
+			if !bytesEqual(bytes, want) {
+				t.Errorf("encodedSignedToBytes() = % X, want % X", bytes, want)
+			}
+
+			result, err := c.FromBytesWithEncoding(bytes, tt.valueType, 1.0, 0, tt.encoding)
+			if err != nil {
+				t.Fatalf("FromBytesWithEncoding() error = %v", err)
+			}
+			if result != tt.want {
+				t.Errorf("round trip = %v, want %v", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedEncodingOutOfRange(t *testing.T) {
+	c := NewConverter(BigEndian)
+	if _, err := c.ToRegistersWithEncoding(float64(-32768), "int16", 1.0, 0, SignMagnitude); err == nil {
+		t.Error("expected error for -32768 in sign-magnitude int16")
+	}
+	if _, err := c.ToRegistersWithEncoding(float64(40000), "int16", 1.0, 0, OffsetBinary); err == nil {
+		t.Error("expected error for 40000 in offset-binary int16")
+	}
+	if _, err := ParseSignedEncoding("onesComplement"); err == nil {
+		t.Error("expected error for unknown signed encoding")
+	}
+}
+
+func TestQFormatRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		valueType string
+		value     float64
+		want      []byte
+		registers int
+	}{
+		{"q15 half", "q15", 0.5, []byte{0x40, 0x00}, 1},
+		{"q15 negative", "Q15", -0.25, []byte{0xE0, 0x00}, 1},
+		{"q15 min", "q15", -1.0, []byte{0x80, 0x00}, 1},
+		{"q15 max", "q15", 1 - 1.0/32768, []byte{0x7F, 0xFF}, 1},
+		{"q1.15 alias", "q1.15", 0.5, []byte{0x40, 0x00}, 1},
+		{"q8.8", "q8.8", -1.5, []byte{0xFE, 0x80}, 1},
+		{"q16.16", "q16.16", 1.5, []byte{0x00, 0x01, 0x80, 0x00}, 2},
+		{"q16.16 negative", "q16.16", -3.25, []byte{0xFF, 0xFC, 0xC0, 0x00}, 2},
+		{"q31", "q31", -0.5, []byte{0xC0, 0x00, 0x00, 0x00}, 2},
+		{"q32.32", "q32.32", 1234.5, []byte{0x00, 0x00, 0x04, 0xD2, 0x80, 0x00, 0x00, 0x00}, 4},
+	}
+
+	c := NewConverter(BigEndian)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.GetRegisterCount(tt.valueType); got != tt.registers {
+				t.Errorf("GetRegisterCount(%s) = %d, want %d", tt.valueType, got, tt.registers)
+			}
+
+			bytes, err := c.ToRegisters(tt.value, tt.valueType, 1.0, 0)
+			if err != nil {
+				t.Fatalf("ToRegisters() error = %v", err)
+			}
+			if !bytesEqual(bytes, tt.want) {
+				t.Errorf("ToRegisters() = % X, want % X", bytes, tt.want)
+			}
+
+			result, err := c.FromBytes(bytes, tt.valueType, 1.0, 0)
+			if err != nil {
+				t.Fatalf("FromBytes() error = %v", err)
+			}
+			if result != tt.value {
+				t.Errorf("round trip = %v, want %v", result, tt.value)
+			}
+		})
+	}
+}
+
+func TestQFormatEdgeCases(t *testing.T) {
+	c := NewConverter(BigEndian)
+
+	// 超出位宽
+	for _, v := range []float64{1.0, -1.0001, math.NaN()} {
+		if _, err := c.ToRegisters(v, "q15", 1.0, 0); err == nil {
+			t.Errorf("expected out-of-range error for %v in q15", v)
+		}
+	}
+
+	// 最近的可表示值
+	bytes, err := c.ToRegisters(0.1, "q15", 1.0, 0)
+	if err != nil {
+		t.Fatalf("ToRegisters() error = %v", err)
+	}
+	result, _ := c.FromBytes(bytes, "q15", 1.0, 0)
+	if diff := math.Abs(result.(float64) - 0.1); diff > 1.0/65536 {
+		t.Errorf("q15 0.1 round trip = %v, off by %v", result, diff)
+	}
+
+	// 缩放在定点编码之前应用
+	bytes, err = c.ToRegisters(30.0, "q16.16", 0.1, 0)
+	if err != nil {
+		t.Fatalf("ToRegisters() error = %v", err)
+	}
+	if want := []byte{0x01, 0x2C, 0x00, 0x00}; !bytesEqual(bytes, want) {
+		t.Errorf("scaled q16.16 = % X, want % X", bytes, want)
+	}
+
+	// 原始值为定点整数
+	raw, err := c.RawValue(1.5, "q16.16", 1.0, 0, TwosComplement)
+	if err != nil || raw != int64(0x18000) {
+		t.Errorf("RawValue() = %v, %v, want %d", raw, err, 0x18000)
+	}
+
+	// 字顺序同样适用
+	low := NewConverter(LittleEndian)
+	bytes, _ = low.ToRegisters(-3.25, "q16.16", 1.0, 0)
+	if result, _ := low.FromBytes(bytes, "q16.16", 1.0, 0); result != -3.25 {
+		t.Errorf("little-endian q16.16 round trip = %v, want -3.25", result)
+	}
+}
+
+func TestIntegerWordOrderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     float64
+		valueType string
+		want      []byte
+	}{
+		{"int32 negative", -100000, "int32", []byte{0x79, 0x60, 0xFF, 0xFE}},
+		{"int32 positive", 100000, "int32", []byte{0x86, 0xA0, 0x00, 0x01}},
+		{"uint32", 305419896, "uint32", []byte{0x56, 0x78, 0x12, 0x34}},
+		{"int64 negative", -2, "int64", []byte{0xFF, 0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{"uint64", 4294967296, "uint64", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}},
+	}
+
+	c := NewConverter(BigEndian).WithWordOrder(LowWordFirst)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bytes, err := c.ToRegisters(tt.value, tt.valueType, 1.0, 0)
+			if err != nil {
+				t.Fatalf("ToRegisters() error = %v", err)
+			}
+			if !bytesEqual(bytes, tt.want) {
+				t.Errorf("ToRegisters() = % X, want % X", bytes, tt.want)
+			}
+
+			result, err := c.FromBytes(bytes, tt.valueType, 1.0, 0)
+			if err != nil {
+				t.Fatalf("FromBytes() error = %v", err)
+			}
+			if result != tt.value {
+				t.Errorf("round trip = %v, want %v", result, tt.value)
+			}
+		})
+	}
+}
+
+func TestEncodeWindowMatchesPerValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		valueType string
+		scale     float64
+		offset    float64
+		values    []interface{}
+	}{
+		{"int16", "int16", 1.0, 0, []interface{}{-1, 0, 1000, int16(-32768)}},
+		{"uint16 scaled", "UINT16", 0.1, 10, []interface{}{25.0, 30.5, 100}},
+		{"float32", "float32", 1.0, 0, []interface{}{1.5, -2.25, float32(3.125)}},
+		{"int32", "int32", 1.0, 0, []interface{}{-100000, 100000}},
+		{"uint64", "uint64", 1.0, 0, []interface{}{uint64(1) << 40, 7}},
+		{"bool", "bool", 1.0, 0, []interface{}{true, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, c := range []*Converter{NewConverter(BigEndian), NewConverter(LittleEndian)} {
+				var want []byte
+				for _, v := range tt.values {
+					bytes, err := c.ToRegisters(v, tt.valueType, tt.scale, tt.offset)
+					if err != nil {
+						t.Fatalf("ToRegisters(%v) error = %v", v, err)
+					}
+					want = append(want, bytes...)
+				}
+
+				got := c.EncodeWindow(tt.values, tt.valueType, tt.scale, tt.offset)
+				if !bytesEqual(got, want) {
+					t.Errorf("EncodeWindow() = % X, want % X", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeWindowInvalidValue(t *testing.T) {
+	c := NewConverter(BigEndian)
+	got := c.EncodeWindow([]interface{}{int16(1), "bad", int16(3)}, "int16", 1.0, 0)
+	want := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x03}
+	if !bytesEqual(got, want) {
+		t.Errorf("EncodeWindow() = % X, want % X", got, want)
+	}
+}
+
+func TestMemoizedToRegistersMatchesFresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     interface{}
+		valueType string
+		scale     float64
+		offset    float64
+		encoding  SignedEncoding
+	}{
+		{"zero int16", 0, "int16", 1.0, 0, TwosComplement},
+		{"negative offset binary", -5, "int16", 1.0, 0, OffsetBinary},
+		{"scaled uint16", 25.5, "uint16", 0.1, 10, TwosComplement},
+		{"float32", 1.5, "float32", 1.0, 0, TwosComplement},
+		{"int32", int32(-100000), "int32", 1.0, 0, SignMagnitude},
+		{"uint64", uint64(1) << 40, "uint64", 1.0, 0, TwosComplement},
+		{"bool", true, "bool", 1.0, 0, TwosComplement},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, order := range []ByteOrder{BigEndian, LittleEndian} {
+				fresh := NewConverter(order)
+				memo := NewConverter(order)
+				memo.SetMemoSize(4)
+
+				want, err := fresh.ToRegistersWithEncoding(tt.value, tt.valueType, tt.scale, tt.offset, tt.encoding)
+				if err != nil {
+					t.Fatalf("ToRegistersWithEncoding() error = %v", err)
+				}
+				for i := 0; i < 3; i++ {
+					got, err := memo.ToRegistersWithEncoding(tt.value, tt.valueType, tt.scale, tt.offset, tt.encoding)
+					if err != nil {
+						t.Fatalf("memoized ToRegistersWithEncoding() error = %v", err)
+					}
+					if !bytesEqual(got, want) {
+						t.Errorf("call %d = % X, want % X", i, got, want)
+					}
+					// 调用方修改返回值不能污染缓存
+					for j := range got {
+						got[j] = 0xFF
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMemoKeyedByOrderAndType(t *testing.T) {
+	c := NewConverter(BigEndian)
+	c.SetMemoSize(2)
+	swapped := c.WithWordOrder(LowWordFirst)
+	if swapped.memo != c.memo {
+		t.Fatal("derived converter should share the memo")
+	}
+
+	checks := []struct {
+		c         *Converter
+		valueType string
+		scale     float64
+	}{
+		{c, "int32", 1.0},
+		{swapped, "int32", 1.0},
+		{c, "uint32", 1.0},
+		{c, "int32", 0.5},
+		{c, "int32", 1.0},
+	}
+	for _, ch := range checks {
+		want, err := NewConverterWithWordOrder(ch.c.ByteOrder(), ch.c.WordOrder()).ToRegisters(70000, ch.valueType, ch.scale, 0)
+		if err != nil {
+			t.Fatalf("ToRegisters() error = %v", err)
+		}
+		got, err := ch.c.ToRegisters(70000, ch.valueType, ch.scale, 0)
+		if err != nil {
+			t.Fatalf("memoized ToRegisters() error = %v", err)
+		}
+		if !bytesEqual(got, want) {
+			t.Errorf("%s/%s scale %v = % X, want % X", ch.c.WordOrder(), ch.valueType, ch.scale, got, want)
+		}
+	}
+	if n := len(c.memo.entries); n > 2 {
+		t.Errorf("memo holds %d entries, want at most 2", n)
+	}
+
+	if _, err := c.ToRegisters("bad", "int16", 1.0, 0); err == nil {
+		t.Error("expected conversion error")
+	}
+	if _, err := c.ToRegisters([]int{1}, "int16", 1.0, 0); err == nil {
+		t.Error("expected conversion error for unhashable value")
+	}
+}
+
+func TestMemoizedEncodeWindowMatchesFresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    []interface{}
+		valueType string
+		scale     float64
+		wantMemo  int
+	}{
+		{"zero block", []interface{}{0.0, 0.0, 0.0, 0.0}, "float32", 1.0, 1},
+		{"repeated values", []interface{}{int16(1), int16(2), int16(1), int16(2)}, "int16", 1.0, 2},
+		{"invalid value not cached", []interface{}{int16(1), "bad", int16(1)}, "int16", 1.0, 1},
+		{"NaN not cached", []interface{}{math.NaN(), 1.5, math.NaN()}, "float32", 1.0, 1},
+		{"scaled", []interface{}{25.5, 25.5}, "uint16", 0.1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fresh := NewConverter(BigEndian)
+			memo := NewConverter(BigEndian)
+			memo.SetMemoSize(8)
+
+			want, wantFailed := fresh.EncodeWindowFailures(tt.values, tt.valueType, tt.scale, 0)
+			for i := 0; i < 2; i++ {
+				got, failed := memo.EncodeWindowFailures(tt.values, tt.valueType, tt.scale, 0)
+				if !bytesEqual(got, want) {
+					t.Errorf("call %d = % X, want % X", i, got, want)
+				}
+				if len(failed) != len(wantFailed) {
+					t.Errorf("call %d failed = %v, want %v", i, failed, wantFailed)
+				}
+			}
+			if n := len(memo.memo.entries); n != tt.wantMemo {
+				t.Errorf("memo holds %d entries, want %d", n, tt.wantMemo)
+			}
+		})
+	}
+}
+
+func TestSetMemoSizeWhileEncoding(t *testing.T) {
+	c := NewConverter(BigEndian)
+	c.SetMemoSize(4)
+	values := []interface{}{0.0, 1.5, 0.0, 1.5}
+	want := NewConverter(BigEndian).EncodeWindow(values, "float32", 1.0, 0)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			c.SetMemoSize(i % 3)
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		if got := c.EncodeWindow(values, "float32", 1.0, 0); !bytesEqual(got, want) {
+			t.Fatalf("EncodeWindow() = % X, want % X", got, want)
+		}
+		if _, err := c.ToRegisters(0.0, "float32", 1.0, 0); err != nil {
+			t.Fatalf("ToRegisters() error = %v", err)
+		}
+	}
+	<-done
+}
+
+func TestFromBytesWithPrecision(t *testing.T) {
+	converter := NewConverter(BigEndian)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		valueType string
+		scale     float64
+		offset    float64
+		precision int
+		expected  interface{}
+	}{
+		{"scaled uint16 rounded", []byte{0x04, 0xD2}, "uint16", 0.01, 0, 2, 12.34},
+		{"scaled int16 rounded", []byte{0xFB, 0x2E}, "int16", 0.01, 0, 2, -12.34},
+		{"fewer decimals than scale", []byte{0x04, 0xD2}, "uint16", 0.01, 0, 1, 12.3},
+		{"offset rounded", []byte{0x00, 0x03}, "uint16", 0.1, 0.2, 1, 0.5},
+		{"zero decimals", []byte{0x04, 0xD2}, "uint16", 0.01, 0, 0, float64(12)},
+		{"bool unchanged", []byte{0x00, 0x01}, "bool", 1, 0, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := converter.FromBytesWithPrecision(tt.data, tt.valueType, tt.scale, tt.offset, TwosComplement, tt.precision)
+			if err != nil {
+				t.Fatalf("FromBytesWithPrecision failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("FromBytesWithPrecision() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	// Negative precision leaves the scaled value untouched
+	raw, _ := converter.FromBytes([]byte{0x00, 0x03}, "uint16", 0.1, 0.2)
+	got, _ := converter.FromBytesWithPrecision([]byte{0x00, 0x03}, "uint16", 0.1, 0.2, TwosComplement, -1)
+	if got != raw {
+		t.Errorf("precision -1 = %v, want unrounded %v", got, raw)
+	}
+}
+
+func TestRawValue(t *testing.T) {
+	converter := NewConverter(BigEndian)
+
+	tests := []struct {
+		name      string
+		value     interface{}
+		valueType string
+		scale     float64
+		offset    float64
+		encoding  SignedEncoding
+		expected  interface{}
+	}{
+		{"scaled uint16", 12.34, "uint16", 0.01, 0, TwosComplement, int64(1234)},
+		{"scaled int16 negative", -12.5, "int16", 0.1, 0, TwosComplement, int64(-125)},
+		{"offset int32", 30.0, "int32", 1, 10, TwosComplement, int64(20)},
+		{"sign magnitude int16", -3.0, "int16", 1, 0, SignMagnitude, int64(-3)},
+		{"float32", 1.5, "float32", 0.5, 0, TwosComplement, float64(3)},
+		{"bool", true, "bool", 1, 0, TwosComplement, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := converter.RawValue(tt.value, tt.valueType, tt.scale, tt.offset, tt.encoding)
+			if err != nil {
+				t.Fatalf("RawValue failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("RawValue() = %v (%T), want %v (%T)", got, got, tt.expected, tt.expected)
+			}
+		})
+	}
+
+	if _, err := converter.RawValue("abc", "uint16", 1, 0, TwosComplement); err == nil {
+		t.Error("expected error for unconvertible value")
+	}
+}
+
+func TestDecodeString(t *testing.T) {
+	tests := []struct {
+		name  string
+		order ByteOrder
+		data  []byte
+		want  string
+	}{
+		{"even length", BigEndian, []byte("ABCD"), "ABCD"},
+		{"NUL padded", BigEndian, []byte{'H', 'E', 'L', 'L', 'O', 0x00}, "HELLO"},
+		{"space padded", BigEndian, []byte("OK  "), "OK"},
+		{"little endian swaps bytes", LittleEndian, []byte{'E', 'H', 'L', 'L', 0x00, 'O'}, "HELLO"},
+		{"empty", BigEndian, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewConverter(tt.order).DecodeString(tt.data); got != tt.want {
+				t.Errorf("DecodeString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectOrder(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          []byte
+		magic         uint32
+		wantByteOrder ByteOrder
+		wantWordOrder WordOrder
+		wantErr       bool
+	}{
+		{"one register big endian", []byte{0x12, 0x34}, 0x1234, BigEndian, HighWordFirst, false},
+		{"one register little endian", []byte{0x34, 0x12}, 0x1234, LittleEndian, LowWordFirst, false},
+		{"ABCD", []byte{0x12, 0x34, 0x56, 0x78}, 0x12345678, BigEndian, HighWordFirst, false},
+		{"CDAB", []byte{0x56, 0x78, 0x12, 0x34}, 0x12345678, BigEndian, LowWordFirst, false},
+		{"BADC", []byte{0x34, 0x12, 0x78, 0x56}, 0x12345678, LittleEndian, HighWordFirst, false},
+		{"DCBA", []byte{0x78, 0x56, 0x34, 0x12}, 0x12345678, LittleEndian, LowWordFirst, false},
+		{"no match", []byte{0x00, 0x01}, 0x1234, 0, 0, true},
+		{"ambiguous magic", []byte{0x12, 0x12}, 0x1212, 0, 0, true},
+		{"ambiguous word order", []byte{0x12, 0x34, 0x12, 0x34}, 0x12341234, 0, 0, true},
+		{"magic too wide for one register", []byte{0x12, 0x34}, 0x12345678, 0, 0, true},
+		{"odd length", []byte{0x12, 0x34, 0x56}, 0x123456, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := DetectOrder(tt.data, tt.magic)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s/%s", c.ByteOrder(), c.WordOrder())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DetectOrder failed: %v", err)
+			}
+			if c.ByteOrder() != tt.wantByteOrder || c.WordOrder() != tt.wantWordOrder {
+				t.Errorf("detected %s/%s, want %s/%s", c.ByteOrder(), c.WordOrder(), tt.wantByteOrder, tt.wantWordOrder)
+			}
+		})
+	}
+}
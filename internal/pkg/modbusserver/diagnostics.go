@@ -0,0 +1,124 @@
+package modbusserver
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/tbrandon/mbserver"
+)
+
+// 诊断子功能码 (功能码 0x08)
+const (
+	DiagReturnQueryData        uint16 = 0x0000 // 回送查询数据
+	DiagClearCounters          uint16 = 0x000A // 清除计数器
+	DiagBusMessageCount        uint16 = 0x000B // 总线报文计数
+	DiagBusCommErrorCount      uint16 = 0x000C // 总线通信错误计数
+	DiagBusExceptionErrorCount uint16 = 0x000D // 异常响应计数
+	DiagServerMessageCount     uint16 = 0x000E // 本站报文计数
+	DiagServerNoResponseCount  uint16 = 0x000F // 本站无响应计数
+)
+
+// RegisterCounters 记录Modbus服务器的通信统计
+// CRC/帧错误在mbserver内部被丢弃，无法在此观察到，因此不统计通信错误
+type RegisterCounters struct {
+	busMessages    atomic.Uint64
+	exceptions     atomic.Uint64
+	serverMessages atomic.Uint64
+}
+
+// CounterSnapshot 是计数器在某一时刻的快照
+type CounterSnapshot struct {
+	BusMessages    uint64
+	Exceptions     uint64
+	ServerMessages uint64
+}
+
+// Snapshot 返回当前计数器值
+func (c *RegisterCounters) Snapshot() CounterSnapshot {
+	return CounterSnapshot{
+		BusMessages:    c.busMessages.Load(),
+		Exceptions:     c.exceptions.Load(),
+		ServerMessages: c.serverMessages.Load(),
+	}
+}
+
+// Reset 清零所有计数器
+func (c *RegisterCounters) Reset() {
+	c.busMessages.Store(0)
+	c.exceptions.Store(0)
+	c.serverMessages.Store(0)
+}
+
+// record 根据处理结果更新计数器
+func (c *RegisterCounters) record(exception *mbserver.Exception) {
+	c.busMessages.Add(1)
+	c.serverMessages.Add(1)
+	if exception != nil && exception != &mbserver.Success {
+		c.exceptions.Add(1)
+	}
+}
+
+// FunctionHandler 是mbserver功能码处理程序的签名
+type FunctionHandler func(*mbserver.Server, mbserver.Framer) ([]byte, *mbserver.Exception)
+
+// Counters 返回服务器通信统计快照
+func (s *ModbusServer) Counters() CounterSnapshot {
+	return s.counters.Snapshot()
+}
+
+// handleDiagnostics 处理功能码 0x08 - 诊断
+// 计数器子功能返回当前统计值（截断为16位），不包含本次诊断请求
+func (s *ModbusServer) handleDiagnostics(srv *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+	data := frame.GetData()
+	if len(data) < 4 || len(data)%2 != 0 {
+		return nil, &mbserver.IllegalDataValue
+	}
+
+	subFunction := uint16(data[0])<<8 | uint16(data[1])
+	s.lc.Debug(fmt.Sprintf("Diagnostics: sub-function=0x%04X", subFunction))
+
+	snapshot := s.counters.Snapshot()
+	var value uint64
+	switch subFunction {
+	case DiagReturnQueryData:
+		return data, &mbserver.Success
+	case DiagClearCounters:
+		s.counters.Reset()
+		return data, &mbserver.Success
+	case DiagBusMessageCount:
+		value = snapshot.BusMessages
+	case DiagBusExceptionErrorCount:
+		value = snapshot.Exceptions
+	case DiagServerMessageCount:
+		value = snapshot.ServerMessages
+	case DiagBusCommErrorCount, DiagServerNoResponseCount:
+		value = 0 // 无法观测，恒为0
+	default:
+		return nil, &mbserver.IllegalFunction
+	}
+
+	return []byte{data[0], data[1], byte(value >> 8), byte(value)}, &mbserver.Success
+}
+
+// handleReadExceptionStatus 处理功能码 0x07 - 读异常状态
+// 状态字节的第i位取自配置的第i个线圈地址，无缓存数据的线圈按0返回
+func (s *ModbusServer) handleReadExceptionStatus(srv *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+	var status byte
+	for i, addr := range s.config.ExceptionStatusCoils {
+		if i >= config.MaxExceptionStatusCoils {
+			break
+		}
+		result, err := s.reader.ReadCoils(addr, 1)
+		if err != nil {
+			s.lc.Error(fmt.Sprintf("Read exception status coil %d error: %s", addr, err.Error()))
+			return nil, &mbserver.SlaveDeviceFailure
+		}
+		if result.Data[1]&0x01 != 0 {
+			status |= 1 << uint(i)
+		}
+	}
+
+	s.lc.Debug(fmt.Sprintf("ReadExceptionStatus: status=0x%02X", status))
+	return []byte{status}, &mbserver.Success
+}
@@ -12,4 +12,19 @@ type ModbusServerInterface interface {
 
 	// IsRunning returns whether the server is running
 	IsRunning() bool
+
+	// Pause makes the server answer every request with Slave Device Busy while keeping connections open
+	Pause()
+
+	// Resume ends a pause and serves requests again
+	Resume()
+
+	// IsPaused returns whether the server is paused
+	IsPaused() bool
+
+	// Capabilities returns the function codes that currently have a handler, in ascending order
+	Capabilities() []uint8
+
+	// Addr returns the resolved listen address (empty until started)
+	Addr() string
 }
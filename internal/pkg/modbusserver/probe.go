@@ -0,0 +1,63 @@
+package modbusserver
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ProbeOrder 按 OrderProbe 配置从探测寄存器的魔数推断字节/字顺序，未启用时直接返回
+// 应在 Start 之前调用；探测地址尚无缓存值时等待其第一次更新，最长 OrderProbe.Timeout。
+// 探测值视为设备上报的原始寄存器内容，按网络字节序（大端、高位字在前）还原为寄存器字节后交给 DetectOrder。
+// 探测失败时保留当前顺序并返回错误
+func (s *ModbusServer) ProbeOrder(ctx context.Context) error {
+	probe := s.config.OrderProbe
+	if !probe.Enabled {
+		return nil
+	}
+
+	valueType := "uint16"
+	if probe.Magic > math.MaxUint16 {
+		valueType = "uint32"
+	}
+	addr, _ := s.config.AddressOffsets.ResourceKey("", probe.Address)
+	value, err := s.probeValue(ctx, addr, probe.GetTimeout())
+	if err != nil {
+		return err
+	}
+	data, err := NewConverter(BigEndian).ToRegisters(value, valueType, 1.0, 0)
+	if err != nil {
+		return fmt.Errorf("order probe at address %d: %w", probe.Address, err)
+	}
+	if err := s.reader.ProbeOrder(data, probe.Magic); err != nil {
+		return fmt.Errorf("order probe at address %d: %w", probe.Address, err)
+	}
+	return nil
+}
+
+// probeValue 返回 addr 的缓存值，尚无缓存时等待其第一次更新
+func (s *ModbusServer) probeValue(ctx context.Context, addr config.AddressKey, timeout time.Duration) (interface{}, error) {
+	// 先订阅再查缓存，避免错过两者之间到达的更新
+	sub := s.mappingManager.Subscribe(addr)
+	defer s.mappingManager.Unsubscribe(addr, sub)
+	if cached, ok := s.mappingManager.GetCachedValue(addr); ok {
+		return cached.Value, nil
+	}
+
+	s.lc.Info(fmt.Sprintf("Waiting up to %s for the order probe value at address %v", timeout, addr))
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case update, ok := <-sub:
+		if !ok {
+			return nil, fmt.Errorf("order probe at address %v: subscription closed", addr)
+		}
+		return update.Value, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("order probe at address %v: no value within %s", addr, timeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
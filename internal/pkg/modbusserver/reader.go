@@ -1,21 +1,74 @@
 package modbusserver
 
 import (
+	"app-modbus-go/internal/pkg/config"
 	"app-modbus-go/internal/pkg/logger"
 	"app-modbus-go/internal/pkg/mappingmanager"
+	"app-modbus-go/internal/pkg/mqtt"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 质量寄存器的取值，未配置或未映射的寄存器读取为0，与无数据含义一致
+const (
+	QualityNoData uint16 = 0 // 无缓存数据（从未收到或已过期清除）
+	QualityGood   uint16 = 1 // 缓存值在TTL内
+	QualityStale  uint16 = 2 // 已过期但仍在宽限期内或保持最后值
 )
 
 // ReadResult 表示一次Modbus读取的结果
 type ReadResult struct {
 	Data          []byte                            // Modbus响应数据
 	ForwardedData map[string]map[string]interface{} // 按设备分组的转发数据: deviceName -> {resourceName: value}
+	ReadTime      time.Time                         // 从缓存读取数据的时间
+	Quality       []bool                            // 位读取时每个请求位是否有缓存数据（仅用于诊断，不随Modbus响应发送）
+
+	ConversionErrors map[string]map[string]uint64 // 本次读取中类型转换失败的资源及其累计失败次数: deviceName -> {resourceName: count}
+}
+
+// conversionErrors 按设备和资源累计类型转换失败次数，读取器的副本共享同一计数
+type conversionErrors struct {
+	mu     sync.Mutex
+	counts map[string]map[string]uint64
+}
+
+// add 累加一次失败并返回该资源的累计次数
+func (e *conversionErrors) add(deviceName, resourceName string) uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.counts[deviceName] == nil {
+		e.counts[deviceName] = make(map[string]uint64)
+	}
+	e.counts[deviceName][resourceName]++
+	return e.counts[deviceName][resourceName]
+}
+
+// snapshot 返回当前计数的副本
+func (e *conversionErrors) snapshot() map[string]map[string]uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	result := make(map[string]map[string]uint64, len(e.counts))
+	for dev, resources := range e.counts {
+		result[dev] = make(map[string]uint64, len(resources))
+		for res, n := range resources {
+			result[dev][res] = n
+		}
+	}
+	return result
 }
 
 // RegisterReader 处理Modbus寄存器读取
 type RegisterReader struct {
 	mappingManager mappingmanager.MappingManagerInterface
-	converter      *Converter
+	converter      *atomic.Pointer[Converter] // 读取器副本共享，探测顺序后整体替换
+	addressOffsets *config.AddressOffsetConfig
+	oneBased       bool                                    // 资源地址从1开始编号
+	quality        map[config.AddressKey]config.AddressKey // 质量寄存器地址 -> 被监视的数据寄存器地址
+	convErrors     *conversionErrors
 	lc             logger.LoggingClient
 }
 
@@ -25,42 +78,181 @@ func NewRegisterReader(
 	conv *Converter,
 	lc logger.LoggingClient,
 ) *RegisterReader {
+	converter := &atomic.Pointer[Converter]{}
+	converter.Store(conv)
 	return &RegisterReader{
 		mappingManager: mm,
-		converter:      conv,
+		converter:      converter,
+		convErrors:     &conversionErrors{counts: make(map[string]map[string]uint64)},
 		lc:             lc,
 	}
 }
 
+// ConversionErrors 返回按设备和资源累计的类型转换失败次数
+func (r *RegisterReader) ConversionErrors() map[string]map[string]uint64 {
+	return r.convErrors.snapshot()
+}
+
+// recordConversionError 累计资源的转换失败，并在读取结果中记录其累计次数
+func (r *RegisterReader) recordConversionError(result *ReadResult, data *mappingmanager.CachedData) {
+	count := r.convErrors.add(data.NorthDevName, data.ResourceName)
+	if result.ConversionErrors == nil {
+		result.ConversionErrors = make(map[string]map[string]uint64)
+	}
+	if result.ConversionErrors[data.NorthDevName] == nil {
+		result.ConversionErrors[data.NorthDevName] = make(map[string]uint64)
+	}
+	result.ConversionErrors[data.NorthDevName][data.ResourceName] = count
+}
+
+// SetAddressOffsets 设置各对象类型的基地址偏移
+func (r *RegisterReader) SetAddressOffsets(offsets *config.AddressOffsetConfig) {
+	r.addressOffsets = offsets
+}
+
+// ProbeOrder 根据探测寄存器中的魔数推断字节/字顺序，检测成功后替换读取器的转换器
+// 新转换器沿用原转换器的编码缓存；替换是原子的，但应在服务器开始处理请求之前调用，
+// 避免同一响应中的资源以不同顺序编码
+func (r *RegisterReader) ProbeOrder(data []byte, magic uint32) error {
+	converter, err := DetectOrder(data, magic)
+	if err != nil {
+		return err
+	}
+	converter.memo = r.Converter().memo
+	r.converter.Store(converter)
+	r.lc.Info(fmt.Sprintf("Detected register order from probe: byte order %s, word order %s",
+		converter.ByteOrder(), converter.WordOrder()))
+	return nil
+}
+
+// Converter 返回读取器当前使用的全局转换器
+func (r *RegisterReader) Converter() *Converter {
+	return r.converter.Load()
+}
+
+// WithLogger 返回使用指定记录器的读取器副本，用于为单个请求的日志附加关联ID
+func (r *RegisterReader) WithLogger(lc logger.LoggingClient) *RegisterReader {
+	cp := *r
+	cp.lc = lc
+	return &cp
+}
+
+// SetOneBased 设置资源地址是否使用从1开始的文档编号
+func (r *RegisterReader) SetOneBased(oneBased bool) {
+	r.oneBased = oneBased
+}
+
+// SetQualityRegisters 设置质量寄存器，读取时返回关联数据寄存器的质量码而不是缓存值
+// 两个地址都按未指定对象类型的资源地址换算为缓存键，因此应在 SetAddressOffsets 之后调用
+func (r *RegisterReader) SetQualityRegisters(regs []config.QualityRegisterConfig) {
+	if len(regs) == 0 {
+		r.quality = nil
+		return
+	}
+	r.quality = make(map[config.AddressKey]config.AddressKey, len(regs))
+	for _, q := range regs {
+		addr, _ := r.addressOffsets.ResourceKey("", q.Address)
+		dataAddr, _ := r.addressOffsets.ResourceKey("", q.DataAddress)
+		r.quality[addr] = dataAddr
+	}
+}
+
+// qualityOf 返回数据寄存器当前缓存值的质量码
+func (r *RegisterReader) qualityOf(dataAddr config.AddressKey) uint16 {
+	data, ok := r.mappingManager.GetCachedValue(dataAddr)
+	switch {
+	case !ok || data == nil:
+		return QualityNoData
+	case data.Stale:
+		return QualityStale
+	default:
+		return QualityGood
+	}
+}
+
+// ErrAddressOutOfRange 表示请求的地址范围超出对象类型的地址表
+var ErrAddressOutOfRange = errors.New("address out of range")
+
+// ResolveAddress 返回对象类型从PDU地址 addr 开始的 quantity 个地址中首个地址的缓存键
+// PDU地址总是对象类型表内的地址：配置了基地址偏移的类型使用独立的地址表（见 AddressOffsetConfig.Key），不同对象类型的同一地址互不冲突；
+// 资源地址从1开始编号时，PDU地址加1后查询（PDU地址0对应寄存器1）。整个范围超出地址表时返回 false
+func (r *RegisterReader) ResolveAddress(objectType string, addr, quantity uint16) (config.AddressKey, bool) {
+	key := r.addressOffsets.Key(objectType, addr)
+	if r.oneBased {
+		var ok bool
+		if key, ok = key.Add(1); !ok {
+			return 0, false
+		}
+	}
+	if quantity > 0 {
+		if _, ok := key.Add(int(quantity) - 1); !ok {
+			return 0, false
+		}
+	}
+	return key, true
+}
+
+// resolveRange 返回读取范围首个地址的缓存键，超出范围时返回 ErrAddressOutOfRange
+func (r *RegisterReader) resolveRange(objectType string, addr, quantity uint16) (config.AddressKey, error) {
+	key, ok := r.ResolveAddress(objectType, addr, quantity)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s %d+%d", ErrAddressOutOfRange, objectType, addr, quantity)
+	}
+	return key, nil
+}
+
 // ReadHoldingRegisters 读取保持寄存器 (功能码 0x03)
 func (r *RegisterReader) ReadHoldingRegisters(startAddr uint16, quantity uint16) (*ReadResult, error) {
-	return r.readRegisters(startAddr, quantity, "HoldingRegisters")
+	key, err := r.resolveRange(config.ObjectHoldingRegister, startAddr, quantity)
+	if err != nil {
+		return nil, err
+	}
+	return r.readRegisters(key, quantity, "HoldingRegisters")
 }
 
 // ReadInputRegisters 读取输入寄存器 (功能码 0x04)
 func (r *RegisterReader) ReadInputRegisters(startAddr uint16, quantity uint16) (*ReadResult, error) {
-	return r.readRegisters(startAddr, quantity, "InputRegisters")
+	key, err := r.resolveRange(config.ObjectInputRegister, startAddr, quantity)
+	if err != nil {
+		return nil, err
+	}
+	return r.readRegisters(key, quantity, "InputRegisters")
 }
 
 // readRegisters 通用寄存器读取逻辑
-func (r *RegisterReader) readRegisters(startAddr uint16, quantity uint16, regType string) (*ReadResult, error) {
-	r.lc.Debug(fmt.Sprintf("[%s] 读取寄存器 - 起始地址:%d, 数量:%d", regType, startAddr, quantity))
+func (r *RegisterReader) readRegisters(startAddr config.AddressKey, quantity uint16, regType string) (*ReadResult, error) {
+	r.lc.Debug(fmt.Sprintf("[%s] 读取寄存器 - 起始地址:%v, 数量:%d", regType, startAddr, quantity))
 
 	// 构建响应: 字节数 + 寄存器值
 	result := &ReadResult{
 		Data:          make([]byte, 1+quantity*2),
 		ForwardedData: make(map[string]map[string]interface{}),
+		ReadTime:      time.Now(),
 	}
 	result.Data[0] = byte(quantity * 2)
 
+	// 一次取出整个范围的缓存条目，每个资源只在其首地址解析一次，避免逐寄存器查询
+	block, err := r.mappingManager.GetCachedRegisters(startAddr, quantity)
+	if err != nil {
+		return nil, fmt.Errorf("read cached registers %v+%d: %w", startAddr, quantity, err)
+	}
+
 	offset := 1
 	currentReg := uint16(0)
 
 	for currentReg < quantity {
-		queryAddr := startAddr + currentReg
-		data, ok := r.mappingManager.GetCachedValue(queryAddr)
+		// 范围已由 resolveRange 检查，不会超出地址表
+		queryAddr := startAddr + config.AddressKey(currentReg)
+		data := block[currentReg]
+
+		if dataAddr, ok := r.quality[queryAddr]; ok {
+			r.Converter().putUint16(result.Data[offset:], r.qualityOf(dataAddr))
+			offset += 2
+			currentReg++
+			continue
+		}
 
-		if !ok || data == nil {
+		if data == nil {
 			// 无缓存数据，返回零值
 			result.Data[offset] = 0
 			result.Data[offset+1] = 0
@@ -69,13 +261,78 @@ func (r *RegisterReader) readRegisters(startAddr uint16, quantity uint16, regTyp
 			continue
 		}
 
+		// 根据符号模式标志确定实际类型
+		valueType := r.resolveValueType(data.ValueType, data.SignedFlagAddr)
+
+		// 拆分到两个地址的32位值在每个地址只占一个寄存器
+		if data.WordPart > 0 {
+			if word, err := r.splitWord(data, valueType); err != nil {
+				r.lc.Warn(fmt.Sprintf("[%s] 地址 %v: 类型转换失败 - %s", regType, queryAddr, err.Error()))
+				r.recordConversionError(result, data)
+			} else {
+				copy(result.Data[offset:offset+2], word)
+				r.collectForwardData(result.ForwardedData, data.NorthDevName, data.ResourceName, data.Value)
+			}
+			offset += 2
+			currentReg++
+			continue
+		}
+
+		// 多寄存器值必须独占其跨度内的所有寄存器，否则整个跨度返回零值，避免混合不同资源的字
+		if span := uint16(r.Converter().GetRegisterCount(valueType)); span > 1 {
+			if owner, conflict := r.spanConflict(queryAddr, span); conflict {
+				r.lc.Warn(fmt.Sprintf("[%s] 地址 %v: %s/%s 的 %d 个寄存器跨度与地址 %v 的资源 %s 重叠，返回零值",
+					regType, queryAddr, data.NorthDevName, data.ResourceName, span, owner, r.resourceAt(owner)))
+				if span > quantity-currentReg {
+					span = quantity - currentReg
+				}
+				// result.Data 已初始化为零值
+				offset += int(span) * 2
+				currentReg += span
+				continue
+			}
+		}
+
+		// 同类型的连续资源一次编码
+		if run := r.collectRun(queryAddr, block[currentReg:], valueType); len(run) > 1 {
+			values := make([]interface{}, len(run))
+			for i, d := range run {
+				values[i] = d.Value
+			}
+			window, failed := r.Converter().EncodeWindowFailures(values, valueType, data.Scale, data.Offset)
+			width := uint16(r.Converter().GetRegisterCount(valueType))
+			for i, d := range run {
+				if len(failed) > 0 && failed[0] == i {
+					failed = failed[1:]
+					r.lc.Warn(fmt.Sprintf("[%s] 地址 %v: %s/%s 类型转换失败，返回零值",
+						regType, queryAddr+config.AddressKey(uint16(i)*width), d.NorthDevName, d.ResourceName))
+					r.recordConversionError(result, d)
+					continue
+				}
+				r.collectForwardData(result.ForwardedData, d.NorthDevName, d.ResourceName, d.Value)
+			}
+			copy(result.Data[offset:], window)
+			offset += len(window)
+			currentReg += uint16(len(window) / 2)
+			continue
+		}
+
 		// 计算该数据类型需要的寄存器数量
-		registerCount := r.converter.GetRegisterCount(data.ValueType)
+		registerCount := r.Converter().GetRegisterCount(valueType)
 
 		// 将值转换为字节
-		bytes, err := r.converter.ToRegisters(data.Value, data.ValueType, data.Scale, data.Offset)
+		converter, err := r.converterFor(data.WordOrder)
+		var bytes []byte
+		if err == nil {
+			var encoding SignedEncoding
+			encoding, err = ParseSignedEncoding(data.SignedEncoding)
+			if err == nil {
+				bytes, err = converter.ToRegistersWithEncoding(data.Value, valueType, data.Scale, data.Offset, encoding)
+			}
+		}
 		if err != nil {
-			r.lc.Warn(fmt.Sprintf("[%s] 地址 %d: 类型转换失败 - %s", regType, queryAddr, err.Error()))
+			r.lc.Warn(fmt.Sprintf("[%s] 地址 %v: 类型转换失败 - %s", regType, queryAddr, err.Error()))
+			r.recordConversionError(result, data)
 			result.Data[offset] = 0
 			result.Data[offset+1] = 0
 			offset += 2
@@ -113,19 +370,206 @@ func (r *RegisterReader) readRegisters(startAddr uint16, quantity uint16, regTyp
 	return result, nil
 }
 
+// collectRun 从 startAddr 开始收集与首个条目类型、缩放和偏移相同且地址紧邻的缓存条目
+// block 是从 startAddr 开始的剩余缓存条目，只收集完全落在其中的条目；使用非默认编码或字顺序的资源不参与批量编码
+func (r *RegisterReader) collectRun(startAddr config.AddressKey, block []*mappingmanager.CachedData, valueType string) []*mappingmanager.CachedData {
+	first := block[0]
+	if first.SignedEncoding != "" || first.WordOrder != "" || first.WordPart > 0 {
+		return nil
+	}
+	width := uint16(r.Converter().GetRegisterCount(valueType))
+	remaining := uint16(len(block))
+	if width > remaining {
+		return nil
+	}
+
+	run := []*mappingmanager.CachedData{first}
+	for offset := width; uint16(len(run)+1)*width <= remaining; offset += width {
+		next := startAddr + config.AddressKey(offset)
+		data := block[offset]
+		if data == nil || r.hasSpanConflict(next, width) ||
+			data.SignedEncoding != "" || data.WordOrder != "" || data.WordPart > 0 ||
+			data.Scale != first.Scale || data.Offset != first.Offset ||
+			r.resolveValueType(data.ValueType, data.SignedFlagAddr) != valueType {
+			break
+		}
+		run = append(run, data)
+	}
+	return run
+}
+
+// splitWord 按资源的字顺序编码32位值，返回 data.WordPart 对应的那个字
+func (r *RegisterReader) splitWord(data *mappingmanager.CachedData, valueType string) ([]byte, error) {
+	converter, err := r.converterFor(data.WordOrder)
+	if err != nil {
+		return nil, err
+	}
+	encoding, err := ParseSignedEncoding(data.SignedEncoding)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := converter.ToRegistersWithEncoding(data.Value, valueType, data.Scale, data.Offset, encoding)
+	if err != nil {
+		return nil, err
+	}
+	start := (data.WordPart - 1) * 2
+	if len(bytes) < start+2 {
+		return nil, fmt.Errorf("%s value has no word %d", valueType, data.WordPart)
+	}
+	return bytes[start : start+2], nil
+}
+
+// spanConflict 检查从 addr 开始的 span 个寄存器中，除首地址外是否有其他资源的映射
+// 返回第一个冲突的地址；超出地址表的寄存器没有映射
+func (r *RegisterReader) spanConflict(addr config.AddressKey, span uint16) (config.AddressKey, bool) {
+	for k := 1; k < int(span); k++ {
+		next, ok := addr.Add(k)
+		if !ok {
+			break
+		}
+		if _, ok := r.mappingManager.GetMappingByAddress(next); ok {
+			return next, true
+		}
+	}
+	return 0, false
+}
+
+// hasSpanConflict 返回 addr 处的多寄存器值是否与其他资源重叠
+func (r *RegisterReader) hasSpanConflict(addr config.AddressKey, span uint16) bool {
+	_, conflict := r.spanConflict(addr, span)
+	return conflict
+}
+
+// resourceAt 返回地址映射的资源名称，用于日志
+func (r *RegisterReader) resourceAt(addr config.AddressKey) string {
+	if mapping, ok := r.mappingManager.GetMappingByAddress(addr); ok && mapping.NorthResource != nil {
+		return mapping.NorthResource.Name
+	}
+	return ""
+}
+
+// DecodeRegisters 按地址映射的类型将寄存器字节解码为值，符号性由符号模式标志决定
+// 资源配置了precision时结果按该小数位数四舍五入
+func (r *RegisterReader) DecodeRegisters(addr config.AddressKey, data []byte) (interface{}, error) {
+	codec, err := r.codecFor(addr)
+	if err != nil {
+		return nil, err
+	}
+	return codec.decode(data)
+}
+
+// registerCodec 是资源寄存器与值之间的转换参数
+// 解析时查询符号模式标志的缓存，因此必须在缓存的读改写锁外创建，转换本身不再访问缓存
+type registerCodec struct {
+	converter   *Converter
+	valueType   string
+	encoding    SignedEncoding
+	precision   int
+	readScale   float64
+	readOffset  float64
+	writeScale  float64
+	writeOffset float64
+}
+
+// codecFor 解析地址所映射资源的转换参数
+func (r *RegisterReader) codecFor(addr config.AddressKey) (*registerCodec, error) {
+	mapping, ok := r.mappingManager.GetMappingByAddress(addr)
+	if !ok || mapping.NorthResource == nil {
+		return nil, fmt.Errorf("no mapping for address %v", addr)
+	}
+
+	nr := mapping.NorthResource
+	converter, err := r.converterFor(nr.OtherParameters.Modbus.WordOrder)
+	if err != nil {
+		return nil, err
+	}
+	encoding, err := ParseSignedEncoding(nr.OtherParameters.Modbus.SignedEncoding)
+	if err != nil {
+		return nil, err
+	}
+	codec := &registerCodec{
+		converter: converter,
+		valueType: strings.ToLower(r.resolveValueType(nr.ValueType, r.signedFlagAddress(nr))),
+		encoding:  encoding,
+		precision: -1,
+	}
+	if nr.Precision != nil {
+		codec.precision = *nr.Precision
+	}
+	codec.readScale, codec.readOffset = nr.ReadCalibration()
+	codec.writeScale, codec.writeOffset = nr.WriteCalibration()
+	return codec, nil
+}
+
+// decode 按写入校准将主站写入的寄存器解码为值
+func (c *registerCodec) decode(data []byte) (interface{}, error) {
+	return c.converter.FromBytesWithPrecision(data, c.valueType, c.writeScale, c.writeOffset, c.encoding, c.precision)
+}
+
+// encode 按读取校准将值编码为寄存器
+func (c *registerCodec) encode(value interface{}) ([]byte, error) {
+	return c.converter.ToRegistersWithEncoding(value, c.valueType, c.readScale, c.readOffset, c.encoding)
+}
+
+// converterFor 返回按资源字顺序调整后的转换器，未配置时使用全局转换器
+func (r *RegisterReader) converterFor(wordOrder string) (*Converter, error) {
+	if wordOrder == "" {
+		return r.Converter(), nil
+	}
+	order, err := ParseWordOrder(wordOrder)
+	if err != nil {
+		return nil, err
+	}
+	return r.Converter().WithWordOrder(order), nil
+}
+
+// signedFlagAddress 返回资源符号模式标志的缓存键，标志地址按资源的对象类型换算，与映射管理器缓存该标志时一致
+func (r *RegisterReader) signedFlagAddress(nr *mqtt.NorthResource) *config.AddressKey {
+	flag := nr.OtherParameters.Modbus.SignedFlagAddress
+	if flag == nil {
+		return nil
+	}
+	addr, ok := r.addressOffsets.ResourceKey(nr.OtherParameters.Modbus.ObjectType, *flag)
+	if !ok {
+		return nil
+	}
+	return &addr
+}
+
+// resolveValueType 查询符号模式标志，选择有符号或无符号类型
+// 未配置标志或标志无缓存数据时使用静态类型
+func (r *RegisterReader) resolveValueType(valueType string, signedFlagAddr *config.AddressKey) string {
+	if signedFlagAddr == nil {
+		return valueType
+	}
+	flag, ok := r.mappingManager.GetCachedValue(*signedFlagAddr)
+	if !ok || flag == nil {
+		return valueType
+	}
+	return WithSignedness(valueType, r.valueToBool(flag.Value))
+}
+
 // ReadCoils 读取线圈 (功能码 0x01)
 func (r *RegisterReader) ReadCoils(startAddr uint16, quantity uint16) (*ReadResult, error) {
-	return r.readBits(startAddr, quantity, "Coils")
+	key, err := r.resolveRange(config.ObjectCoil, startAddr, quantity)
+	if err != nil {
+		return nil, err
+	}
+	return r.readBits(key, quantity, "Coils")
 }
 
 // ReadDiscreteInputs 读取离散输入 (功能码 0x02)
 func (r *RegisterReader) ReadDiscreteInputs(startAddr uint16, quantity uint16) (*ReadResult, error) {
-	return r.readBits(startAddr, quantity, "DiscreteInputs")
+	key, err := r.resolveRange(config.ObjectDiscreteInput, startAddr, quantity)
+	if err != nil {
+		return nil, err
+	}
+	return r.readBits(key, quantity, "DiscreteInputs")
 }
 
 // readBits 通用位读取逻辑（线圈和离散输入）
-func (r *RegisterReader) readBits(startAddr uint16, quantity uint16, bitType string) (*ReadResult, error) {
-	r.lc.Debug(fmt.Sprintf("[%s] 读取位数据 - 起始地址:%d, 数量:%d", bitType, startAddr, quantity))
+func (r *RegisterReader) readBits(startAddr config.AddressKey, quantity uint16, bitType string) (*ReadResult, error) {
+	r.lc.Debug(fmt.Sprintf("[%s] 读取位数据 - 起始地址:%v, 数量:%d", bitType, startAddr, quantity))
 
 	// 计算字节数（每字节8位，向上取整）
 	byteCount := (quantity + 7) / 8
@@ -133,15 +577,18 @@ func (r *RegisterReader) readBits(startAddr uint16, quantity uint16, bitType str
 	result := &ReadResult{
 		Data:          make([]byte, 1+byteCount),
 		ForwardedData: make(map[string]map[string]interface{}),
+		ReadTime:      time.Now(),
+		Quality:       make([]bool, quantity),
 	}
 	result.Data[0] = byte(byteCount)
 
 	for i := uint16(0); i < quantity; i++ {
-		addr := startAddr + i
-		data, ok := r.mappingManager.GetCachedValue(addr)
+		// 范围已由 resolveRange 检查，不会超出地址表
+		data, ok := r.mappingManager.GetCachedValue(startAddr + config.AddressKey(i))
 
 		var bitValue bool
 		if ok && data != nil {
+			result.Quality[i] = true
 			bitValue = r.valueToBool(data.Value)
 			// 记录成功读取的数据
 			r.collectForwardData(result.ForwardedData, data.NorthDevName, data.ResourceName, data.Value)
@@ -0,0 +1,904 @@
+package modbusserver
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"app-modbus-go/internal/pkg/logger"
+	"app-modbus-go/internal/pkg/mappingmanager"
+	"app-modbus-go/internal/pkg/mqtt"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func createTestReader(t *testing.T) (*RegisterReader, *mappingmanager.MappingManager) {
+	lc := logger.NewClient("ERROR")
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, lc)
+	cacheConfig := &config.CacheConfig{
+		DefaultTTL:      "30s",
+		CleanupInterval: "5m",
+	}
+	mm := mappingmanager.NewMappingManager(mqttClient, lc, cacheConfig)
+
+	nr := &mqtt.NorthResource{
+		Name:      "temperature",
+		ValueType: "int16",
+	}
+	nr.OtherParameters.Modbus.Address = 100
+
+	mappings := []*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{
+					NorthResource: nr,
+					SouthResource: &mqtt.SouthResource{Name: "temperature", ValueType: "int16"},
+				},
+			},
+		},
+	}
+	if err := mm.UpdateMappings(mappings); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+
+	return NewRegisterReader(mm, NewConverter(BigEndian), lc), mm
+}
+
+func TestReadRegistersReadTime(t *testing.T) {
+	reader, mm := createTestReader(t)
+	if err := mm.UpdateCache("device1", map[string]interface{}{"temperature": 25}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	before := time.Now()
+	result, err := reader.ReadHoldingRegisters(100, 1)
+	after := time.Now()
+	if err != nil {
+		t.Fatalf("ReadHoldingRegisters failed: %v", err)
+	}
+
+	if result.ReadTime.Before(before) || result.ReadTime.After(after) {
+		t.Errorf("read time %v not within read window [%v, %v]", result.ReadTime, before, after)
+	}
+	if result.ForwardedData["device1"]["temperature"] != 25 {
+		t.Errorf("expected forwarded value 25, got %v", result.ForwardedData["device1"]["temperature"])
+	}
+}
+
+func TestReadBitsReadTime(t *testing.T) {
+	reader, _ := createTestReader(t)
+
+	before := time.Now()
+	result, err := reader.ReadCoils(100, 8)
+	after := time.Now()
+	if err != nil {
+		t.Fatalf("ReadCoils failed: %v", err)
+	}
+
+	if result.ReadTime.Before(before) || result.ReadTime.After(after) {
+		t.Errorf("read time %v not within read window [%v, %v]", result.ReadTime, before, after)
+	}
+}
+
+func TestDecodeRegistersSignedFlag(t *testing.T) {
+	lc := logger.NewClient("ERROR")
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, lc)
+	cacheConfig := &config.CacheConfig{
+		DefaultTTL:      "30s",
+		CleanupInterval: "5m",
+	}
+	mm := mappingmanager.NewMappingManager(mqttClient, lc, cacheConfig)
+
+	flagAddr := uint16(200)
+	value := &mqtt.NorthResource{Name: "current", ValueType: "uint16"}
+	value.OtherParameters.Modbus.Address = 100
+	value.OtherParameters.Modbus.SignedFlagAddress = &flagAddr
+
+	mode := &mqtt.NorthResource{Name: "signedMode", ValueType: "bool"}
+	mode.OtherParameters.Modbus.Address = flagAddr
+
+	mappings := []*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "meter1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: value, SouthResource: &mqtt.SouthResource{Name: "current"}},
+				{NorthResource: mode, SouthResource: &mqtt.SouthResource{Name: "signedMode"}},
+			},
+		},
+	}
+	if err := mm.UpdateMappings(mappings); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	reader := NewRegisterReader(mm, NewConverter(BigEndian), lc)
+	raw := []byte{0xFF, 0xFF}
+
+	// No flag cached: static uint16 decoding
+	got, err := reader.DecodeRegisters(100, raw)
+	if err != nil {
+		t.Fatalf("DecodeRegisters failed: %v", err)
+	}
+	if got != float64(65535) {
+		t.Errorf("static decode = %v, want 65535", got)
+	}
+
+	tests := []struct {
+		name     string
+		signed   bool
+		expected float64
+	}{
+		{"mode flag signed", true, -1},
+		{"mode flag unsigned", false, 65535},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mm.UpdateCache("meter1", map[string]interface{}{"signedMode": tt.signed})
+
+			got, err := reader.DecodeRegisters(100, raw)
+			if err != nil {
+				t.Fatalf("DecodeRegisters failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("DecodeRegisters() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReadHoldingRegistersAddressOffset(t *testing.T) {
+	lc := logger.NewClient("ERROR")
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, lc)
+	cacheConfig := &config.CacheConfig{
+		DefaultTTL:      "30s",
+		CleanupInterval: "5m",
+	}
+	offsets := &config.AddressOffsetConfig{HoldingRegisters: 40001}
+	mm := mappingmanager.NewMappingManager(mqttClient, lc, cacheConfig)
+	mm.SetAddressOffsets(offsets)
+
+	nr := &mqtt.NorthResource{Name: "pressure", ValueType: "int16"}
+	nr.OtherParameters.Modbus.Address = 40010
+
+	mappings := []*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "pump1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "pressure"}},
+			},
+		},
+	}
+	if err := mm.UpdateMappings(mappings); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if err := mm.UpdateCache("pump1", map[string]interface{}{"pressure": 42}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	key := config.NewAddressKey(config.ObjectHoldingRegister, 9)
+	if _, ok := mm.GetCachedValue(key); !ok {
+		t.Fatalf("expected resource at 40010 to be cached under key %v", key)
+	}
+	if addr, ok := mm.GetAddressByResource("pump1", "pressure"); !ok || addr != key {
+		t.Errorf("GetAddressByResource = %v, %v; want %v, true", addr, ok, key)
+	}
+
+	reader := NewRegisterReader(mm, NewConverter(BigEndian), lc)
+	reader.SetAddressOffsets(offsets)
+
+	// PDU地址总是表内地址：40010 不是资源地址 40010 的别名
+	tests := []struct {
+		start uint16
+		want  []byte
+	}{
+		{9, []byte{0x02, 0x00, 0x2A}},
+		{40010, []byte{0x02, 0x00, 0x00}},
+		{30000, []byte{0x02, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		result, err := reader.ReadHoldingRegisters(tt.start, 1)
+		if err != nil {
+			t.Fatalf("ReadHoldingRegisters(%d) failed: %v", tt.start, err)
+		}
+		if !bytesEqual(result.Data, tt.want) {
+			t.Errorf("ReadHoldingRegisters(%d) data = % X, want % X", tt.start, result.Data, tt.want)
+		}
+	}
+}
+
+func TestAddressOffsetObjectTypes(t *testing.T) {
+	lc := logger.NewClient("ERROR")
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, lc)
+	mm := mappingmanager.NewMappingManager(mqttClient, lc, &config.CacheConfig{DefaultTTL: "30s", CleanupInterval: "5m"})
+	offsets := &config.AddressOffsetConfig{Coils: 1, DiscreteInputs: 10001, HoldingRegisters: 40001}
+	mm.SetAddressOffsets(offsets)
+
+	// 线圈1、离散输入10001与保持寄存器40001的表内地址都是0
+	resource := func(name, valueType, objectType string, addr uint16) *mqtt.ResourceMapping {
+		nr := &mqtt.NorthResource{Name: name, ValueType: valueType}
+		nr.OtherParameters.Modbus.Address = addr
+		nr.OtherParameters.Modbus.ObjectType = objectType
+		return &mqtt.ResourceMapping{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: name}}
+	}
+	mappings := []*mqtt.DeviceMapping{{NorthDeviceName: "pump1", Resources: []*mqtt.ResourceMapping{
+		resource("running", "bool", "", 1),
+		resource("valve", "bool", config.ObjectCoil, 2),
+		resource("alarm", "bool", config.ObjectDiscreteInput, 10001),
+		resource("pressure", "int16", "", 40001),
+		resource("setpoint", "int16", config.ObjectHoldingRegister, 40010),
+		resource("bogus", "int16", "Register", 20),
+		resource("belowBase", "int16", config.ObjectHoldingRegister, 9),
+	}}}
+	if err := mm.UpdateMappings(mappings); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if got := mm.Stats().Skipped[mappingmanager.SkipInvalidAddress]; got != 2 {
+		t.Errorf("invalid address skips = %d, want 2", got)
+	}
+	if err := mm.UpdateCache("pump1", map[string]interface{}{
+		"running": true, "valve": false, "alarm": false, "pressure": 42, "setpoint": 7,
+	}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	reader := NewRegisterReader(mm, NewConverter(BigEndian), lc)
+	reader.SetAddressOffsets(offsets)
+
+	tests := []struct {
+		name     string
+		read     func(start, quantity uint16) (*ReadResult, error)
+		start    uint16
+		quantity uint16
+		want     []byte
+	}{
+		{"coil PDU 0 is coil 1", reader.ReadCoils, 0, 1, []byte{0x01, 0x01}},
+		{"coil PDU 1 is coil 2", reader.ReadCoils, 1, 1, []byte{0x01, 0x00}},
+		{"coils PDU 0-1", reader.ReadCoils, 0, 2, []byte{0x01, 0x01}},
+		{"discrete input PDU 0 is not coil PDU 0", reader.ReadDiscreteInputs, 0, 1, []byte{0x01, 0x00}},
+		{"holding PDU 0", reader.ReadHoldingRegisters, 0, 1, []byte{0x02, 0x00, 0x2A}},
+		{"holding PDU 9", reader.ReadHoldingRegisters, 9, 1, []byte{0x02, 0x00, 0x07}},
+		{"holding PDU 40001 is not an alias", reader.ReadHoldingRegisters, 40001, 1, []byte{0x02, 0x00, 0x00}},
+		{"coil PDU 9 is not the holding register", reader.ReadCoils, 9, 1, []byte{0x01, 0x00}},
+		{"holding PDU 30000 is in range", reader.ReadHoldingRegisters, 30000, 1, []byte{0x02, 0x00, 0x00}},
+		{"holding last table address", reader.ReadHoldingRegisters, 65535, 1, []byte{0x02, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.read(tt.start, tt.quantity)
+			if err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if !bytesEqual(result.Data, tt.want) {
+				t.Errorf("data = % X, want % X", result.Data, tt.want)
+			}
+		})
+	}
+
+	// 超出地址表末尾的读取被拒绝
+	if _, err := reader.ReadHoldingRegisters(65535, 2); !errors.Is(err, ErrAddressOutOfRange) {
+		t.Errorf("out-of-range read error = %v, want ErrAddressOutOfRange", err)
+	}
+}
+
+func TestReadHoldingRegistersArray(t *testing.T) {
+	lc := logger.NewClient("ERROR")
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, lc)
+	cacheConfig := &config.CacheConfig{
+		DefaultTTL:      "30s",
+		CleanupInterval: "5m",
+	}
+	mm := mappingmanager.NewMappingManager(mqttClient, lc, cacheConfig)
+
+	nr := &mqtt.NorthResource{Name: "samples", ValueType: "int16", ArrayLength: 5}
+	nr.OtherParameters.Modbus.Address = 100
+
+	mappings := []*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "scope1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "samples"}},
+			},
+		},
+	}
+	if err := mm.UpdateMappings(mappings); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	// 传感器数据经JSON解码后为 []interface{}
+	samples := []interface{}{float64(1), float64(-2), float64(3), float64(-4), float64(5)}
+	if err := mm.UpdateCache("scope1", map[string]interface{}{"samples": samples}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	last, ok := mm.GetCachedValue(104)
+	if !ok {
+		t.Fatal("expected last array element cached at address 104")
+	}
+	if last.ResourceName != "samples[4]" {
+		t.Errorf("element resource name = %s, want samples[4]", last.ResourceName)
+	}
+
+	reader := NewRegisterReader(mm, NewConverter(BigEndian), lc)
+	result, err := reader.ReadHoldingRegisters(100, 5)
+	if err != nil {
+		t.Fatalf("ReadHoldingRegisters failed: %v", err)
+	}
+
+	expected := []byte{0x0A, 0x00, 0x01, 0xFF, 0xFE, 0x00, 0x03, 0xFF, 0xFC, 0x00, 0x05}
+	if !bytesEqual(result.Data, expected) {
+		t.Errorf("packed array = % X, want % X", result.Data, expected)
+	}
+	if len(result.ForwardedData["scope1"]) != 5 {
+		t.Errorf("expected 5 forwarded elements, got %v", result.ForwardedData["scope1"])
+	}
+}
+
+func TestReadHoldingRegistersResourceWordOrder(t *testing.T) {
+	reader, mm := createTestReader(t)
+
+	swapped := &mqtt.NorthResource{Name: "energy", ValueType: "int32"}
+	swapped.OtherParameters.Modbus.Address = 200
+	swapped.OtherParameters.Modbus.WordOrder = "lowWordFirst"
+	plain := &mqtt.NorthResource{Name: "power", ValueType: "int32"}
+	plain.OtherParameters.Modbus.Address = 202
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "meter1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: swapped, SouthResource: &mqtt.SouthResource{Name: "energy"}},
+				{NorthResource: plain, SouthResource: &mqtt.SouthResource{Name: "power"}},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if err := mm.UpdateCache("meter1", map[string]interface{}{"energy": -100000, "power": -100000}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	result, err := reader.ReadHoldingRegisters(200, 4)
+	if err != nil {
+		t.Fatalf("ReadHoldingRegisters failed: %v", err)
+	}
+	want := []byte{0x08, 0x79, 0x60, 0xFF, 0xFE, 0xFF, 0xFE, 0x79, 0x60}
+	if !bytesEqual(result.Data, want) {
+		t.Errorf("data = % X, want % X", result.Data, want)
+	}
+
+	value, err := reader.DecodeRegisters(200, result.Data[1:5])
+	if err != nil {
+		t.Fatalf("DecodeRegisters failed: %v", err)
+	}
+	if value != float64(-100000) {
+		t.Errorf("decoded value = %v, want -100000", value)
+	}
+}
+
+func TestReadHoldingRegistersSameTypeRun(t *testing.T) {
+	reader, mm := createTestReader(t)
+
+	var resources []*mqtt.ResourceMapping
+	for i, name := range []string{"l1", "l2", "l3"} {
+		nr := &mqtt.NorthResource{Name: name, ValueType: "float32", Scale: 0.5}
+		nr.OtherParameters.Modbus.Address = uint16(300 + 2*i)
+		resources = append(resources, &mqtt.ResourceMapping{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: name}})
+	}
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{NorthDeviceName: "meter1", Resources: resources}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if err := mm.UpdateCache("meter1", map[string]interface{}{"l1": 230.0, "l2": 231.5, "l3": 229.0}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	// Read the run plus one register of the last value to cover a truncated tail
+	result, err := reader.ReadHoldingRegisters(300, 5)
+	if err != nil {
+		t.Fatalf("ReadHoldingRegisters failed: %v", err)
+	}
+
+	c := NewConverter(BigEndian)
+	want := []byte{10}
+	for _, v := range []float64{230.0, 231.5, 229.0} {
+		bytes, _ := c.ToRegisters(v, "float32", 0.5, 0)
+		want = append(want, bytes...)
+	}
+	want = want[:11]
+	if !bytesEqual(result.Data, want) {
+		t.Errorf("data = % X, want % X", result.Data, want)
+	}
+	if got := len(result.ForwardedData["meter1"]); got != 3 {
+		t.Errorf("forwarded %d resources, want 3", got)
+	}
+}
+
+func TestReadWriteCalibration(t *testing.T) {
+	float := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name         string
+		nr           mqtt.NorthResource
+		wantRegister uint16  // register served for a cached value of 25
+		wantDecoded  float64 // value decoded when the master writes that register back
+	}{
+		{
+			name:         "symmetric",
+			nr:           mqtt.NorthResource{Scale: 0.5},
+			wantRegister: 50,
+			wantDecoded:  25,
+		},
+		{
+			name:         "asymmetric offset",
+			nr:           mqtt.NorthResource{Scale: 0.5, ReadOffsetValue: float(1), WriteOffsetValue: float(-1)},
+			wantRegister: 48,
+			wantDecoded:  23,
+		},
+		{
+			name:         "write scale only",
+			nr:           mqtt.NorthResource{Scale: 0.5, OffsetValue: 5, WriteScale: float(2)},
+			wantRegister: 40,
+			wantDecoded:  85,
+		},
+		{
+			name:         "read scale only",
+			nr:           mqtt.NorthResource{Scale: 0.5, ReadScale: float(0.25)},
+			wantRegister: 100,
+			wantDecoded:  50,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, mm := createTestReader(t)
+
+			nr := tt.nr
+			nr.Name = "setpoint"
+			nr.ValueType = "int16"
+			nr.OtherParameters.Modbus.Address = 400
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+				NorthDeviceName: "dev1",
+				Resources:       []*mqtt.ResourceMapping{{NorthResource: &nr, SouthResource: &mqtt.SouthResource{Name: "setpoint"}}},
+			}}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+			if err := mm.UpdateCache("dev1", map[string]interface{}{"setpoint": 25.0}); err != nil {
+				t.Fatalf("UpdateCache failed: %v", err)
+			}
+
+			result, err := reader.ReadHoldingRegisters(400, 1)
+			if err != nil {
+				t.Fatalf("ReadHoldingRegisters failed: %v", err)
+			}
+			want := []byte{2, byte(tt.wantRegister >> 8), byte(tt.wantRegister)}
+			if !bytesEqual(result.Data, want) {
+				t.Errorf("data = % X, want % X", result.Data, want)
+			}
+
+			value, err := reader.DecodeRegisters(400, result.Data[1:])
+			if err != nil {
+				t.Fatalf("DecodeRegisters failed: %v", err)
+			}
+			if value != tt.wantDecoded {
+				t.Errorf("decoded value = %v, want %v", value, tt.wantDecoded)
+			}
+		})
+	}
+}
+
+func TestReadHoldingRegistersOverlappingSpan(t *testing.T) {
+	reader, mm := createTestReader(t)
+
+	// Misconfiguration: "status" sits inside the float32 span of "flow"
+	flow := &mqtt.NorthResource{Name: "flow", ValueType: "float32"}
+	flow.OtherParameters.Modbus.Address = 1000
+	status := &mqtt.NorthResource{Name: "status", ValueType: "uint16"}
+	status.OtherParameters.Modbus.Address = 1001
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "meter1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: flow, SouthResource: &mqtt.SouthResource{Name: "flow"}},
+				{NorthResource: status, SouthResource: &mqtt.SouthResource{Name: "status"}},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if err := mm.UpdateCache("meter1", map[string]interface{}{"flow": 12.5, "status": 7}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		start         uint16
+		quantity      uint16
+		want          []byte
+		wantForwarded []string
+	}{
+		{"span conflict returns zeros", 1000, 2, []byte{0x04, 0x00, 0x00, 0x00, 0x00}, nil},
+		{"conflicting word served alone", 1001, 1, []byte{0x02, 0x00, 0x07}, []string{"status"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := reader.ReadHoldingRegisters(tt.start, tt.quantity)
+			if err != nil {
+				t.Fatalf("ReadHoldingRegisters failed: %v", err)
+			}
+			if !bytesEqual(result.Data, tt.want) {
+				t.Errorf("data = % X, want % X", result.Data, tt.want)
+			}
+			forwarded := result.ForwardedData["meter1"]
+			if len(forwarded) != len(tt.wantForwarded) {
+				t.Fatalf("forwarded = %v, want %v", forwarded, tt.wantForwarded)
+			}
+			for _, name := range tt.wantForwarded {
+				if _, ok := forwarded[name]; !ok {
+					t.Errorf("expected %s to be forwarded, got %v", name, forwarded)
+				}
+			}
+		})
+	}
+}
+
+// countingMappingManager 统计逐地址缓存查询的次数
+type countingMappingManager struct {
+	mappingmanager.MappingManagerInterface
+	cachedValueCalls int
+}
+
+func (c *countingMappingManager) GetCachedValue(addr config.AddressKey) (*mappingmanager.CachedData, bool) {
+	c.cachedValueCalls++
+	return c.MappingManagerInterface.GetCachedValue(addr)
+}
+
+func TestReadHoldingRegistersMixedBlock(t *testing.T) {
+	_, mm := createTestReader(t)
+
+	energy := &mqtt.NorthResource{Name: "energy", ValueType: "int32"}
+	energy.OtherParameters.Modbus.WordOrder = "lowWordFirst"
+	resources := []*mqtt.ResourceMapping{}
+	for _, r := range []struct {
+		nr   *mqtt.NorthResource
+		addr uint16
+	}{
+		{&mqtt.NorthResource{Name: "voltage", ValueType: "float32"}, 1000},
+		{&mqtt.NorthResource{Name: "mode", ValueType: "uint16"}, 1002},
+		{&mqtt.NorthResource{Name: "status", ValueType: "uint16"}, 1003},
+		{energy, 1004},
+	} {
+		r.nr.OtherParameters.Modbus.Address = r.addr
+		resources = append(resources, &mqtt.ResourceMapping{NorthResource: r.nr, SouthResource: &mqtt.SouthResource{Name: r.nr.Name}})
+	}
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{NorthDeviceName: "meter1", Resources: resources}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if err := mm.UpdateCache("meter1", map[string]interface{}{
+		"voltage": 1.5, "mode": 7, "status": 65535, "energy": -100000,
+	}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	counting := &countingMappingManager{MappingManagerInterface: mm}
+	reader := NewRegisterReader(counting, NewConverter(BigEndian), logger.NewClient("ERROR"))
+
+	// 1006 无映射，按零值返回
+	result, err := reader.ReadHoldingRegisters(1000, 7)
+	if err != nil {
+		t.Fatalf("ReadHoldingRegisters failed: %v", err)
+	}
+	want := []byte{
+		14,
+		0x3F, 0xC0, 0x00, 0x00, // voltage float32
+		0x00, 0x07, // mode uint16
+		0xFF, 0xFF, // status uint16
+		0x79, 0x60, 0xFF, 0xFE, // energy int32, low word first
+		0x00, 0x00, // unmapped
+	}
+	if !bytesEqual(result.Data, want) {
+		t.Errorf("data = % X, want % X", result.Data, want)
+	}
+	if got := len(result.ForwardedData["meter1"]); got != 4 {
+		t.Errorf("forwarded %d resources, want 4", got)
+	}
+	if counting.cachedValueCalls != 0 {
+		t.Errorf("block read made %d per-register cache lookups, want 0", counting.cachedValueCalls)
+	}
+}
+
+func TestResolveAddressOneBased(t *testing.T) {
+	reader, mm := createTestReader(t)
+
+	// createTestReader 将 temperature 映射在地址 100
+	if err := mm.UpdateCache("device1", map[string]interface{}{"temperature": 42}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		oneBased bool
+		pduAddr  uint16
+		wantAddr config.AddressKey
+		wantData []byte
+	}{
+		{"zero-based reads configured address", false, 100, 100, []byte{0x02, 0x00, 0x2A}},
+		{"zero-based misses shifted address", false, 99, 99, []byte{0x02, 0x00, 0x00}},
+		{"one-based reads register after PDU address", true, 99, 100, []byte{0x02, 0x00, 0x2A}},
+		{"one-based misses configured address", true, 100, 101, []byte{0x02, 0x00, 0x00}},
+		{"one-based PDU address zero is register one", true, 0, 1, []byte{0x02, 0x00, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader.SetOneBased(tt.oneBased)
+			if got, ok := reader.ResolveAddress(config.ObjectHoldingRegister, tt.pduAddr, 1); !ok || got != tt.wantAddr {
+				t.Errorf("ResolveAddress(%d) = %v, %v; want %v, true", tt.pduAddr, got, ok, tt.wantAddr)
+			}
+			result, err := reader.ReadHoldingRegisters(tt.pduAddr, 1)
+			if err != nil {
+				t.Fatalf("ReadHoldingRegisters failed: %v", err)
+			}
+			if !bytesEqual(result.Data, tt.wantData) {
+				t.Errorf("data = % X, want % X", result.Data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestProbeOrder(t *testing.T) {
+	reader, mm := createTestReader(t)
+	if err := mm.UpdateCache("device1", map[string]interface{}{"temperature": 0x0102}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	// 失败的探测不改变当前顺序
+	if err := reader.ProbeOrder([]byte{0x00, 0x00}, 0x1234); err == nil {
+		t.Fatal("expected probe without magic to fail")
+	}
+	if err := reader.ProbeOrder([]byte{0x34, 0x12}, 0x1234); err != nil {
+		t.Fatalf("ProbeOrder failed: %v", err)
+	}
+
+	result, err := reader.ReadHoldingRegisters(100, 1)
+	if err != nil {
+		t.Fatalf("ReadHoldingRegisters failed: %v", err)
+	}
+	if want := []byte{0x02, 0x02, 0x01}; !bytesEqual(result.Data, want) {
+		t.Errorf("data after probe = % X, want % X", result.Data, want)
+	}
+}
+
+func TestQualityRegister(t *testing.T) {
+	lc := logger.NewClient("ERROR")
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, lc)
+	mm := mappingmanager.NewMappingManager(mqttClient, lc, &config.CacheConfig{
+		DefaultTTL:       "20ms",
+		CleanupInterval:  "5m",
+		StaleGracePeriod: "1h",
+	})
+	nr := &mqtt.NorthResource{Name: "temperature", ValueType: "int16"}
+	nr.OtherParameters.Modbus.Address = 100
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature", ValueType: "int16"}},
+		},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+
+	reader := NewRegisterReader(mm, NewConverter(BigEndian), lc)
+	reader.SetQualityRegisters([]config.QualityRegisterConfig{{Address: 101, DataAddress: 100}})
+
+	readQuality := func() uint16 {
+		t.Helper()
+		result, err := reader.ReadHoldingRegisters(100, 2)
+		if err != nil {
+			t.Fatalf("ReadHoldingRegisters failed: %v", err)
+		}
+		return uint16(result.Data[3])<<8 | uint16(result.Data[4])
+	}
+
+	if got := readQuality(); got != QualityNoData {
+		t.Errorf("quality before data = %d, want %d (no data)", got, QualityNoData)
+	}
+
+	if err := mm.UpdateCache("device1", map[string]interface{}{"temperature": 25}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+	if got := readQuality(); got != QualityGood {
+		t.Errorf("quality after update = %d, want %d (good)", got, QualityGood)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if got := readQuality(); got != QualityStale {
+		t.Errorf("quality after TTL = %d, want %d (stale)", got, QualityStale)
+	}
+}
+
+func TestReadRegistersRunConversionError(t *testing.T) {
+	reader, mm := createTestReader(t)
+	good := &mqtt.NorthResource{Name: "pressure", ValueType: "int16"}
+	good.OtherParameters.Modbus.Address = 101
+	bad := &mqtt.NorthResource{Name: "humidity", ValueType: "int16"}
+	bad.OtherParameters.Modbus.Address = 102
+	temp := &mqtt.NorthResource{Name: "temperature", ValueType: "int16"}
+	temp.OtherParameters.Modbus.Address = 100
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: temp, SouthResource: &mqtt.SouthResource{Name: "temperature", ValueType: "int16"}},
+			{NorthResource: good, SouthResource: &mqtt.SouthResource{Name: "pressure", ValueType: "int16"}},
+			{NorthResource: bad, SouthResource: &mqtt.SouthResource{Name: "humidity", ValueType: "int16"}},
+		},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if err := mm.UpdateCache("device1", map[string]interface{}{"temperature": 1, "pressure": 2, "humidity": "wet"}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	result, err := reader.ReadHoldingRegisters(100, 3)
+	if err != nil {
+		t.Fatalf("ReadHoldingRegisters failed: %v", err)
+	}
+	if want := []byte{0x06, 0x00, 0x01, 0x00, 0x02, 0x00, 0x00}; !bytesEqual(result.Data, want) {
+		t.Errorf("data = % X, want % X", result.Data, want)
+	}
+	if got := result.ConversionErrors["device1"]["humidity"]; got != 1 {
+		t.Errorf("result conversion errors for humidity = %d, want 1", got)
+	}
+	if _, ok := result.ForwardedData["device1"]["humidity"]; ok {
+		t.Error("failed resource should not be forwarded")
+	}
+	if len(result.ConversionErrors["device1"]) != 1 {
+		t.Errorf("unexpected conversion errors %v", result.ConversionErrors)
+	}
+}
+
+func TestReadCoilAndRegisterTarget(t *testing.T) {
+	lc := logger.NewClient("ERROR")
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, lc)
+	mm := mappingmanager.NewMappingManager(mqttClient, lc, &config.CacheConfig{DefaultTTL: "30s", CleanupInterval: "5m"})
+
+	pump := &mqtt.NorthResource{Name: "pumpRunning", ValueType: "bool"}
+	pump.OtherParameters.Modbus.Address = 1
+	pump.OtherParameters.Modbus.Targets = []mqtt.ModbusTarget{{ObjectType: config.ObjectHoldingRegister, Address: 100}}
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: pump, SouthResource: &mqtt.SouthResource{Name: "pumpRunning"}},
+		},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	reader := NewRegisterReader(mm, NewConverter(BigEndian), lc)
+
+	for _, running := range []bool{true, false} {
+		if err := mm.UpdateCache("device1", map[string]interface{}{"pumpRunning": running}); err != nil {
+			t.Fatalf("UpdateCache failed: %v", err)
+		}
+		var want byte
+		if running {
+			want = 1
+		}
+
+		coils, err := reader.ReadCoils(1, 1)
+		if err != nil {
+			t.Fatalf("ReadCoils failed: %v", err)
+		}
+		if !bytesEqual(coils.Data, []byte{1, want}) {
+			t.Errorf("running=%v: coil response = % X, want 01 %02X", running, coils.Data, want)
+		}
+
+		regs, err := reader.ReadHoldingRegisters(100, 1)
+		if err != nil {
+			t.Fatalf("ReadHoldingRegisters failed: %v", err)
+		}
+		if !bytesEqual(regs.Data, []byte{2, 0, want}) {
+			t.Errorf("running=%v: register response = % X, want 02 00 %02X", running, regs.Data, want)
+		}
+	}
+}
+
+func TestReadSplitWordValue(t *testing.T) {
+	second := uint16(410)
+
+	tests := []struct {
+		name      string
+		valueType string
+		wordOrder string
+		value     interface{}
+		want      uint32 // 32-bit pattern served across the two addresses in word order
+		wantFirst uint16 // register at the resource address
+	}{
+		{name: "uint32 high word first", valueType: "uint32", value: 0x12345678, want: 0x12345678, wantFirst: 0x1234},
+		{name: "uint32 low word first", valueType: "uint32", wordOrder: "lowWordFirst", value: 0x12345678, want: 0x12345678, wantFirst: 0x5678},
+		{name: "int32 negative", valueType: "int32", value: -2, want: 0xFFFFFFFE, wantFirst: 0xFFFF},
+		{name: "float32", valueType: "float32", value: 1.5, want: math.Float32bits(1.5), wantFirst: 0x3FC0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, mm := createTestReader(t)
+
+			nr := &mqtt.NorthResource{Name: "energy", ValueType: tt.valueType}
+			nr.OtherParameters.Modbus.Address = 400
+			nr.OtherParameters.Modbus.SecondWordAddress = &second
+			nr.OtherParameters.Modbus.WordOrder = tt.wordOrder
+			// An unrelated resource directly after the first word must not be reported as overlapping
+			next := &mqtt.NorthResource{Name: "status", ValueType: "uint16"}
+			next.OtherParameters.Modbus.Address = 401
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+				NorthDeviceName: "dev1",
+				Resources: []*mqtt.ResourceMapping{
+					{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "energy"}},
+					{NorthResource: next, SouthResource: &mqtt.SouthResource{Name: "status"}},
+				},
+			}}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+			for _, issue := range mm.MappingIssues() {
+				if issue.Kind == mappingmanager.IssueOverlap || issue.Kind == mappingmanager.IssueInvalidSplitWord {
+					t.Fatalf("unexpected mapping issue: %+v", issue)
+				}
+			}
+			if err := mm.UpdateCache("dev1", map[string]interface{}{"energy": tt.value, "status": 7}); err != nil {
+				t.Fatalf("UpdateCache failed: %v", err)
+			}
+
+			result, err := reader.ReadHoldingRegisters(400, 2)
+			if err != nil {
+				t.Fatalf("ReadHoldingRegisters(400) failed: %v", err)
+			}
+			if want := []byte{4, byte(tt.wantFirst >> 8), byte(tt.wantFirst), 0, 7}; !bytesEqual(result.Data, want) {
+				t.Errorf("data at 400 = % X, want % X", result.Data, want)
+			}
+			firstWord := uint32(result.Data[1])<<8 | uint32(result.Data[2])
+
+			result, err = reader.ReadHoldingRegisters(second, 1)
+			if err != nil {
+				t.Fatalf("ReadHoldingRegisters(%d) failed: %v", second, err)
+			}
+			secondWord := uint32(result.Data[1])<<8 | uint32(result.Data[2])
+
+			got := firstWord<<16 | secondWord
+			if tt.wordOrder == "lowWordFirst" {
+				got = secondWord<<16 | firstWord
+			}
+			if got != tt.want {
+				t.Errorf("combined value = 0x%08X, want 0x%08X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitWordAddressConflict(t *testing.T) {
+	_, mm := createTestReader(t)
+
+	second := uint16(100) // taken by dev1/temperature below
+	nr := &mqtt.NorthResource{Name: "energy", ValueType: "uint32"}
+	nr.OtherParameters.Modbus.Address = 400
+	nr.OtherParameters.Modbus.SecondWordAddress = &second
+	temp := &mqtt.NorthResource{Name: "temperature", ValueType: "int16"}
+	temp.OtherParameters.Modbus.Address = 100
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "dev1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: temp, SouthResource: &mqtt.SouthResource{Name: "temperature"}},
+			{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "energy"}},
+		},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+
+	if _, ok := mm.GetMappingByAddress(400); ok {
+		t.Error("resource with a conflicting second word should not be mapped")
+	}
+	found := false
+	for _, issue := range mm.MappingIssues() {
+		found = found || (issue.Kind == mappingmanager.IssueInvalidSplitWord && issue.Address == 400)
+	}
+	if !found {
+		t.Errorf("issues = %+v, want %s at 400", mm.MappingIssues(), mappingmanager.IssueInvalidSplitWord)
+	}
+	if got := mm.Stats().Skipped[mappingmanager.SkipSplitWord]; got != 1 {
+		t.Errorf("skipped split words = %d, want 1", got)
+	}
+}
@@ -0,0 +1,97 @@
+//go:build !nortu
+
+package modbusserver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/goburrow/serial"
+	"github.com/tbrandon/mbserver"
+)
+
+// rtuSupported 表示当前构建是否提供串口驱动，测试替换
+var rtuSupported = true
+
+// 串口打开重试参数：忙或未知错误时按指数退避重试，不存在和无权限直接失败
+const serialOpenAttempts = 5
+
+var (
+	serialOpenBaseDelay = 200 * time.Millisecond
+	openSerial          = serial.Open // 测试替换
+)
+
+// classifySerialError 将驱动返回的错误归类，未知错误原样返回
+func classifySerialError(port string, err error) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("%w: %s does not exist, check the RTU Port setting and that the adapter is connected", ErrSerialPortNotFound, port)
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Errorf("%w: %s, add the service user to the device's group (e.g. dialout)", ErrSerialPortPermission, port)
+	case errors.Is(err, syscall.EBUSY):
+		return fmt.Errorf("%w: %s is in use by another process", ErrSerialPortBusy, port)
+	default:
+		return err
+	}
+}
+
+// startRTU 启动RTU监听器
+func (s *ModbusServer) startRTU() error {
+	serialConfig := &serial.Config{
+		Address:  s.config.RTU.Port,
+		BaudRate: s.config.RTU.BaudRate,
+		DataBits: s.config.RTU.DataBits,
+		StopBits: s.config.RTU.StopBits,
+		Parity:   s.config.RTU.Parity,
+		Timeout:  time.Duration(s.config.Timeout) * time.Millisecond,
+	}
+
+	if err := s.probeSerialPort(serialConfig); err != nil {
+		return fmt.Errorf("failed to start Modbus RTU listener: %w", err)
+	}
+	// 串口仍由 mbserver 读取，请求经其处理goroutine进入 dispatch
+	s.server = mbserver.NewServer()
+	for code := 0; code < len(s.handlers); code++ {
+		s.server.RegisterFunctionHandler(uint8(code), s.dispatch)
+	}
+	if err := s.server.ListenRTU(serialConfig); err != nil {
+		return fmt.Errorf("failed to start Modbus RTU listener: %w", err)
+	}
+	s.addr.Store(s.config.RTU.Port)
+	s.lc.Info(fmt.Sprintf("Modbus RTU server started on %s", s.config.RTU.Port))
+	return nil
+}
+
+// probeSerialPort 尝试打开串口并立即关闭，端口忙等暂时性错误时有限次退避重试
+// mbserver.ListenRTU 打开失败时直接调用 log.Fatalf 退出进程，因此先在这里确认串口可用
+func (s *ModbusServer) probeSerialPort(cfg *serial.Config) error {
+	delay := serialOpenBaseDelay
+	var err error
+	for attempt := 1; attempt <= serialOpenAttempts; attempt++ {
+		var port serial.Port
+		port, err = openSerial(cfg)
+		if err == nil {
+			return port.Close()
+		}
+		err = classifySerialError(cfg.Address, err)
+		if errors.Is(err, ErrSerialPortNotFound) || errors.Is(err, ErrSerialPortPermission) {
+			return err
+		}
+		if attempt == serialOpenAttempts {
+			break
+		}
+
+		s.lc.Warn(fmt.Sprintf("Failed to open serial port %s (attempt %d/%d), retrying in %s: %s",
+			cfg.Address, attempt, serialOpenAttempts, delay, err.Error()))
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+		delay *= 2
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", serialOpenAttempts, err)
+}
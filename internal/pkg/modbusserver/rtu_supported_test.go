@@ -0,0 +1,106 @@
+//go:build !nortu
+
+package modbusserver
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+func TestStartRTUMissingPort(t *testing.T) {
+	if !rtuSupported {
+		t.Skip("RTU is not supported by this build")
+	}
+	s, _ := createTestServer(t)
+	s.config.Type = "RTU"
+	s.config.RTU = config.ModbusRtuConfig{Port: "/dev/does-not-exist-modbus", BaudRate: 9600, DataBits: 8, StopBits: 1, Parity: "N"}
+
+	err := s.Start(context.Background())
+	if !errors.Is(err, ErrSerialPortNotFound) {
+		t.Fatalf("Start error = %v, want ErrSerialPortNotFound", err)
+	}
+	if !strings.Contains(err.Error(), "/dev/does-not-exist-modbus") {
+		t.Errorf("error %q does not name the port", err.Error())
+	}
+	if s.IsRunning() {
+		t.Error("server should not be running after failed start")
+	}
+}
+
+func TestStartRTUUnsupported(t *testing.T) {
+	orig := rtuSupported
+	defer func() { rtuSupported = orig }()
+	rtuSupported = false
+
+	opened := false
+	origOpen := openSerial
+	defer func() { openSerial = origOpen }()
+	openSerial = func(*serial.Config) (serial.Port, error) {
+		opened = true
+		return nil, os.ErrNotExist
+	}
+
+	s, _ := createTestServer(t)
+	s.config.Type = "RTU"
+	s.config.RTU = config.ModbusRtuConfig{Port: "/dev/ttyUSB0", BaudRate: 9600, DataBits: 8, StopBits: 1, Parity: "N"}
+
+	err := s.Start(context.Background())
+	if !errors.Is(err, ErrRTUUnsupported) {
+		t.Fatalf("Start error = %v, want ErrRTUUnsupported", err)
+	}
+	if !strings.Contains(err.Error(), runtime.GOOS) {
+		t.Errorf("error %q does not name the platform", err.Error())
+	}
+	if opened {
+		t.Error("serial port should not be opened when RTU is unsupported")
+	}
+	if s.IsRunning() {
+		t.Error("server should not be running after failed start")
+	}
+}
+
+func TestProbeSerialPortRetry(t *testing.T) {
+	origOpen, origDelay := openSerial, serialOpenBaseDelay
+	defer func() { openSerial, serialOpenBaseDelay = origOpen, origDelay }()
+	serialOpenBaseDelay = time.Millisecond
+
+	tests := []struct {
+		name         string
+		openErr      error
+		wantErr      error
+		wantAttempts int
+	}{
+		{"not found", &os.PathError{Op: "open", Path: "/dev/ttyUSB0", Err: syscall.ENOENT}, ErrSerialPortNotFound, 1},
+		{"permission denied", syscall.EACCES, ErrSerialPortPermission, 1},
+		{"busy", syscall.EBUSY, ErrSerialPortBusy, serialOpenAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := createTestServer(t)
+			s.ctx = context.Background()
+			attempts := 0
+			openSerial = func(*serial.Config) (serial.Port, error) {
+				attempts++
+				return nil, tt.openErr
+			}
+
+			err := s.probeSerialPort(&serial.Config{Address: "/dev/ttyUSB0"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
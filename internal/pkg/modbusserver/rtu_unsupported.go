@@ -0,0 +1,12 @@
+//go:build nortu
+
+package modbusserver
+
+// rtuSupported 以 nortu 标签构建时为 false，此时只能使用TCP
+// 标签只关闭RTU启动路径：mbserver 仍然导入 goburrow/serial，串口驱动不支持的平台（如 js/wasm）即使加上标签也无法构建
+var rtuSupported = false
+
+// startRTU 在未编入串口驱动的构建中直接返回不支持错误；Start 已提前检查，这里只是兜底
+func (s *ModbusServer) startRTU() error {
+	return checkRTUSupport()
+}
@@ -0,0 +1,24 @@
+//go:build nortu
+
+package modbusserver
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"context"
+	"errors"
+	"testing"
+)
+
+// Run with: go test -tags nortu ./internal/pkg/modbusserver
+func TestStartRTUNotBuilt(t *testing.T) {
+	if rtuSupported {
+		t.Fatal("nortu build should report RTU as unsupported")
+	}
+
+	s, _ := createTestServer(t)
+	s.config.Type = "RTU"
+	s.config.RTU = config.ModbusRtuConfig{Port: "/dev/ttyUSB0", BaudRate: 9600, DataBits: 8, StopBits: 1, Parity: "N"}
+	if err := s.Start(context.Background()); !errors.Is(err, ErrRTUUnsupported) {
+		t.Fatalf("Start error = %v, want ErrRTUUnsupported", err)
+	}
+}
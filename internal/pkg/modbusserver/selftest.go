@@ -0,0 +1,61 @@
+package modbusserver
+
+import (
+	"app-modbus-go/internal/pkg/mappingmanager"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// VerifyRoundTrip 将缓存值按读取路径转换为寄存器字节再解码回来，检查结果是否与原值一致
+// 整数类型允许一个缩放单位的截断误差，浮点类型按相对误差比较
+func (r *RegisterReader) VerifyRoundTrip(data *mappingmanager.CachedData) error {
+	valueType := strings.ToLower(r.resolveValueType(data.ValueType, data.SignedFlagAddr))
+	converter, err := r.converterFor(data.WordOrder)
+	if err != nil {
+		return err
+	}
+	encoding, err := ParseSignedEncoding(data.SignedEncoding)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := converter.ToRegistersWithEncoding(data.Value, valueType, data.Scale, data.Offset, encoding)
+	if err != nil {
+		return fmt.Errorf("encode %v as %s: %w", data.Value, valueType, err)
+	}
+	decoded, err := converter.FromBytesWithEncoding(bytes, valueType, data.Scale, data.Offset, encoding)
+	if err != nil {
+		return fmt.Errorf("decode % X as %s: %w", bytes, valueType, err)
+	}
+
+	if valueType == "bool" {
+		if decoded != r.valueToBool(data.Value) {
+			return fmt.Errorf("round trip of %v as bool returned %v", data.Value, decoded)
+		}
+		return nil
+	}
+
+	want, ok := converter.applyScaleOffset(data.Value, 1, 0).(float64)
+	got, gotOK := decoded.(float64)
+	if !ok || !gotOK {
+		return fmt.Errorf("round trip of %v (%T) as %s returned %v", data.Value, data.Value, valueType, decoded)
+	}
+
+	var tolerance float64
+	switch valueType {
+	case "float32":
+		tolerance = math.Abs(want) * 1e-6
+	case "float64":
+		tolerance = math.Abs(want) * 1e-12
+	default:
+		tolerance = math.Abs(data.Scale)
+		if tolerance == 0 {
+			tolerance = 1
+		}
+	}
+	if math.Abs(got-want) > tolerance {
+		return fmt.Errorf("round trip of %v as %s returned %v", data.Value, valueType, got)
+	}
+	return nil
+}
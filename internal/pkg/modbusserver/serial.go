@@ -0,0 +1,26 @@
+package modbusserver
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// 串口打开失败的分类
+var (
+	ErrSerialPortNotFound   = errors.New("serial port not found")
+	ErrSerialPortPermission = errors.New("permission denied opening serial port")
+	ErrSerialPortBusy       = errors.New("serial port busy")
+)
+
+// ErrRTUUnsupported 表示当前构建不支持Modbus RTU
+var ErrRTUUnsupported = errors.New("modbus RTU is not supported by this build")
+
+// checkRTUSupport 在打开串口前确认当前构建支持RTU，避免在串口驱动内部以难以理解的错误失败
+func checkRTUSupport() error {
+	if rtuSupported {
+		return nil
+	}
+	return fmt.Errorf("%w (%s/%s): serial ports need a build without the nortu tag, or set Modbus Type to TCP",
+		ErrRTUUnsupported, runtime.GOOS, runtime.GOARCH)
+}
@@ -4,25 +4,60 @@ import (
 	"app-modbus-go/internal/pkg/config"
 	"app-modbus-go/internal/pkg/logger"
 	"app-modbus-go/internal/pkg/mappingmanager"
+	"app-modbus-go/internal/pkg/mqtt"
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/goburrow/serial"
 	"github.com/tbrandon/mbserver"
 )
 
+// ConnectionChecker 报告北向MQTT连接状态
+type ConnectionChecker interface {
+	IsConnected() bool
+}
+
+// WritePublisher 将Modbus主站的写入作为PUT命令发布到北向
+type WritePublisher interface {
+	PublishPut(northDeviceName, northResourceName, value string) error
+}
+
+// ConversionErrorReporter 上报读取时的类型转换失败计数
+type ConversionErrorReporter interface {
+	LogConversionErrors(northDeviceName string, counts map[string]interface{})
+}
+
 // ModbusServer 实现Modbus TCP/RTU服务器
 type ModbusServer struct {
 	config         *config.ModbusConfig
 	server         *mbserver.Server
+	tcp            *tcpListener
+	requestMu      sync.Mutex
 	mappingManager mappingmanager.MappingManagerInterface
 	reader         *RegisterReader
+	counters       RegisterCounters
+	handlersMu     sync.RWMutex
+	handlers       [256]FunctionHandler
+	reads          [256]readFunc
+	units          map[uint8]*ModbusServer
+	addr           atomic.Value // string, 实际监听地址
+	connection     ConnectionChecker
+	writes         WritePublisher
+	convReporter   ConversionErrorReporter
+	convReportMu   sync.Mutex
+	convReported   map[string]map[string]uint64
+	requestSeq     atomic.Uint64 // 读请求关联ID序号
 	lc             logger.LoggingClient
 	running        atomic.Bool
+	paused         atomic.Bool // 维护暂停中，所有请求返回从站忙
 	ctx            context.Context
 	cancel         context.CancelFunc
+	wg             sync.WaitGroup
 }
 
 // NewModbusServer 创建新的Modbus服务器
@@ -32,12 +67,19 @@ func NewModbusServer(
 	lc logger.LoggingClient,
 ) *ModbusServer {
 	converter := NewConverter(BigEndian)
-	return &ModbusServer{
+	converter.SetMemoSize(cfg.ConversionCacheSize)
+	reader := NewRegisterReader(mappingManager, converter, lc)
+	reader.SetAddressOffsets(&cfg.AddressOffsets)
+	reader.SetOneBased(cfg.OneBased)
+	reader.SetQualityRegisters(cfg.QualityRegisters)
+	s := &ModbusServer{
 		config:         cfg,
 		mappingManager: mappingManager,
-		reader:         NewRegisterReader(mappingManager, converter, lc),
+		reader:         reader,
 		lc:             lc,
 	}
+	s.registerHandlers()
+	return s
 }
 
 // Start 启动Modbus服务器
@@ -45,12 +87,13 @@ func (s *ModbusServer) Start(ctx context.Context) error {
 	if s.running.Load() {
 		return fmt.Errorf("modbus server already running")
 	}
+	if s.config.Type == "RTU" {
+		if err := checkRTUSupport(); err != nil {
+			return err
+		}
+	}
 
 	s.ctx, s.cancel = context.WithCancel(ctx)
-	s.server = mbserver.NewServer()
-
-	// 注册功能码处理程序
-	s.registerHandlers()
 
 	// 启动监听器
 	var err error
@@ -68,133 +111,378 @@ func (s *ModbusServer) Start(ctx context.Context) error {
 	}
 
 	s.running.Store(true)
+	// 上报是否启用在每次上报时检查，重载配置后开关随之生效
+	if s.convReporter != nil {
+		s.goReport(s.ctx, s)
+	}
+	for _, unit := range s.units {
+		if unit.convReporter != nil {
+			s.goReport(s.ctx, unit)
+		}
+	}
 	return nil
 }
 
+// goReport 在 s.wg 跟踪的goroutine中运行 unit 的转换失败上报，Stop 等待其退出
+func (s *ModbusServer) goReport(ctx context.Context, unit *ModbusServer) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		unit.runConversionErrorReports(ctx)
+	}()
+}
+
 // registerHandlers 注册所有Modbus功能码处理程序
 func (s *ModbusServer) registerHandlers() {
 	// 读取功能码
-	s.server.RegisterFunctionHandler(1, s.handleReadCoils)            // 0x01 读线圈
-	s.server.RegisterFunctionHandler(2, s.handleReadDiscreteInputs)   // 0x02 读离散输入
-	s.server.RegisterFunctionHandler(3, s.handleReadHoldingRegisters) // 0x03 读保持寄存器
-	s.server.RegisterFunctionHandler(4, s.handleReadInputRegisters)   // 0x04 读输入寄存器
+	s.setReadHandler(1, s.handleReadCoils, s.readCoils)                       // 0x01 读线圈
+	s.setReadHandler(2, s.handleReadDiscreteInputs, s.readDiscreteInputs)     // 0x02 读离散输入
+	s.setReadHandler(3, s.handleReadHoldingRegisters, s.readHoldingRegisters) // 0x03 读保持寄存器
+	s.setReadHandler(4, s.handleReadInputRegisters, s.readInputRegisters)     // 0x04 读输入寄存器
 
-	// 写入功能码
-	s.server.RegisterFunctionHandler(5, s.handleWriteSingleCoil)         // 0x05 写单个线圈
-	s.server.RegisterFunctionHandler(6, s.handleWriteSingleRegister)     // 0x06 写单个寄存器
-	s.server.RegisterFunctionHandler(15, s.handleWriteMultipleCoils)     // 0x0F 写多个线圈
-	s.server.RegisterFunctionHandler(16, s.handleWriteMultipleRegisters) // 0x10 写多个寄存器
+	// 写入功能码，只读模式下不注册
+	if !s.config.ReadOnly {
+		s.SetFunctionHandler(5, s.handleWriteSingleCoil)         // 0x05 写单个线圈
+		s.SetFunctionHandler(6, s.handleWriteSingleRegister)     // 0x06 写单个寄存器
+		s.SetFunctionHandler(15, s.handleWriteMultipleCoils)     // 0x0F 写多个线圈
+		s.SetFunctionHandler(16, s.handleWriteMultipleRegisters) // 0x10 写多个寄存器
+	}
+
+	// 诊断功能码
+	s.SetFunctionHandler(7, s.handleReadExceptionStatus) // 0x07 读异常状态
+	if s.config.Diagnostics {
+		s.SetFunctionHandler(8, s.handleDiagnostics) // 0x08 诊断
+	}
 }
 
-// startTCP 启动TCP监听器
-func (s *ModbusServer) startTCP() error {
-	addr := fmt.Sprintf("%s:%d", s.config.TCP.Host, s.config.TCP.Port)
-	if err := s.server.ListenTCP(addr); err != nil {
-		return fmt.Errorf("failed to start Modbus TCP listener: %w", err)
+// SetFunctionHandler 设置或替换功能码处理程序，可在服务器启动后并发调用
+// fn 为 nil 时禁用该功能码（返回非法功能异常）
+func (s *ModbusServer) SetFunctionHandler(code uint8, fn FunctionHandler) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	s.handlers[code] = fn
+	s.reads[code] = nil
+}
+
+// setReadHandler 注册内置读取处理程序及其不记录转发日志的实现，供 consistentRead 安全重试
+// 之后用 SetFunctionHandler 替换该功能码时，内置实现随之失效
+func (s *ModbusServer) setReadHandler(code uint8, fn FunctionHandler, read readFunc) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	s.handlers[code] = fn
+	s.reads[code] = read
+}
+
+// AddUnit 将发往单元标识符 unitID 的请求交给 unit 处理，使一个监听器服务多个节点的映射
+// unit 不单独启动监听，其转换失败上报随本服务器启动和停止；未添加的单元标识符由本服务器处理
+func (s *ModbusServer) AddUnit(unitID uint8, unit *ModbusServer) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	if s.units == nil {
+		s.units = make(map[uint8]*ModbusServer)
 	}
-	s.lc.Info(fmt.Sprintf("Modbus TCP server started on %s", addr))
-	return nil
+	s.units[unitID] = unit
 }
 
-// startRTU 启动RTU监听器
-func (s *ModbusServer) startRTU() error {
-	serialConfig := &serial.Config{
-		Address:  s.config.RTU.Port,
-		BaudRate: s.config.RTU.BaudRate,
-		DataBits: s.config.RTU.DataBits,
-		StopBits: s.config.RTU.StopBits,
-		Parity:   s.config.RTU.Parity,
-		Timeout:  time.Duration(s.config.Timeout) * time.Millisecond,
+// unitFor 返回处理该请求单元标识符的服务器，未添加时返回nil
+func (s *ModbusServer) unitFor(frame mbserver.Framer) *ModbusServer {
+	var unitID uint8
+	switch f := frame.(type) {
+	case *mbserver.TCPFrame:
+		unitID = f.Device
+	case *mbserver.RTUFrame:
+		unitID = f.Address
+	default:
+		return nil
 	}
+	s.handlersMu.RLock()
+	defer s.handlersMu.RUnlock()
+	return s.units[unitID]
+}
 
-	if err := s.server.ListenRTU(serialConfig); err != nil {
-		return fmt.Errorf("failed to start Modbus RTU listener: %w", err)
+// Capabilities 返回当前已注册处理程序的功能码，按升序排列
+func (s *ModbusServer) Capabilities() []uint8 {
+	s.handlersMu.RLock()
+	defer s.handlersMu.RUnlock()
+	var codes []uint8
+	for code, fn := range s.handlers {
+		if fn != nil {
+			codes = append(codes, uint8(code))
+		}
 	}
-	s.lc.Info(fmt.Sprintf("Modbus RTU server started on %s", s.config.RTU.Port))
-	return nil
+	return codes
+}
+
+// dispatch 按功能码查找当前处理程序并更新计数器
+// 所有连接的请求在 requestMu 下依次处理：同一主站对同一地址的读写按到达顺序处理，无需额外的按地址串行化，
+// Reconfigure 也持有该锁，不会与正在处理的请求并发修改处理程序和读取器设置
+func (s *ModbusServer) dispatch(srv *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+	s.requestMu.Lock()
+	defer s.requestMu.Unlock()
+
+	// 发往其他节点单元的请求由该单元的处理程序和映射处理，暂停时同样返回从站忙
+	if unit := s.unitFor(frame); unit != nil && !s.paused.Load() {
+		data, exc := unit.dispatch(srv, frame)
+		s.counters.record(exc)
+		return data, exc
+	}
+
+	s.handlersMu.RLock()
+	fn := s.handlers[frame.GetFunction()]
+	read := s.reads[frame.GetFunction()]
+	s.handlersMu.RUnlock()
+
+	if fn == nil {
+		s.counters.record(&mbserver.IllegalFunction)
+		return nil, &mbserver.IllegalFunction
+	}
+
+	var data []byte
+	var exc *mbserver.Exception
+	if s.paused.Load() {
+		exc = &mbserver.SlaveDeviceBusy
+	} else if isReadFunction(frame.GetFunction()) {
+		data, exc = s.consistentRead(fn, read, srv, frame)
+	} else if isWriteFunction(frame.GetFunction()) && s.northDisconnected() {
+		s.lc.Warn(fmt.Sprintf("Rejecting function 0x%02X: MQTT broker disconnected", frame.GetFunction()))
+		exc = &mbserver.SlaveDeviceBusy
+	} else {
+		data, exc = fn(srv, frame)
+	}
+	s.counters.record(exc)
+	return data, exc
+}
+
+// Pause 暂停处理请求，期间所有请求返回从站忙异常，连接保持不断开
+func (s *ModbusServer) Pause() {
+	if !s.paused.Swap(true) {
+		s.lc.Info("Modbus server paused, answering requests with Slave Device Busy")
+	}
+}
+
+// Resume 恢复处理请求
+func (s *ModbusServer) Resume() {
+	if s.paused.Swap(false) {
+		s.lc.Info("Modbus server resumed")
+	}
+}
+
+// IsPaused 返回服务器是否处于暂停状态
+func (s *ModbusServer) IsPaused() bool {
+	return s.paused.Load()
+}
+
+// maxReloadRetries 读请求因映射重载而重试的最大次数，超出后返回从站忙
+const maxReloadRetries = 3
+
+// isReadFunction 判断功能码是否为只读的寄存器/线圈读取
+func isReadFunction(code uint8) bool {
+	return code >= 1 && code <= 4
+}
+
+// isWriteFunction 判断功能码是否为线圈/寄存器写入
+func isWriteFunction(code uint8) bool {
+	return code == 5 || code == 6 || code == 15 || code == 16
+}
+
+// SetWritePublisher 设置写入下发目标，未设置时写请求只确认不下发
+func (s *ModbusServer) SetWritePublisher(publisher WritePublisher) {
+	s.writes = publisher
+}
+
+// SetConversionErrorReporter 设置转换失败计数的上报目标，配置 ReportConversionErrors 时生效
+// 需在 Start 之前设置，启动后按 ConversionErrorReportInterval 定期上报
+func (s *ModbusServer) SetConversionErrorReporter(reporter ConversionErrorReporter) {
+	s.convReporter = reporter
+}
+
+// SetConnectionChecker 设置北向连接状态来源，配置 RejectWritesWhenDisconnected 时用于拒绝写入
+func (s *ModbusServer) SetConnectionChecker(checker ConnectionChecker) {
+	s.connection = checker
+}
+
+// northDisconnected 返回是否应因北向连接断开而拒绝写入
+// 写入无法下发时返回从站忙，让主站知道写入未生效，而不是确认一个不会到达设备的写入
+func (s *ModbusServer) northDisconnected() bool {
+	return s.config.RejectWritesWhenDisconnected && s.connection != nil && !s.connection.IsConnected()
+}
+
+// consistentRead 执行读处理程序，并确保整个请求只看到重载前或重载后的映射
+// 执行期间映射发生变化时重新读取；配置 BusyDuringReload 时直接返回从站忙
+// 内置读取通过 read 执行，转发日志只在得到一致的结果后记录一次；自定义处理程序 fn 整体重试
+func (s *ModbusServer) consistentRead(fn FunctionHandler, read readFunc, srv *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+	for attempt := 0; attempt <= maxReloadRetries; attempt++ {
+		gen := s.mappingManager.MappingGeneration()
+		if gen%2 == 1 && s.config.BusyDuringReload {
+			return nil, &mbserver.SlaveDeviceBusy
+		}
+
+		var result *ReadResult
+		var data []byte
+		var exc *mbserver.Exception
+		if read != nil {
+			if result, exc = read(frame); result != nil {
+				data = result.Data
+			}
+		} else {
+			data, exc = fn(srv, frame)
+		}
+		if gen%2 == 0 && s.mappingManager.MappingGeneration() == gen {
+			// 转发日志只记录最终返回给主站的那次读取
+			if result != nil {
+				s.logForward(result)
+			}
+			return data, exc
+		}
+		if s.config.BusyDuringReload {
+			return nil, &mbserver.SlaveDeviceBusy
+		}
+		s.lc.Debug(fmt.Sprintf("Mapping reloaded during function 0x%02X, retrying read", frame.GetFunction()))
+	}
+
+	s.lc.Warn(fmt.Sprintf("Mapping kept changing during function 0x%02X, returning busy", frame.GetFunction()))
+	return nil, &mbserver.SlaveDeviceBusy
+}
+
+// Reader 返回服务器使用的寄存器读取器
+func (s *ModbusServer) Reader() *RegisterReader {
+	return s.reader
+}
+
+// Addr 返回服务器实际监听地址，启动前为空
+func (s *ModbusServer) Addr() string {
+	if addr, ok := s.addr.Load().(string); ok {
+		return addr
+	}
+	return ""
+}
+
+// requestScope 为一次读请求生成关联ID，返回带该ID前缀的记录器和读取器
+// 同一请求在处理程序和读取器中的日志可按 req=ID 分组
+func (s *ModbusServer) requestScope() (logger.LoggingClient, *RegisterReader) {
+	lc := logger.WithPrefix(s.lc, fmt.Sprintf("[req=%08x] ", s.requestSeq.Add(1)))
+	return lc, s.reader.WithLogger(lc)
 }
 
 // ============== 读取处理程序 ==============
 
+// readFunc 执行一次内置读取，返回读取结果而不记录转发日志，可安全重试
+type readFunc func(frame mbserver.Framer) (*ReadResult, *mbserver.Exception)
+
+// serveRead 执行一次读取并记录转发日志，用于不经过 consistentRead 的直接调用
+func (s *ModbusServer) serveRead(read readFunc, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+	result, exc := read(frame)
+	if result == nil {
+		return nil, exc
+	}
+	s.logForward(result)
+	return result.Data, exc
+}
+
+// readException 返回读取失败对应的异常：地址范围超出缓存键范围时为非法数据地址，其他错误为从站设备故障
+func readException(err error) *mbserver.Exception {
+	if errors.Is(err, ErrAddressOutOfRange) {
+		return &mbserver.IllegalDataAddress
+	}
+	return &mbserver.SlaveDeviceFailure
+}
+
 // handleReadCoils 处理功能码 0x01 - 读取线圈
 func (s *ModbusServer) handleReadCoils(srv *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+	return s.serveRead(s.readCoils, frame)
+}
+
+// readCoils 读取线圈
+func (s *ModbusServer) readCoils(frame mbserver.Framer) (*ReadResult, *mbserver.Exception) {
 	startAddr, quantity, err := s.parseReadRequest(frame, 1, 2000)
 	if err != nil {
 		return nil, &mbserver.IllegalDataValue
 	}
 
-	s.lc.Debug(fmt.Sprintf("Read coils: addr=%d, quantity=%d", startAddr, quantity))
+	lc, reader := s.requestScope()
+	lc.Debug(fmt.Sprintf("Read coils: addr=%d, quantity=%d", startAddr, quantity))
 
-	result, err := s.reader.ReadCoils(startAddr, quantity)
+	result, err := reader.ReadCoils(startAddr, quantity)
 	if err != nil {
-		s.lc.Error(fmt.Sprintf("Read coils error: %s", err.Error()))
-		return nil, &mbserver.SlaveDeviceFailure
+		lc.Error(fmt.Sprintf("Read coils error: %s", err.Error()))
+		return nil, readException(err)
 	}
-
-	// 记录转发日志
-	s.logForward(result.ForwardedData)
-
-	return result.Data, &mbserver.Success
+	return result, &mbserver.Success
 }
 
 // handleReadDiscreteInputs 处理功能码 0x02 - 读取离散输入
 func (s *ModbusServer) handleReadDiscreteInputs(srv *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+	return s.serveRead(s.readDiscreteInputs, frame)
+}
+
+// readDiscreteInputs 读取离散输入
+func (s *ModbusServer) readDiscreteInputs(frame mbserver.Framer) (*ReadResult, *mbserver.Exception) {
 	startAddr, quantity, err := s.parseReadRequest(frame, 1, 2000)
 	if err != nil {
 		return nil, &mbserver.IllegalDataValue
 	}
 
-	s.lc.Debug(fmt.Sprintf("Read discrete inputs: addr=%d, quantity=%d", startAddr, quantity))
+	lc, reader := s.requestScope()
+	lc.Debug(fmt.Sprintf("Read discrete inputs: addr=%d, quantity=%d", startAddr, quantity))
 
-	result, err := s.reader.ReadDiscreteInputs(startAddr, quantity)
+	result, err := reader.ReadDiscreteInputs(startAddr, quantity)
 	if err != nil {
-		s.lc.Error(fmt.Sprintf("Read discrete inputs error: %s", err.Error()))
-		return nil, &mbserver.SlaveDeviceFailure
+		lc.Error(fmt.Sprintf("Read discrete inputs error: %s", err.Error()))
+		return nil, readException(err)
 	}
-
-	s.logForward(result.ForwardedData)
-	return result.Data, &mbserver.Success
+	return result, &mbserver.Success
 }
 
 // handleReadHoldingRegisters 处理功能码 0x03 - 读取保持寄存器
 func (s *ModbusServer) handleReadHoldingRegisters(srv *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+	return s.serveRead(s.readHoldingRegisters, frame)
+}
+
+// readHoldingRegisters 读取保持寄存器
+func (s *ModbusServer) readHoldingRegisters(frame mbserver.Framer) (*ReadResult, *mbserver.Exception) {
 	startAddr, quantity, err := s.parseReadRequest(frame, 1, 125)
 	if err != nil {
 		return nil, &mbserver.IllegalDataValue
 	}
 
-	s.lc.Debug(fmt.Sprintf("Read holding registers: addr=%d, quantity=%d", startAddr, quantity))
+	lc, reader := s.requestScope()
+	lc.Debug(fmt.Sprintf("Read holding registers: addr=%d, quantity=%d", startAddr, quantity))
 
-	result, err := s.reader.ReadHoldingRegisters(startAddr, quantity)
+	result, err := reader.ReadHoldingRegisters(startAddr, quantity)
 	if err != nil {
-		s.lc.Error(fmt.Sprintf("Read holding registers error: %s", err.Error()))
-		return nil, &mbserver.SlaveDeviceFailure
+		lc.Error(fmt.Sprintf("Read holding registers error: %s", err.Error()))
+		return nil, readException(err)
 	}
-
-	s.logForward(result.ForwardedData)
-	return result.Data, &mbserver.Success
+	return result, &mbserver.Success
 }
 
 // handleReadInputRegisters 处理功能码 0x04 - 读取输入寄存器
 func (s *ModbusServer) handleReadInputRegisters(srv *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+	return s.serveRead(s.readInputRegisters, frame)
+}
+
+// readInputRegisters 读取输入寄存器
+func (s *ModbusServer) readInputRegisters(frame mbserver.Framer) (*ReadResult, *mbserver.Exception) {
 	startAddr, quantity, err := s.parseReadRequest(frame, 1, 125)
 	if err != nil {
 		return nil, &mbserver.IllegalDataValue
 	}
 
-	s.lc.Debug(fmt.Sprintf("Read input registers: addr=%d, quantity=%d", startAddr, quantity))
+	lc, reader := s.requestScope()
+	lc.Debug(fmt.Sprintf("Read input registers: addr=%d, quantity=%d", startAddr, quantity))
 
-	result, err := s.reader.ReadInputRegisters(startAddr, quantity)
+	result, err := reader.ReadInputRegisters(startAddr, quantity)
 	if err != nil {
-		s.lc.Error(fmt.Sprintf("Read input registers error: %s", err.Error()))
-		return nil, &mbserver.SlaveDeviceFailure
+		lc.Error(fmt.Sprintf("Read input registers error: %s", err.Error()))
+		return nil, readException(err)
 	}
-
-	s.logForward(result.ForwardedData)
-	return result.Data, &mbserver.Success
+	return result, &mbserver.Success
 }
 
 // ============== 写入处理程序 ==============
+//
+// 广播写（单元标识0）：启用 BroadcastWrites 时由TCP连接循环交给本服务器和所有单元执行且不回复，见 broadcast；
+// 未启用时或在RTU上（mbserver 对每个请求都写回响应），单元0的写请求与普通写请求一样处理并回复。
 
 // handleWriteSingleCoil 处理功能码 0x05 - 写单个线圈
 func (s *ModbusServer) handleWriteSingleCoil(srv *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
@@ -214,11 +502,16 @@ func (s *ModbusServer) handleWriteSingleCoil(srv *mbserver.Server, frame mbserve
 	s.lc.Debug(fmt.Sprintf("Write single coil: addr=%d, value=0x%04X", addr, value))
 
 	// 检查地址映射和写权限
-	if exc := s.checkWritePermission(addr); exc != nil {
+	resolved, ok := s.reader.ResolveAddress(config.ObjectCoil, addr, 1)
+	if !ok {
+		return nil, &mbserver.IllegalDataAddress
+	}
+	if exc := s.checkWritePermission(resolved); exc != nil {
+		return nil, exc
+	}
+	if exc := s.writeCoil(resolved, value == 0xFF00); exc != nil {
 		return nil, exc
 	}
-
-	// TODO: 实现实际写入逻辑（通过MQTT发送到南向设备）
 
 	return data, &mbserver.Success
 }
@@ -235,12 +528,19 @@ func (s *ModbusServer) handleWriteSingleRegister(srv *mbserver.Server, frame mbs
 
 	s.lc.Debug(fmt.Sprintf("Write single register: addr=%d, value=%d", addr, value))
 
-	if exc := s.checkWritePermission(addr); exc != nil {
+	// 寄存器可以是多寄存器资源的任一字，由所属资源决定权限；未映射的寄存器不可写
+	resolved, ok := s.reader.ResolveAddress(config.ObjectHoldingRegister, addr, 1)
+	if !ok {
+		return nil, &mbserver.IllegalDataAddress
+	}
+	if _, _, _, ok := s.registerOwner(resolved); !ok {
+		s.lc.Warn(fmt.Sprintf("No mapping for address %v", resolved))
+		return nil, &mbserver.IllegalDataAddress
+	}
+	if exc := s.writeRegisters(resolved, data[2:4]); exc != nil {
 		return nil, exc
 	}
 
-	// TODO: 实现实际写入逻辑
-
 	return data, &mbserver.Success
 }
 
@@ -266,18 +566,50 @@ func (s *ModbusServer) handleWriteMultipleCoils(srv *mbserver.Server, frame mbse
 
 	s.lc.Debug(fmt.Sprintf("Write multiple coils: addr=%d, quantity=%d", startAddr, quantity))
 
-	// 检查所有地址的写权限
+	// 先检查所有地址的写权限，skipReadOnly 策略下跳过只读线圈，未映射的地址始终拒绝
+	skipReadOnly := s.config.MultiCoilWritePolicy == config.CoilWritePolicySkipReadOnly
+	baseAddr, ok := s.reader.ResolveAddress(config.ObjectCoil, startAddr, quantity)
+	if !ok {
+		return nil, &mbserver.IllegalDataAddress
+	}
+	writable := make([]uint16, 0, quantity)
 	for i := uint16(0); i < quantity; i++ {
-		if exc := s.checkWritePermission(startAddr + i); exc != nil {
+		addr := baseAddr + config.AddressKey(i) // 范围已由 ResolveAddress 检查
+		if skipReadOnly && s.isReadOnly(addr) {
+			s.lc.Debug(fmt.Sprintf("Write multiple coils: skipping read-only coil %v", addr))
+			continue
+		}
+		if exc := s.checkWritePermission(addr); exc != nil {
 			return nil, exc
 		}
+		writable = append(writable, i)
 	}
 
-	// TODO: 实现实际写入逻辑
+	// 线圈值按位打包，首字节最低位对应起始地址
+	// 所有线圈已通过检查后才开始写入；逐个下发时某个PUT失败会中止请求，此前的线圈已经下发，不会回滚
+	for _, i := range writable {
+		on := data[5+i/8]>>(i%8)&1 == 1
+		if exc := s.writeCoil(baseAddr+config.AddressKey(i), on); exc != nil {
+			return nil, exc
+		}
+	}
 
 	return data[:4], &mbserver.Success
 }
 
+// writeCoil 将线圈状态作为写回值保存，并作为PUT命令下发，值为 "true" 或 "false"
+func (s *ModbusServer) writeCoil(addr config.AddressKey, on bool) *mbserver.Exception {
+	mapping, ok := s.mappingManager.GetMappingByAddress(addr)
+	if !ok || mapping.NorthResource == nil {
+		return &mbserver.IllegalDataAddress
+	}
+	if _, err := s.mappingManager.ReadModifyWrite(addr, func(interface{}) (interface{}, error) { return on, nil }); err != nil {
+		s.lc.Warn(fmt.Sprintf("Write to %s at address %v: %s", mapping.NorthResource.Name, addr, err.Error()))
+		return &mbserver.IllegalDataAddress
+	}
+	return s.publishWrite(addr, mapping.NorthResource.Name, strconv.FormatBool(on))
+}
+
 // handleWriteMultipleRegisters 处理功能码 0x10 - 写多个寄存器
 func (s *ModbusServer) handleWriteMultipleRegisters(srv *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
 	data := frame.GetData()
@@ -287,22 +619,94 @@ func (s *ModbusServer) handleWriteMultipleRegisters(srv *mbserver.Server, frame
 
 	startAddr := uint16(data[0])<<8 | uint16(data[1])
 	quantity := uint16(data[2])<<8 | uint16(data[3])
+	byteCount := data[4]
+
+	// 数量必须在协议规定的 1-123 范围内
+	if quantity < 1 || quantity > 123 {
+		s.lc.Warn(fmt.Sprintf("Write multiple registers: quantity %d out of range 1-123", quantity))
+		return nil, &mbserver.IllegalDataValue
+	}
+
+	// 字节数必须等于 quantity*2，且负载长度必须与字节数完全一致
+	if int(byteCount) != int(quantity)*2 || len(data) != 5+int(byteCount) {
+		s.lc.Warn(fmt.Sprintf("Write multiple registers: byte count mismatch (quantity=%d, byteCount=%d, payload=%d)",
+			quantity, byteCount, len(data)-5))
+		return nil, &mbserver.IllegalDataValue
+	}
 
 	s.lc.Debug(fmt.Sprintf("Write multiple registers: addr=%d, quantity=%d", startAddr, quantity))
 
-	// TODO: 实现实际写入逻辑
+	addr, ok := s.reader.ResolveAddress(config.ObjectHoldingRegister, startAddr, quantity)
+	if !ok {
+		return nil, &mbserver.IllegalDataAddress
+	}
+	if mapping, ok := s.mappingManager.GetMappingByAddress(addr); ok && mapping.NorthResource != nil &&
+		strings.EqualFold(mapping.NorthResource.ValueType, "string") {
+		if exc := s.writeString(addr, mapping.NorthResource, data[5:]); exc != nil {
+			return nil, exc
+		}
+		return data[:4], &mbserver.Success
+	}
 
+	if exc := s.writeRegisters(addr, data[5:]); exc != nil {
+		return nil, exc
+	}
 	return data[:4], &mbserver.Success
 }
 
+// writeString 将写入字符串资源的寄存器解码为ASCII字符串，作为写回值保存并作为PUT命令下发
+// 写入必须从资源首地址开始并恰好覆盖其 stringLength 个寄存器，未配置长度的字符串资源不可写，避免写入越过相邻资源
+func (s *ModbusServer) writeString(addr config.AddressKey, nr *mqtt.NorthResource, registers []byte) *mbserver.Exception {
+	if exc := s.checkWritePermission(addr); exc != nil {
+		return exc
+	}
+	length := int(nr.OtherParameters.Modbus.StringLength)
+	if length == 0 {
+		s.lc.Warn(fmt.Sprintf("Write to string %s at address %v: stringLength not configured", nr.Name, addr))
+		return &mbserver.IllegalDataAddress
+	}
+	if len(registers) != length*2 {
+		s.lc.Warn(fmt.Sprintf("Write to string %s at address %v: %d registers written, stringLength is %d",
+			nr.Name, addr, len(registers)/2, length))
+		return &mbserver.IllegalDataValue
+	}
+	str := s.reader.Converter().DecodeString(registers)
+	if _, err := s.mappingManager.ReadModifyWrite(addr, func(interface{}) (interface{}, error) { return str, nil }); err != nil {
+		s.lc.Warn(fmt.Sprintf("Write to string %s at address %v: %s", nr.Name, addr, err.Error()))
+		return &mbserver.IllegalDataAddress
+	}
+	return s.publishWrite(addr, nr.Name, str)
+}
+
+// publishWrite 将写入值作为PUT命令下发到地址所属的北向设备，未设置写入发布器时只记录
+func (s *ModbusServer) publishWrite(addr config.AddressKey, resourceName, value string) *mbserver.Exception {
+	if s.writes == nil {
+		s.lc.Debug(fmt.Sprintf("Write %q to address %v not forwarded: no write publisher", value, addr))
+		return nil
+	}
+	deviceName, ok := s.mappingManager.GetDeviceNameByAddress(addr)
+	if !ok {
+		return &mbserver.IllegalDataAddress
+	}
+	if err := s.writes.PublishPut(deviceName, resourceName, value); err != nil {
+		s.lc.Error(fmt.Sprintf("Failed to publish PUT for %s/%s: %s", deviceName, resourceName, err.Error()))
+		return &mbserver.SlaveDeviceFailure
+	}
+	return nil
+}
+
 // ============== 辅助方法 ==============
 
 // parseReadRequest 解析读取请求的起始地址和数量
+// maxQty 为协议上限，配置了更小的 MaxReadQuantity 时以配置为准
 func (s *ModbusServer) parseReadRequest(frame mbserver.Framer, minQty, maxQty uint16) (uint16, uint16, error) {
 	data := frame.GetData()
 	if len(data) < 4 {
 		return 0, 0, fmt.Errorf("invalid data length")
 	}
+	if limit := s.config.MaxReadQuantity; limit > 0 && limit < int(maxQty) {
+		maxQty = uint16(limit)
+	}
 
 	startAddr := uint16(data[0])<<8 | uint16(data[1])
 	quantity := uint16(data[2])<<8 | uint16(data[3])
@@ -315,28 +719,98 @@ func (s *ModbusServer) parseReadRequest(frame mbserver.Framer, minQty, maxQty ui
 }
 
 // checkWritePermission 检查地址的写权限
-func (s *ModbusServer) checkWritePermission(addr uint16) *mbserver.Exception {
-	mapping, ok := s.mappingManager.GetMappingByAddress(addr)
-	if !ok {
-		s.lc.Warn(fmt.Sprintf("No mapping for address %d", addr))
+func (s *ModbusServer) checkWritePermission(addr config.AddressKey) *mbserver.Exception {
+	if _, ok := s.mappingManager.GetMappingByAddress(addr); !ok {
+		s.lc.Warn(fmt.Sprintf("No mapping for address %v", addr))
 		return &mbserver.IllegalDataAddress
 	}
 
-	if mapping.SouthResource != nil && mapping.SouthResource.ReadWrite == "R" {
-		s.lc.Warn(fmt.Sprintf("Address %d is read-only", addr))
+	if s.isReadOnly(addr) {
+		s.lc.Warn(fmt.Sprintf("Address %v is read-only", addr))
 		return &mbserver.IllegalDataAddress
 	}
 
 	return nil
 }
 
+// isReadOnly 判断地址是否映射到只读资源，ReadWrite 无法识别时按只读处理
+func (s *ModbusServer) isReadOnly(addr config.AddressKey) bool {
+	mapping, ok := s.mappingManager.GetMappingByAddress(addr)
+	return ok && mapping.SouthResource != nil && !mappingmanager.Writable(mapping.SouthResource.ReadWrite)
+}
+
 // logForward 记录数据转发日志
-func (s *ModbusServer) logForward(forwardedData map[string]map[string]interface{}) {
-	if len(forwardedData) > 0 {
-		s.mappingManager.LogDataForward(forwardedData)
+func (s *ModbusServer) logForward(result *ReadResult) {
+	if len(result.ForwardedData) > 0 {
+		s.mappingManager.LogDataForward(result.ForwardedData, result.ReadTime)
+	}
+}
+
+// runConversionErrorReports 按 ConversionErrorReportInterval 定期上报转换失败计数，直到服务器停止
+func (s *ModbusServer) runConversionErrorReports(ctx context.Context) {
+	ticker := time.NewTicker(s.config.GetConversionErrorReportInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reportConversionErrors()
+		}
+	}
+}
+
+// reportConversionErrors 按设备上报自上次上报（记录在 convReported）以来计数有变化的资源的累计失败次数
+// 持续失败的资源每个间隔最多上报一次，计数不再增长后不再重复上报
+func (s *ModbusServer) reportConversionErrors() {
+	if s.convReporter == nil || !s.config.ReportConversionErrors {
+		return
+	}
+	s.convReportMu.Lock()
+	defer s.convReportMu.Unlock()
+	if s.convReported == nil {
+		s.convReported = make(map[string]map[string]uint64)
+	}
+	for deviceName, resources := range s.reader.ConversionErrors() {
+		counts := make(map[string]interface{})
+		for resourceName, n := range resources {
+			if s.convReported[deviceName][resourceName] != n {
+				counts[resourceName] = n
+			}
+		}
+		if len(counts) == 0 {
+			continue
+		}
+		s.convReporter.LogConversionErrors(deviceName, counts)
+		s.convReported[deviceName] = resources
 	}
 }
 
+// Reconfigure 在配置热重载后改用 cfg，并重新应用其中的转换缓存、地址编号、质量寄存器和功能码设置
+// 须在 Stop 之后、再次 Start 之前调用；cfg 此后不应再被修改，地址偏移仍使用创建时的配置。
+// 内置功能码处理程序被重置，通过 SetFunctionHandler 替换的处理程序需重新设置
+func (s *ModbusServer) Reconfigure(cfg *config.ModbusConfig) error {
+	if s.running.Load() {
+		return fmt.Errorf("modbus server must be stopped before reconfiguring")
+	}
+	s.requestMu.Lock()
+	defer s.requestMu.Unlock()
+	s.config = cfg
+	s.reader.Converter().SetMemoSize(s.config.ConversionCacheSize)
+	s.reader.SetOneBased(s.config.OneBased)
+	s.reader.SetQualityRegisters(s.config.QualityRegisters)
+	for _, code := range []uint8{5, 6, 8, 15, 16} {
+		s.SetFunctionHandler(code, nil)
+	}
+	s.registerHandlers()
+	for _, unit := range s.units {
+		if err := unit.Reconfigure(cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Stop 停止Modbus服务器
 func (s *ModbusServer) Stop() error {
 	if !s.running.Load() {
@@ -348,9 +822,15 @@ func (s *ModbusServer) Stop() error {
 		s.cancel()
 	}
 
+	// 关闭监听器和已接受的连接，等待正在处理的请求和转换失败上报结束
+	if s.tcp != nil {
+		s.tcp.close()
+		s.tcp = nil
+	}
 	if s.server != nil {
 		s.server.Close()
 	}
+	s.wg.Wait()
 
 	s.lc.Info("Modbus server stopped")
 	return nil
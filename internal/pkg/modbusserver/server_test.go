@@ -0,0 +1,1590 @@
+package modbusserver
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"app-modbus-go/internal/pkg/forwardlog"
+	"app-modbus-go/internal/pkg/logger"
+	"app-modbus-go/internal/pkg/mappingmanager"
+	"app-modbus-go/internal/pkg/mqtt"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tbrandon/mbserver"
+)
+
+func createTestServer(t *testing.T) (*ModbusServer, *mappingmanager.MappingManager) {
+	lc := logger.NewClient("ERROR")
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, lc)
+	cacheConfig := &config.CacheConfig{
+		DefaultTTL:      "30s",
+		CleanupInterval: "5m",
+	}
+	mm := mappingmanager.NewMappingManager(mqttClient, lc, cacheConfig)
+	modbusConfig := &config.ModbusConfig{
+		Type: "TCP",
+		TCP:  config.ModbusTcpConfig{Host: "127.0.0.1", Port: 0, SlaveID: 1},
+	}
+	return NewModbusServer(modbusConfig, mm, lc), mm
+}
+
+func TestHandleWriteMultipleRegistersByteCount(t *testing.T) {
+	s, _ := createTestServer(t)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantExc *mbserver.Exception
+	}{
+		{
+			name:    "correctly sized frame",
+			data:    []byte{0x00, 0x64, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00, 0x02},
+			wantExc: &mbserver.Success,
+		},
+		{
+			name:    "truncated frame",
+			data:    []byte{0x00, 0x64, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00},
+			wantExc: &mbserver.IllegalDataValue,
+		},
+		{
+			name:    "oversized frame",
+			data:    []byte{0x00, 0x64, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00, 0x02, 0x00, 0x03},
+			wantExc: &mbserver.IllegalDataValue,
+		},
+		{
+			name:    "byte count does not match quantity",
+			data:    []byte{0x00, 0x64, 0x00, 0x02, 0x02, 0x00, 0x01},
+			wantExc: &mbserver.IllegalDataValue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := &mbserver.TCPFrame{Function: 16, Data: tt.data}
+			resp, exc := s.handleWriteMultipleRegisters(nil, frame)
+			if exc != tt.wantExc {
+				t.Fatalf("exception = %v, want %v", exc, tt.wantExc)
+			}
+			if tt.wantExc == &mbserver.Success && !bytesEqual(resp, tt.data[:4]) {
+				t.Errorf("response = % X, want % X", resp, tt.data[:4])
+			}
+		})
+	}
+}
+
+func TestDiagnosticsCounters(t *testing.T) {
+	s, mm := createTestServer(t)
+
+	nr := &mqtt.NorthResource{Name: "temperature", ValueType: "int16"}
+	nr.OtherParameters.Modbus.Address = 100
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature", ReadWrite: "R"}},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		s.dispatch(nil, &mbserver.TCPFrame{Function: 3, Data: []byte{0x00, 0x64, 0x00, 0x01}})
+	}
+	// 只读地址写入返回异常
+	s.dispatch(nil, &mbserver.TCPFrame{Function: 6, Data: []byte{0x00, 0x64, 0x00, 0x01}})
+
+	stats := s.Counters()
+	tests := []struct {
+		name        string
+		subFunction uint16
+		want        uint64
+	}{
+		{"bus message count", DiagBusMessageCount, stats.BusMessages},
+		{"exception count", DiagBusExceptionErrorCount, stats.Exceptions},
+		{"server message count", DiagServerMessageCount, stats.ServerMessages},
+	}
+	if stats.BusMessages != 4 || stats.Exceptions != 1 {
+		t.Fatalf("counters = %+v, want 4 messages and 1 exception", stats)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte{byte(tt.subFunction >> 8), byte(tt.subFunction), 0x00, 0x00}
+			resp, exc := s.handleDiagnostics(nil, &mbserver.TCPFrame{Function: 8, Data: data})
+			if exc != &mbserver.Success {
+				t.Fatalf("exception = %v, want Success", exc)
+			}
+			got := uint64(resp[2])<<8 | uint64(resp[3])
+			if got != tt.want {
+				t.Errorf("counter 0x%04X = %d, want %d", tt.subFunction, got, tt.want)
+			}
+		})
+	}
+
+	// 清除计数器
+	s.handleDiagnostics(nil, &mbserver.TCPFrame{Function: 8, Data: []byte{0x00, 0x0A, 0x00, 0x00}})
+	if got := s.Counters(); got.BusMessages != 0 || got.Exceptions != 0 {
+		t.Errorf("counters after clear = %+v, want zero", got)
+	}
+}
+
+func TestSetFunctionHandlerAfterStart(t *testing.T) {
+	s, _ := createTestServer(t)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	frame := &mbserver.TCPFrame{Function: 3, Data: []byte{0x00, 0x64, 0x00, 0x01}}
+	resp, exc := s.dispatch(nil, frame)
+	if exc != &mbserver.Success || !bytesEqual(resp, []byte{0x02, 0x00, 0x00}) {
+		t.Fatalf("default handler = % X, %v", resp, exc)
+	}
+
+	// 运行时替换处理程序
+	s.SetFunctionHandler(3, func(*mbserver.Server, mbserver.Framer) ([]byte, *mbserver.Exception) {
+		return []byte{0x02, 0xAB, 0xCD}, &mbserver.Success
+	})
+	resp, exc = s.dispatch(nil, frame)
+	if exc != &mbserver.Success || !bytesEqual(resp, []byte{0x02, 0xAB, 0xCD}) {
+		t.Errorf("overridden handler = % X, %v", resp, exc)
+	}
+
+	// 运行时禁用功能码
+	s.SetFunctionHandler(3, nil)
+	if _, exc = s.dispatch(nil, frame); exc != &mbserver.IllegalFunction {
+		t.Errorf("disabled handler exception = %v, want IllegalFunction", exc)
+	}
+}
+
+func TestHandleWriteMultipleRegistersQuantityBounds(t *testing.T) {
+	s, _ := createTestServer(t)
+
+	// frame 按数量构建格式正确的请求
+	frame := func(quantity uint16) []byte {
+		byteCount := int(quantity) * 2
+		data := []byte{0x00, 0x64, byte(quantity >> 8), byte(quantity), byte(byteCount)}
+		return append(data, make([]byte, byteCount)...)
+	}
+
+	tests := []struct {
+		name     string
+		quantity uint16
+		wantExc  *mbserver.Exception
+	}{
+		{"zero quantity", 0, &mbserver.IllegalDataValue},
+		{"minimum quantity", 1, &mbserver.Success},
+		{"maximum quantity", 123, &mbserver.Success},
+		{"over limit", 124, &mbserver.IllegalDataValue},
+		{"far over limit", 2000, &mbserver.IllegalDataValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, exc := s.handleWriteMultipleRegisters(nil, &mbserver.TCPFrame{Function: 16, Data: frame(tt.quantity)})
+			if exc != tt.wantExc {
+				t.Errorf("quantity %d: exception = %v, want %v", tt.quantity, exc, tt.wantExc)
+			}
+		})
+	}
+}
+
+// recordingPublisher records PUT commands published by the write handlers
+type recordingPublisher struct {
+	puts [][3]string
+}
+
+func (p *recordingPublisher) PublishPut(northDeviceName, northResourceName, value string) error {
+	p.puts = append(p.puts, [3]string{northDeviceName, northResourceName, value})
+	return nil
+}
+
+func TestWriteMultipleCoilsPolicy(t *testing.T) {
+	// 线圈10、12可写，11只读，13未映射；写入值 10=开 11=开 12=关 13=开
+	coils := []byte{0x0B}
+	tests := []struct {
+		name     string
+		policy   string
+		quantity uint16
+		wantExc  *mbserver.Exception
+		wantPuts [][3]string
+	}{
+		{
+			name: "all or nothing rejects read-only", policy: config.CoilWritePolicyAllOrNothing, quantity: 3,
+			wantExc: &mbserver.IllegalDataAddress,
+		},
+		{
+			name: "default policy rejects read-only", policy: "", quantity: 3,
+			wantExc: &mbserver.IllegalDataAddress,
+		},
+		{
+			name: "skip read-only writes the rest", policy: config.CoilWritePolicySkipReadOnly, quantity: 3,
+			wantExc:  &mbserver.Success,
+			wantPuts: [][3]string{{"device1", "pump", "true"}, {"device1", "valve", "false"}},
+		},
+		{
+			name: "skip read-only still rejects unmapped", policy: config.CoilWritePolicySkipReadOnly, quantity: 4,
+			wantExc: &mbserver.IllegalDataAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mm := createTestServer(t)
+			s.config.MultiCoilWritePolicy = tt.policy
+			var resources []*mqtt.ResourceMapping
+			for i, rw := range []string{"RW", "R", "RW"} {
+				name := []string{"pump", "alarm", "valve"}[i]
+				nr := &mqtt.NorthResource{Name: name, ValueType: "bool"}
+				nr.OtherParameters.Modbus.Address = uint16(10 + i)
+				resources = append(resources, &mqtt.ResourceMapping{
+					NorthResource: nr,
+					SouthResource: &mqtt.SouthResource{Name: name, ReadWrite: rw},
+				})
+			}
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{NorthDeviceName: "device1", Resources: resources}}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+			publisher := &recordingPublisher{}
+			s.SetWritePublisher(publisher)
+
+			data := append([]byte{0x00, 0x0A, byte(tt.quantity >> 8), byte(tt.quantity), 0x01}, coils...)
+			resp, exc := s.handleWriteMultipleCoils(nil, &mbserver.TCPFrame{Function: 15, Data: data})
+			if exc != tt.wantExc {
+				t.Fatalf("exception = %v, want %v", exc, tt.wantExc)
+			}
+			if exc == &mbserver.Success && !bytesEqual(resp, data[:4]) {
+				t.Errorf("response = % X, want % X", resp, data[:4])
+			}
+			if len(publisher.puts) != len(tt.wantPuts) {
+				t.Fatalf("published PUTs = %v, want %v", publisher.puts, tt.wantPuts)
+			}
+			for i, want := range tt.wantPuts {
+				if publisher.puts[i] != want {
+					t.Errorf("PUT %d = %v, want %v", i, publisher.puts[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteSingleCoil(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantExc  *mbserver.Exception
+		wantPuts [][3]string
+	}{
+		{"on", []byte{0x00, 0x0A, 0xFF, 0x00}, &mbserver.Success, [][3]string{{"device1", "pump", "true"}}},
+		{"off", []byte{0x00, 0x0A, 0x00, 0x00}, &mbserver.Success, [][3]string{{"device1", "pump", "false"}}},
+		{"read-only", []byte{0x00, 0x0B, 0xFF, 0x00}, &mbserver.IllegalDataAddress, nil},
+		{"unmapped", []byte{0x00, 0x0D, 0xFF, 0x00}, &mbserver.IllegalDataAddress, nil},
+		{"invalid value", []byte{0x00, 0x0A, 0x12, 0x34}, &mbserver.IllegalDataValue, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mm := createTestServer(t)
+			pump := &mqtt.NorthResource{Name: "pump", ValueType: "bool"}
+			pump.OtherParameters.Modbus.Address = 10
+			alarm := &mqtt.NorthResource{Name: "alarm", ValueType: "bool"}
+			alarm.OtherParameters.Modbus.Address = 11
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+				NorthDeviceName: "device1",
+				Resources: []*mqtt.ResourceMapping{
+					{NorthResource: pump, SouthResource: &mqtt.SouthResource{Name: "pump", ReadWrite: "RW"}},
+					{NorthResource: alarm, SouthResource: &mqtt.SouthResource{Name: "alarm", ReadWrite: "R"}},
+				},
+			}}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+			publisher := &recordingPublisher{}
+			s.SetWritePublisher(publisher)
+
+			resp, exc := s.handleWriteSingleCoil(nil, &mbserver.TCPFrame{Function: 5, Data: tt.data})
+			if exc != tt.wantExc {
+				t.Fatalf("exception = %v, want %v", exc, tt.wantExc)
+			}
+			if exc == &mbserver.Success && !bytesEqual(resp, tt.data) {
+				t.Errorf("response = % X, want echo % X", resp, tt.data)
+			}
+			if len(publisher.puts) != len(tt.wantPuts) {
+				t.Fatalf("published PUTs = %v, want %v", publisher.puts, tt.wantPuts)
+			}
+			for i, want := range tt.wantPuts {
+				if publisher.puts[i] != want {
+					t.Errorf("PUT %d = %v, want %v", i, publisher.puts[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWritePermissionReadWrite(t *testing.T) {
+	tests := []struct {
+		readWrite string
+		wantExc   *mbserver.Exception
+	}{
+		{"RO", &mbserver.IllegalDataAddress},
+		{"read", &mbserver.IllegalDataAddress},
+		{"read-only", &mbserver.IllegalDataAddress},
+		{"unknown", &mbserver.IllegalDataAddress},
+		{"rw", nil},
+		{"W", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.readWrite, func(t *testing.T) {
+			s, mm := createTestServer(t)
+			nr := &mqtt.NorthResource{Name: "setpoint", ValueType: "int16"}
+			nr.OtherParameters.Modbus.Address = 50
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+				NorthDeviceName: "device1",
+				Resources: []*mqtt.ResourceMapping{
+					{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "setpoint", ReadWrite: tt.readWrite}},
+				},
+			}}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+			if exc := s.checkWritePermission(50); exc != tt.wantExc {
+				t.Errorf("checkWritePermission(%q) = %v, want %v", tt.readWrite, exc, tt.wantExc)
+			}
+		})
+	}
+}
+
+func TestWriteMultipleRegistersString(t *testing.T) {
+	s, mm := createTestServer(t)
+	nr := &mqtt.NorthResource{Name: "label", ValueType: "string"}
+	nr.OtherParameters.Modbus.Address = 200
+	nr.OtherParameters.Modbus.StringLength = 3
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "label", ReadWrite: "RW"}},
+		},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	publisher := &recordingPublisher{}
+	s.SetWritePublisher(publisher)
+
+	// "HELLO" 占3个寄存器，最后一个字节补NUL
+	data := []byte{0x00, 0xC8, 0x00, 0x03, 0x06, 'H', 'E', 'L', 'L', 'O', 0x00}
+	resp, exc := s.handleWriteMultipleRegisters(nil, &mbserver.TCPFrame{Function: 16, Data: data})
+	if exc != &mbserver.Success {
+		t.Fatalf("exception = %v, want success", exc)
+	}
+	if !bytesEqual(resp, data[:4]) {
+		t.Errorf("response = % X, want % X", resp, data[:4])
+	}
+
+	want := [][3]string{{"device1", "label", "HELLO"}}
+	if len(publisher.puts) != 1 || publisher.puts[0] != want[0] {
+		t.Errorf("published PUTs = %v, want %v", publisher.puts, want)
+	}
+
+	// 写入的字符串作为写回值保存，设备上报前即可读回
+	mm.UpdateCache("device1", map[string]interface{}{"label": "OLD"})
+	if _, exc := s.handleWriteMultipleRegisters(nil, &mbserver.TCPFrame{Function: 16, Data: data}); exc != &mbserver.Success {
+		t.Fatalf("second write exception = %v, want success", exc)
+	}
+	if cached, ok := mm.GetCachedValue(200); !ok || !cached.WriteBack || cached.Value != "HELLO" {
+		t.Errorf("expected written-back string HELLO, got %+v (found=%v)", cached, ok)
+	}
+}
+
+func TestWriteMultipleRegistersStringLength(t *testing.T) {
+	// label 占 200-202 三个寄存器，其后紧邻 203 的 mode
+	tests := []struct {
+		name    string
+		length  uint16
+		data    []byte
+		wantExc *mbserver.Exception
+	}{
+		{"exact length", 3, []byte{0x00, 0xC8, 0x00, 0x03, 0x06, 'A', 'B', 'C', 0x00, 0x00, 0x00}, &mbserver.Success},
+		{"overlong write", 3, []byte{0x00, 0xC8, 0x00, 0x04, 0x08, 'O', 'V', 'E', 'R', 'L', 'O', 'N', 'G'}, &mbserver.IllegalDataValue},
+		{"short write", 3, []byte{0x00, 0xC8, 0x00, 0x02, 0x04, 'H', 'I', 0x00, 0x00}, &mbserver.IllegalDataValue},
+		{"length not configured", 0, []byte{0x00, 0xC8, 0x00, 0x01, 0x02, 'H', 'I'}, &mbserver.IllegalDataAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mm := createTestServer(t)
+			label := &mqtt.NorthResource{Name: "label", ValueType: "string"}
+			label.OtherParameters.Modbus.Address = 200
+			label.OtherParameters.Modbus.StringLength = tt.length
+			mode := &mqtt.NorthResource{Name: "mode", ValueType: "uint16"}
+			mode.OtherParameters.Modbus.Address = 203
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+				NorthDeviceName: "device1",
+				Resources: []*mqtt.ResourceMapping{
+					{NorthResource: label, SouthResource: &mqtt.SouthResource{Name: "label", ReadWrite: "RW"}},
+					{NorthResource: mode, SouthResource: &mqtt.SouthResource{Name: "mode", ReadWrite: "RW"}},
+				},
+			}}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+			publisher := &recordingPublisher{}
+			s.SetWritePublisher(publisher)
+
+			_, exc := s.handleWriteMultipleRegisters(nil, &mbserver.TCPFrame{Function: 16, Data: tt.data})
+			if exc != tt.wantExc {
+				t.Fatalf("exception = %v, want %v", exc, tt.wantExc)
+			}
+			wantPuts := 0
+			if exc == &mbserver.Success {
+				wantPuts = 1
+			}
+			if len(publisher.puts) != wantPuts {
+				t.Errorf("published PUTs = %v, want %d", publisher.puts, wantPuts)
+			}
+		})
+	}
+}
+
+func TestWriteNumericRegisters(t *testing.T) {
+	precision := 2
+	setpoint := &mqtt.NorthResource{Name: "setpoint", ValueType: "int16", Scale: 0.01, Precision: &precision}
+	setpoint.OtherParameters.Modbus.Address = 50
+	flow := &mqtt.NorthResource{Name: "flow", ValueType: "float32"}
+	flow.OtherParameters.Modbus.Address = 60
+	mode := &mqtt.NorthResource{Name: "mode", ValueType: "uint16"}
+	mode.OtherParameters.Modbus.Address = 62
+	status := &mqtt.NorthResource{Name: "status", ValueType: "uint16"}
+	status.OtherParameters.Modbus.Address = 64
+
+	tests := []struct {
+		name     string
+		function uint8
+		data     []byte
+		wantExc  *mbserver.Exception
+		wantPuts [][3]string
+	}{
+		{
+			name: "single register rounded to precision", function: 6,
+			data:     []byte{0x00, 0x32, 0x04, 0xD2}, // 1234 * 0.01
+			wantExc:  &mbserver.Success,
+			wantPuts: [][3]string{{"device1", "setpoint", "12.34"}},
+		},
+		{
+			name: "block across resources", function: 16,
+			data:     []byte{0x00, 0x3C, 0x00, 0x04, 0x08, 0x3F, 0xC0, 0x00, 0x00, 0x00, 0x07, 0x00, 0x00}, // flow=1.5, mode=7, 63 unmapped
+			wantExc:  &mbserver.Success,
+			wantPuts: [][3]string{{"device1", "flow", "1.5"}, {"device1", "mode", "7"}},
+		},
+		{
+			name: "half of an uncached float32", function: 6,
+			data:     []byte{0x00, 0x3C, 0x3F, 0xC0}, // low word taken as zero
+			wantExc:  &mbserver.Success,
+			wantPuts: [][3]string{{"device1", "flow", "1.5"}},
+		},
+		{
+			name: "read-only resource in block", function: 16,
+			data:    []byte{0x00, 0x3E, 0x00, 0x03, 0x06, 0x00, 0x07, 0x00, 0x00, 0x00, 0x01},
+			wantExc: &mbserver.IllegalDataAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mm := createTestServer(t)
+			var resources []*mqtt.ResourceMapping
+			for _, nr := range []*mqtt.NorthResource{setpoint, flow, mode, status} {
+				rw := "RW"
+				if nr == status {
+					rw = "R"
+				}
+				resources = append(resources, &mqtt.ResourceMapping{
+					NorthResource: nr,
+					SouthResource: &mqtt.SouthResource{Name: nr.Name, ReadWrite: rw},
+				})
+			}
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{NorthDeviceName: "device1", Resources: resources}}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+			publisher := &recordingPublisher{}
+			s.SetWritePublisher(publisher)
+
+			_, exc := s.dispatch(nil, &mbserver.TCPFrame{Function: tt.function, Data: tt.data})
+			if exc != tt.wantExc {
+				t.Fatalf("exception = %v, want %v", exc, tt.wantExc)
+			}
+			if len(publisher.puts) != len(tt.wantPuts) {
+				t.Fatalf("published PUTs = %v, want %v", publisher.puts, tt.wantPuts)
+			}
+			for i, want := range tt.wantPuts {
+				if publisher.puts[i] != want {
+					t.Errorf("PUT %d = %v, want %v", i, publisher.puts[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteRegistersPartialMerge(t *testing.T) {
+	s, mm := createTestServer(t)
+	flow := &mqtt.NorthResource{Name: "flow", ValueType: "float32"}
+	flow.OtherParameters.Modbus.Address = 60
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: flow, SouthResource: &mqtt.SouthResource{Name: "flow", ReadWrite: "RW"}},
+		},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	mm.UpdateCache("device1", map[string]interface{}{"flow": 1.5}) // 0x3FC00000
+	publisher := &recordingPublisher{}
+	s.SetWritePublisher(publisher)
+
+	// Each half is merged into the current value, including the half written just before
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte{0x00, 0x3D, 0x80, 0x00}, "1.50390625"}, // 0x3FC08000
+		{[]byte{0x00, 0x3C, 0x40, 0x00}, "2.0078125"},  // 0x40008000
+	}
+	for _, tt := range tests {
+		publisher.puts = nil
+		if _, exc := s.dispatch(nil, &mbserver.TCPFrame{Function: 6, Data: tt.data}); exc != &mbserver.Success {
+			t.Fatalf("write %X: exception = %v, want success", tt.data, exc)
+		}
+		want := [3]string{"device1", "flow", tt.want}
+		if len(publisher.puts) != 1 || publisher.puts[0] != want {
+			t.Errorf("write %X: published PUTs = %v, want %v", tt.data, publisher.puts, want)
+		}
+	}
+
+	cached, ok := mm.GetCachedValue(60)
+	if !ok || !cached.WriteBack || cached.Value != 2.0078125 {
+		t.Errorf("expected write-back value 2.0078125, got %+v (found=%v)", cached, ok)
+	}
+}
+
+func TestWriteBackServedToReads(t *testing.T) {
+	lc := logger.NewClient("ERROR")
+	mm := mappingmanager.NewMappingManager(mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, lc), lc,
+		&config.CacheConfig{DefaultTTL: "30s", CleanupInterval: "5m", WriteBackMaxAge: "100ms"})
+	s := NewModbusServer(&config.ModbusConfig{
+		Type: "TCP",
+		TCP:  config.ModbusTcpConfig{Host: "127.0.0.1", Port: 0, SlaveID: 1},
+	}, mm, lc)
+	mode := &mqtt.NorthResource{Name: "mode", ValueType: "uint16"}
+	mode.OtherParameters.Modbus.Address = 70
+	valve := &mqtt.NorthResource{Name: "valve", ValueType: "bool"}
+	valve.OtherParameters.Modbus.Address = 5
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: mode, SouthResource: &mqtt.SouthResource{Name: "mode", ReadWrite: "RW"}},
+			{NorthResource: valve, SouthResource: &mqtt.SouthResource{Name: "valve", ReadWrite: "RW"}},
+		},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	s.SetWritePublisher(&recordingPublisher{})
+
+	readMode := func() []byte {
+		t.Helper()
+		data, exc := s.dispatch(nil, &mbserver.TCPFrame{Function: 3, Data: []byte{0x00, 0x46, 0x00, 0x01}})
+		if exc != &mbserver.Success {
+			t.Fatalf("read exception = %v, want success", exc)
+		}
+		return data
+	}
+	writeMode := func(value byte) {
+		t.Helper()
+		if _, exc := s.dispatch(nil, &mbserver.TCPFrame{Function: 6, Data: []byte{0x00, 0x46, 0x00, value}}); exc != &mbserver.Success {
+			t.Fatalf("write exception = %v, want success", exc)
+		}
+	}
+
+	// A written register is read back before the device reports it
+	mm.UpdateCache("device1", map[string]interface{}{"mode": 5})
+	writeMode(9)
+	if got := readMode(); !bytesEqual(got, []byte{0x02, 0x00, 0x09}) {
+		t.Errorf("read after write = %X, want written value 9", got)
+	}
+
+	// Fresher sensor data replaces the written-back value
+	mm.UpdateCache("device1", map[string]interface{}{"mode": 6})
+	if got := readMode(); !bytesEqual(got, []byte{0x02, 0x00, 0x06}) {
+		t.Errorf("read after sensor update = %X, want sensor value 6", got)
+	}
+
+	// Without sensor data the written-back value expires after WriteBackMaxAge
+	writeMode(9)
+	time.Sleep(150 * time.Millisecond)
+	if got := readMode(); !bytesEqual(got, []byte{0x02, 0x00, 0x00}) {
+		t.Errorf("read after max age = %X, want zero", got)
+	}
+
+	// Coil writes are written back the same way
+	if _, exc := s.dispatch(nil, &mbserver.TCPFrame{Function: 15, Data: []byte{0x00, 0x05, 0x00, 0x01, 0x01, 0x01}}); exc != &mbserver.Success {
+		t.Fatalf("coil write exception = %v, want success", exc)
+	}
+	if cached, ok := mm.GetCachedValue(5); !ok || !cached.WriteBack || cached.Value != true {
+		t.Errorf("expected written-back coil value true, got %+v (found=%v)", cached, ok)
+	}
+}
+
+func TestWriteSingleRegisterSignedFlag(t *testing.T) {
+	s, mm := createTestServer(t)
+	flagAddr := uint16(200)
+	current := &mqtt.NorthResource{Name: "current", ValueType: "uint16"}
+	current.OtherParameters.Modbus.Address = 100
+	current.OtherParameters.Modbus.SignedFlagAddress = &flagAddr
+	mode := &mqtt.NorthResource{Name: "signedMode", ValueType: "bool"}
+	mode.OtherParameters.Modbus.Address = flagAddr
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "meter1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: current, SouthResource: &mqtt.SouthResource{Name: "current", ReadWrite: "RW"}},
+			{NorthResource: mode, SouthResource: &mqtt.SouthResource{Name: "signedMode"}},
+		},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	publisher := &recordingPublisher{}
+	s.SetWritePublisher(publisher)
+
+	// The same raw register is published unsigned or signed depending on the mode flag
+	tests := []struct {
+		signed bool
+		want   string
+	}{
+		{false, "65535"},
+		{true, "-1"},
+	}
+	for _, tt := range tests {
+		mm.UpdateCache("meter1", map[string]interface{}{"signedMode": tt.signed})
+		publisher.puts = nil
+		if _, exc := s.handleWriteSingleRegister(nil, &mbserver.TCPFrame{Function: 6, Data: []byte{0x00, 0x64, 0xFF, 0xFF}}); exc != &mbserver.Success {
+			t.Fatalf("signed=%v: exception = %v, want success", tt.signed, exc)
+		}
+		want := [3]string{"meter1", "current", tt.want}
+		if len(publisher.puts) != 1 || publisher.puts[0] != want {
+			t.Errorf("signed=%v: published PUTs = %v, want %v", tt.signed, publisher.puts, want)
+		}
+	}
+}
+
+func TestWriteSingleRegisterWriteCalibration(t *testing.T) {
+	float := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name string
+		nr   mqtt.NorthResource
+		want string // PUT value for a written register of 40
+	}{
+		{"shared calibration", mqtt.NorthResource{Scale: 0.5, OffsetValue: 5}, "25"},
+		{"write scale override", mqtt.NorthResource{Scale: 0.5, OffsetValue: 5, WriteScale: float(2)}, "85"},
+		{"write offset override", mqtt.NorthResource{Scale: 0.5, ReadOffsetValue: float(1), WriteOffsetValue: float(-1)}, "19"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mm := createTestServer(t)
+			nr := tt.nr
+			nr.Name = "setpoint"
+			nr.ValueType = "int16"
+			nr.OtherParameters.Modbus.Address = 400
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+				NorthDeviceName: "dev1",
+				Resources:       []*mqtt.ResourceMapping{{NorthResource: &nr, SouthResource: &mqtt.SouthResource{Name: "setpoint", ReadWrite: "RW"}}},
+			}}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+			publisher := &recordingPublisher{}
+			s.SetWritePublisher(publisher)
+
+			if _, exc := s.handleWriteSingleRegister(nil, &mbserver.TCPFrame{Function: 6, Data: []byte{0x01, 0x90, 0x00, 0x28}}); exc != &mbserver.Success {
+				t.Fatalf("exception = %v, want success", exc)
+			}
+			want := [3]string{"dev1", "setpoint", tt.want}
+			if len(publisher.puts) != 1 || publisher.puts[0] != want {
+				t.Errorf("published PUTs = %v, want %v", publisher.puts, want)
+			}
+		})
+	}
+}
+
+func TestMaxReadQuantity(t *testing.T) {
+	s, _ := createTestServer(t)
+	s.config.MaxReadQuantity = 10
+
+	readFrame := func(function uint8, quantity uint16) *mbserver.TCPFrame {
+		return &mbserver.TCPFrame{Function: function, Data: []byte{0x00, 0x64, byte(quantity >> 8), byte(quantity)}}
+	}
+
+	tests := []struct {
+		name     string
+		handler  func(*mbserver.Server, mbserver.Framer) ([]byte, *mbserver.Exception)
+		function uint8
+		quantity uint16
+		wantExc  *mbserver.Exception
+	}{
+		{"registers at cap", s.handleReadHoldingRegisters, 3, 10, &mbserver.Success},
+		{"registers over cap", s.handleReadHoldingRegisters, 3, 11, &mbserver.IllegalDataValue},
+		{"input registers over cap", s.handleReadInputRegisters, 4, 11, &mbserver.IllegalDataValue},
+		{"coils at cap", s.handleReadCoils, 1, 10, &mbserver.Success},
+		{"coils over cap", s.handleReadCoils, 1, 11, &mbserver.IllegalDataValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, exc := tt.handler(nil, readFrame(tt.function, tt.quantity))
+			if exc != tt.wantExc {
+				t.Errorf("quantity %d: exception = %v, want %v", tt.quantity, exc, tt.wantExc)
+			}
+		})
+	}
+}
+
+func TestAddrWithAutoPort(t *testing.T) {
+	s, _ := createTestServer(t)
+	if s.Addr() != "" {
+		t.Errorf("expected empty address before start, got %q", s.Addr())
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	host, port, err := net.SplitHostPort(s.Addr())
+	if err != nil {
+		t.Fatalf("invalid address %q: %v", s.Addr(), err)
+	}
+	if host != "127.0.0.1" {
+		t.Errorf("host = %s, want 127.0.0.1", host)
+	}
+	if port == "0" || port == "" {
+		t.Fatalf("expected a concrete port, got %q", port)
+	}
+
+	conn, err := net.DialTimeout("tcp", s.Addr(), time.Second)
+	if err != nil {
+		t.Fatalf("dial %s failed: %v", s.Addr(), err)
+	}
+	conn.Close()
+}
+
+func TestStopClosesTCPConnections(t *testing.T) {
+	s, _ := createTestServer(t)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	conn, err := net.DialTimeout("tcp", s.Addr(), time.Second)
+	if err != nil {
+		t.Fatalf("dial %s failed: %v", s.Addr(), err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// 读取未映射的保持寄存器：响应回显事务标识符和单元标识符，寄存器值为 0
+	request := []byte{0x12, 0x34, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x64, 0x00, 0x01}
+	if _, err := conn.Write(request); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	response := make([]byte, 11)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		t.Fatalf("read response failed: %v", err)
+	}
+	want := []byte{0x12, 0x34, 0x00, 0x00, 0x00, 0x05, 0x01, 0x03, 0x02, 0x00, 0x00}
+	if !bytesEqual(response, want) {
+		t.Fatalf("response = % X, want % X", response, want)
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("read after Stop = %v, want EOF from the closed connection", err)
+	}
+}
+
+func TestReadExceptionStatus(t *testing.T) {
+	s, mm := createTestServer(t)
+
+	var resources []*mqtt.ResourceMapping
+	for i, name := range []string{"alarm", "fault", "ready"} {
+		nr := &mqtt.NorthResource{Name: name, ValueType: "bool"}
+		nr.OtherParameters.Modbus.Address = uint16(20 + i)
+		resources = append(resources, &mqtt.ResourceMapping{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: name}})
+	}
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{NorthDeviceName: "plc1", Resources: resources}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if err := mm.UpdateCache("plc1", map[string]interface{}{"alarm": true, "fault": false, "ready": true}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		coils []uint16
+		want  byte
+	}{
+		{"unconfigured", nil, 0x00},
+		{"source bits in order", []uint16{20, 21, 22}, 0x05},
+		{"reordered sources", []uint16{21, 22, 20}, 0x06},
+		{"uncached coil reads as zero", []uint16{99, 20}, 0x02},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.config.ExceptionStatusCoils = tt.coils
+			resp, exc := s.dispatch(nil, &mbserver.TCPFrame{Function: 7})
+			if exc != &mbserver.Success {
+				t.Fatalf("exception = %v, want Success", exc)
+			}
+			if !bytesEqual(resp, []byte{tt.want}) {
+				t.Errorf("status = % X, want %02X", resp, tt.want)
+			}
+		})
+	}
+}
+
+// reloadMappings returns two resources at addresses 100 and 101 whose names start with prefix
+func reloadMappings(prefix string) []*mqtt.DeviceMapping {
+	first := &mqtt.NorthResource{Name: prefix + "1", ValueType: "uint16"}
+	first.OtherParameters.Modbus.Address = 100
+	second := &mqtt.NorthResource{Name: prefix + "2", ValueType: "uint16"}
+	second.OtherParameters.Modbus.Address = 101
+	return []*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device-" + prefix,
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: first, SouthResource: &mqtt.SouthResource{Name: prefix + "1"}},
+				{NorthResource: second, SouthResource: &mqtt.SouthResource{Name: prefix + "2"}},
+			},
+		},
+	}
+}
+
+// mappingPrefixHandler returns the name prefixes of the resources mapped at 100 and 101
+func mappingPrefixHandler(mm *mappingmanager.MappingManager, onRead func()) FunctionHandler {
+	return func(srv *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+		first, ok1 := mm.GetMappingByAddress(100)
+		if onRead != nil {
+			onRead()
+		}
+		second, ok2 := mm.GetMappingByAddress(101)
+		if !ok1 || !ok2 {
+			return nil, &mbserver.IllegalDataAddress
+		}
+		return []byte{first.NorthResource.Name[0], second.NorthResource.Name[0]}, &mbserver.Success
+	}
+}
+
+func TestReadDuringMappingReload(t *testing.T) {
+	s, mm := createTestServer(t)
+	if err := mm.UpdateMappings(reloadMappings("a")); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	s.SetFunctionHandler(3, mappingPrefixHandler(mm, runtime.Gosched))
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			prefix := "a"
+			if i%2 == 0 {
+				prefix = "b"
+			}
+			_ = mm.UpdateMappings(reloadMappings(prefix))
+			runtime.Gosched()
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	frame := &mbserver.TCPFrame{Function: 3, Data: []byte{0x00, 0x64, 0x00, 0x02}}
+	for i := 0; i < 2000; i++ {
+		data, exc := s.dispatch(nil, frame)
+		if exc == &mbserver.SlaveDeviceBusy {
+			continue
+		}
+		if exc != &mbserver.Success {
+			t.Fatalf("unexpected exception %v", exc)
+		}
+		if data[0] != data[1] {
+			t.Fatalf("read saw mixed mappings %q and %q", data[0], data[1])
+		}
+	}
+}
+
+func TestBusyDuringReload(t *testing.T) {
+	tests := []struct {
+		name      string
+		busy      bool
+		wantExc   *mbserver.Exception
+		wantCalls int
+		wantData  []byte
+	}{
+		{"retry after reload", false, &mbserver.Success, 2, []byte{'b', 'b'}},
+		{"busy during reload", true, &mbserver.SlaveDeviceBusy, 1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mm := createTestServer(t)
+			s.config.BusyDuringReload = tt.busy
+			if err := mm.UpdateMappings(reloadMappings("a")); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+
+			// The first read triggers a reload between its two lookups
+			calls := 0
+			s.SetFunctionHandler(3, mappingPrefixHandler(mm, func() {
+				calls++
+				if calls == 1 {
+					_ = mm.UpdateMappings(reloadMappings("b"))
+				}
+			}))
+
+			data, exc := s.dispatch(nil, &mbserver.TCPFrame{Function: 3, Data: []byte{0x00, 0x64, 0x00, 0x02}})
+			if exc != tt.wantExc {
+				t.Fatalf("exception = %v, want %v", exc, tt.wantExc)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", calls, tt.wantCalls)
+			}
+			if !bytesEqual(data, tt.wantData) {
+				t.Errorf("data = %v, want %v", data, tt.wantData)
+			}
+		})
+	}
+}
+
+// reloadingManager reloads the mappings during the first register read and counts forward log calls
+type reloadingManager struct {
+	*mappingmanager.MappingManager
+	reads    int
+	forwards int
+}
+
+func (m *reloadingManager) GetCachedRegisters(startAddr config.AddressKey, quantity uint16) ([]*mappingmanager.CachedData, error) {
+	m.reads++
+	if m.reads == 1 {
+		_ = m.UpdateMappings(reloadMappings("b"))
+		_ = m.UpdateCache("device-b", map[string]interface{}{"b1": 1, "b2": 2})
+	}
+	return m.MappingManager.GetCachedRegisters(startAddr, quantity)
+}
+
+func (m *reloadingManager) LogDataForward(forwardedData map[string]map[string]interface{}, readTime time.Time) {
+	m.forwards++
+}
+
+func TestRetriedReadLogsForwardOnce(t *testing.T) {
+	_, mm := createTestServer(t)
+	if err := mm.UpdateMappings(reloadMappings("a")); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if err := mm.UpdateCache("device-a", map[string]interface{}{"a1": 7, "a2": 8}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+	rm := &reloadingManager{MappingManager: mm}
+	s := NewModbusServer(&config.ModbusConfig{Type: "TCP"}, rm, logger.NewClient("ERROR"))
+
+	data, exc := s.dispatch(nil, &mbserver.TCPFrame{Function: 3, Data: []byte{0x00, 0x64, 0x00, 0x02}})
+	if exc != &mbserver.Success {
+		t.Fatalf("exception = %v, want success", exc)
+	}
+	if !bytesEqual(data, []byte{0x04, 0x00, 0x01, 0x00, 0x02}) {
+		t.Errorf("data = % X, want the values read after the reload", data)
+	}
+	if rm.reads != 2 {
+		t.Errorf("read %d times, want 2", rm.reads)
+	}
+	if rm.forwards != 1 {
+		t.Errorf("forward log recorded %d times, want once", rm.forwards)
+	}
+}
+
+// tcpRequest 在连接上发送一个Modbus TCP请求并返回响应的PDU
+func tcpRequest(conn net.Conn, txID uint16, pdu []byte) ([]byte, error) {
+	req := make([]byte, 7+len(pdu))
+	binary.BigEndian.PutUint16(req[0:], txID)
+	binary.BigEndian.PutUint16(req[4:], uint16(len(pdu)+1))
+	req[6] = 1
+	copy(req[7:], pdu)
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, 260)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+	if n < 8 || binary.BigEndian.Uint16(resp[0:]) != txID {
+		return nil, fmt.Errorf("unexpected response % X", resp[:n])
+	}
+	return resp[7:n], nil
+}
+
+func TestInterleavedReadWriteOrder(t *testing.T) {
+	s, _ := createTestServer(t)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	// 不加锁的寄存器表：若处理程序被并发调用，竞态检测会报告，读到的值也会错乱
+	registers := map[uint16]uint16{}
+	var inFlight, maxInFlight atomic.Int32
+	track := func() func() {
+		if n := inFlight.Add(1); n > maxInFlight.Load() {
+			maxInFlight.Store(n)
+		}
+		time.Sleep(100 * time.Microsecond)
+		return func() { inFlight.Add(-1) }
+	}
+	s.SetFunctionHandler(6, func(_ *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+		defer track()()
+		data := frame.GetData()
+		registers[binary.BigEndian.Uint16(data[0:])] = binary.BigEndian.Uint16(data[2:])
+		return data[:4], &mbserver.Success
+	})
+	s.SetFunctionHandler(3, func(_ *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+		defer track()()
+		resp := []byte{2, 0, 0}
+		binary.BigEndian.PutUint16(resp[1:], registers[binary.BigEndian.Uint16(frame.GetData()[0:])])
+		return resp, &mbserver.Success
+	})
+
+	const masters, rounds = 4, 50
+	var wg sync.WaitGroup
+	errs := make(chan error, masters)
+	for m := 0; m < masters; m++ {
+		wg.Add(1)
+		go func(addr uint16) {
+			defer wg.Done()
+			conn, err := net.DialTimeout("tcp", s.Addr(), time.Second)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+			for i := uint16(1); i <= rounds; i++ {
+				write := []byte{6, 0, 0, 0, 0}
+				binary.BigEndian.PutUint16(write[1:], addr)
+				binary.BigEndian.PutUint16(write[3:], i)
+				if _, err := tcpRequest(conn, 2*i, write); err != nil {
+					errs <- err
+					return
+				}
+				read := []byte{3, 0, 0, 0, 1}
+				binary.BigEndian.PutUint16(read[1:], addr)
+				resp, err := tcpRequest(conn, 2*i+1, read)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if got := binary.BigEndian.Uint16(resp[2:]); got != i {
+					errs <- fmt.Errorf("address %d: read %d after writing %d", addr, got, i)
+					return
+				}
+			}
+		}(uint16(100 + m))
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if got := maxInFlight.Load(); got != 1 {
+		t.Errorf("max concurrent handlers = %d, want 1", got)
+	}
+}
+
+// fakeConnection 是可切换的北向连接状态
+type fakeConnection struct {
+	connected bool
+}
+
+func (f *fakeConnection) IsConnected() bool {
+	return f.connected
+}
+
+func TestRejectWritesWhenDisconnected(t *testing.T) {
+	tests := []struct {
+		name      string
+		reject    bool
+		connected bool
+		function  uint8
+		wantExc   *mbserver.Exception
+		wantCalls int
+	}{
+		{"write while connected", true, true, 6, &mbserver.Success, 1},
+		{"write while disconnected", true, false, 6, &mbserver.SlaveDeviceBusy, 0},
+		{"multiple write while disconnected", true, false, 16, &mbserver.SlaveDeviceBusy, 0},
+		{"read while disconnected", true, false, 3, &mbserver.Success, 1},
+		{"option disabled", false, false, 6, &mbserver.Success, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := createTestServer(t)
+			s.config.RejectWritesWhenDisconnected = tt.reject
+			s.SetConnectionChecker(&fakeConnection{connected: tt.connected})
+
+			calls := 0
+			s.SetFunctionHandler(tt.function, func(*mbserver.Server, mbserver.Framer) ([]byte, *mbserver.Exception) {
+				calls++
+				return nil, &mbserver.Success
+			})
+
+			_, exc := s.dispatch(nil, &mbserver.TCPFrame{Function: tt.function, Data: []byte{0x00, 0x64, 0x00, 0x01}})
+			if exc != tt.wantExc {
+				t.Errorf("exception = %v, want %v", exc, tt.wantExc)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		name        string
+		readOnly    bool
+		diagnostics bool
+		want        []uint8
+	}{
+		{"default", false, false, []uint8{1, 2, 3, 4, 5, 6, 7, 15, 16}},
+		{"read-only", true, false, []uint8{1, 2, 3, 4, 7}},
+		{"read-only with diagnostics", true, true, []uint8{1, 2, 3, 4, 7, 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, mm := createTestServer(t)
+			s := NewModbusServer(&config.ModbusConfig{ReadOnly: tt.readOnly, Diagnostics: tt.diagnostics}, mm, base.lc)
+			if got := s.Capabilities(); !bytesEqual(got, tt.want) {
+				t.Errorf("Capabilities() = %v, want %v", got, tt.want)
+			}
+
+			write := &mbserver.TCPFrame{Function: 6, Data: []byte{0x00, 0x64, 0x00, 0x01}}
+			if _, exc := s.dispatch(nil, write); tt.readOnly && exc != &mbserver.IllegalFunction {
+				t.Errorf("write in read-only mode: exception = %v, want illegal function", exc)
+			}
+		})
+	}
+
+	// 运行时禁用的功能码不再报告
+	s, _ := createTestServer(t)
+	s.SetFunctionHandler(7, nil)
+	if got, want := s.Capabilities(), []uint8{1, 2, 3, 4, 5, 6, 15, 16}; !bytesEqual(got, want) {
+		t.Errorf("Capabilities() after disabling 0x07 = %v, want %v", got, want)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	s, mm := createTestServer(t)
+	nr := &mqtt.NorthResource{Name: "temperature", ValueType: "int16"}
+	nr.OtherParameters.Modbus.Address = 100
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature", ValueType: "int16"}},
+		},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	if err := mm.UpdateCache("device1", map[string]interface{}{"temperature": 25}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+	read := &mbserver.TCPFrame{Function: 3, Data: []byte{0x00, 0x64, 0x00, 0x01}}
+
+	s.Pause()
+	if !s.IsPaused() {
+		t.Fatal("expected server to be paused")
+	}
+	if _, exc := s.dispatch(nil, read); exc != &mbserver.SlaveDeviceBusy {
+		t.Errorf("paused read exception = %v, want %v", exc, &mbserver.SlaveDeviceBusy)
+	}
+	write := &mbserver.TCPFrame{Function: 6, Data: []byte{0x00, 0x64, 0x00, 0x01}}
+	if _, exc := s.dispatch(nil, write); exc != &mbserver.SlaveDeviceBusy {
+		t.Errorf("paused write exception = %v, want %v", exc, &mbserver.SlaveDeviceBusy)
+	}
+
+	s.Resume()
+	data, exc := s.dispatch(nil, read)
+	if exc != &mbserver.Success {
+		t.Fatalf("resumed read exception = %v, want success", exc)
+	}
+	if want := []byte{0x02, 0x00, 0x19}; !bytesEqual(data, want) {
+		t.Errorf("resumed read = % X, want % X", data, want)
+	}
+}
+
+func TestReportConversionErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		report      bool
+		wantEntries int
+	}{
+		{"reporting enabled", true, 2},
+		{"reporting disabled", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mm := createTestServer(t)
+			s.config.ReportConversionErrors = tt.report
+			nr := &mqtt.NorthResource{Name: "temperature", ValueType: "int16"}
+			nr.OtherParameters.Modbus.Address = 100
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+				NorthDeviceName: "device1",
+				Resources: []*mqtt.ResourceMapping{
+					{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature", ValueType: "int16"}},
+				},
+			}}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+			if err := mm.UpdateCache("device1", map[string]interface{}{"temperature": "not a number"}); err != nil {
+				t.Fatalf("UpdateCache failed: %v", err)
+			}
+			logs := forwardlog.NewManager(nil, s.lc)
+			s.SetConversionErrorReporter(logs)
+
+			read := func(times int) {
+				t.Helper()
+				frame := &mbserver.TCPFrame{Function: 3, Data: []byte{0x00, 0x64, 0x00, 0x01}}
+				for i := 0; i < times; i++ {
+					data, exc := s.handleReadHoldingRegisters(nil, frame)
+					if exc != &mbserver.Success {
+						t.Fatalf("read exception = %v, want success", exc)
+					}
+					if want := []byte{0x02, 0x00, 0x00}; !bytesEqual(data, want) {
+						t.Errorf("read = % X, want zero-filled % X", data, want)
+					}
+				}
+			}
+
+			// Reads only count failures; the report carries the accumulated count
+			read(2)
+			if got := s.reader.ConversionErrors()["device1"]["temperature"]; got != 2 {
+				t.Errorf("conversion error count = %d, want 2", got)
+			}
+			if entries := logs.Peek(); len(entries) != 0 {
+				t.Fatalf("reads produced %d forward log entries, want none", len(entries))
+			}
+			s.reportConversionErrors()
+
+			// An unchanged count is not reported again
+			s.reportConversionErrors()
+
+			read(1)
+			s.reportConversionErrors()
+
+			entries := logs.Peek()
+			if len(entries) != tt.wantEntries {
+				t.Fatalf("forward log has %d entries, want %d", len(entries), tt.wantEntries)
+			}
+			for i, want := range []uint64{2, 3}[:tt.wantEntries] {
+				entry := entries[i]
+				if entry.Source != forwardlog.SourceConversionError || entry.Status != 0 || entry.NorthDeviceName != "device1" {
+					t.Errorf("unexpected entry %+v", entry)
+				}
+				if entry.Data["temperature"] != want {
+					t.Errorf("report %d count = %v, want %d", i, entry.Data["temperature"], want)
+				}
+			}
+		})
+	}
+}
+
+// captureLogger 记录所有级别的日志消息
+type captureLogger struct {
+	logger.LoggingClient
+	mu       sync.Mutex
+	messages []string
+}
+
+func (c *captureLogger) record(msg string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, msg)
+}
+
+func (c *captureLogger) Debug(msg string, args ...interface{}) { c.record(msg) }
+func (c *captureLogger) Info(msg string, args ...interface{})  { c.record(msg) }
+func (c *captureLogger) Warn(msg string, args ...interface{})  { c.record(msg) }
+func (c *captureLogger) Error(msg string, args ...interface{}) { c.record(msg) }
+
+func (c *captureLogger) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	msgs := c.messages
+	c.messages = nil
+	return msgs
+}
+
+func TestReadRequestCorrelationID(t *testing.T) {
+	s, mm := createTestServer(t)
+	capture := &captureLogger{LoggingClient: logger.NewClient("ERROR")}
+	s.lc = capture
+
+	nr := &mqtt.NorthResource{Name: "code", ValueType: "uint16"}
+	nr.OtherParameters.Modbus.Address = 100
+	if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources:       []*mqtt.ResourceMapping{{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "code"}}},
+	}}); err != nil {
+		t.Fatalf("UpdateMappings failed: %v", err)
+	}
+	// 无法转换为uint16的值让读取器记录一条转换失败警告
+	if err := mm.UpdateCache("device1", map[string]interface{}{"code": "not-a-number"}); err != nil {
+		t.Fatalf("UpdateCache failed: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		if _, exc := s.dispatch(nil, &mbserver.TCPFrame{Function: 3, Data: []byte{0x00, 0x64, 0x00, 0x02}}); exc != &mbserver.Success {
+			t.Fatalf("exception = %v, want Success", exc)
+		}
+
+		msgs := capture.take()
+		// 处理程序一条，读取器开始、转换失败、完成各一条
+		if len(msgs) < 4 {
+			t.Fatalf("expected at least 4 log lines, got %d: %q", len(msgs), msgs)
+		}
+		id := msgs[0][:strings.Index(msgs[0], "]")+1]
+		if !strings.HasPrefix(id, "[req=") {
+			t.Fatalf("first log line %q has no correlation ID", msgs[0])
+		}
+		for _, msg := range msgs {
+			if !strings.HasPrefix(msg, id+" ") {
+				t.Errorf("log line %q does not carry %s", msg, id)
+			}
+		}
+		if seen[id] {
+			t.Errorf("correlation ID %s reused across requests", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestServerProbeOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   bool
+		magic     uint32
+		cached    interface{} // 启动前已缓存的探测值，nil表示未缓存
+		arriving  interface{} // 探测开始后到达的探测值，nil表示不到达
+		wantErr   bool
+		wantOrder ByteOrder
+		wantWord  WordOrder
+	}{
+		{"disabled", false, 0x1234, 0x3412, nil, false, BigEndian, HighWordFirst},
+		{"cached big endian", true, 0x1234, 0x1234, nil, false, BigEndian, HighWordFirst},
+		{"cached little endian", true, 0x1234, 0x3412, nil, false, LittleEndian, LowWordFirst},
+		{"two-register word swap", true, 0x12345678, 0x56781234, nil, false, BigEndian, LowWordFirst},
+		{"value arrives after start", true, 0x1234, nil, 0x3412, false, LittleEndian, LowWordFirst},
+		{"no value within timeout", true, 0x1234, nil, nil, true, BigEndian, HighWordFirst},
+		{"value does not match magic", true, 0x1234, 0x0001, nil, true, BigEndian, HighWordFirst},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mm := createTestServer(t)
+			s.Reader().Converter().SetMemoSize(8)
+			memo := s.Reader().Converter().memo
+			s.config.OrderProbe = config.OrderProbeConfig{Enabled: tt.enabled, Address: 500, Magic: tt.magic, Timeout: "200ms"}
+			nr := &mqtt.NorthResource{Name: "magic", ValueType: "uint32"}
+			nr.OtherParameters.Modbus.Address = 500
+			if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+				NorthDeviceName: "device1",
+				Resources: []*mqtt.ResourceMapping{
+					{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "magic", ValueType: "uint32"}},
+				},
+			}}); err != nil {
+				t.Fatalf("UpdateMappings failed: %v", err)
+			}
+			if tt.cached != nil {
+				if err := mm.UpdateCache("device1", map[string]interface{}{"magic": tt.cached}); err != nil {
+					t.Fatalf("UpdateCache failed: %v", err)
+				}
+			}
+			if tt.arriving != nil {
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					mm.UpdateCache("device1", map[string]interface{}{"magic": tt.arriving})
+				}()
+			}
+
+			err := s.ProbeOrder(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProbeOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			conv := s.Reader().Converter()
+			if conv.ByteOrder() != tt.wantOrder || conv.WordOrder() != tt.wantWord {
+				t.Errorf("order = %s/%s, want %s/%s", conv.ByteOrder(), conv.WordOrder(), tt.wantOrder, tt.wantWord)
+			}
+			// 替换后的转换器沿用原有的编码缓存
+			if conv.memo != memo {
+				t.Error("probed converter dropped the conversion cache")
+			}
+		})
+	}
+}
+
+func TestUnitRouting(t *testing.T) {
+	primary, primaryMM := createTestServer(t)
+	unit, unitMM := createTestServer(t)
+	primary.AddUnit(2, unit)
+	for mm, value := range map[*mappingmanager.MappingManager]int{primaryMM: 21, unitMM: 35} {
+		nr := &mqtt.NorthResource{Name: "temperature", ValueType: "int16"}
+		nr.OtherParameters.Modbus.Address = 100
+		if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature", ValueType: "int16"}},
+			},
+		}}); err != nil {
+			t.Fatalf("UpdateMappings failed: %v", err)
+		}
+		if err := mm.UpdateCache("device1", map[string]interface{}{"temperature": value}); err != nil {
+			t.Fatalf("UpdateCache failed: %v", err)
+		}
+	}
+
+	data := []byte{0x00, 0x64, 0x00, 0x01}
+	tests := []struct {
+		name  string
+		frame mbserver.Framer
+		want  []byte
+	}{
+		{"primary unit", &mbserver.TCPFrame{Device: 1, Function: 3, Data: data}, []byte{0x02, 0x00, 0x15}},
+		{"added unit", &mbserver.TCPFrame{Device: 2, Function: 3, Data: data}, []byte{0x02, 0x00, 0x23}},
+		{"unknown unit served by primary", &mbserver.TCPFrame{Device: 9, Function: 3, Data: data}, []byte{0x02, 0x00, 0x15}},
+		{"added unit over RTU", &mbserver.RTUFrame{Address: 2, Function: 3, Data: data}, []byte{0x02, 0x00, 0x23}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, exc := primary.dispatch(nil, tt.frame)
+			if exc != &mbserver.Success {
+				t.Fatalf("dispatch exception = %v, want success", exc)
+			}
+			if !bytesEqual(got, tt.want) {
+				t.Errorf("dispatch = % X, want % X", got, tt.want)
+			}
+		})
+	}
+
+	// 暂停主服务器时发往其他单元的请求同样返回从站忙
+	primary.Pause()
+	if _, exc := primary.dispatch(nil, tests[1].frame); exc != &mbserver.SlaveDeviceBusy {
+		t.Errorf("paused unit read exception = %v, want %v", exc, &mbserver.SlaveDeviceBusy)
+	}
+}
+
+func TestBroadcastWrite(t *testing.T) {
+	tests := []struct {
+		name         string
+		broadcast    bool
+		wantResponse bool // 单元0的写请求是否收到响应
+		wantUnitPuts int
+	}{
+		{"broadcast enabled", true, false, 1},
+		{"broadcast disabled", false, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, primaryMM := createTestServer(t)
+			unit, unitMM := createTestServer(t)
+			primary.config.BroadcastWrites = tt.broadcast
+			primary.AddUnit(2, unit)
+			publishers := map[*mappingmanager.MappingManager]*recordingPublisher{primaryMM: {}, unitMM: {}}
+			for mm, s := range map[*mappingmanager.MappingManager]*ModbusServer{primaryMM: primary, unitMM: unit} {
+				nr := &mqtt.NorthResource{Name: "setpoint", ValueType: "uint16"}
+				nr.OtherParameters.Modbus.Address = 100
+				if err := mm.UpdateMappings([]*mqtt.DeviceMapping{{
+					NorthDeviceName: "device1",
+					Resources: []*mqtt.ResourceMapping{
+						{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "setpoint", ReadWrite: "RW"}},
+					},
+				}}); err != nil {
+					t.Fatalf("UpdateMappings failed: %v", err)
+				}
+				s.SetWritePublisher(publishers[mm])
+			}
+			if err := primary.Start(context.Background()); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			defer primary.Stop()
+
+			conn, err := net.DialTimeout("tcp", primary.Addr(), time.Second)
+			if err != nil {
+				t.Fatalf("dial %s failed: %v", primary.Addr(), err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+			// 单元0写保持寄存器100为42，随后向单元1读取同一寄存器
+			write := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x00, 0x06, 0x00, 0x64, 0x00, 0x2A}
+			read := []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x64, 0x00, 0x01}
+			if _, err := conn.Write(append(write, read...)); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			if tt.wantResponse {
+				response := make([]byte, len(write))
+				if _, err := io.ReadFull(conn, response); err != nil {
+					t.Fatalf("read write response failed: %v", err)
+				}
+				if !bytesEqual(response, write) {
+					t.Fatalf("write response = % X, want echo % X", response, write)
+				}
+			}
+			response := make([]byte, 11)
+			if _, err := io.ReadFull(conn, response); err != nil {
+				t.Fatalf("read response failed: %v", err)
+			}
+			if txID := binary.BigEndian.Uint16(response); txID != 2 {
+				t.Fatalf("first response after the write has transaction %d, want the read's 2", txID)
+			}
+
+			// Stop 等待连接处理结束后再检查发布的写入
+			primary.Stop()
+			want := [3]string{"device1", "setpoint", "42"}
+			if puts := publishers[primaryMM].puts; len(puts) != 1 || puts[0] != want {
+				t.Errorf("primary published %v, want %v", puts, want)
+			}
+			if puts := publishers[unitMM].puts; len(puts) != tt.wantUnitPuts {
+				t.Errorf("unit published %v, want %d PUTs", puts, tt.wantUnitPuts)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package modbusserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/tbrandon/mbserver"
+)
+
+// MBAP报文头长度（事务标识符、协议标识符、长度、单元标识符）和长度字段的取值范围
+// 长度字段计入单元标识符和PDU，PDU至少包含功能码和一个数据字节，ADU最长260字节
+const (
+	mbapHeaderLength = 7
+	minMBAPLength    = 3
+	maxMBAPLength    = 254
+)
+
+// broadcastUnitID 是Modbus广播请求的单元标识符
+const broadcastUnitID = 0
+
+// tcpListener 是Modbus TCP监听器及其已接受的连接
+// mbserver 的 Close 只关闭监听器，已连接的主站仍可继续发送请求，因此由服务器自行接受并跟踪连接，Stop 时一并关闭
+type tcpListener struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// startTCP 启动TCP监听器；端口为 0 时由系统分配，实际地址可由 Addr 获取
+func (s *ModbusServer) startTCP() error {
+	addr := net.JoinHostPort(s.config.TCP.Host, strconv.Itoa(s.config.TCP.Port))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start Modbus TCP listener: %w", err)
+	}
+
+	t := &tcpListener{ln: ln, conns: make(map[net.Conn]struct{})}
+	s.tcp = t
+	t.wg.Add(1)
+	go s.acceptTCP(t)
+	s.addr.Store(ln.Addr().String())
+	s.lc.Info(fmt.Sprintf("Modbus TCP server started on %s", ln.Addr()))
+	return nil
+}
+
+// acceptTCP 接受连接并为每个连接启动处理goroutine，监听器关闭后返回
+func (s *ModbusServer) acceptTCP(t *tcpListener) {
+	defer t.wg.Done()
+	for {
+		conn, err := t.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.lc.Error(fmt.Sprintf("Modbus TCP accept failed: %s", err.Error()))
+			}
+			return
+		}
+		if !t.track(conn) {
+			conn.Close()
+			return
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			defer t.untrack(conn)
+			s.serveTCPConn(conn)
+		}()
+	}
+}
+
+// track 记录已接受的连接，监听器已关闭时返回 false
+func (t *tcpListener) track(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conns == nil {
+		return false
+	}
+	t.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack 关闭并移除连接
+func (t *tcpListener) untrack(conn net.Conn) {
+	conn.Close()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, conn)
+}
+
+// close 关闭监听器和所有已接受的连接，并等待连接的处理goroutine退出
+func (t *tcpListener) close() {
+	t.ln.Close()
+	t.mu.Lock()
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.conns = nil
+	t.mu.Unlock()
+	t.wg.Wait()
+}
+
+// serveTCPConn 依次读取连接上的MBAP帧并写回响应，连接关闭或收到无效帧时返回
+func (s *ModbusServer) serveTCPConn(conn net.Conn) {
+	header := make([]byte, mbapHeaderLength)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(header[4:6]))
+		if length < minMBAPLength || length > maxMBAPLength {
+			s.lc.Warn(fmt.Sprintf("Closing Modbus TCP connection from %s: invalid MBAP length %d", conn.RemoteAddr(), length))
+			return
+		}
+		packet := make([]byte, mbapHeaderLength-1+length)
+		copy(packet, header)
+		if _, err := io.ReadFull(conn, packet[mbapHeaderLength:]); err != nil {
+			return
+		}
+		frame, err := mbserver.NewTCPFrame(packet)
+		if err != nil {
+			s.lc.Warn(fmt.Sprintf("Closing Modbus TCP connection from %s: %s", conn.RemoteAddr(), err.Error()))
+			return
+		}
+		if frame.Device == broadcastUnitID && s.broadcastWrites() {
+			s.broadcast(frame)
+			continue
+		}
+		if _, err := conn.Write(s.respond(frame).Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+// respond 分发请求帧并按 mbserver 的方式构造响应帧：复制请求的报文头，异常时设置异常码
+func (s *ModbusServer) respond(frame mbserver.Framer) mbserver.Framer {
+	response := frame.Copy()
+	data, exc := s.dispatch(s.server, frame)
+	response.SetData(data)
+	if exc != &mbserver.Success {
+		response.SetException(exc)
+	}
+	return response
+}
+
+// broadcastWrites 返回是否按广播处理单元标识符0的请求
+func (s *ModbusServer) broadcastWrites() bool {
+	s.requestMu.Lock()
+	defer s.requestMu.Unlock()
+	return s.config.BroadcastWrites
+}
+
+// broadcast 由本服务器和所有已添加的单元执行广播写，不回复；主站不等待广播的响应，因此其他功能码的广播直接忽略
+// RTU 由 mbserver 收发，无法抑制响应，广播只在TCP上支持
+func (s *ModbusServer) broadcast(frame mbserver.Framer) {
+	function := frame.GetFunction()
+	if !isWriteFunction(function) {
+		s.lc.Debug(fmt.Sprintf("Ignoring broadcast function 0x%02X: only writes can be broadcast", function))
+		return
+	}
+	if s.paused.Load() {
+		s.lc.Warn(fmt.Sprintf("Dropping broadcast write function 0x%02X: server paused", function))
+		return
+	}
+
+	s.handlersMu.RLock()
+	targets := []*ModbusServer{s}
+	for _, unit := range s.units {
+		targets = append(targets, unit)
+	}
+	s.handlersMu.RUnlock()
+
+	for _, target := range targets {
+		if _, exc := target.dispatch(s.server, frame); exc != &mbserver.Success {
+			s.lc.Warn(fmt.Sprintf("Broadcast write function 0x%02X failed: %s", function, exc.String()))
+		}
+	}
+}
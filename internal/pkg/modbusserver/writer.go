@@ -0,0 +1,142 @@
+package modbusserver
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"app-modbus-go/internal/pkg/mqtt"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tbrandon/mbserver"
+)
+
+// maxResourceWidth 是数值资源最多占用的寄存器数（64位类型），用于从被写寄存器向前查找所属资源
+const maxResourceWidth = 4
+
+// registerWrite 是一次寄存器写入落在某个资源上的部分
+type registerWrite struct {
+	addr    config.AddressKey // 资源首地址（缓存查询地址）
+	mapping *mqtt.ResourceMapping
+	width   int    // 资源占用的寄存器数
+	offset  int    // 写入部分相对资源首地址的寄存器偏移
+	data    []byte // 写入该资源的寄存器字节
+}
+
+// registerOwner 返回覆盖寄存器 addr 的数值资源的首地址、映射和寄存器数
+// 从 addr 在同一地址表内向前查找最近的映射，其跨度不覆盖 addr 时视为未映射
+func (s *ModbusServer) registerOwner(addr config.AddressKey) (config.AddressKey, *mqtt.ResourceMapping, int, bool) {
+	for k := 0; k < maxResourceWidth; k++ {
+		start, ok := addr.Add(-k)
+		if !ok {
+			break
+		}
+		mapping, ok := s.mappingManager.GetMappingByAddress(start)
+		if !ok || mapping.NorthResource == nil {
+			continue
+		}
+		width := s.reader.Converter().GetRegisterCount(strings.ToLower(mapping.NorthResource.ValueType))
+		if k >= width {
+			return 0, nil, 0, false
+		}
+		return start, mapping, width, true
+	}
+	return 0, nil, 0, false
+}
+
+// planRegisterWrite 将从 addr 开始写入的寄存器按所属资源拆分
+// 未映射的寄存器被忽略，与读取时返回零值一致；任何被写资源只读或不支持写入时整个请求被拒绝，不下发任何写入
+// 只覆盖资源部分寄存器的写入在 writeRegisters 中与资源当前值合并
+// addr 开始的整个范围已由 ResolveAddress 检查，不会超出地址表
+func (s *ModbusServer) planRegisterWrite(addr config.AddressKey, registers []byte) ([]registerWrite, *mbserver.Exception) {
+	var writes []registerWrite
+	count := len(registers) / 2
+	for i := 0; i < count; {
+		start, mapping, width, ok := s.registerOwner(addr + config.AddressKey(i))
+		if !ok {
+			i++
+			continue
+		}
+		nr := mapping.NorthResource
+		if exc := s.checkWritePermission(start); exc != nil {
+			return nil, exc
+		}
+		if nr.ArrayLength > 0 || nr.OtherParameters.Modbus.SecondWordAddress != nil {
+			s.lc.Warn(fmt.Sprintf("Write to %s at address %v: array and split-word resources are not writable", nr.Name, start))
+			return nil, &mbserver.IllegalDataAddress
+		}
+
+		offset := int(addr.Addr()) + i - int(start.Addr())
+		n := width - offset
+		if n > count-i {
+			n = count - i
+		}
+		writes = append(writes, registerWrite{
+			addr:    start,
+			mapping: mapping,
+			width:   width,
+			offset:  offset,
+			data:    registers[i*2 : (i+n)*2],
+		})
+		i += n
+	}
+	return writes, nil
+}
+
+// writeRegisters 按资源类型、符号性和写入校准解码主站写入的寄存器，并将每个资源的新值作为PUT命令下发
+// 解码和合并在缓存的读改写中完成，新值作为写回值保存，并发的部分写入不会互相覆盖；
+// PUT下发失败时写回值保留，直到被传感器数据覆盖或超过 WriteBackMaxAge
+func (s *ModbusServer) writeRegisters(addr config.AddressKey, registers []byte) *mbserver.Exception {
+	writes, exc := s.planRegisterWrite(addr, registers)
+	if exc != nil {
+		return exc
+	}
+	for _, w := range writes {
+		name := w.mapping.NorthResource.Name
+		codec, err := s.reader.codecFor(w.addr)
+		if err != nil {
+			s.lc.Warn(fmt.Sprintf("Write to %s at address %v: %s", name, w.addr, err.Error()))
+			return &mbserver.IllegalDataValue
+		}
+		value, err := s.mappingManager.ReadModifyWrite(w.addr, func(old interface{}) (interface{}, error) {
+			return w.merge(codec, old)
+		})
+		if err != nil {
+			s.lc.Warn(fmt.Sprintf("Write to %s at address %v: %s", name, w.addr, err.Error()))
+			return &mbserver.IllegalDataValue
+		}
+		if exc := s.publishWrite(w.addr, name, formatWriteValue(value)); exc != nil {
+			return exc
+		}
+	}
+	return nil
+}
+
+// merge 将写入的寄存器合并到资源当前值的寄存器中并解码
+// 部分写入时未写的寄存器取当前值按读取校准编码的结果，没有当前值时为零
+func (w registerWrite) merge(codec *registerCodec, old interface{}) (interface{}, error) {
+	if w.offset == 0 && len(w.data) == w.width*2 {
+		return codec.decode(w.data)
+	}
+	registers := make([]byte, w.width*2)
+	if old != nil {
+		current, err := codec.encode(old)
+		if err != nil {
+			return nil, fmt.Errorf("encode current value for partial write: %w", err)
+		}
+		copy(registers, current)
+	}
+	copy(registers[w.offset*2:], w.data)
+	return codec.decode(registers)
+}
+
+// formatWriteValue 将解码后的值格式化为PUT命令的值字符串
+func formatWriteValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
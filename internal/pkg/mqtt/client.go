@@ -3,8 +3,13 @@ package mqtt
 import (
 	"app-modbus-go/internal/pkg/logger"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pahomqtt "github.com/eclipse/paho.mqtt.golang"
@@ -16,22 +21,69 @@ type MessageHandler func(msg *MQTTMessage) error
 // ResponseHandler 处理特定类型的传入MQTT响应
 type ResponseHandler func(resp *MQTTResponse) error
 
+// TopicHandler 处理额外订阅主题上收到的原始消息
+type TopicHandler func(topic string, payload []byte) error
+
+// TopicSubscription 描述上行主题之外额外订阅的主题及其QoS
+type TopicSubscription struct {
+	Topic string // 主题过滤器，可包含 '+' 和 '#' 通配符
+	QoS   byte
+}
+
+// ResponseDetector 根据顶层JSON字段判断传入数据是否为响应
+type ResponseDetector func(fields map[string]json.RawMessage) bool
+
+// HasResponseFields 是默认的响应判别器：同时包含顶层 code 和 msg 字段即视为响应
+// 不依赖 code 的取值，因此 code 为 0 的响应同样能被识别
+func HasResponseFields(fields map[string]json.RawMessage) bool {
+	_, hasCode := fields["code"]
+	_, hasMsg := fields["msg"]
+	return hasCode && hasMsg
+}
+
+// DefaultMaxPendingRequests 是未配置时同时等待响应的请求数上限
+const DefaultMaxPendingRequests = 1000
+
+// ErrTooManyPendingRequests 在等待响应的请求数达到上限时由 PublishAndWait 返回
+var ErrTooManyPendingRequests = errors.New("too many pending requests")
+
 // ClientManager 管理MQTT连接和消息路由
 type ClientManager struct {
-	client pahomqtt.Client
-	nodeID string
+	client   pahomqtt.Client
+	injected bool // client 由 SetClient 注入，Connect 不再创建
+	nodeID   string
 
 	topicUp   string // 订阅: /v1/data/{nodeId}/up
 	topicDown string // 发布: /v1/data/{nodeId}/down
 
+	sharedGroup string // 非空时以 $share/{group}/ 前缀订阅上行主题
+	replyTopic  string // 共享订阅下本实例私有的响应主题，非共享订阅，为空时响应经上行主题返回
+	commandQoS  byte   // 上行主题订阅和命令响应发布使用的QoS
+
+	topics        []TopicSubscription     // 额外订阅的主题
+	topicHandlers map[string]TopicHandler // 主题过滤器 -> 处理程序
+
+	sequenceField string            // 携带消息序号的顶层字段，为空时不检测
+	lastSequence  map[string]uint64 // 主题 -> 最近收到的序号
+	sequenceMu    sync.Mutex
+	sequenceGaps  atomic.Uint64 // 检测到的序号不连续次数
+
 	messageHandlers  map[int]MessageHandler
 	responseHandlers map[int]ResponseHandler
+	responseDetector ResponseDetector
+	deadLetter       DeadLetterHandler // 上行主题上无法解析的消息交给它保存，nil 时只记录错误
 
 	// 请求/响应匹配
 	pendingRequests map[string]chan *MQTTResponse
 	pendingMu       sync.RWMutex
+	maxPending      int
 
 	heartbeatStop chan struct{}
+	capabilities  func() []uint8 // 返回当前支持的Modbus功能码，随心跳上报
+
+	heartbeatGrace    time.Duration // 连接断开后该时长内心跳失败不计入连续失败
+	heartbeatFailures atomic.Uint64 // 宽限期外连续发送失败的心跳数
+	disconnectedAt    atomic.Int64  // 连接断开的时间（UnixNano），0 表示已连接
 
 	lc logger.LoggingClient
 	mu sync.RWMutex
@@ -45,23 +97,134 @@ type ClientConfig struct {
 	Password  string
 	QoS       byte
 	KeepAlive int // 秒数
+	TLS       TLSConfig
+
+	// PersistentSession 为true时使用持久会话，断线期间Broker为本节点保留QoS 1/2消息；零值为清除会话
+	PersistentSession bool
+
+	// SharedGroup 非空时以共享订阅方式订阅上行主题，同组实例由Broker负载均衡
+	// 需要Broker支持 $share 前缀（MQTT v5共享订阅）。上行主题的消息可能投递到同组任一实例，
+	// 因此 PublishAndWait 的请求携带 replyTo 指向本实例私有的 /v1/data/{nodeId}/up/{ClientID}，该主题以普通订阅方式订阅
+	SharedGroup string
+
+	MaxPendingRequests int // 同时等待响应的请求数上限，<=0 使用 DefaultMaxPendingRequests
+
+	// Topics 上行主题之外额外订阅的主题，与上行主题在一次 SubscribeMultiple 中订阅
+	// 只订阅已通过 RegisterTopicHandler 注册处理程序的主题，其余主题的消息无人处理，不订阅
+	Topics []TopicSubscription
+
+	// ReconnectJitter 大于0时，每次自动重连前额外等待 [0, ReconnectJitter) 内的随机时长，
+	// 避免Broker重启后大量节点同时重连
+	ReconnectJitter time.Duration
+
+	// SequenceField 非空时从消息的该顶层字段读取单调序号，按主题检测丢失或乱序的消息
+	SequenceField string
+
+	// CommandQoS 上行主题（承载命令）订阅和命令响应发布使用的QoS，0 时使用1
+	// QoS 2 让Broker与客户端之间恰好投递一次；跨会话的重复投递由服务的命令去重处理
+	CommandQoS byte
 }
 
 // NewClientManager 创建新的MQTT客户端管理器
 func NewClientManager(nodeID string, cfg ClientConfig, lc logger.LoggingClient) *ClientManager {
+	maxPending := cfg.MaxPendingRequests
+	if maxPending <= 0 {
+		maxPending = DefaultMaxPendingRequests
+	}
 	return &ClientManager{
 		nodeID:           nodeID,
 		topicUp:          fmt.Sprintf("/v1/data/%s/up", nodeID),
 		topicDown:        fmt.Sprintf("/v1/data/%s/down", nodeID),
 		messageHandlers:  make(map[int]MessageHandler),
 		responseHandlers: make(map[int]ResponseHandler),
+		responseDetector: HasResponseFields,
 		pendingRequests:  make(map[string]chan *MQTTResponse),
+		maxPending:       maxPending,
+		sharedGroup:      cfg.SharedGroup,
+		replyTopic:       replyTopic(nodeID, cfg),
+		commandQoS:       commandQoS(cfg.CommandQoS),
+		topics:           cfg.Topics,
+		topicHandlers:    make(map[string]TopicHandler),
+		sequenceField:    cfg.SequenceField,
+		lastSequence:     make(map[string]uint64),
 		lc:               lc,
 	}
 }
 
+// SetClient 注入预先构建的paho客户端（例如测试用的假客户端），Connect 将直接使用它而不再按配置创建
+// 注入的客户端不会安装重连后重新订阅的回调，Connect 成功后直接订阅一次
+func (cm *ClientManager) SetClient(client pahomqtt.Client) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.client = client
+	cm.injected = client != nil
+}
+
 // Connect 建立MQTT连接
 func (cm *ClientManager) Connect(cfg ClientConfig) error {
+	cm.mu.RLock()
+	injected := cm.injected
+	cm.mu.RUnlock()
+
+	if !injected {
+		opts, err := cm.newClientOptions(cfg)
+		if err != nil {
+			return err
+		}
+		// 心跳和发布路径可能同时在使用旧客户端，在锁内替换
+		cm.mu.Lock()
+		cm.client = pahomqtt.NewClient(opts)
+		cm.mu.Unlock()
+	}
+
+	token := cm.pahoClient().Connect()
+	token.Wait()
+	if token.Error() != nil {
+		return fmt.Errorf("MQTT connect failed: %w", token.Error())
+	}
+	cm.lc.Info("MQTT connected to broker:", cfg.Broker)
+
+	if injected {
+		return cm.subscribe()
+	}
+	return nil
+}
+
+// Reconnect 断开当前连接并按新配置重新连接，用于配置热重载
+// 共享订阅组、额外主题、序号字段和等待请求上限按新配置更新，已注册的处理程序保留；心跳需由调用方重新启动
+func (cm *ClientManager) Reconnect(cfg ClientConfig) error {
+	cm.Disconnect()
+
+	maxPending := cfg.MaxPendingRequests
+	if maxPending <= 0 {
+		maxPending = DefaultMaxPendingRequests
+	}
+	cm.mu.Lock()
+	cm.sharedGroup = cfg.SharedGroup
+	cm.replyTopic = replyTopic(cm.nodeID, cfg)
+	cm.commandQoS = commandQoS(cfg.CommandQoS)
+	cm.topics = cfg.Topics
+	cm.mu.Unlock()
+	cm.pendingMu.Lock()
+	cm.maxPending = maxPending
+	cm.pendingMu.Unlock()
+	cm.sequenceMu.Lock()
+	cm.sequenceField = cfg.SequenceField
+	cm.lastSequence = make(map[string]uint64)
+	cm.sequenceMu.Unlock()
+
+	return cm.Connect(cfg)
+}
+
+// pahoClient 返回当前的paho客户端，未连接过时为nil
+func (cm *ClientManager) pahoClient() pahomqtt.Client {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.client
+}
+
+// newClientOptions 根据配置构建paho客户端选项
+func (cm *ClientManager) newClientOptions(cfg ClientConfig) (*pahomqtt.ClientOptions, error) {
 	opts := pahomqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
 	opts.SetClientID(cfg.ClientID)
@@ -74,50 +237,233 @@ func (cm *ClientManager) Connect(cfg ClientConfig) error {
 	if cfg.KeepAlive > 0 {
 		opts.SetKeepAlive(time.Duration(cfg.KeepAlive) * time.Second)
 	}
+	if cfg.TLS.Enabled() {
+		tlsCfg, err := buildTLSConfig(cfg.TLS, cm.nodeID)
+		if err != nil {
+			return nil, fmt.Errorf("MQTT TLS setup failed: %w", err)
+		}
+		opts.SetTLSConfig(tlsCfg)
+	}
 	opts.SetAutoReconnect(true)
-	opts.SetCleanSession(true)
+	if cfg.ReconnectJitter > 0 {
+		opts.SetReconnectingHandler(func(c pahomqtt.Client, o *pahomqtt.ClientOptions) {
+			delay := reconnectJitter(cfg.ReconnectJitter)
+			cm.lc.Info(fmt.Sprintf("MQTT reconnecting in %v (jitter)", delay))
+			time.Sleep(delay)
+		})
+	}
+	opts.SetCleanSession(!cfg.PersistentSession)
 	opts.SetOnConnectHandler(func(c pahomqtt.Client) {
+		cm.disconnectedAt.Store(0)
 		cm.lc.Info("MQTT connected, re-subscribing topics")
 		_ = cm.subscribe()
 	})
+	// 连接断开到自动重连成功之间为重连期，期间的心跳失败按宽限期处理
 	opts.SetConnectionLostHandler(func(c pahomqtt.Client, err error) {
+		cm.markDisconnected()
 		cm.lc.Warn("MQTT connection lost:", err.Error())
 	})
+	return opts, nil
+}
 
-	cm.client = pahomqtt.NewClient(opts)
-	token := cm.client.Connect()
-	token.Wait()
-	if token.Error() != nil {
-		return fmt.Errorf("MQTT connect failed: %w", token.Error())
+// markDisconnected 记录连接断开的时间，已记录时保留最初的时间
+func (cm *ClientManager) markDisconnected() {
+	cm.disconnectedAt.CompareAndSwap(0, time.Now().UnixNano())
+}
+
+// inReconnectGrace 判断连接是否正在重连且距断开未超过心跳宽限期
+func (cm *ClientManager) inReconnectGrace() bool {
+	since := cm.disconnectedAt.Load()
+	if since == 0 {
+		return false
 	}
-	cm.lc.Info("MQTT connected to broker:", cfg.Broker)
-	return nil
+	cm.mu.RLock()
+	grace := cm.heartbeatGrace
+	cm.mu.RUnlock()
+	return time.Since(time.Unix(0, since)) <= grace
+}
+
+// reconnectJitter 返回 [0, max) 内均匀分布的随机时长
+func reconnectJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(max)))
 }
 
-// Subscribe 订阅上行主题以接收消息
+// Subscribe 订阅上行主题和配置的额外主题以接收消息
 func (cm *ClientManager) Subscribe() error {
 	return cm.subscribe()
 }
 
+// subscribe 通过一次 SubscribeMultiple 订阅所有主题，消息按主题路由
 func (cm *ClientManager) subscribe() error {
-	token := cm.client.Subscribe(cm.topicUp, 1, cm.onMessage)
+	filters := cm.subscribeFilters()
+	token := cm.pahoClient().SubscribeMultiple(filters, cm.routeMessage)
 	token.Wait()
 	if token.Error() != nil {
 		return fmt.Errorf("MQTT subscribe failed: %w", token.Error())
 	}
-	cm.lc.Info("Subscribed to topic:", cm.topicUp)
+	if err := rejectedSubscription(token); err != nil {
+		return err
+	}
+
+	topics := make([]string, 0, len(filters))
+	for topic := range filters {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		cm.lc.Info(fmt.Sprintf("Subscribed to topic: %s (QoS %d)", topic, filters[topic]))
+	}
 	return nil
 }
 
+// rejectedSubscription 检查Broker对每个主题的SUBACK返回码，有主题被拒绝（0x80）时返回错误
+// MQTT 3.1.1 没有共享订阅，不支持 $share 的Broker通常拒绝该主题
+func rejectedSubscription(token pahomqtt.Token) error {
+	st, ok := token.(*pahomqtt.SubscribeToken)
+	if !ok {
+		return nil
+	}
+	var rejected []string
+	for topic, code := range st.Result() {
+		if code == 0x80 {
+			rejected = append(rejected, topic)
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	sort.Strings(rejected)
+	for _, topic := range rejected {
+		if strings.HasPrefix(topic, "$share/") {
+			return fmt.Errorf("MQTT subscribe failed: broker rejected %s, it may not support shared subscriptions for MQTT 3.1.1 clients", topic)
+		}
+	}
+	return fmt.Errorf("MQTT subscribe failed: broker rejected %s", strings.Join(rejected, ", "))
+}
+
+// subscribeFilters 返回主题过滤器到QoS的映射，上行主题和私有响应主题使用命令QoS
+// 没有注册处理程序的额外主题被跳过并记录警告
+func (cm *ClientManager) subscribeFilters() map[string]byte {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	filters := make(map[string]byte, len(cm.topics)+2)
+	for _, t := range cm.topics {
+		if _, ok := cm.topicHandlers[t.Topic]; !ok {
+			cm.lc.Warn(fmt.Sprintf("Not subscribing to %s: no handler registered for the topic", t.Topic))
+			continue
+		}
+		filters[t.Topic] = t.QoS
+	}
+	filters[cm.subscribeTopic()] = cm.commandQoS
+	if cm.replyTopic != "" {
+		filters[cm.replyTopic] = cm.commandQoS
+	}
+	return filters
+}
+
+// replyTopic 返回共享订阅下本实例私有的响应主题，未配置共享组时为空
+func replyTopic(nodeID string, cfg ClientConfig) string {
+	if cfg.SharedGroup == "" {
+		return ""
+	}
+	return fmt.Sprintf("/v1/data/%s/up/%s", nodeID, cfg.ClientID)
+}
+
+// commandQoS 返回生效的命令QoS，未配置时为1
+func commandQoS(qos byte) byte {
+	if qos == 0 {
+		return 1
+	}
+	return qos
+}
+
+// RegisterTopicHandler 为额外订阅的主题过滤器注册处理程序，已存在时替换
+// 过滤器应与 ClientConfig.Topics 中的某一项一致，在 Connect 之前注册，下次订阅时生效
+func (cm *ClientManager) RegisterTopicHandler(filter string, handler TopicHandler) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.topicHandlers[filter] = handler
+}
+
+// routeMessage 上行主题的消息交给 onMessage，其他主题交给匹配过滤器的处理程序
+func (cm *ClientManager) routeMessage(client pahomqtt.Client, msg pahomqtt.Message) {
+	cm.mu.RLock()
+	reply := cm.replyTopic
+	cm.mu.RUnlock()
+	if msg.Topic() == cm.topicUp || reply != "" && msg.Topic() == reply {
+		cm.onMessage(client, msg)
+		return
+	}
+
+	cm.mu.RLock()
+	var handler TopicHandler
+	for filter, h := range cm.topicHandlers {
+		if topicMatches(filter, msg.Topic()) {
+			handler = h
+			break
+		}
+	}
+	cm.mu.RUnlock()
+
+	if handler == nil {
+		cm.lc.Warn("No handler registered for topic:", msg.Topic())
+		return
+	}
+	if err := handler(msg.Topic(), msg.Payload()); err != nil {
+		cm.lc.Error(fmt.Sprintf("Topic handler error for %s: %s", msg.Topic(), err.Error()))
+	}
+}
+
+// topicMatches 判断主题是否匹配过滤器，支持单层 '+' 和多层 '#' 通配符
+func topicMatches(filter, topic string) bool {
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+	for i, f := range fl {
+		if f == "#" {
+			return true
+		}
+		if i >= len(tl) || (f != "+" && f != tl[i]) {
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
+
+// subscribeTopic 返回实际订阅的上行主题，配置共享组时加上 $share/{group}/ 前缀
+// 共享组名后的 / 只是分隔符，其后才是原主题，因此以 / 开头的上行主题订阅为 $share/{group}//v1/...
+// 共享订阅下上行主题的消息可能被投递到同组其他实例，因此请求的响应改经私有的 replyTopic 返回
+func (cm *ClientManager) subscribeTopic() string {
+	if cm.sharedGroup == "" {
+		return cm.topicUp
+	}
+	return fmt.Sprintf("$share/%s/%s", cm.sharedGroup, cm.topicUp)
+}
+
 // onMessage 处理传入的MQTT消息并路由到相应的处理程序
 func (cm *ClientManager) onMessage(client pahomqtt.Client, msg pahomqtt.Message) {
 	cm.lc.Debug("Received MQTT message on topic:", msg.Topic())
 
 	raw := msg.Payload()
 
-	// 先尝试解析为响应（有code/msg字段）
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		cm.lc.Error("Failed to parse MQTT message:", err.Error())
+		cm.captureDeadLetter(msg.Topic(), raw, err)
+		return
+	}
+
+	seq := cm.checkSequence(msg.Topic(), fields)
+
+	cm.mu.RLock()
+	detector := cm.responseDetector
+	cm.mu.RUnlock()
+
+	// 先判断是否为响应（默认依据顶层code/msg字段）
 	var resp MQTTResponse
-	if err := json.Unmarshal(raw, &resp); err == nil && resp.Code != 0 {
+	if detector(fields) && json.Unmarshal(raw, &resp) == nil {
 		cm.lc.Debug(fmt.Sprintf("Received response type=%d requestId=%s code=%d", resp.Type, resp.RequestID, resp.Code))
 
 		// 检查这是否是对待机请求的响应
@@ -151,8 +497,10 @@ func (cm *ClientManager) onMessage(client pahomqtt.Client, msg pahomqtt.Message)
 	var message MQTTMessage
 	if err := json.Unmarshal(raw, &message); err != nil {
 		cm.lc.Error("Failed to parse MQTT message:", err.Error())
+		cm.captureDeadLetter(msg.Topic(), raw, err)
 		return
 	}
+	message.Sequence = seq
 	cm.lc.Debug(fmt.Sprintf("Received message type=%d requestId=%s", message.Type, message.RequestID))
 
 	// 路由到消息处理程序
@@ -168,13 +516,64 @@ func (cm *ClientManager) onMessage(client pahomqtt.Client, msg pahomqtt.Message)
 	}
 }
 
+// captureDeadLetter 将无法解析的消息交给死信处理程序
+func (cm *ClientManager) captureDeadLetter(topic string, payload []byte, parseErr error) {
+	cm.mu.RLock()
+	handler := cm.deadLetter
+	cm.mu.RUnlock()
+	if handler == nil {
+		return
+	}
+	if err := handler(topic, payload, parseErr); err != nil {
+		cm.lc.Error(fmt.Sprintf("Failed to capture dead letter from %s: %s", topic, err.Error()))
+	}
+}
+
+// checkSequence 读取消息序号并与该主题上一条比较，不连续时记录警告并计数
+// 序号回退（乱序或发送方重启）同样计为一次不连续，之后从新序号继续比较
+func (cm *ClientManager) checkSequence(topic string, fields map[string]json.RawMessage) *uint64 {
+	if cm.sequenceField == "" {
+		return nil
+	}
+	raw, ok := fields[cm.sequenceField]
+	if !ok {
+		return nil
+	}
+	var seq uint64
+	if err := json.Unmarshal(raw, &seq); err != nil {
+		cm.lc.Warn(fmt.Sprintf("Invalid sequence field %s on topic %s: %s", cm.sequenceField, topic, string(raw)))
+		return nil
+	}
+
+	cm.sequenceMu.Lock()
+	last, seen := cm.lastSequence[topic]
+	cm.lastSequence[topic] = seq
+	cm.sequenceMu.Unlock()
+
+	switch {
+	case !seen || seq == last+1:
+	case seq > last+1:
+		cm.sequenceGaps.Add(1)
+		cm.lc.Warn(fmt.Sprintf("Sequence gap on topic %s: expected %d, got %d (%d messages missing)", topic, last+1, seq, seq-last-1))
+	default:
+		cm.sequenceGaps.Add(1)
+		cm.lc.Warn(fmt.Sprintf("Out-of-order sequence on topic %s: got %d after %d", topic, seq, last))
+	}
+	return &seq
+}
+
+// SequenceGaps 返回检测到的序号不连续次数
+func (cm *ClientManager) SequenceGaps() uint64 {
+	return cm.sequenceGaps.Load()
+}
+
 // Publish 发布消息到下行主题
 func (cm *ClientManager) Publish(msg *MQTTMessage) error {
 	data, err := msg.ToJSON()
 	if err != nil {
 		return fmt.Errorf("failed to serialize message: %w", err)
 	}
-	token := cm.client.Publish(cm.topicDown, 1, false, data)
+	token := cm.pahoClient().Publish(cm.topicDown, 1, false, data)
 	token.Wait()
 	if token.Error() != nil {
 		return fmt.Errorf("MQTT publish failed: %w", token.Error())
@@ -183,13 +582,38 @@ func (cm *ClientManager) Publish(msg *MQTTMessage) error {
 	return nil
 }
 
-// PublishResponse 发布响应消息到下行主题
+// PublishPut 将资源写入作为 type=6 PUT 命令发布到下行主题
+func (cm *ClientManager) PublishPut(northDeviceName, northResourceName, value string) error {
+	return cm.Publish(NewMessage(TypeCommand, &CommandPayload{
+		CmdType: "PUT",
+		CmdContent: CommandContent{
+			NorthDeviceName:    northDeviceName,
+			NorthResourceName:  northResourceName,
+			NorthResourceValue: value,
+		},
+	}))
+}
+
+// PublishDataQuery 发布 type=2 数据查询，请求数据中心以传感器数据重新上报资源的当前值
+// cmd "0102" 是对 type=2 协议的扩展（协议本身只定义了 "0101"），数据中心需支持后才能启用 Cache.RequeryEnabled
+func (cm *ClientManager) PublishDataQuery(northDeviceName, northResourceName string) error {
+	return cm.Publish(NewMessage(TypeQueryDevice, &QueryDataPayload{
+		Cmd:             "0102",
+		NorthDeviceName: northDeviceName,
+		Resources:       []string{northResourceName},
+	}))
+}
+
+// PublishResponse 以命令QoS发布响应消息到下行主题
 func (cm *ClientManager) PublishResponse(resp *MQTTResponse) error {
 	data, err := resp.ToJSON()
 	if err != nil {
 		return fmt.Errorf("failed to serialize response: %w", err)
 	}
-	token := cm.client.Publish(cm.topicDown, 1, false, data)
+	cm.mu.RLock()
+	client, qos := cm.client, cm.commandQoS
+	cm.mu.RUnlock()
+	token := client.Publish(cm.topicDown, qos, false, data)
 	token.Wait()
 	if token.Error() != nil {
 		return fmt.Errorf("MQTT publish response failed: %w", token.Error())
@@ -199,13 +623,25 @@ func (cm *ClientManager) PublishResponse(resp *MQTTResponse) error {
 }
 
 // PublishAndWait 发布消息并等待匹配的响应
+// 如果相同RequestID的请求仍在等待响应，则返回错误而不是覆盖已有的等待通道
 func (cm *ClientManager) PublishAndWait(msg *MQTTMessage, timeout time.Duration) (*MQTTResponse, error) {
 	ch := make(chan *MQTTResponse, 1)
 
 	cm.pendingMu.Lock()
+	if _, exists := cm.pendingRequests[msg.RequestID]; exists {
+		cm.pendingMu.Unlock()
+		return nil, fmt.Errorf("request %s is already pending", msg.RequestID)
+	}
+	if len(cm.pendingRequests) >= cm.maxPending {
+		cm.pendingMu.Unlock()
+		return nil, fmt.Errorf("request %s rejected: %w (limit %d)", msg.RequestID, ErrTooManyPendingRequests, cm.maxPending)
+	}
 	cm.pendingRequests[msg.RequestID] = ch
 	cm.pendingMu.Unlock()
 
+	cm.mu.RLock()
+	msg.ReplyTo = cm.replyTopic
+	cm.mu.RUnlock()
 	if err := cm.Publish(msg); err != nil {
 		cm.pendingMu.Lock()
 		delete(cm.pendingRequests, msg.RequestID)
@@ -225,40 +661,97 @@ func (cm *ClientManager) PublishAndWait(msg *MQTTMessage, timeout time.Duration)
 }
 
 // StartHeartbeat 启动定期心跳发送
-func (cm *ClientManager) StartHeartbeat(interval time.Duration) {
+// initialDelay 大于0时，首次心跳延迟发送，以等待订阅建立完成
+func (cm *ClientManager) StartHeartbeat(interval, initialDelay time.Duration) {
 	cm.heartbeatStop = make(chan struct{})
+	stop := cm.heartbeatStop
 	go func() {
+		if initialDelay > 0 {
+			timer := time.NewTimer(initialDelay)
+			select {
+			case <-timer.C:
+			case <-stop:
+				timer.Stop()
+				cm.lc.Info("Heartbeat stopped")
+				return
+			}
+		}
+
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
-		// 立即发送初始心跳
+		// 发送初始心跳
 		cm.sendHeartbeat()
 
 		for {
 			select {
 			case <-ticker.C:
 				cm.sendHeartbeat()
-			case <-cm.heartbeatStop:
+			case <-stop:
 				cm.lc.Info("Heartbeat stopped")
 				return
 			}
 		}
 	}()
-	cm.lc.Info(fmt.Sprintf("Heartbeat started with interval %v", interval))
+	cm.lc.Info(fmt.Sprintf("Heartbeat started with interval %v, initial delay %v", interval, initialDelay))
+}
+
+// SetCapabilities 设置返回当前支持的Modbus功能码的函数，心跳中随之上报，使数据中心得知节点能力
+func (cm *ClientManager) SetCapabilities(fn func() []uint8) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.capabilities = fn
 }
 
 func (cm *ClientManager) sendHeartbeat() {
-	msg := NewMessage(TypeHeartbeat, nil)
+	cm.mu.RLock()
+	capabilities := cm.capabilities
+	cm.mu.RUnlock()
+
+	var payload interface{}
+	if capabilities != nil {
+		hb := &HeartbeatPayload{}
+		for _, code := range capabilities() {
+			hb.FunctionCodes = append(hb.FunctionCodes, int(code))
+		}
+		payload = hb
+	}
+	msg := NewMessage(TypeHeartbeat, payload)
 	if err := cm.Publish(msg); err != nil {
-		cm.lc.Error("Failed to send heartbeat:", err.Error())
+		// 重连期间的失败是预期的，不作为节点离线的迹象
+		if cm.inReconnectGrace() {
+			cm.lc.Warn("Heartbeat not sent while MQTT reconnects:", err.Error())
+			return
+		}
+		failures := cm.heartbeatFailures.Add(1)
+		cm.lc.Error(fmt.Sprintf("Failed to send heartbeat (%d consecutive): %s", failures, err.Error()))
 	} else {
+		cm.heartbeatFailures.Store(0)
 		cm.lc.Debug("Heartbeat sent")
 	}
 }
 
-// StopHeartbeat stops the heartbeat goroutine
+// SetHeartbeatGrace 设置连接断开后的心跳宽限期：自动重连期间该时长内的心跳发送失败只记录警告，
+// 不计入 HeartbeatFailures；0 表示不宽限
+func (cm *ClientManager) SetHeartbeatGrace(grace time.Duration) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.heartbeatGrace = grace
+}
+
+// HeartbeatFailures 返回宽限期外连续发送失败的心跳数，发送成功后归零
+func (cm *ClientManager) HeartbeatFailures() uint64 {
+	return cm.heartbeatFailures.Load()
+}
+
+// StopHeartbeat stops the heartbeat goroutine; it is safe to call more than once
 func (cm *ClientManager) StopHeartbeat() {
-	if cm.heartbeatStop != nil {
+	if cm.heartbeatStop == nil {
+		return
+	}
+	select {
+	case <-cm.heartbeatStop:
+	default:
 		close(cm.heartbeatStop)
 	}
 }
@@ -270,6 +763,23 @@ func (cm *ClientManager) RegisterMessageHandler(msgType int, handler MessageHand
 	cm.messageHandlers[msgType] = handler
 }
 
+// SetResponseDetector 替换响应判别器，nil 恢复默认的 HasResponseFields
+func (cm *ClientManager) SetResponseDetector(detector ResponseDetector) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if detector == nil {
+		detector = HasResponseFields
+	}
+	cm.responseDetector = detector
+}
+
+// SetDeadLetterHandler 设置上行主题上无法解析的消息的处理程序，nil 表示只记录错误
+func (cm *ClientManager) SetDeadLetterHandler(handler DeadLetterHandler) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.deadLetter = handler
+}
+
 // RegisterResponseHandler registers a handler for a specific response type
 func (cm *ClientManager) RegisterResponseHandler(msgType int, handler ResponseHandler) {
 	cm.mu.Lock()
@@ -280,8 +790,8 @@ func (cm *ClientManager) RegisterResponseHandler(msgType int, handler ResponseHa
 // Disconnect cleanly disconnects the MQTT client
 func (cm *ClientManager) Disconnect() {
 	cm.StopHeartbeat()
-	if cm.client != nil && cm.client.IsConnected() {
-		cm.client.Disconnect(1000)
+	if client := cm.pahoClient(); client != nil && client.IsConnected() {
+		client.Disconnect(1000)
 		cm.lc.Info("MQTT disconnected")
 	}
 }
@@ -293,5 +803,6 @@ func (cm *ClientManager) GetNodeID() string {
 
 // IsConnected returns whether the MQTT client is connected
 func (cm *ClientManager) IsConnected() bool {
-	return cm.client != nil && cm.client.IsConnected()
+	client := cm.pahoClient()
+	return client != nil && client.IsConnected()
 }
@@ -1,19 +1,281 @@
 package mqtt
 
 import (
+	"app-modbus-go/internal/pkg/logger"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/stretchr/testify/assert"
 )
 
+// mockPahoClient records published payloads; other Client methods are not implemented
+type mockPahoClient struct {
+	pahomqtt.Client
+	mu         sync.Mutex
+	published  [][]byte
+	subscribed []string
+	qos        map[string]byte
+	callback   pahomqtt.MessageHandler
+	connects   int
+}
+
+func (c *mockPahoClient) Connect() pahomqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connects++
+	return &mockToken{}
+}
+
+func (c *mockPahoClient) Subscribe(topic string, qos byte, callback pahomqtt.MessageHandler) pahomqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribed = append(c.subscribed, topic)
+	return &mockToken{}
+}
+
+func (c *mockPahoClient) SubscribeMultiple(filters map[string]byte, callback pahomqtt.MessageHandler) pahomqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	topics := make([]string, 0, len(filters))
+	for topic := range filters {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	c.subscribed = append(c.subscribed, topics...)
+	c.qos = filters
+	c.callback = callback
+	return &mockToken{}
+}
+
+func (c *mockPahoClient) Publish(topic string, qos byte, retained bool, payload interface{}) pahomqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if data, ok := payload.([]byte); ok {
+		c.published = append(c.published, data)
+	}
+	return &mockToken{}
+}
+
+func (c *mockPahoClient) publishCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.published)
+}
+
+// mockToken is an already completed token without error
+type mockToken struct {
+	pahomqtt.Token
+}
+
+func (t *mockToken) Wait() bool   { return true }
+func (t *mockToken) Error() error { return nil }
+
 // TestGetNodeID tests the GetNodeID method
 func TestGetNodeID(t *testing.T) {
 	cm := createTestClientManager(t)
 	assert.Equal(t, "test-node", cm.GetNodeID())
 }
 
+// TestSubscribe_SharedGroup tests that the up topic gets the $share prefix only when a group is configured,
+// and that a shared group adds the instance's private, non-shared reply topic
+func TestSubscribe_SharedGroup(t *testing.T) {
+	tests := []struct {
+		name  string
+		group string
+		want  []string
+	}{
+		{name: "no group", group: "", want: []string{"/v1/data/test-node/up"}},
+		{name: "shared group", group: "modbus", want: []string{"$share/modbus//v1/data/test-node/up", "/v1/data/test-node/up/inst-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := NewClientManager("test-node", ClientConfig{ClientID: "inst-1", SharedGroup: tt.group}, logger.NewClient("DEBUG"))
+			client := &mockPahoClient{}
+			cm.client = client
+
+			assert.NoError(t, cm.Subscribe())
+			assert.Equal(t, tt.want, client.subscribed)
+		})
+	}
+}
+
+// TestPublishAndWait_SharedReplyTopic tests that under a shared subscription requests carry the private
+// reply topic and responses arriving there complete the waiting request
+func TestPublishAndWait_SharedReplyTopic(t *testing.T) {
+	tests := []struct {
+		name        string
+		group       string
+		wantReplyTo string
+	}{
+		{name: "no group", group: "", wantReplyTo: ""},
+		{name: "shared group", group: "modbus", wantReplyTo: "/v1/data/test-node/up/inst-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := NewClientManager("test-node", ClientConfig{ClientID: "inst-1", SharedGroup: tt.group}, logger.NewClient("DEBUG"))
+			client := &mockPahoClient{}
+			cm.client = client
+			assert.NoError(t, cm.Subscribe())
+
+			msg := NewMessage(TypeQueryDevice, &QueryDevicePayload{Cmd: "0101"})
+			done := make(chan *MQTTResponse, 1)
+			go func() {
+				resp, err := cm.PublishAndWait(msg, 2*time.Second)
+				assert.NoError(t, err)
+				done <- resp
+			}()
+			assert.Eventually(t, func() bool { return client.publishCount() == 1 }, time.Second, 5*time.Millisecond)
+
+			client.mu.Lock()
+			var sent map[string]interface{}
+			assert.NoError(t, json.Unmarshal(client.published[0], &sent))
+			client.mu.Unlock()
+			replyTo, _ := sent["replyTo"].(string)
+			assert.Equal(t, tt.wantReplyTo, replyTo)
+
+			topic := tt.wantReplyTo
+			if topic == "" {
+				topic = cm.topicUp
+			}
+			data, _ := NewResponse(msg.RequestID, TypeQueryDevice, 200, "ok", nil).ToJSON()
+			client.callback(nil, &mockMessage{topic: topic, payload: data})
+
+			select {
+			case resp := <-done:
+				assert.Equal(t, msg.RequestID, resp.RequestID)
+			case <-time.After(2 * time.Second):
+				t.Fatal("response on the reply topic did not complete the request")
+			}
+		})
+	}
+}
+
+// TestSubscribe_MultipleTopics tests that configured topics are subscribed together with the up topic and routed by topic
+func TestSubscribe_MultipleTopics(t *testing.T) {
+	cm := NewClientManager("test-node", ClientConfig{
+		Topics: []TopicSubscription{
+			{Topic: "/v1/status/test-node", QoS: 0},
+			{Topic: "/v1/control/test-node/+", QoS: 2},
+		},
+	}, logger.NewClient("DEBUG"))
+	client := &mockPahoClient{}
+	cm.client = client
+
+	var gotTopic string
+	var gotPayload []byte
+	cm.RegisterTopicHandler("/v1/control/test-node/+", func(topic string, payload []byte) error {
+		gotTopic = topic
+		gotPayload = payload
+		return nil
+	})
+	cm.RegisterTopicHandler("/v1/status/test-node", func(topic string, payload []byte) error { return nil })
+	upHandled := false
+	cm.RegisterMessageHandler(TypeHeartbeat, func(msg *MQTTMessage) error {
+		upHandled = true
+		return nil
+	})
+
+	assert.NoError(t, cm.Subscribe())
+	assert.Equal(t, []string{"/v1/control/test-node/+", "/v1/data/test-node/up", "/v1/status/test-node"}, client.subscribed)
+	assert.Equal(t, map[string]byte{
+		"/v1/control/test-node/+": 2,
+		"/v1/data/test-node/up":   1,
+		"/v1/status/test-node":    0,
+	}, client.qos)
+
+	client.callback(nil, &mockMessage{topic: "/v1/control/test-node/reset", payload: []byte("now")})
+	assert.Equal(t, "/v1/control/test-node/reset", gotTopic)
+	assert.Equal(t, []byte("now"), gotPayload)
+
+	data, _ := json.Marshal(NewMessage(TypeHeartbeat, &HeartbeatPayload{}))
+	client.callback(nil, &mockMessage{topic: "/v1/data/test-node/up", payload: data})
+	assert.True(t, upHandled)
+}
+
+// TestSubscribe_TopicWithoutHandler tests that configured topics without a registered handler are not subscribed
+func TestSubscribe_TopicWithoutHandler(t *testing.T) {
+	cm := NewClientManager("test-node", ClientConfig{
+		Topics: []TopicSubscription{
+			{Topic: "/v1/status/test-node", QoS: 0},
+			{Topic: "/v1/control/test-node/+", QoS: 2},
+		},
+	}, logger.NewClient("DEBUG"))
+	client := &mockPahoClient{}
+	cm.client = client
+	cm.RegisterTopicHandler("/v1/control/test-node/+", func(topic string, payload []byte) error { return nil })
+
+	assert.NoError(t, cm.Subscribe())
+	assert.Equal(t, []string{"/v1/control/test-node/+", "/v1/data/test-node/up"}, client.subscribed)
+}
+
+// TestTopicMatches tests MQTT wildcard matching of topic filters
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"/a/b", "/a/b", true},
+		{"/a/b", "/a/c", false},
+		{"/a/+", "/a/b", true},
+		{"/a/+", "/a/b/c", false},
+		{"/a/#", "/a/b/c", true},
+		{"/a/#", "/a", true},
+		{"/a/b/c", "/a/b", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter+" "+tt.topic, func(t *testing.T) {
+			assert.Equal(t, tt.want, topicMatches(tt.filter, tt.topic))
+		})
+	}
+}
+
+// TestConnect_InjectedClient tests that Connect uses an injected client and publishes through it
+func TestConnect_InjectedClient(t *testing.T) {
+	cm := createTestClientManager(t)
+	client := &mockPahoClient{}
+	cm.SetClient(client)
+
+	assert.NoError(t, cm.Connect(ClientConfig{Broker: "tcp://unused:1883"}))
+	assert.Equal(t, 1, client.connects)
+	assert.Equal(t, []string{"/v1/data/test-node/up"}, client.subscribed)
+
+	msg := NewMessage(TypeSensorData, map[string]interface{}{"northDeviceName": "device1"})
+	assert.NoError(t, cm.Publish(msg))
+	assert.Equal(t, 1, client.publishCount())
+
+	var published MQTTMessage
+	assert.NoError(t, json.Unmarshal(client.published[0], &published))
+	assert.Equal(t, msg.RequestID, published.RequestID)
+	assert.Equal(t, TypeSensorData, published.Type)
+	assert.Equal(t, map[string]interface{}{"northDeviceName": "device1"}, published.Payload)
+}
+
+// TestNewClientOptions_PersistentSession tests that the session flag is applied to the client options
+// and that the zero value keeps a clean session
+func TestNewClientOptions_PersistentSession(t *testing.T) {
+	cm := createTestClientManager(t)
+
+	opts, err := cm.newClientOptions(ClientConfig{Broker: "tcp://localhost:1883", ClientID: "test-client"})
+	assert.NoError(t, err)
+	assert.True(t, opts.CleanSession, "zero value must keep a clean session")
+
+	for _, persistent := range []bool{true, false} {
+		opts, err := cm.newClientOptions(ClientConfig{Broker: "tcp://localhost:1883", ClientID: "test-client", PersistentSession: persistent})
+		assert.NoError(t, err)
+		assert.Equal(t, !persistent, opts.CleanSession)
+	}
+}
+
 // TestIsConnected_NotConnected tests IsConnected when client is nil or not connected
 func TestIsConnected_NotConnected(t *testing.T) {
 	cm := createTestClientManager(t)
@@ -46,6 +308,101 @@ func TestStopHeartbeat_WithHeartbeat(t *testing.T) {
 	assert.False(t, ok, "heartbeatStop channel should be closed")
 }
 
+// TestNewClientOptions_ReconnectJitter tests that reconnect attempts wait a random delay within the configured jitter
+func TestNewClientOptions_ReconnectJitter(t *testing.T) {
+	cm := createTestClientManager(t)
+
+	opts, err := cm.newClientOptions(ClientConfig{Broker: "tcp://localhost:1883", ClientID: "test-client"})
+	assert.NoError(t, err)
+	assert.Nil(t, opts.OnReconnecting, "no jitter configured")
+
+	jitter := 30 * time.Millisecond
+	opts, err = cm.newClientOptions(ClientConfig{Broker: "tcp://localhost:1883", ClientID: "test-client", ReconnectJitter: jitter})
+	assert.NoError(t, err)
+	if assert.NotNil(t, opts.OnReconnecting) {
+		start := time.Now()
+		opts.OnReconnecting(nil, opts)
+		assert.Less(t, time.Since(start), jitter+50*time.Millisecond)
+	}
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		d := reconnectJitter(jitter)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.Less(t, d, jitter)
+		seen[d] = true
+	}
+	assert.Greater(t, len(seen), 1, "jitter should be randomized")
+	assert.Equal(t, time.Duration(0), reconnectJitter(0))
+}
+
+// TestStartHeartbeat_InitialDelay tests that no heartbeat is sent before the initial delay elapses
+func TestStartHeartbeat_InitialDelay(t *testing.T) {
+	cm := createTestClientManager(t)
+	client := &mockPahoClient{}
+	cm.client = client
+
+	cm.StartHeartbeat(time.Hour, 200*time.Millisecond)
+	defer cm.StopHeartbeat()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, client.publishCount(), "heartbeat sent before initial delay")
+
+	assert.Eventually(t, func() bool { return client.publishCount() == 1 }, time.Second, 10*time.Millisecond)
+
+	var msg MQTTMessage
+	client.mu.Lock()
+	err := json.Unmarshal(client.published[0], &msg)
+	client.mu.Unlock()
+	assert.NoError(t, err)
+	assert.Equal(t, TypeHeartbeat, msg.Type)
+}
+
+// TestSendHeartbeat_Capabilities tests that the heartbeat reports the function codes from the capabilities provider
+func TestSendHeartbeat_Capabilities(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities func() []uint8
+		want         []int
+	}{
+		{name: "no provider", capabilities: nil, want: nil},
+		{name: "read-only node", capabilities: func() []uint8 { return []uint8{1, 2, 3, 4} }, want: []int{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := createTestClientManager(t)
+			client := &mockPahoClient{}
+			cm.client = client
+			cm.SetCapabilities(tt.capabilities)
+
+			cm.sendHeartbeat()
+
+			var msg struct {
+				Type    int              `json:"type"`
+				Payload HeartbeatPayload `json:"payload"`
+			}
+			assert.Equal(t, 1, client.publishCount())
+			assert.NoError(t, json.Unmarshal(client.published[0], &msg))
+			assert.Equal(t, TypeHeartbeat, msg.Type)
+			assert.Equal(t, tt.want, msg.Payload.FunctionCodes)
+		})
+	}
+}
+
+// TestStartHeartbeat_StopDuringDelay tests that stopping during the initial delay sends nothing
+func TestStartHeartbeat_StopDuringDelay(t *testing.T) {
+	cm := createTestClientManager(t)
+	client := &mockPahoClient{}
+	cm.client = client
+
+	cm.StartHeartbeat(time.Hour, 100*time.Millisecond)
+	cm.StopHeartbeat()
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 0, client.publishCount())
+}
+
 // TestDisconnect_NoClient tests disconnect when client is nil
 func TestDisconnect_NoClient(t *testing.T) {
 	cm := createTestClientManager(t)
@@ -135,6 +492,81 @@ func TestOnMessage_Response(t *testing.T) {
 	assert.Equal(t, 200, receivedResp.Code)
 }
 
+// TestOnMessage_ZeroCodeResponse tests that a response with code 0 is routed as a response
+func TestOnMessage_ZeroCodeResponse(t *testing.T) {
+	cm := createTestClientManager(t)
+
+	var receivedResp *MQTTResponse
+	cm.RegisterResponseHandler(TypeHeartbeat, func(resp *MQTTResponse) error {
+		receivedResp = resp
+		return nil
+	})
+	messageCalled := false
+	cm.RegisterMessageHandler(TypeHeartbeat, func(msg *MQTTMessage) error {
+		messageCalled = true
+		return nil
+	})
+
+	data, _ := json.Marshal(NewResponse("test-req-0", TypeHeartbeat, 0, "", nil))
+	cm.onMessage(nil, &mockMessage{topic: cm.topicUp, payload: data})
+
+	assert.False(t, messageCalled, "code-0 response must not be routed as a message")
+	if assert.NotNil(t, receivedResp) {
+		assert.Equal(t, 0, receivedResp.Code)
+		assert.Equal(t, "test-req-0", receivedResp.RequestID)
+	}
+}
+
+// TestOnMessage_MessageWithCodeField tests that a message carrying a code field is still routed as a message
+func TestOnMessage_MessageWithCodeField(t *testing.T) {
+	cm := createTestClientManager(t)
+
+	responseCalled := false
+	cm.RegisterResponseHandler(TypeSensorData, func(resp *MQTTResponse) error {
+		responseCalled = true
+		return nil
+	})
+	var receivedMsg *MQTTMessage
+	cm.RegisterMessageHandler(TypeSensorData, func(msg *MQTTMessage) error {
+		receivedMsg = msg
+		return nil
+	})
+
+	raw := []byte(`{"requestId":"msg-1","version":"1.0","type":4,"timestamp":1,"code":500,` +
+		`"payload":{"northDeviceName":"device1","data":{"code":7}}}`)
+	cm.onMessage(nil, &mockMessage{topic: cm.topicUp, payload: raw})
+
+	assert.False(t, responseCalled, "message with code but no msg must not be routed as a response")
+	if assert.NotNil(t, receivedMsg) {
+		assert.Equal(t, "msg-1", receivedMsg.RequestID)
+	}
+}
+
+// TestSetResponseDetector tests replacing the response discriminator
+func TestSetResponseDetector(t *testing.T) {
+	cm := createTestClientManager(t)
+
+	responseCalled := false
+	cm.RegisterResponseHandler(TypeHeartbeat, func(resp *MQTTResponse) error {
+		responseCalled = true
+		return nil
+	})
+
+	// Treat anything with a "code" key as a response
+	cm.SetResponseDetector(func(fields map[string]json.RawMessage) bool {
+		_, ok := fields["code"]
+		return ok
+	})
+	cm.onMessage(nil, &mockMessage{topic: cm.topicUp, payload: []byte(`{"requestId":"r","type":1,"code":0}`)})
+	assert.True(t, responseCalled)
+
+	// nil restores the default detector
+	cm.SetResponseDetector(nil)
+	responseCalled = false
+	cm.onMessage(nil, &mockMessage{topic: cm.topicUp, payload: []byte(`{"requestId":"r","type":1,"code":0}`)})
+	assert.False(t, responseCalled)
+}
+
 // TestOnMessage_PendingRequest tests onMessage with a pending request response
 func TestOnMessage_PendingRequest(t *testing.T) {
 	cm := createTestClientManager(t)
@@ -176,6 +608,55 @@ func TestOnMessage_PendingRequest(t *testing.T) {
 	assert.False(t, exists)
 }
 
+// TestPublishAndWait_DuplicateRequestID tests that a duplicate pending RequestID is rejected
+func TestPublishAndWait_DuplicateRequestID(t *testing.T) {
+	cm := createTestClientManager(t)
+
+	msg := NewMessage(TypeQueryDevice, nil)
+	existing := make(chan *MQTTResponse, 1)
+
+	// Simulate an in-flight request with the same RequestID
+	cm.pendingMu.Lock()
+	cm.pendingRequests[msg.RequestID] = existing
+	cm.pendingMu.Unlock()
+
+	resp, err := cm.PublishAndWait(msg, 100*time.Millisecond)
+	assert.Nil(t, resp)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already pending")
+
+	// The original pending channel must not be clobbered
+	cm.pendingMu.RLock()
+	ch, exists := cm.pendingRequests[msg.RequestID]
+	cm.pendingMu.RUnlock()
+	assert.True(t, exists)
+	assert.Equal(t, existing, ch)
+}
+
+// TestPublishAndWait_PendingLimit tests that requests beyond the pending cap are rejected without publishing
+func TestPublishAndWait_PendingLimit(t *testing.T) {
+	cm := NewClientManager("test-node", ClientConfig{MaxPendingRequests: 2}, logger.NewClient("DEBUG"))
+	client := &mockPahoClient{}
+	cm.client = client
+
+	// Simulate requests still waiting for a response
+	cm.pendingMu.Lock()
+	cm.pendingRequests["req-1"] = make(chan *MQTTResponse, 1)
+	cm.pendingRequests["req-2"] = make(chan *MQTTResponse, 1)
+	cm.pendingMu.Unlock()
+
+	msg := NewMessage(TypeQueryDevice, nil)
+	resp, err := cm.PublishAndWait(msg, 100*time.Millisecond)
+	assert.Nil(t, resp)
+	assert.ErrorIs(t, err, ErrTooManyPendingRequests)
+	assert.Equal(t, 0, client.publishCount())
+
+	cm.pendingMu.RLock()
+	_, exists := cm.pendingRequests[msg.RequestID]
+	cm.pendingMu.RUnlock()
+	assert.False(t, exists)
+}
+
 // TestOnMessage_NoHandler tests onMessage when no handler is registered
 func TestOnMessage_NoHandler(t *testing.T) {
 	cm := createTestClientManager(t)
@@ -195,6 +676,59 @@ func TestOnMessage_NoHandler(t *testing.T) {
 	})
 }
 
+// TestOnMessage_SequenceGaps tests that missing and out-of-order sequence numbers are counted per topic
+func TestOnMessage_SequenceGaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    string
+		topics   []string
+		seqs     []uint64
+		wantGaps uint64
+	}{
+		{name: "in order", field: "seq", seqs: []uint64{1, 2, 3, 4}, wantGaps: 0},
+		{name: "missing messages", field: "seq", seqs: []uint64{1, 2, 5, 6}, wantGaps: 1},
+		{name: "reordered", field: "seq", seqs: []uint64{1, 3, 2, 3}, wantGaps: 2},
+		{name: "duplicate", field: "seq", seqs: []uint64{7, 7}, wantGaps: 1},
+		{name: "tracked per topic", field: "seq", topics: []string{"a", "b", "a", "b"}, seqs: []uint64{1, 10, 2, 11}, wantGaps: 0},
+		{name: "detection disabled", field: "", seqs: []uint64{1, 5, 2}, wantGaps: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := NewClientManager("test-node", ClientConfig{SequenceField: tt.field}, logger.NewClient("ERROR"))
+			var received []*uint64
+			cm.RegisterMessageHandler(TypeSensorData, func(msg *MQTTMessage) error {
+				received = append(received, msg.Sequence)
+				return nil
+			})
+
+			for i, seq := range tt.seqs {
+				data, _ := json.Marshal(map[string]interface{}{
+					"requestId": fmt.Sprintf("req-%d", i),
+					"type":      TypeSensorData,
+					"seq":       seq,
+					"payload":   map[string]interface{}{"northDeviceName": "device1"},
+				})
+				topic := cm.topicUp
+				if tt.topics != nil {
+					topic = tt.topics[i]
+				}
+				cm.onMessage(nil, &mockMessage{topic: topic, payload: data})
+			}
+
+			assert.Equal(t, tt.wantGaps, cm.SequenceGaps())
+			assert.Len(t, received, len(tt.seqs))
+			for i, seq := range received {
+				if tt.field == "" {
+					assert.Nil(t, seq)
+				} else if assert.NotNil(t, seq) {
+					assert.Equal(t, tt.seqs[i], *seq)
+				}
+			}
+		})
+	}
+}
+
 // mockMessage implements pahomqtt.Message for testing
 type mockMessage struct {
 	topic   string
@@ -208,3 +742,67 @@ func (m *mockMessage) Topic() string                { return m.topic }
 func (m *mockMessage) MessageID() uint16            { return 0 }
 func (m *mockMessage) Payload() []byte              { return m.payload }
 func (m *mockMessage) Ack()                         {}
+
+// disconnectedPahoClient fails every publish like a client whose connection was lost
+type disconnectedPahoClient struct {
+	mockPahoClient
+	failing bool
+}
+
+func (c *disconnectedPahoClient) Publish(topic string, qos byte, retained bool, payload interface{}) pahomqtt.Token {
+	if c.failing {
+		return &errorToken{err: errors.New("not connected")}
+	}
+	return c.mockPahoClient.Publish(topic, qos, retained, payload)
+}
+
+// errorToken is an already completed token with an error
+type errorToken struct {
+	pahomqtt.Token
+	err error
+}
+
+func (t *errorToken) Wait() bool   { return true }
+func (t *errorToken) Error() error { return t.err }
+
+// TestSendHeartbeat_ReconnectGrace tests that heartbeat failures during a reconnect do not escalate
+func TestSendHeartbeat_ReconnectGrace(t *testing.T) {
+	tests := []struct {
+		name         string
+		grace        time.Duration
+		lost         bool
+		wantFailures uint64
+	}{
+		{name: "reconnecting within grace", grace: time.Minute, lost: true, wantFailures: 0},
+		{name: "connected", grace: time.Minute, lost: false, wantFailures: 3},
+		{name: "grace disabled", grace: 0, lost: true, wantFailures: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := createTestClientManager(t)
+			client := &disconnectedPahoClient{failing: true}
+			cm.client = client
+			cm.SetHeartbeatGrace(tt.grace)
+
+			opts, err := cm.newClientOptions(ClientConfig{Broker: "tcp://localhost:1883", ClientID: "test-client"})
+			assert.NoError(t, err)
+			if tt.lost {
+				opts.OnConnectionLost(client, errors.New("EOF"))
+			}
+
+			for i := 0; i < 3; i++ {
+				cm.sendHeartbeat()
+			}
+			assert.Equal(t, tt.wantFailures, cm.HeartbeatFailures())
+
+			// After reconnecting failures escalate again, and a successful heartbeat resets the count
+			opts.OnConnect(client)
+			cm.sendHeartbeat()
+			assert.Equal(t, tt.wantFailures+1, cm.HeartbeatFailures())
+			client.failing = false
+			cm.sendHeartbeat()
+			assert.Equal(t, uint64(0), cm.HeartbeatFailures())
+		})
+	}
+}
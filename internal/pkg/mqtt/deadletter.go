@@ -0,0 +1,102 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DeadLetterHandler 接收上行主题上无法解析的原始消息及解析错误，返回的错误只记录日志
+type DeadLetterHandler func(topic string, payload []byte, err error) error
+
+// DeadLetterRecord 是死信文件中的一行记录
+// 载荷为合法UTF-8时写入 Payload，否则以base64写入 PayloadBase64
+type DeadLetterRecord struct {
+	Time          time.Time `json:"time"`
+	Topic         string    `json:"topic"`
+	Error         string    `json:"error"`
+	Size          int       `json:"size"` // 原始载荷字节数
+	Truncated     bool      `json:"truncated,omitempty"`
+	Payload       string    `json:"payload,omitempty"`
+	PayloadBase64 []byte    `json:"payloadBase64,omitempty"`
+}
+
+// FileDeadLetter 将无法解析的消息按行追加到文件
+// 每条记录的载荷截断到 maxPayload 字节；文件超过 maxFile 字节时轮转为 path.1，只保留一个轮转文件
+type FileDeadLetter struct {
+	path       string
+	maxPayload int
+	maxFile    int64
+
+	mu sync.Mutex
+}
+
+// NewFileDeadLetter 创建写入path的死信文件，maxPayload 和 maxFile 小于等于0时不限制
+func NewFileDeadLetter(path string, maxPayload int, maxFile int64) *FileDeadLetter {
+	return &FileDeadLetter{
+		path:       path,
+		maxPayload: maxPayload,
+		maxFile:    maxFile,
+	}
+}
+
+// Write 追加一条死信记录，可直接作为 DeadLetterHandler 使用
+func (d *FileDeadLetter) Write(topic string, payload []byte, parseErr error) error {
+	record := DeadLetterRecord{
+		Time:  time.Now(),
+		Topic: topic,
+		Size:  len(payload),
+	}
+	if parseErr != nil {
+		record.Error = parseErr.Error()
+	}
+	if d.maxPayload > 0 && len(payload) > d.maxPayload {
+		payload = payload[:d.maxPayload]
+		record.Truncated = true
+	}
+	if utf8.Valid(payload) {
+		record.Payload = string(payload)
+	} else {
+		record.PayloadBase64 = payload
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter: %w", err)
+	}
+	line = append(line, '\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.rotate(int64(len(line))); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(d.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open dead letter file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to write dead letter file: %w", err)
+	}
+	return nil
+}
+
+// rotate 在追加n字节会超过文件上限时将当前文件改名为 path.1
+func (d *FileDeadLetter) rotate(n int64) error {
+	if d.maxFile <= 0 {
+		return nil
+	}
+	info, err := os.Stat(d.path)
+	if err != nil || info.Size() == 0 || info.Size()+n <= d.maxFile {
+		return nil
+	}
+	if err := os.Rename(d.path, d.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate dead letter file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readDeadLetters parses every record in a dead-letter file
+func readDeadLetters(t *testing.T, path string) []DeadLetterRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []DeadLetterRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r DeadLetterRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestOnMessage_DeadLetter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadletter.log")
+	cm := createTestClientManager(t)
+	cm.SetDeadLetterHandler(NewFileDeadLetter(path, 0, 0).Write)
+
+	cm.onMessage(nil, &mockMessage{topic: cm.topicUp, payload: []byte(`{"type":1,`)})
+	cm.onMessage(nil, &mockMessage{topic: cm.topicUp, payload: []byte(`{"type":"one"}`)})
+	cm.onMessage(nil, &mockMessage{topic: cm.topicUp, payload: []byte{0xff, 0xfe}})
+	cm.onMessage(nil, &mockMessage{topic: cm.topicUp, payload: []byte(`{"requestId":"r","type":1}`)})
+
+	records := readDeadLetters(t, path)
+	require.Len(t, records, 3)
+	assert.Equal(t, cm.topicUp, records[0].Topic)
+	assert.Equal(t, `{"type":1,`, records[0].Payload)
+	assert.NotEmpty(t, records[0].Error)
+	assert.Equal(t, `{"type":"one"}`, records[1].Payload)
+	assert.Empty(t, records[2].Payload)
+	assert.Equal(t, []byte{0xff, 0xfe}, records[2].PayloadBase64)
+}
+
+func TestFileDeadLetter_Limits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadletter.log")
+	sink := NewFileDeadLetter(path, 8, 200)
+
+	require.NoError(t, sink.Write("t", []byte(strings.Repeat("x", 100)), nil))
+	records := readDeadLetters(t, path)
+	require.Len(t, records, 1)
+	assert.Equal(t, "xxxxxxxx", records[0].Payload)
+	assert.Equal(t, 100, records[0].Size)
+	assert.True(t, records[0].Truncated)
+
+	// Each record is well under 200 bytes; keep writing until the file rotates
+	for i := 0; i < 5; i++ {
+		require.NoError(t, sink.Write("t", []byte("payload"), nil))
+	}
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, info.Size(), int64(200))
+	_, err = os.Stat(path + ".1")
+	assert.NoError(t, err, "expected rotated file")
+}
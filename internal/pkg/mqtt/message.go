@@ -2,6 +2,7 @@ package mqtt
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -25,6 +26,12 @@ type MQTTMessage struct {
 	Type      int         `json:"type"`
 	Timestamp int64       `json:"timestamp"`
 	Payload   interface{} `json:"payload"`
+
+	// ReplyTo 非空时数据中心应将响应发布到该主题而不是上行主题，共享订阅下由 PublishAndWait 设置为本实例私有的主题
+	ReplyTo string `json:"replyTo,omitempty"`
+
+	// Sequence 是发送方的单调递增序号，从 ClientConfig.SequenceField 指定的顶层字段解析，未携带时为nil
+	Sequence *uint64 `json:"-"`
 }
 
 // MQTTResponse represents a response message with code and msg
@@ -93,13 +100,24 @@ func ParseResponse(data []byte) (*MQTTResponse, error) {
 // ---- Payload Types ----
 
 // HeartbeatPayload for type=1 heartbeat messages
-type HeartbeatPayload struct{}
+type HeartbeatPayload struct {
+	FunctionCodes []int `json:"functionCodes,omitempty"` // 节点当前支持的Modbus功能码，用于注册和诊断
+}
 
 // QueryDevicePayload for type=2 query device request
 type QueryDevicePayload struct {
 	Cmd string `json:"cmd"` // "0101" for querying device attributes
 }
 
+// QueryDataPayload for type=2 query data request; the data center answers with type=4 sensor data.
+// cmd "0102" is an extension of the type=2 protocol, which otherwise only defines "0101"; it is
+// only sent when Cache.RequeryEnabled is set, so the data center must implement it before enabling.
+type QueryDataPayload struct {
+	Cmd             string   `json:"cmd"` // "0102" for querying current resource values
+	NorthDeviceName string   `json:"northDeviceName"`
+	Resources       []string `json:"resources"`
+}
+
 // NorthResource represents a north-side resource definition
 type NorthResource struct {
 	Name            string  `json:"name"`
@@ -108,11 +126,59 @@ type NorthResource struct {
 	ValueType       string  `json:"valueType"` // int16, float32, etc.
 	Scale           float64 `json:"scale"`
 	OffsetValue     float64 `json:"offsetValue"`
+	Unit            string  `json:"unit,omitempty"`        // 工程单位，例如 °C、kPa
+	ArrayLength     int     `json:"arrayLength,omitempty"` // 数组元素个数，大于0时资源为ValueType元素组成的数组
+	Precision       *int    `json:"precision,omitempty"`   // 浮点值输出的小数位数，覆盖全局配置
 	OtherParameters struct {
 		Modbus struct {
-			Address uint16 `json:"address"` // Modbus register address
+			Address           uint16  `json:"address"`                     // Modbus register address
+			ObjectType        string  `json:"objectType,omitempty"`        // Coil、DiscreteInput、InputRegister、HoldingRegister，为空时按地址范围确定；配置了基地址偏移时决定缓存键
+			SignedFlagAddress *uint16 `json:"signedFlagAddress,omitempty"` // 符号模式标志地址（非零为有符号）
+			SignedEncoding    string  `json:"signedEncoding,omitempty"`    // 有符号整数表示：twosComplement(默认)、offsetBinary、signMagnitude
+			WordOrder         string  `json:"wordOrder,omitempty"`         // 32/64位值的寄存器顺序：highWordFirst、lowWordFirst，为空时使用全局顺序
+			SecondWordAddress *uint16 `json:"secondWordAddress,omitempty"` // 32位值的第二个字所在地址（可与Address不相邻），Address只提供按WordOrder排在前面的字
+			HoldLastValue     bool    `json:"holdLastValue,omitempty"`     // TTL过期后继续返回最后的值（标记为Stale），适用于变化缓慢的设定值
+			MaxAge            string  `json:"maxAge,omitempty"`            // 数据超过该时长后读取时标记为Stale并向数据中心重新查询，例如 "30s"
+			StringLength      uint16  `json:"stringLength,omitempty"`      // string资源占用的寄存器数（每个寄存器两个字符），主站写入必须恰好覆盖这些寄存器
+
+			Targets []ModbusTarget `json:"targets,omitempty"` // 同时提供该值的其他对象类型/地址，随主地址一起更新
+
+			DefaultValue interface{} `json:"defaultValue,omitempty"` // 映射加载后、首个真实数据到达前返回的值，例如设定值的额定值
 		} `json:"modbus"`
 	} `json:"otherParameters"`
+
+	// 读写方向各自的校准，未配置的项使用 Scale/OffsetValue，用于读写校准不对称的设备
+	ReadScale        *float64 `json:"readScale,omitempty"`        // Modbus主站读取（值→寄存器）使用的比例
+	ReadOffsetValue  *float64 `json:"readOffsetValue,omitempty"`  // Modbus主站读取使用的偏移
+	WriteScale       *float64 `json:"writeScale,omitempty"`       // Modbus主站写入（寄存器→值）使用的比例
+	WriteOffsetValue *float64 `json:"writeOffsetValue,omitempty"` // Modbus主站写入使用的偏移
+}
+
+// ReadCalibration 返回Modbus主站读取时将值编码为寄存器使用的比例和偏移：寄存器 = (值-偏移)/比例
+func (nr *NorthResource) ReadCalibration() (scale, offset float64) {
+	return calibration(nr.Scale, nr.OffsetValue, nr.ReadScale, nr.ReadOffsetValue)
+}
+
+// WriteCalibration 返回Modbus主站写入时将寄存器解码为值使用的比例和偏移：值 = 寄存器*比例+偏移
+func (nr *NorthResource) WriteCalibration() (scale, offset float64) {
+	return calibration(nr.Scale, nr.OffsetValue, nr.WriteScale, nr.WriteOffsetValue)
+}
+
+// calibration 用方向专用的比例/偏移覆盖共用的设置
+func calibration(scale, offset float64, scaleOverride, offsetOverride *float64) (float64, float64) {
+	if scaleOverride != nil {
+		scale = *scaleOverride
+	}
+	if offsetOverride != nil {
+		offset = *offsetOverride
+	}
+	return scale, offset
+}
+
+// ModbusTarget 是资源值的附加Modbus地址，例如线圈1的布尔值同时映射到保持寄存器40001的bit 0
+type ModbusTarget struct {
+	ObjectType string `json:"objectType,omitempty"` // Coil、DiscreteInput、InputRegister、HoldingRegister，为空时按地址范围确定
+	Address    uint16 `json:"address"`
 }
 
 // SouthResource represents a south-side resource definition
@@ -136,9 +202,15 @@ type ResourceMapping struct {
 // DeviceMapping represents device level mapping
 type DeviceMapping struct {
 	NorthDeviceName string             `json:"northDeviceName"`
+	Enabled         *bool              `json:"enabled,omitempty"` // nil means enabled
 	Resources       []*ResourceMapping `json:"resources"`
 }
 
+// IsEnabled reports whether the device is enabled; devices without the flag are enabled
+func (dm *DeviceMapping) IsEnabled() bool {
+	return dm.Enabled == nil || *dm.Enabled
+}
+
 // QueryDeviceResponse for type=2 query device response payload
 type QueryDeviceResponse struct {
 	Cmd    string           `json:"cmd"`
@@ -158,11 +230,20 @@ type SensorDataPayload struct {
 	Data            map[string]interface{} `json:"data"`
 }
 
+// SensorDataAckPayload for type=4 sensor data acknowledgements
+type SensorDataAckPayload struct {
+	NorthDeviceName string `json:"northDeviceName"`
+	Applied         int    `json:"applied"` // 写入缓存的数据项数
+	Skipped         int    `json:"skipped"` // 未匹配任何资源的数据项数
+}
+
 // ForwardLogPayload for type=5 forward log messages
 type ForwardLogPayload struct {
 	Status          int                    `json:"status"` // 1-success, 0-failure
 	NorthDeviceName string                 `json:"northDeviceName"`
 	Data            map[string]interface{} `json:"data"`
+	ReadTimestamp   int64                  `json:"readTimestamp,omitempty"` // Modbus read time (Unix ms)
+	Source          string                 `json:"source,omitempty"`        // "command" for data center PUT audits, "conversionError" for failure counts, empty for Modbus reads
 }
 
 // CommandPayload for type=6 command messages
@@ -190,21 +271,37 @@ type CommandResponseContent struct {
 	NorthDeviceName    string `json:"northDeviceName"`
 	NorthResourceName  string `json:"northResourceName"`
 	NorthResourceValue string `json:"northResourceValue,omitempty"`
+	NorthResourceUnit  string `json:"northResourceUnit,omitempty"`
 }
 
 // ---- Helper functions for payload extraction ----
 
+// ErrEmptyPayload is returned by the payload extractors when the payload is missing or null
+var ErrEmptyPayload = errors.New("payload is empty")
+
+// decodePayload re-decodes a generic payload into out, rejecting nil/null payloads
+// so callers never receive a zero-value struct for a missing payload
+func decodePayload(payload interface{}, kind string, out interface{}) error {
+	if payload == nil {
+		return fmt.Errorf("%s: %w", kind, ErrEmptyPayload)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if string(data) == "null" {
+		return fmt.Errorf("%s: %w", kind, ErrEmptyPayload)
+	}
+	return json.Unmarshal(data, out)
+}
+
 // GetSensorDataPayload extracts SensorDataPayload from message
 func (m *MQTTMessage) GetSensorDataPayload() (*SensorDataPayload, error) {
 	if m.Type != TypeSensorData {
 		return nil, fmt.Errorf("message type is not sensor data: %d", m.Type)
 	}
-	data, err := json.Marshal(m.Payload)
-	if err != nil {
-		return nil, err
-	}
 	var payload SensorDataPayload
-	if err := json.Unmarshal(data, &payload); err != nil {
+	if err := decodePayload(m.Payload, "sensor data", &payload); err != nil {
 		return nil, err
 	}
 	return &payload, nil
@@ -215,12 +312,8 @@ func (m *MQTTMessage) GetCommandPayload() (*CommandPayload, error) {
 	if m.Type != TypeCommand {
 		return nil, fmt.Errorf("message type is not command: %d", m.Type)
 	}
-	data, err := json.Marshal(m.Payload)
-	if err != nil {
-		return nil, err
-	}
 	var payload CommandPayload
-	if err := json.Unmarshal(data, &payload); err != nil {
+	if err := decodePayload(m.Payload, "command", &payload); err != nil {
 		return nil, err
 	}
 	return &payload, nil
@@ -231,12 +324,8 @@ func (r *MQTTResponse) GetQueryDeviceResponse() (*QueryDeviceResponse, error) {
 	if r.Type != TypeQueryDevice {
 		return nil, fmt.Errorf("response type is not query device: %d", r.Type)
 	}
-	data, err := json.Marshal(r.Payload)
-	if err != nil {
-		return nil, err
-	}
 	var payload QueryDeviceResponse
-	if err := json.Unmarshal(data, &payload); err != nil {
+	if err := decodePayload(r.Payload, "query device", &payload); err != nil {
 		return nil, err
 	}
 	return &payload, nil
@@ -247,12 +336,8 @@ func (m *MQTTMessage) GetDeviceAttributePushPayload() (*DeviceAttributePushPaylo
 	if m.Type != TypeDeviceAttributePush {
 		return nil, fmt.Errorf("message type is not device attribute push: %d", m.Type)
 	}
-	data, err := json.Marshal(m.Payload)
-	if err != nil {
-		return nil, err
-	}
 	var payload DeviceAttributePushPayload
-	if err := json.Unmarshal(data, &payload); err != nil {
+	if err := decodePayload(m.Payload, "device attribute push", &payload); err != nil {
 		return nil, err
 	}
 	return &payload, nil
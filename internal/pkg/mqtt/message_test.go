@@ -3,6 +3,7 @@ package mqtt
 import (
 	"app-modbus-go/internal/pkg/logger"
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 )
@@ -200,6 +201,43 @@ func TestForwardLogPayloadSerialization(t *testing.T) {
 	}
 }
 
+func TestForwardLogPayloadReadTimestamp(t *testing.T) {
+	readTime := time.Now()
+	payload := &ForwardLogPayload{
+		Status:          1,
+		NorthDeviceName: "device1",
+		Data:            map[string]interface{}{"temperature": 25.5},
+		ReadTimestamp:   readTime.UnixMilli(),
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	var unmarshaled ForwardLogPayload
+	if err := json.Unmarshal(data, &unmarshaled); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if unmarshaled.ReadTimestamp != readTime.UnixMilli() {
+		t.Errorf("expected readTimestamp %d, got %d", readTime.UnixMilli(), unmarshaled.ReadTimestamp)
+	}
+
+	// A zero read timestamp is omitted from the payload
+	payload.ReadTimestamp = 0
+	data, err = json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if _, ok := raw["readTimestamp"]; ok {
+		t.Error("expected readTimestamp to be omitted when zero")
+	}
+}
+
 func TestCommandPayloadSerialization(t *testing.T) {
 	payload := &CommandPayload{
 		CmdType: "GET",
@@ -397,3 +435,41 @@ func TestMessagePayloadNil(t *testing.T) {
 		t.Fatalf("failed to unmarshal message with nil payload: %v", err)
 	}
 }
+
+func TestPayloadExtractorsNilPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		extract func(payload interface{}) error
+	}{
+		{name: "sensor data", extract: func(p interface{}) error {
+			_, err := NewMessage(TypeSensorData, p).GetSensorDataPayload()
+			return err
+		}},
+		{name: "command", extract: func(p interface{}) error {
+			_, err := NewMessage(TypeCommand, p).GetCommandPayload()
+			return err
+		}},
+		{name: "device attribute push", extract: func(p interface{}) error {
+			_, err := NewMessage(TypeDeviceAttributePush, p).GetDeviceAttributePushPayload()
+			return err
+		}},
+		{name: "query device", extract: func(p interface{}) error {
+			_, err := NewResponse("req", TypeQueryDevice, 200, "OK", p).GetQueryDeviceResponse()
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.extract(nil); !errors.Is(err, ErrEmptyPayload) {
+				t.Errorf("nil payload: expected ErrEmptyPayload, got %v", err)
+			}
+			if err := tt.extract(json.RawMessage("null")); !errors.Is(err, ErrEmptyPayload) {
+				t.Errorf("null payload: expected ErrEmptyPayload, got %v", err)
+			}
+			if err := tt.extract(map[string]interface{}{}); err != nil {
+				t.Errorf("empty object payload: unexpected error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig 保存MQTT TLS配置
+type TLSConfig struct {
+	CAFile   string // 校验Broker证书的CA文件，为空时使用系统根证书
+	CertFile string // 客户端证书，与KeyFile同时配置时启用mTLS
+	KeyFile  string // 客户端私钥
+}
+
+// Enabled 返回是否启用TLS
+func (c TLSConfig) Enabled() bool {
+	return c.CAFile != "" || c.MutualEnabled()
+}
+
+// MutualEnabled 返回是否启用客户端证书认证(mTLS)
+func (c TLSConfig) MutualEnabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// buildTLSConfig 根据配置构建 tls.Config
+// 启用mTLS时，客户端证书的CN必须与nodeID一致，否则返回错误
+func buildTLSConfig(cfg TLSConfig, nodeID string) (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates in CA file %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.MutualEnabled() {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		if err := verifyNodeIdentity(cert, nodeID); err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// verifyNodeIdentity 校验客户端证书的CN与节点ID一致
+func verifyNodeIdentity(cert tls.Certificate, nodeID string) error {
+	if len(cert.Certificate) == 0 {
+		return fmt.Errorf("client certificate is empty")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse client certificate: %w", err)
+	}
+	if leaf.Subject.CommonName != nodeID {
+		return fmt.Errorf("client certificate CN %q does not match node ID %q", leaf.Subject.CommonName, nodeID)
+	}
+	return nil
+}
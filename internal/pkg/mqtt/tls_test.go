@@ -0,0 +1,85 @@
+package mqtt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert generates a self-signed client certificate with the given CN
+func writeTestCert(t *testing.T, commonName string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "client.crt")
+	keyFile = filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+// TestBuildTLSConfigNodeIdentity verifies the client certificate CN must match the node ID
+func TestBuildTLSConfigNodeIdentity(t *testing.T) {
+	tests := []struct {
+		name       string
+		commonName string
+		wantErr    bool
+	}{
+		{name: "matching identity", commonName: "test-node", wantErr: false},
+		{name: "mismatching identity", commonName: "other-node", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certFile, keyFile := writeTestCert(t, tt.commonName)
+			tlsCfg, err := buildTLSConfig(TLSConfig{CertFile: certFile, KeyFile: keyFile}, "test-node")
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "does not match node ID")
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, tlsCfg.Certificates, 1)
+		})
+	}
+}
+
+// TestConnectRejectsMismatchedIdentity verifies Connect fails fast before dialing the broker
+func TestConnectRejectsMismatchedIdentity(t *testing.T) {
+	cm := createTestClientManager(t)
+	certFile, keyFile := writeTestCert(t, "other-node")
+
+	err := cm.Connect(ClientConfig{
+		Broker:   "ssl://localhost:8883",
+		ClientID: "test-client",
+		TLS:      TLSConfig{CertFile: certFile, KeyFile: keyFile},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match node ID")
+	assert.False(t, cm.IsConnected())
+}
@@ -0,0 +1,63 @@
+package service
+
+import "sync"
+
+// commandQueueSize 是一个节点最多未完成的命令数，达到上限时入队阻塞消息回调
+const commandQueueSize = 64
+
+// commandQueue 按到达顺序逐个执行一个节点的命令
+// 命令不在MQTT消息回调中执行（PUT写入确认要等待同一连接上的下一条传感器数据），但仍保持回调的到达顺序，
+// 同一资源的两个PUT按收到的顺序下发。队列非空时才有一个goroutine执行命令
+type commandQueue struct {
+	slots chan struct{} // 每个未完成的命令占用一个槽
+
+	mu      sync.Mutex
+	pending []func()
+	running bool
+}
+
+func newCommandQueue() *commandQueue {
+	return &commandQueue{slots: make(chan struct{}, commandQueueSize)}
+}
+
+// enqueue 把命令加入队尾，没有执行中的goroutine时经wg启动一个
+// 未完成的命令达到 commandQueueSize 时阻塞，直到有命令执行完毕或done关闭；done关闭时丢弃命令并返回false
+func (q *commandQueue) enqueue(wg *sync.WaitGroup, done <-chan struct{}, run func()) bool {
+	select {
+	case q.slots <- struct{}{}:
+	case <-done:
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, run)
+	if !q.running {
+		q.running = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.drain()
+		}()
+	}
+	return true
+}
+
+// drain 依次执行队列中的命令，队列为空时退出
+func (q *commandQueue) drain() {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		run := q.pending[0]
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		run()
+		<-q.slots
+	}
+}
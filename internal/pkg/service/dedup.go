@@ -0,0 +1,53 @@
+package service
+
+import (
+	"app-modbus-go/internal/pkg/mqtt"
+	"sync"
+	"time"
+)
+
+// commandDedup 记录去重窗口内收到的命令requestId及其响应
+// QoS 2 只保证一次会话内Broker到客户端恰好投递一次；持久会话恢复或数据中心重发时
+// 同一命令仍可能再次到达，此时不再执行，而是重发原响应
+type commandDedup struct {
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+}
+
+// dedupEntry 是一个已收到的命令，resp 为nil表示仍在执行
+type dedupEntry struct {
+	receivedAt time.Time
+	resp       *mqtt.MQTTResponse
+}
+
+func newCommandDedup() *commandDedup {
+	return &commandDedup{entries: make(map[string]*dedupEntry)}
+}
+
+// begin 登记requestId，窗口内已登记过时返回 true 及原响应（仍在执行时为nil）
+// 登记时顺带清除超出窗口的条目
+func (d *commandDedup) begin(requestID string, window time.Duration) (*mqtt.MQTTResponse, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for id, e := range d.entries {
+		if now.Sub(e.receivedAt) > window {
+			delete(d.entries, id)
+		}
+	}
+	if e, ok := d.entries[requestID]; ok {
+		return e.resp, true
+	}
+	d.entries[requestID] = &dedupEntry{receivedAt: now}
+	return nil, false
+}
+
+// finish 保存命令的响应，供重复投递时重发
+func (d *commandDedup) finish(requestID string, resp *mqtt.MQTTResponse) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.entries[requestID]; ok {
+		e.resp = resp
+	}
+}
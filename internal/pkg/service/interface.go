@@ -3,6 +3,7 @@ package service
 import (
 	"app-modbus-go/internal/pkg/config"
 	"app-modbus-go/internal/pkg/forwardlog"
+	"app-modbus-go/internal/pkg/httpserver"
 	"app-modbus-go/internal/pkg/logger"
 	"app-modbus-go/internal/pkg/mappingmanager"
 	"app-modbus-go/internal/pkg/modbusserver"
@@ -15,18 +16,27 @@ type AppServiceInterface interface {
 	// Initialize initializes the service with configuration
 	Initialize(configPath string) error
 
+	// PreflightCheck verifies config, Modbus port and optionally broker reachability
+	PreflightCheck() *PreflightReport
+
 	// Run runs the service until stop is called
 	Run() error
 
 	// Stop stops the service
 	Stop() error
 
+	// Reload re-reads the config file and reinitializes only the subsystems whose settings changed
+	Reload() (*config.ReloadPlan, error)
+
 	// GetLoggingClient returns the logging client
 	GetLoggingClient() logger.LoggingClient
 
 	// GetMappingManager returns the mapping manager
 	GetMappingManager() mappingmanager.MappingManagerInterface
 
+	// GetNodeMappingManager returns the mapping manager of a configured node ID
+	GetNodeMappingManager(nodeID string) (mappingmanager.MappingManagerInterface, bool)
+
 	// GetModbusServer returns the Modbus server
 	GetModbusServer() modbusserver.ModbusServerInterface
 
@@ -36,9 +46,15 @@ type AppServiceInterface interface {
 	// GetForwardLogManager returns the forward log manager
 	GetForwardLogManager() *forwardlog.Manager
 
+	// GetHTTPServer returns the HTTP server
+	GetHTTPServer() httpserver.HTTPServerInterface
+
 	// GetAppConfig returns the application configuration
 	GetAppConfig() *config.AppConfig
 
 	// GetContext returns the service context
 	GetContext() context.Context
+
+	// RegisterCommandHandler registers a handler for a command type, replacing any existing one
+	RegisterCommandHandler(cmdType string, handler CommandHandler) error
 }
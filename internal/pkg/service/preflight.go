@@ -0,0 +1,91 @@
+package service
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PreflightResult 是单项启动前检查的结果
+type PreflightResult struct {
+	Name string
+	Err  error
+}
+
+// PreflightReport 汇总所有启动前检查结果
+type PreflightReport struct {
+	Results []PreflightResult
+}
+
+// Failed 返回是否有检查未通过
+func (r *PreflightReport) Failed() bool {
+	for _, res := range r.Results {
+		if res.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// String 按检查顺序逐行输出结果
+func (r *PreflightReport) String() string {
+	var b strings.Builder
+	for _, res := range r.Results {
+		if res.Err != nil {
+			fmt.Fprintf(&b, "  [FAIL] %s: %s\n", res.Name, res.Err.Error())
+		} else {
+			fmt.Fprintf(&b, "  [ OK ] %s\n", res.Name)
+		}
+	}
+	return b.String()
+}
+
+// PreflightCheck 在启动前检查配置有效性、Modbus端口是否可用，以及（可选）Broker是否可达
+// 所有检查都会执行，调用方根据报告一次性看到全部问题
+func (s *AppService) PreflightCheck() *PreflightReport {
+	report := &PreflightReport{}
+	report.Results = append(report.Results, PreflightResult{Name: "config", Err: s.config.Validate()})
+	report.Results = append(report.Results, PreflightResult{Name: "modbus port", Err: checkModbusPort(&s.config.Modbus)})
+	if s.config.Preflight.CheckBroker {
+		report.Results = append(report.Results, PreflightResult{
+			Name: "mqtt broker",
+			Err:  checkBroker(s.config.Mqtt.Broker, s.config.Preflight.GetBrokerTimeout()),
+		})
+	}
+	return report
+}
+
+// checkModbusPort 检查TCP监听地址是否可以绑定，或RTU串口设备是否存在
+func checkModbusPort(cfg *config.ModbusConfig) error {
+	if cfg.Type == "RTU" {
+		if _, err := os.Stat(cfg.RTU.Port); err != nil {
+			return fmt.Errorf("serial port %s unavailable: %w", cfg.RTU.Port, err)
+		}
+		return nil
+	}
+
+	addr := net.JoinHostPort(cfg.TCP.Host, strconv.Itoa(cfg.TCP.Port))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot bind %s (port in use or insufficient permission): %w", addr, err)
+	}
+	return ln.Close()
+}
+
+// checkBroker 尝试与Broker建立TCP连接，只验证网络可达，不做MQTT握手
+func checkBroker(broker string, timeout time.Duration) error {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid broker address %q", broker)
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, timeout)
+	if err != nil {
+		return fmt.Errorf("broker %s unreachable: %w", u.Host, err)
+	}
+	return conn.Close()
+}
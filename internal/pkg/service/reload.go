@@ -0,0 +1,118 @@
+package service
+
+import (
+	"app-modbus-go/internal/pkg/config"
+	"app-modbus-go/internal/pkg/mqtt"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Reload 重新加载配置文件，按与当前配置的差异只重新初始化受影响的子系统
+// 不支持热重载的配置项保持原值并记录警告，重启服务后生效
+func (s *AppService) Reload() (*config.ReloadPlan, error) {
+	cfg, err := config.LoadConfig(s.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("config reload failed: %w", err)
+	}
+
+	plan := config.DiffConfig(s.config, cfg)
+	s.lc.Info(fmt.Sprintf("Config reload plan: %s", plan))
+	if len(plan.RestartRequired) > 0 {
+		s.lc.Warn(fmt.Sprintf("Config changes in %s take effect after restart", strings.Join(plan.RestartRequired, ", ")))
+	}
+	return plan, s.applyReload(cfg, plan)
+}
+
+// applyReload 将新配置中计划内子系统的部分在 configMu 下写入当前配置，并用这些部分的副本重新初始化子系统
+// 组件在创建时取得各部分的副本，重载时传入新副本而不是原地修改组件正在读取的配置
+func (s *AppService) applyReload(cfg *config.AppConfig, plan *config.ReloadPlan) error {
+	var errs []error
+
+	if plan.Has(config.SubsystemLogger) {
+		if err := s.lc.SetLogLevel(cfg.Writable.LogLevel); err != nil {
+			errs = append(errs, fmt.Errorf("logger: %w", err))
+		} else {
+			s.configMu.Lock()
+			s.config.Writable.LogLevel = cfg.Writable.LogLevel
+			s.configMu.Unlock()
+			s.lc.Info(fmt.Sprintf("Log level set to %s", cfg.Writable.LogLevel))
+		}
+	}
+
+	if plan.Has(config.SubsystemCache) {
+		s.configMu.Lock()
+		cleanupInterval := s.config.Cache.CleanupInterval
+		s.config.Cache = cfg.Cache
+		s.config.Cache.CleanupInterval = cleanupInterval
+		cacheConfig := s.config.Cache
+		s.configMu.Unlock()
+		for _, nodeID := range s.config.GetNodeIDs() {
+			s.nodes[nodeID].mapManage.ApplyCacheConfig(&cacheConfig)
+		}
+		s.lc.Info("Cache settings reloaded")
+	}
+
+	// 重新连接会停止心跳，因此MQTT变化时心跳随之重启
+	if plan.Has(config.SubsystemHeartbeat) {
+		s.configMu.Lock()
+		s.config.Heartbeat = cfg.Heartbeat
+		s.configMu.Unlock()
+	}
+	if plan.Has(config.SubsystemMQTT) {
+		s.configMu.Lock()
+		deadLetter := s.config.Mqtt.DeadLetter
+		s.config.Mqtt = cfg.Mqtt
+		s.config.Mqtt.DeadLetter = deadLetter
+		clientConfigs := make(map[string]mqtt.ClientConfig)
+		for _, nodeID := range s.config.GetNodeIDs() {
+			clientConfigs[nodeID] = mqttClientConfig(s.config, nodeID)
+		}
+		s.configMu.Unlock()
+		for _, nodeID := range s.config.GetNodeIDs() {
+			n := s.nodes[nodeID]
+			n.mapManage.SetSensorDataAck(cfg.Mqtt.SensorDataAck)
+			if err := n.mqttClient.Reconnect(clientConfigs[nodeID]); err != nil {
+				errs = append(errs, fmt.Errorf("mqtt node %s: %w", nodeID, err))
+				continue
+			}
+			s.startHeartbeat(n.mqttClient)
+		}
+		s.lc.Info("MQTT clients reconnected with reloaded config")
+	} else if plan.Has(config.SubsystemHeartbeat) {
+		for _, nodeID := range s.config.GetNodeIDs() {
+			n := s.nodes[nodeID]
+			n.mqttClient.StopHeartbeat()
+			s.startHeartbeat(n.mqttClient)
+		}
+	}
+
+	if plan.Has(config.SubsystemModbus) {
+		if err := s.reloadModbus(cfg); err != nil {
+			errs = append(errs, fmt.Errorf("modbus: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// reloadModbus 停止Modbus服务器，应用新配置（地址偏移和节点单元标识符除外）后重新启动监听
+func (s *AppService) reloadModbus(cfg *config.AppConfig) error {
+	if err := s.mdbsServer.Stop(); err != nil {
+		return err
+	}
+	s.configMu.Lock()
+	offsets, unitIDs := s.config.Modbus.AddressOffsets, s.config.Modbus.NodeUnitIDs
+	s.config.Modbus = cfg.Modbus
+	s.config.Modbus.AddressOffsets, s.config.Modbus.NodeUnitIDs = offsets, unitIDs
+	modbusConfig := s.config.Modbus
+	s.configMu.Unlock()
+	if err := s.mdbsServer.Reconfigure(&modbusConfig); err != nil {
+		return err
+	}
+	if err := s.mdbsServer.Start(s.ctx); err != nil {
+		return err
+	}
+	s.lc.Info("Modbus server restarted with reloaded config")
+	return nil
+}
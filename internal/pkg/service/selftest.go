@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// startSelfTest 按配置间隔定期执行缓存转换自检，未配置间隔时不启用
+func (s *AppService) startSelfTest() {
+	interval := s.config.SelfTest.GetInterval()
+	if interval <= 0 {
+		return
+	}
+	sampleSize := s.config.SelfTest.SampleSize
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.runSelfTest(sampleSize)
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+	s.lc.Info(fmt.Sprintf("Cache conversion self-test started (interval=%s, sample=%d)", interval, sampleSize))
+}
+
+// runSelfTest 抽样缓存条目，转换为寄存器字节再解码，返回往返结果不一致的条目数
+func (s *AppService) runSelfTest(sampleSize int) int {
+	reader := s.mdbsServer.Reader()
+	checked, mismatches := 0, 0
+	// map遍历顺序随机，每次自检覆盖不同的条目
+	for addr, data := range s.mapManage.GetAllCachedValues() {
+		if checked >= sampleSize {
+			break
+		}
+		checked++
+		if err := reader.VerifyRoundTrip(data); err != nil {
+			mismatches++
+			s.lc.Warn(fmt.Sprintf("Self-test mismatch at address %d (%s/%s): %s",
+				addr, data.NorthDevName, data.ResourceName, err.Error()))
+		}
+	}
+
+	if mismatches > 0 {
+		s.selfTestFailures.Add(uint64(mismatches))
+	}
+	s.lc.Debug(fmt.Sprintf("Self-test checked %d cache entries, %d mismatches", checked, mismatches))
+	return mismatches
+}
+
+// SelfTestFailures 返回自检累计发现的不一致次数
+func (s *AppService) SelfTestFailures() uint64 {
+	return s.selfTestFailures.Load()
+}
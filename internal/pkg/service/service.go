@@ -3,6 +3,7 @@ package service
 import (
 	"app-modbus-go/internal/pkg/config"
 	"app-modbus-go/internal/pkg/forwardlog"
+	"app-modbus-go/internal/pkg/httpserver"
 	"app-modbus-go/internal/pkg/logger"
 	"app-modbus-go/internal/pkg/mappingmanager"
 	"app-modbus-go/internal/pkg/modbusserver"
@@ -12,8 +13,12 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 // AppService 是主应用服务
@@ -27,13 +32,34 @@ type AppService struct {
 	mapManage     *mappingmanager.MappingManager
 	mdbsServer    *modbusserver.ModbusServer
 	forwardLogMgr *forwardlog.Manager
+	httpServer    *httpserver.Server
 	config        *config.AppConfig
+	configMu      sync.RWMutex // 保护 applyReload 更新的配置部分，组件持有各部分的副本
+
+	nodes map[string]*nodeClient // 节点ID -> 节点的MQTT客户端、映射管理器和前向日志，包含主节点
 
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
+
+	selfTestFailures atomic.Uint64 // 自检发现的往返转换不一致次数
+
+	commandHandlers map[string]CommandHandler // 按CmdType注册的命令处理程序，优先于内置的GET/PUT
+	commandMu       sync.RWMutex
+	commandDedup    *commandDedup // 按requestId去除重复投递的命令
 }
 
+// nodeClient 是一个节点的MQTT客户端、只接收该节点数据的映射管理器和该节点的前向日志管理器
+type nodeClient struct {
+	mqttClient    *mqtt.ClientManager
+	mapManage     *mappingmanager.MappingManager
+	forwardLogMgr *forwardlog.Manager
+	commands      *commandQueue // 按到达顺序执行该节点的type=6命令，registerNodeHandlers 时创建
+}
+
+// CommandHandler 处理一种CmdType的type=6命令并返回响应负载
+type CommandHandler func(payload *mqtt.CommandPayload) *mqtt.CommandResponsePayload
+
 // NewAppService 创建新的应用服务
 func NewAppService(name string, version string) (AppServiceInterface, error) {
 	if name == "" {
@@ -44,11 +70,27 @@ func NewAppService(name string, version string) (AppServiceInterface, error) {
 	}
 
 	return &AppService{
-		appName: name,
-		version: version,
+		appName:         name,
+		version:         version,
+		commandDedup:    newCommandDedup(),
+		commandHandlers: make(map[string]CommandHandler),
 	}, nil
 }
 
+// RegisterCommandHandler 为CmdType注册命令处理程序，已存在时替换（包括内置的GET/PUT）
+func (s *AppService) RegisterCommandHandler(cmdType string, handler CommandHandler) error {
+	if cmdType == "" {
+		return errors.New("command type cannot be empty")
+	}
+	if handler == nil {
+		return fmt.Errorf("command handler for %s cannot be nil", cmdType)
+	}
+	s.commandMu.Lock()
+	defer s.commandMu.Unlock()
+	s.commandHandlers[cmdType] = handler
+	return nil
+}
+
 // Initialize 使用配置初始化服务
 func (s *AppService) Initialize(configPath string) error {
 	s.configPath = configPath
@@ -66,39 +108,50 @@ func (s *AppService) Initialize(configPath string) error {
 	}
 	s.config = cfg
 
-	// 从配置更新日志级别
+	// 按配置重建记录器(日志级别、source查找)
 	if err := s.lc.SetLogLevel(cfg.Writable.LogLevel); err != nil {
 		s.lc.Warn("Failed to set log level:", err.Error())
 	}
+	s.lc = logger.NewClientWithConfig(logger.LoggerConfig{
+		LogLevel:        s.lc.LogLevel(),
+		EnableConsole:   true,
+		DisableCaller:   cfg.Writable.LogCallerDisabled,
+		SourcePathDepth: cfg.Writable.LogSourceDepth,
+	})
+
+	// 启动前自检，一次性报告所有问题
+	report := s.PreflightCheck()
+	if report.Failed() {
+		return fmt.Errorf("preflight check failed:\n%s", report)
+	}
+	s.lc.Debug("Preflight check passed:\n" + report.String())
 
 	// 创建上下文
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 
 	// 创建MQTT客户端管理器
-	s.mqttClient = mqtt.NewClientManager(
-		cfg.NodeID,
-		mqtt.ClientConfig{
-			Broker:    cfg.Mqtt.Broker,
-			ClientID:  cfg.Mqtt.ClientID,
-			Username:  cfg.Mqtt.Username,
-			Password:  cfg.Mqtt.Password,
-			QoS:       byte(cfg.Mqtt.QoS),
-			KeepAlive: cfg.Mqtt.KeepAlive,
-		},
-		s.lc,
-	)
+	s.mqttClient = mqtt.NewClientManager(cfg.NodeID, mqttClientConfig(cfg, cfg.NodeID), s.lc)
 
 	// 创建映射管理器
-	s.mapManage = mappingmanager.NewMappingManager(s.mqttClient, s.lc, &cfg.Cache)
-
-	// 创建前向日志管理器
-	s.forwardLogMgr = forwardlog.NewManager(s.mqttClient, s.lc)
+	s.mapManage = s.newMappingManager(s.mqttClient)
+	s.restoreSnapshot(cfg.NodeID, s.mapManage)
 
-	// 将前向日志管理器设置到映射管理器
+	// 创建前向日志管理器，并设置到映射管理器
+	s.forwardLogMgr = s.newForwardLogManager(s.mqttClient)
 	s.mapManage.SetForwardLogHandler(s.forwardLogMgr)
 
 	// 创建Modbus服务器
-	s.mdbsServer = modbusserver.NewModbusServer(&cfg.Modbus, s.mapManage, s.lc)
+	s.mdbsServer = s.newModbusServer(s.primaryNode())
+	s.mqttClient.SetCapabilities(s.mdbsServer.Capabilities)
+
+	// 额外节点各自使用独立的MQTT客户端、映射管理器和前向日志，由同一Modbus服务器按单元标识符服务
+	s.initNodes()
+
+	// 创建HTTP服务器
+	s.httpServer = httpserver.NewServer(&cfg.Service, s.mapManage, s.lc)
+	s.httpServer.SetBitReader(s.mdbsServer.Reader())
+	s.httpServer.SetForwardLogStats(s.forwardLogMgr)
+	s.httpServer.SetHeartbeatStats(s.mqttClient)
 
 	s.lc.Info("Service initialized successfully")
 	return nil
@@ -109,20 +162,12 @@ func (s *AppService) Run() error {
 	s.lc.Info("Starting service:", s.appName)
 
 	// 连接MQTT
-	mqttCfg := mqtt.ClientConfig{
-		Broker:    s.config.Mqtt.Broker,
-		ClientID:  s.config.Mqtt.ClientID,
-		Username:  s.config.Mqtt.Username,
-		Password:  s.config.Mqtt.Password,
-		QoS:       byte(s.config.Mqtt.QoS),
-		KeepAlive: s.config.Mqtt.KeepAlive,
-	}
-	if err := s.mqttClient.Connect(mqttCfg); err != nil {
+	if err := s.mqttClient.Connect(mqttClientConfig(s.config, s.config.NodeID)); err != nil {
 		return fmt.Errorf("MQTT connect failed: %w", err)
 	}
 
 	// 注册消息处理程序
-	s.registerMQTTHandlers()
+	s.registerNodeHandlers(s.primaryNode())
 
 	// 订阅主题
 	if err := s.mqttClient.Subscribe(); err != nil {
@@ -136,19 +181,37 @@ func (s *AppService) Run() error {
 	}
 
 	// 启动心跳
-	s.mqttClient.StartHeartbeat(s.config.Heartbeat.GetInterval())
+	s.startHeartbeat(s.mqttClient)
 
 	// 启动缓存清理
 	s.mapManage.StartCleanup()
 
+	// 启动额外节点
+	if err := s.startNodes(); err != nil {
+		return err
+	}
+
 	// 启动前向日志管理器
 	s.forwardLogMgr.Start()
 
+	// 探测字节/字顺序，失败时沿用默认顺序
+	if err := s.mdbsServer.ProbeOrder(s.ctx); err != nil {
+		s.lc.Warn("Byte/word order probe failed, keeping the default order:", err.Error())
+	}
+
 	// 启动Modbus服务器
 	if err := s.mdbsServer.Start(s.ctx); err != nil {
 		return fmt.Errorf("Modbus server start failed: %w", err)
 	}
 
+	// 启动HTTP服务器
+	if err := s.httpServer.Start(); err != nil {
+		return fmt.Errorf("HTTP server start failed: %w", err)
+	}
+
+	// 启动缓存转换自检
+	s.startSelfTest()
+
 	s.lc.Info("Service started successfully")
 
 	// 等待关闭信号
@@ -157,10 +220,138 @@ func (s *AppService) Run() error {
 	return nil
 }
 
-// registerMQTTHandlers 注册所有MQTT消息处理程序
-func (s *AppService) registerMQTTHandlers() {
+// mqttClientConfig 返回节点的MQTT客户端配置
+// 额外节点的ClientID追加节点ID后缀，避免与主节点的连接互相踢下线
+func mqttClientConfig(cfg *config.AppConfig, nodeID string) mqtt.ClientConfig {
+	clientID := cfg.Mqtt.ClientID
+	if nodeID != cfg.NodeID {
+		clientID = fmt.Sprintf("%s-%s", clientID, nodeID)
+	}
+	return mqtt.ClientConfig{
+		Broker:    cfg.Mqtt.Broker,
+		ClientID:  clientID,
+		Username:  cfg.Mqtt.Username,
+		Password:  cfg.Mqtt.Password,
+		QoS:       byte(cfg.Mqtt.QoS),
+		KeepAlive: cfg.Mqtt.KeepAlive,
+		TLS: mqtt.TLSConfig{
+			CAFile:   cfg.Mqtt.TLS.CAFile,
+			CertFile: cfg.Mqtt.TLS.CertFile,
+			KeyFile:  cfg.Mqtt.TLS.KeyFile,
+		},
+		SharedGroup:        cfg.Mqtt.SharedSubscription.GetGroup(),
+		MaxPendingRequests: cfg.Mqtt.MaxPendingRequests,
+		PersistentSession:  !cfg.Mqtt.GetCleanSession(),
+		ReconnectJitter:    cfg.Mqtt.GetReconnectJitter(),
+		SequenceField:      cfg.Mqtt.SequenceField,
+		CommandQoS:         byte(cfg.Mqtt.CommandQoS),
+	}
+}
+
+// newMappingManager 按配置创建使用client查询数据中心的映射管理器
+func (s *AppService) newMappingManager(client *mqtt.ClientManager) *mappingmanager.MappingManager {
+	cacheConfig, offsets := s.config.Cache, s.config.Modbus.AddressOffsets
+	mm := mappingmanager.NewMappingManager(client, s.lc, &cacheConfig)
+	mm.SetMaxMappings(s.config.Mapping.MaxMappings)
+	mm.SetAddressOffsets(&offsets)
+	mm.SetSensorDataAck(s.config.Mqtt.SensorDataAck)
+	mm.SetStrictSensorKeys(s.config.Mapping.StrictSensorKeys)
+	mm.SetSkipUnknownValueTypes(s.config.Mapping.SkipUnknownValueTypes)
+	mm.SetRequeryFunc(client.PublishDataQuery)
+	return mm
+}
+
+// newForwardLogManager 按配置创建通过client上报的前向日志管理器
+func (s *AppService) newForwardLogManager(client *mqtt.ClientManager) *forwardlog.Manager {
+	m := forwardlog.NewManager(client, s.lc)
+	m.SetMaxQueueSize(s.config.Service.ForwardLogMaxQueueSize)
+	m.SetSignificantFigures(s.config.Service.ForwardLogSignificantFigures)
+	return m
+}
+
+// newModbusServer 创建服务节点映射的Modbus服务器，写入经该节点的客户端下发，转换失败计入该节点的前向日志
+func (s *AppService) newModbusServer(n *nodeClient) *modbusserver.ModbusServer {
+	modbusConfig := s.config.Modbus
+	server := modbusserver.NewModbusServer(&modbusConfig, n.mapManage, s.lc)
+	server.SetConnectionChecker(n.mqttClient)
+	server.SetWritePublisher(n.mqttClient)
+	server.SetConversionErrorReporter(n.forwardLogMgr)
+	return server
+}
+
+// primaryNode 返回主节点的客户端、映射管理器和前向日志管理器
+func (s *AppService) primaryNode() *nodeClient {
+	return &nodeClient{mqttClient: s.mqttClient, mapManage: s.mapManage, forwardLogMgr: s.forwardLogMgr}
+}
+
+// initNodes 以主节点为首项，为每个额外节点创建客户端、映射管理器和前向日志管理器并恢复其缓存快照
+// Modbus服务器已创建时，把配置了单元标识符的额外节点作为单元加入，发往该单元的请求读写该节点的映射
+func (s *AppService) initNodes() {
+	s.nodes = map[string]*nodeClient{s.config.NodeID: s.primaryNode()}
+	for _, nodeID := range s.config.NodeIDs {
+		client := mqtt.NewClientManager(nodeID, mqttClientConfig(s.config, nodeID), s.lc)
+		n := &nodeClient{mqttClient: client, mapManage: s.newMappingManager(client), forwardLogMgr: s.newForwardLogManager(client)}
+		n.mapManage.SetForwardLogHandler(n.forwardLogMgr)
+		s.restoreSnapshot(nodeID, n.mapManage)
+		s.nodes[nodeID] = n
+
+		if s.mdbsServer == nil {
+			continue
+		}
+		unitID, ok := s.config.Modbus.NodeUnitIDs[nodeID]
+		if !ok {
+			s.lc.Warn(fmt.Sprintf("Node %s has no Modbus NodeUnitIDs entry, its data is not served over Modbus", nodeID))
+			continue
+		}
+		s.mdbsServer.AddUnit(unitID, s.newModbusServer(n))
+		s.lc.Info(fmt.Sprintf("Node %s served on Modbus unit ID %d", nodeID, unitID))
+	}
+
+	// 所有节点的无法解析消息写入同一个死信文件
+	if dl := s.config.Mqtt.DeadLetter; dl.File != "" {
+		sink := mqtt.NewFileDeadLetter(dl.File, dl.MaxPayloadBytes, dl.MaxFileBytes)
+		for _, n := range s.nodes {
+			n.mqttClient.SetDeadLetterHandler(sink.Write)
+		}
+		s.lc.Info(fmt.Sprintf("Capturing unparseable MQTT messages to %s", dl.File))
+	}
+}
+
+// startNodes 连接并订阅额外节点，查询其设备属性并启动心跳、缓存清理和前向日志
+func (s *AppService) startNodes() error {
+	for _, nodeID := range s.config.NodeIDs {
+		n := s.nodes[nodeID]
+		if err := n.mqttClient.Connect(mqttClientConfig(s.config, nodeID)); err != nil {
+			return fmt.Errorf("MQTT connect failed for node %s: %w", nodeID, err)
+		}
+		s.registerNodeHandlers(n)
+		if err := n.mqttClient.Subscribe(); err != nil {
+			return fmt.Errorf("MQTT subscribe failed for node %s: %w", nodeID, err)
+		}
+		if err := n.mapManage.QueryDeviceAttributes(); err != nil {
+			s.lc.Warn(fmt.Sprintf("Failed to query device attributes for node %s: %s", nodeID, err.Error()))
+		}
+		s.startHeartbeat(n.mqttClient)
+		n.mapManage.StartCleanup()
+		n.forwardLogMgr.Start()
+		s.lc.Info(fmt.Sprintf("Node %s started", nodeID))
+	}
+	return nil
+}
+
+// startHeartbeat 按心跳配置（包括重连宽限期）启动客户端的心跳
+func (s *AppService) startHeartbeat(client *mqtt.ClientManager) {
+	s.configMu.RLock()
+	heartbeat := s.config.Heartbeat
+	s.configMu.RUnlock()
+	client.SetHeartbeatGrace(heartbeat.GetReconnectGrace())
+	client.StartHeartbeat(heartbeat.GetInterval(), heartbeat.GetInitialDelay())
+}
+
+// registerNodeHandlers 注册节点的心跳、属性推送、传感器数据和命令处理程序，数据只进入该节点的映射管理器
+func (s *AppService) registerNodeHandlers(n *nodeClient) {
 	// Type 1: 心跳响应
-	s.mqttClient.RegisterResponseHandler(mqtt.TypeHeartbeat, func(resp *mqtt.MQTTResponse) error {
+	n.mqttClient.RegisterResponseHandler(mqtt.TypeHeartbeat, func(resp *mqtt.MQTTResponse) error {
 		s.lc.Debug("Heartbeat response received")
 		return nil
 	})
@@ -168,23 +359,26 @@ func (s *AppService) registerMQTTHandlers() {
 	// Type 2: 查询设备响应由PublishAndWait处理
 
 	// Type 3: 设备属性推送
-	s.mqttClient.RegisterMessageHandler(mqtt.TypeDeviceAttributePush, func(msg *mqtt.MQTTMessage) error {
-		return s.mapManage.HandleAttributeUpdate(msg)
+	n.mqttClient.RegisterMessageHandler(mqtt.TypeDeviceAttributePush, func(msg *mqtt.MQTTMessage) error {
+		return n.mapManage.HandleAttributeUpdate(msg)
 	})
 
 	// Type 4: 传感器数据
-	s.mqttClient.RegisterMessageHandler(mqtt.TypeSensorData, func(msg *mqtt.MQTTMessage) error {
-		return s.mapManage.HandleSensorData(msg)
+	n.mqttClient.RegisterMessageHandler(mqtt.TypeSensorData, func(msg *mqtt.MQTTMessage) error {
+		return n.mapManage.HandleSensorData(msg)
 	})
 
-	// Type 6: 命令
-	s.mqttClient.RegisterMessageHandler(mqtt.TypeCommand, func(msg *mqtt.MQTTMessage) error {
-		return s.handleCommand(msg)
+	// Type 6: 命令，GET/PUT基于该节点的映射，响应经该节点的客户端发布
+	n.commands = newCommandQueue()
+	n.mqttClient.RegisterMessageHandler(mqtt.TypeCommand, func(msg *mqtt.MQTTMessage) error {
+		return s.handleCommand(n, msg)
 	})
 }
 
-// handleCommand 处理type=6命令消息
-func (s *AppService) handleCommand(msg *mqtt.MQTTMessage) error {
+// handleCommand 处理节点n收到的type=6命令消息
+// 命令在节点的命令队列中按到达顺序执行并发布响应：PUT写入确认要等待同一连接上的下一条传感器数据，
+// 在消息回调中等待会阻塞该数据的处理，使确认必然超时
+func (s *AppService) handleCommand(n *nodeClient, msg *mqtt.MQTTMessage) error {
 	payload, err := msg.GetCommandPayload()
 	if err != nil {
 		return err
@@ -193,31 +387,122 @@ func (s *AppService) handleCommand(msg *mqtt.MQTTMessage) error {
 	s.lc.Debug(fmt.Sprintf("Received command: type=%s, device=%s, resource=%s",
 		payload.CmdType, payload.CmdContent.NorthDeviceName, payload.CmdContent.NorthResourceName))
 
-	var respPayload *mqtt.CommandResponsePayload
+	// 重复投递的命令不再执行，已有响应时重发以便数据中心收到结果
+	dedup := msg.RequestID != "" && s.commandDedupWindow() > 0
+	if dedup {
+		if resp, duplicate := s.commandDedup.begin(msg.RequestID, s.commandDedupWindow()); duplicate {
+			s.lc.Warn(fmt.Sprintf("Duplicate command requestId=%s ignored", msg.RequestID))
+			if resp != nil {
+				s.queueCommand(n, func() *mqtt.MQTTResponse { return resp })
+			}
+			return nil
+		}
+	}
+
+	s.queueCommand(n, func() *mqtt.MQTTResponse {
+		respPayload := s.dispatchCommand(n, payload)
+		resp := mqtt.NewResponse(msg.RequestID, mqtt.TypeCommand, 200, "success", respPayload)
+		if dedup {
+			s.commandDedup.finish(msg.RequestID, resp)
+		}
+		return resp
+	})
+	return nil
+}
+
+// queueCommand 把命令放入节点n的命令队列，在队列的goroutine中取得命令响应并经节点的客户端发布，
+// 发布的重试等待也不会阻塞MQTT消息处理。发布失败已在 publishCommandResponse 中记录
+func (s *AppService) queueCommand(n *nodeClient, run func() *mqtt.MQTTResponse) {
+	var done <-chan struct{}
+	if s.ctx != nil {
+		done = s.ctx.Done()
+	}
+	if !n.commands.enqueue(&s.wg, done, func() { _ = s.publishCommandResponse(n.mqttClient, run()) }) {
+		s.lc.Warn("Service is stopping, command dropped")
+	}
+}
+
+// commandDedupWindow 返回命令去重窗口，未初始化配置时使用默认值
+func (s *AppService) commandDedupWindow() time.Duration {
+	if s.config == nil {
+		return config.DefaultCommandDedupWindow
+	}
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config.Mqtt.GetCommandDedupWindow()
+}
+
+// publishCommandResponse 经client发布命令响应，失败时按指数退避重试，全部失败后记录错误
+// 响应丢失时数据中心无法得知命令结果，因此值得等待重试；调用方在命令的goroutine中执行，不阻塞消息处理
+func (s *AppService) publishCommandResponse(client *mqtt.ClientManager, resp *mqtt.MQTTResponse) error {
+	retries := 0
+	delay := config.DefaultResponseRetryDelay
+	if s.config != nil {
+		s.configMu.RLock()
+		retries = s.config.Mqtt.GetResponseRetries()
+		delay = s.config.Mqtt.GetResponseRetryDelay()
+		s.configMu.RUnlock()
+	}
+
+	err := client.PublishResponse(resp)
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		s.lc.Warn(fmt.Sprintf("Failed to publish command response requestId=%s (retry %d/%d in %s): %s",
+			resp.RequestID, attempt, retries, delay, err.Error()))
+		if !s.sleep(delay) {
+			break
+		}
+		delay *= 2
+		err = client.PublishResponse(resp)
+	}
+	if err != nil {
+		s.lc.Error(fmt.Sprintf("Giving up publishing command response requestId=%s: %s", resp.RequestID, err.Error()))
+		return fmt.Errorf("publish command response: %w", err)
+	}
+	return nil
+}
 
+// sleep 等待d，服务停止时提前返回false
+func (s *AppService) sleep(d time.Duration) bool {
+	if s.ctx == nil {
+		time.Sleep(d)
+		return true
+	}
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// dispatchCommand 按CmdType调用已注册的处理程序，未注册时GET/PUT由内置处理程序基于节点n的映射处理，其他类型返回400
+func (s *AppService) dispatchCommand(n *nodeClient, payload *mqtt.CommandPayload) *mqtt.CommandResponsePayload {
+	s.commandMu.RLock()
+	handler, ok := s.commandHandlers[payload.CmdType]
+	s.commandMu.RUnlock()
+	if ok {
+		return handler(payload)
+	}
 	switch payload.CmdType {
 	case "GET":
-		respPayload = s.handleGetCommand(payload)
+		return s.handleGetCommand(n, payload)
 	case "PUT":
-		respPayload = s.handlePutCommand(payload)
-	default:
-		respPayload = &mqtt.CommandResponsePayload{
-			CmdType:    payload.CmdType,
-			StatusCode: 400,
-			CmdContent: mqtt.CommandResponseContent{
-				NorthDeviceName:   payload.CmdContent.NorthDeviceName,
-				NorthResourceName: payload.CmdContent.NorthResourceName,
-			},
-		}
+		return s.handlePutCommand(n, payload)
 	}
 
-	resp := mqtt.NewResponse(msg.RequestID, mqtt.TypeCommand, 200, "success", respPayload)
-	return s.mqttClient.PublishResponse(resp)
+	return &mqtt.CommandResponsePayload{
+		CmdType:    payload.CmdType,
+		StatusCode: 400,
+		CmdContent: mqtt.CommandResponseContent{
+			NorthDeviceName:   payload.CmdContent.NorthDeviceName,
+			NorthResourceName: payload.CmdContent.NorthResourceName,
+		},
+	}
 }
 
-// handleGetCommand 处理GET命令
-func (s *AppService) handleGetCommand(payload *mqtt.CommandPayload) *mqtt.CommandResponsePayload {
-	dm, ok := s.mapManage.GetDeviceMapping(payload.CmdContent.NorthDeviceName)
+// handleGetCommand 按节点n的映射和缓存处理GET命令
+func (s *AppService) handleGetCommand(n *nodeClient, payload *mqtt.CommandPayload) *mqtt.CommandResponsePayload {
+	dm, ok := n.mapManage.GetDeviceMapping(payload.CmdContent.NorthDeviceName)
 	if !ok {
 		return &mqtt.CommandResponsePayload{
 			CmdType:    "GET",
@@ -232,8 +517,11 @@ func (s *AppService) handleGetCommand(payload *mqtt.CommandPayload) *mqtt.Comman
 	// 查找资源及其Modbus地址
 	for _, rm := range dm.Resources {
 		if rm.NorthResource != nil && rm.NorthResource.Name == payload.CmdContent.NorthResourceName {
-			addr := rm.NorthResource.OtherParameters.Modbus.Address
-			cachedData, ok := s.mapManage.GetCachedValue(addr)
+			var cachedData *mappingmanager.CachedData
+			addr, ok := n.mapManage.GetAddressByResource(dm.NorthDeviceName, rm.NorthResource.Name)
+			if ok {
+				cachedData, ok = n.mapManage.GetCachedValue(addr)
+			}
 			if !ok {
 				return &mqtt.CommandResponsePayload{
 					CmdType:    "GET",
@@ -245,13 +533,15 @@ func (s *AppService) handleGetCommand(payload *mqtt.CommandPayload) *mqtt.Comman
 				}
 			}
 
+			precision := mappingmanager.ResolvePrecision(cachedData.Precision, s.floatPrecision())
 			return &mqtt.CommandResponsePayload{
 				CmdType:    "GET",
 				StatusCode: 200,
 				CmdContent: mqtt.CommandResponseContent{
 					NorthDeviceName:    payload.CmdContent.NorthDeviceName,
 					NorthResourceName:  payload.CmdContent.NorthResourceName,
-					NorthResourceValue: fmt.Sprintf("%v", cachedData.Value),
+					NorthResourceValue: mappingmanager.FormatValue(cachedData.Value, precision),
+					NorthResourceUnit:  cachedData.Unit,
 				},
 			}
 		}
@@ -267,18 +557,37 @@ func (s *AppService) handleGetCommand(payload *mqtt.CommandPayload) *mqtt.Comman
 	}
 }
 
-// handlePutCommand 处理PUT命令
-func (s *AppService) handlePutCommand(payload *mqtt.CommandPayload) *mqtt.CommandResponsePayload {
-	// 现在只是确认PUT命令
-	// 在完整的实现中,这会通过MQTT向设备写入
-	s.lc.Info(fmt.Sprintf("PUT command: %s/%s = %s",
-		payload.CmdContent.NorthDeviceName,
-		payload.CmdContent.NorthResourceName,
-		payload.CmdContent.NorthResourceValue))
+// floatPrecision 返回全局配置的浮点小数位数，未加载配置时为nil
+func (s *AppService) floatPrecision() *int {
+	if s.config == nil {
+		return nil
+	}
+	return s.config.Service.FloatPrecision
+}
+
+// handlePutCommand 处理节点n收到的PUT命令
+// 配置了 WriteConfirmTimeout 时，等待该资源在节点n的下一次传感器数据并与写入值比较后再回复
+func (s *AppService) handlePutCommand(n *nodeClient, payload *mqtt.CommandPayload) *mqtt.CommandResponsePayload {
+	statusCode := 200
+	if timeout := s.writeConfirmTimeout(); timeout > 0 {
+		addr, ok := n.mapManage.GetAddressByResource(payload.CmdContent.NorthDeviceName, payload.CmdContent.NorthResourceName)
+		if !ok {
+			statusCode = 404
+		} else {
+			// 先订阅再下发，避免错过确认更新
+			sub := n.mapManage.Subscribe(addr)
+			defer n.mapManage.Unsubscribe(addr, sub)
+			s.logPutCommand(payload)
+			statusCode = s.confirmWrite(payload, sub, timeout)
+		}
+	} else {
+		s.logPutCommand(payload)
+	}
+	s.auditPutCommand(n, payload, statusCode)
 
 	return &mqtt.CommandResponsePayload{
 		CmdType:    "PUT",
-		StatusCode: 200,
+		StatusCode: statusCode,
 		CmdContent: mqtt.CommandResponseContent{
 			NorthDeviceName:    payload.CmdContent.NorthDeviceName,
 			NorthResourceName:  payload.CmdContent.NorthResourceName,
@@ -287,24 +596,101 @@ func (s *AppService) handlePutCommand(payload *mqtt.CommandPayload) *mqtt.Comman
 	}
 }
 
-// waitForShutdown 等待关闭信号
+// logPutCommand 记录PUT命令
+// 现在只是确认PUT命令，在完整的实现中,这会通过MQTT向设备写入
+func (s *AppService) logPutCommand(payload *mqtt.CommandPayload) {
+	s.lc.Info(fmt.Sprintf("PUT command: %s/%s = %s",
+		payload.CmdContent.NorthDeviceName,
+		payload.CmdContent.NorthResourceName,
+		payload.CmdContent.NorthResourceValue))
+}
+
+// auditPutCommand 将PUT命令作为来源为command的前向日志条目经节点n上报，记录数据中心下发了什么
+func (s *AppService) auditPutCommand(n *nodeClient, payload *mqtt.CommandPayload, statusCode int) {
+	if n.forwardLogMgr == nil {
+		return
+	}
+	n.forwardLogMgr.LogCommand(payload.CmdContent.NorthDeviceName, map[string]interface{}{
+		payload.CmdContent.NorthResourceName: payload.CmdContent.NorthResourceValue,
+	}, statusCode == 200)
+}
+
+// writeConfirmTolerance 是写入确认比较数值时允许的误差，吸收写入值与上报值之间的浮点表示差异
+const writeConfirmTolerance = 1e-9
+
+// confirmWrite 等待资源的下一次缓存更新并与写入值比较
+// 返回 200 表示已确认，409 表示设备上报的值与写入值不一致，504 表示超时未收到更新或服务正在停止
+func (s *AppService) confirmWrite(payload *mqtt.CommandPayload, sub <-chan mappingmanager.CachedData, timeout time.Duration) int {
+	device, resource, want := payload.CmdContent.NorthDeviceName, payload.CmdContent.NorthResourceName, payload.CmdContent.NorthResourceValue
+
+	var done <-chan struct{}
+	if s.ctx != nil {
+		done = s.ctx.Done()
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return 504
+	case update, ok := <-sub:
+		if !ok {
+			return 504
+		}
+		if !mappingmanager.ValuesEqual(update.Value, want, writeConfirmTolerance) {
+			s.lc.Warn(fmt.Sprintf("PUT %s/%s not confirmed: wrote %s, device reported %v", device, resource, want, update.Value))
+			return 409
+		}
+		s.lc.Info(fmt.Sprintf("PUT %s/%s = %s confirmed by sensor data", device, resource, want))
+		return 200
+	case <-timer.C:
+		s.lc.Warn(fmt.Sprintf("PUT %s/%s = %s not confirmed within %s", device, resource, want, timeout))
+		return 504
+	}
+}
+
+// writeConfirmTimeout 返回PUT写入确认超时，未加载配置时为0
+func (s *AppService) writeConfirmTimeout() time.Duration {
+	if s.config == nil {
+		return 0
+	}
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config.Mqtt.GetWriteConfirmTimeout()
+}
+
+// waitForShutdown 等待关闭信号，收到SIGHUP时重新加载配置
 func (s *AppService) waitForShutdown() {
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	sig := <-sigCh
-	s.lc.Info("Received signal:", sig.String())
-	s.Stop()
+	for sig := range sigCh {
+		if sig == syscall.SIGHUP {
+			s.lc.Info("Received SIGHUP, reloading config")
+			if _, err := s.Reload(); err != nil {
+				s.lc.Error("Config reload failed:", err.Error())
+			}
+			continue
+		}
+		s.lc.Info("Received signal:", sig.String())
+		s.Stop()
+		return
+	}
 }
 
 // Stop 停止服务
 func (s *AppService) Stop() error {
 	s.lc.Info("Stopping service:", s.appName)
 
-	// 取消上下文
+	// 取消上下文，并等待进行中的命令发布响应
 	if s.cancel != nil {
 		s.cancel()
 	}
+	s.wg.Wait()
+
+	// 停止HTTP服务器
+	if s.httpServer != nil {
+		s.httpServer.Stop()
+	}
 
 	// 停止Modbus服务器
 	if s.mdbsServer != nil {
@@ -316,11 +702,26 @@ func (s *AppService) Stop() error {
 		s.forwardLogMgr.Stop()
 	}
 
-	// 停止映射管理器
+	// 写入最终缓存快照并停止映射管理器
 	if s.mapManage != nil {
+		if s.config != nil {
+			s.saveSnapshot(s.config.NodeID, s.mapManage)
+		}
 		s.mapManage.Stop()
 	}
 
+	// 停止额外节点
+	if s.config != nil {
+		for _, nodeID := range s.config.NodeIDs {
+			if n, ok := s.nodes[nodeID]; ok {
+				n.forwardLogMgr.Stop()
+				s.saveSnapshot(nodeID, n.mapManage)
+				n.mapManage.Stop()
+				n.mqttClient.Disconnect()
+			}
+		}
+	}
+
 	// 断开MQTT连接
 	if s.mqttClient != nil {
 		s.mqttClient.Disconnect()
@@ -330,6 +731,68 @@ func (s *AppService) Stop() error {
 	return nil
 }
 
+// snapshotPath 返回节点的缓存快照文件路径，未配置快照时为空
+// 额外节点在主节点路径的扩展名前追加节点ID，例如 cache-node-b.json
+func (s *AppService) snapshotPath(nodeID string) string {
+	s.configMu.RLock()
+	path := s.config.Cache.SnapshotPath
+	s.configMu.RUnlock()
+	if path == "" || nodeID == s.config.NodeID {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, ext), nodeID, ext)
+}
+
+// restoreSnapshot 从节点的快照文件恢复mm的缓存（如果已配置且文件存在）
+func (s *AppService) restoreSnapshot(nodeID string, mm *mappingmanager.MappingManager) {
+	path := s.snapshotPath(nodeID)
+	if path == "" {
+		return
+	}
+
+	restored, err := mm.LoadSnapshot(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.lc.Warn(fmt.Sprintf("Failed to restore cache snapshot from %s: %s", path, err.Error()))
+		}
+		return
+	}
+	s.lc.Info(fmt.Sprintf("Restored %d cache entries from snapshot %s", restored, path))
+}
+
+// saveSnapshot 在超时时间内将mm的缓存写入节点的快照文件（如果已配置）
+func (s *AppService) saveSnapshot(nodeID string, mm *mappingmanager.MappingManager) {
+	path := s.snapshotPath(nodeID)
+	if path == "" {
+		return
+	}
+	s.configMu.RLock()
+	timeout := s.config.Cache.GetSnapshotTimeout()
+	s.configMu.RUnlock()
+
+	type result struct {
+		saved int
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		saved, err := mm.SaveSnapshot(path)
+		done <- result{saved, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			s.lc.Error(fmt.Sprintf("Failed to write cache snapshot to %s: %s", path, r.err.Error()))
+			return
+		}
+		s.lc.Info(fmt.Sprintf("Wrote %d cache entries to snapshot %s", r.saved, path))
+	case <-time.After(timeout):
+		s.lc.Error(fmt.Sprintf("Timed out after %v writing cache snapshot to %s", timeout, path))
+	}
+}
+
 // Getter methods (获取器方法)
 
 // GetLoggingClient 返回日志客户端
@@ -342,6 +805,15 @@ func (s *AppService) GetMappingManager() mappingmanager.MappingManagerInterface
 	return s.mapManage
 }
 
+// GetNodeMappingManager 返回指定节点的映射管理器
+func (s *AppService) GetNodeMappingManager(nodeID string) (mappingmanager.MappingManagerInterface, bool) {
+	n, ok := s.nodes[nodeID]
+	if !ok {
+		return nil, false
+	}
+	return n.mapManage, true
+}
+
 // GetModbusServer 返回Modbus服务器
 func (s *AppService) GetModbusServer() modbusserver.ModbusServerInterface {
 	return s.mdbsServer
@@ -357,6 +829,14 @@ func (s *AppService) GetForwardLogManager() *forwardlog.Manager {
 	return s.forwardLogMgr
 }
 
+// GetHTTPServer 返回HTTP服务器
+func (s *AppService) GetHTTPServer() httpserver.HTTPServerInterface {
+	if s.httpServer == nil {
+		return nil
+	}
+	return s.httpServer
+}
+
 // GetAppConfig 返回应用配置
 func (s *AppService) GetAppConfig() *config.AppConfig {
 	return s.config
@@ -1,10 +1,23 @@
 package service
 
 import (
+	"app-modbus-go/internal/pkg/config"
+	"app-modbus-go/internal/pkg/forwardlog"
 	"app-modbus-go/internal/pkg/logger"
+	"app-modbus-go/internal/pkg/mappingmanager"
+	"app-modbus-go/internal/pkg/modbusserver"
 	"app-modbus-go/internal/pkg/mqtt"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -82,6 +95,7 @@ func TestAppService_GettersBeforeInit(t *testing.T) {
 	assert.Nil(t, svc.GetModbusServer())
 	assert.Nil(t, svc.GetMQTTClient())
 	assert.Nil(t, svc.GetForwardLogManager())
+	assert.Nil(t, svc.GetHTTPServer())
 	assert.Nil(t, svc.GetAppConfig())
 	assert.Nil(t, svc.GetContext())
 }
@@ -139,7 +153,7 @@ func TestAppService_HandlePutCommand(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			resp := appSvc.handlePutCommand(tt.payload)
+			resp := appSvc.handlePutCommand(appSvc.primaryNode(), tt.payload)
 
 			assert.NotNil(t, resp)
 			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
@@ -150,3 +164,927 @@ func TestAppService_HandlePutCommand(t *testing.T) {
 		})
 	}
 }
+
+// TestAppService_HandleGetCommandUnit tests that the resource unit is returned in GET responses
+func TestAppService_HandleGetCommandUnit(t *testing.T) {
+	svc, err := NewAppService("test-service", "1.0.0")
+	assert.NoError(t, err)
+
+	appSvc := svc.(*AppService)
+	appSvc.lc = logger.NewClient("ERROR")
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, appSvc.lc)
+	appSvc.mapManage = mappingmanager.NewMappingManager(mqttClient, appSvc.lc, &config.CacheConfig{
+		DefaultTTL:      "30s",
+		CleanupInterval: "5m",
+	})
+
+	nr := &mqtt.NorthResource{Name: "temperature", ValueType: "float32", Unit: "°C"}
+	nr.OtherParameters.Modbus.Address = 100
+	assert.NoError(t, appSvc.mapManage.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature"}},
+			},
+		},
+	}))
+	assert.NoError(t, appSvc.mapManage.UpdateCache("device1", map[string]interface{}{"temperature": 21.5}))
+
+	payload := &mqtt.CommandPayload{CmdType: "GET"}
+	payload.CmdContent.NorthDeviceName = "device1"
+	payload.CmdContent.NorthResourceName = "temperature"
+
+	resp := appSvc.handleGetCommand(appSvc.primaryNode(), payload)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "21.5", resp.CmdContent.NorthResourceValue)
+	assert.Equal(t, "°C", resp.CmdContent.NorthResourceUnit)
+}
+
+// TestAppService_StopWritesSnapshot tests that Stop writes the current cache to the snapshot file
+func TestAppService_StopWritesSnapshot(t *testing.T) {
+	svc, err := NewAppService("test-service", "1.0.0")
+	assert.NoError(t, err)
+
+	appSvc := svc.(*AppService)
+	appSvc.lc = logger.NewClient("ERROR")
+	appSvc.config = config.DefaultConfig()
+	appSvc.config.Cache.SnapshotPath = filepath.Join(t.TempDir(), "cache.json")
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, appSvc.lc)
+	appSvc.mapManage = mappingmanager.NewMappingManager(mqttClient, appSvc.lc, &appSvc.config.Cache)
+
+	nr := &mqtt.NorthResource{Name: "temperature", ValueType: "float32"}
+	nr.OtherParameters.Modbus.Address = 100
+	assert.NoError(t, appSvc.mapManage.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature"}},
+			},
+		},
+	}))
+	assert.NoError(t, appSvc.mapManage.UpdateCache("device1", map[string]interface{}{"temperature": 21.5}))
+
+	assert.NoError(t, appSvc.Stop())
+
+	payload, err := os.ReadFile(appSvc.config.Cache.SnapshotPath)
+	assert.NoError(t, err)
+
+	var entries map[uint16]*mappingmanager.CachedData
+	assert.NoError(t, json.Unmarshal(payload, &entries))
+	assert.Len(t, entries, 1)
+	if assert.Contains(t, entries, uint16(100)) {
+		assert.Equal(t, 21.5, entries[100].Value)
+		assert.Equal(t, "temperature", entries[100].ResourceName)
+	}
+}
+
+// TestAppService_HandleGetCommandPrecision tests that GET renders floats with the configured decimals
+func TestAppService_HandleGetCommandPrecision(t *testing.T) {
+	two, four := 2, 4
+
+	tests := []struct {
+		name      string
+		global    *int
+		resource  *int
+		value     float64
+		wantValue string
+	}{
+		{"unconfigured", nil, nil, 21.456789, "21.456789"},
+		{"no scientific notation", nil, nil, 0.0000001, "0.0000001"},
+		{"global precision", &two, nil, 21.456789, "21.46"},
+		{"resource overrides global", &two, &four, 21.456789, "21.4568"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := NewAppService("test-service", "1.0.0")
+			assert.NoError(t, err)
+
+			appSvc := svc.(*AppService)
+			appSvc.lc = logger.NewClient("ERROR")
+			appSvc.config = config.DefaultConfig()
+			appSvc.config.Service.FloatPrecision = tt.global
+			mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, appSvc.lc)
+			appSvc.mapManage = mappingmanager.NewMappingManager(mqttClient, appSvc.lc, &appSvc.config.Cache)
+
+			nr := &mqtt.NorthResource{Name: "temperature", ValueType: "float64", Precision: tt.resource}
+			nr.OtherParameters.Modbus.Address = 100
+			assert.NoError(t, appSvc.mapManage.UpdateMappings([]*mqtt.DeviceMapping{
+				{
+					NorthDeviceName: "device1",
+					Resources: []*mqtt.ResourceMapping{
+						{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature"}},
+					},
+				},
+			}))
+			assert.NoError(t, appSvc.mapManage.UpdateCache("device1", map[string]interface{}{"temperature": tt.value}))
+
+			payload := &mqtt.CommandPayload{CmdType: "GET"}
+			payload.CmdContent.NorthDeviceName = "device1"
+			payload.CmdContent.NorthResourceName = "temperature"
+
+			resp := appSvc.handleGetCommand(appSvc.primaryNode(), payload)
+			assert.Equal(t, 200, resp.StatusCode)
+			assert.Equal(t, tt.wantValue, resp.CmdContent.NorthResourceValue)
+		})
+	}
+}
+
+// TestAppService_RunSelfTest tests that the self-test flags values that do not survive a register round trip
+func TestAppService_RunSelfTest(t *testing.T) {
+	svc, err := NewAppService("test-service", "1.0.0")
+	assert.NoError(t, err)
+
+	appSvc := svc.(*AppService)
+	appSvc.lc = logger.NewClient("ERROR")
+	appSvc.config = config.DefaultConfig()
+	mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, appSvc.lc)
+	appSvc.mapManage = mappingmanager.NewMappingManager(mqttClient, appSvc.lc, &appSvc.config.Cache)
+	appSvc.mdbsServer = modbusserver.NewModbusServer(&appSvc.config.Modbus, appSvc.mapManage, appSvc.lc)
+
+	temperature := &mqtt.NorthResource{Name: "temperature", ValueType: "float32"}
+	temperature.OtherParameters.Modbus.Address = 100
+	counter := &mqtt.NorthResource{Name: "counter", ValueType: "int16"}
+	counter.OtherParameters.Modbus.Address = 102
+	assert.NoError(t, appSvc.mapManage.UpdateMappings([]*mqtt.DeviceMapping{
+		{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: temperature, SouthResource: &mqtt.SouthResource{Name: "temperature"}},
+				{NorthResource: counter, SouthResource: &mqtt.SouthResource{Name: "counter"}},
+			},
+		},
+	}))
+
+	// Values that fit their declared type round-trip cleanly
+	assert.NoError(t, appSvc.mapManage.UpdateCache("device1", map[string]interface{}{"temperature": 21.5, "counter": 1200}))
+	assert.Equal(t, 0, appSvc.runSelfTest(10))
+	assert.Equal(t, uint64(0), appSvc.SelfTestFailures())
+
+	// 40000 overflows int16 and wraps on the wire
+	assert.NoError(t, appSvc.mapManage.UpdateCache("device1", map[string]interface{}{"counter": 40000}))
+	assert.Equal(t, 1, appSvc.runSelfTest(10))
+	assert.Equal(t, uint64(1), appSvc.SelfTestFailures())
+}
+
+// TestAppService_HandlePutCommandConfirm tests PUT write confirmation by a following sensor update
+func TestAppService_HandlePutCommandConfirm(t *testing.T) {
+	tests := []struct {
+		name       string
+		update     interface{} // nil: no sensor update arrives
+		wantStatus int
+	}{
+		{"confirmed", 42.0, 200},
+		{"mismatch", 41.0, 409},
+		{"timeout", nil, 504},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := NewAppService("test-service", "1.0.0")
+			assert.NoError(t, err)
+
+			appSvc := svc.(*AppService)
+			appSvc.lc = logger.NewClient("ERROR")
+			appSvc.config = config.DefaultConfig()
+			appSvc.config.Mqtt.WriteConfirmTimeout = "200ms"
+			mqttClient := mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, appSvc.lc)
+			appSvc.mapManage = mappingmanager.NewMappingManager(mqttClient, appSvc.lc, &appSvc.config.Cache)
+
+			nr := &mqtt.NorthResource{Name: "setpoint", ValueType: "int16"}
+			nr.OtherParameters.Modbus.Address = 100
+			assert.NoError(t, appSvc.mapManage.UpdateMappings([]*mqtt.DeviceMapping{
+				{
+					NorthDeviceName: "device1",
+					Resources: []*mqtt.ResourceMapping{
+						{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "setpoint"}},
+					},
+				},
+			}))
+
+			payload := &mqtt.CommandPayload{CmdType: "PUT"}
+			payload.CmdContent.NorthDeviceName = "device1"
+			payload.CmdContent.NorthResourceName = "setpoint"
+			payload.CmdContent.NorthResourceValue = "42"
+
+			respCh := make(chan *mqtt.CommandResponsePayload, 1)
+			go func() { respCh <- appSvc.handlePutCommand(appSvc.primaryNode(), payload) }()
+
+			if tt.update != nil {
+				// Keep publishing until the subscription is in place and the command returns
+				for len(respCh) == 0 {
+					assert.NoError(t, appSvc.mapManage.UpdateCache("device1", map[string]interface{}{"setpoint": tt.update}))
+					time.Sleep(5 * time.Millisecond)
+				}
+			}
+
+			resp := <-respCh
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, "42", resp.CmdContent.NorthResourceValue)
+		})
+	}
+}
+
+// publishingPahoClient records the subscription callback and every published payload
+type publishingPahoClient struct {
+	subscribingPahoClient
+	published chan []byte
+}
+
+func (c *publishingPahoClient) Publish(topic string, qos byte, retained bool, payload interface{}) pahomqtt.Token {
+	c.published <- payload.([]byte)
+	return &doneToken{}
+}
+
+// TestAppService_PutConfirmThroughMessageCallback tests that a confirming sensor update delivered by the
+// MQTT callback after a PUT is processed while the PUT waits, as with paho's ordered delivery
+func TestAppService_PutConfirmThroughMessageCallback(t *testing.T) {
+	svc, err := NewAppService("test-service", "1.0.0")
+	assert.NoError(t, err)
+
+	appSvc := svc.(*AppService)
+	appSvc.lc = logger.NewClient("ERROR")
+	appSvc.config = config.DefaultConfig()
+	appSvc.config.Mqtt.WriteConfirmTimeout = "2s"
+	appSvc.mqttClient = mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, appSvc.lc)
+	appSvc.mapManage = mappingmanager.NewMappingManager(appSvc.mqttClient, appSvc.lc, &appSvc.config.Cache)
+
+	nr := &mqtt.NorthResource{Name: "setpoint", ValueType: "int16"}
+	nr.OtherParameters.Modbus.Address = 100
+	assert.NoError(t, appSvc.mapManage.UpdateMappings([]*mqtt.DeviceMapping{{
+		NorthDeviceName: "device1",
+		Resources: []*mqtt.ResourceMapping{
+			{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "setpoint"}},
+		},
+	}}))
+
+	client := &publishingPahoClient{published: make(chan []byte, 1)}
+	appSvc.mqttClient.SetClient(client)
+	appSvc.registerNodeHandlers(appSvc.primaryNode())
+	assert.NoError(t, appSvc.mqttClient.Subscribe())
+
+	deliver := func(msg *mqtt.MQTTMessage) {
+		payload, err := json.Marshal(msg)
+		assert.NoError(t, err)
+		client.callback(client, &upMessage{topic: "/v1/data/test-node/up", payload: payload})
+	}
+	command := mqtt.CommandPayload{CmdType: "PUT"}
+	command.CmdContent.NorthDeviceName = "device1"
+	command.CmdContent.NorthResourceName = "setpoint"
+	command.CmdContent.NorthResourceValue = "42"
+	deliver(&mqtt.MQTTMessage{RequestID: "cmd-1", Type: mqtt.TypeCommand, Payload: command})
+
+	// Deliver the confirming update until the pending PUT has subscribed to it and responded
+	var published []byte
+	for published == nil {
+		deliver(&mqtt.MQTTMessage{
+			RequestID: "data-1",
+			Type:      mqtt.TypeSensorData,
+			Payload:   mqtt.SensorDataPayload{NorthDeviceName: "device1", Data: map[string]interface{}{"setpoint": 42}},
+		})
+		select {
+		case published = <-client.published:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	var resp struct {
+		RequestID string                      `json:"requestId"`
+		Payload   mqtt.CommandResponsePayload `json:"payload"`
+	}
+	assert.NoError(t, json.Unmarshal(published, &resp))
+	assert.Equal(t, "cmd-1", resp.RequestID)
+	assert.Equal(t, 200, resp.Payload.StatusCode)
+}
+
+// TestAppService_DispatchCommand tests that registered command types are dispatched and unknown ones rejected
+func TestAppService_DispatchCommand(t *testing.T) {
+	svc, err := NewAppService("test-service", "1.0.0")
+	assert.NoError(t, err)
+	appSvc := svc.(*AppService)
+	appSvc.lc = logger.NewClient("ERROR")
+
+	var received *mqtt.CommandPayload
+	assert.NoError(t, svc.RegisterCommandHandler("RESET", func(payload *mqtt.CommandPayload) *mqtt.CommandResponsePayload {
+		received = payload
+		return &mqtt.CommandResponsePayload{CmdType: "RESET", StatusCode: 202}
+	}))
+	assert.Error(t, svc.RegisterCommandHandler("", func(*mqtt.CommandPayload) *mqtt.CommandResponsePayload { return nil }))
+	assert.Error(t, svc.RegisterCommandHandler("CALIBRATE", nil))
+
+	tests := []struct {
+		name           string
+		cmdType        string
+		wantStatusCode int
+	}{
+		{name: "custom command", cmdType: "RESET", wantStatusCode: 202},
+		{name: "built-in PUT", cmdType: "PUT", wantStatusCode: 200},
+		{name: "unregistered command", cmdType: "CALIBRATE", wantStatusCode: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := &mqtt.CommandPayload{CmdType: tt.cmdType}
+			payload.CmdContent.NorthDeviceName = "device1"
+			payload.CmdContent.NorthResourceName = "temperature"
+
+			resp := appSvc.dispatchCommand(appSvc.primaryNode(), payload)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+			assert.Equal(t, tt.cmdType, resp.CmdType)
+		})
+	}
+	assert.NotNil(t, received)
+	assert.Equal(t, "RESET", received.CmdType)
+}
+
+// TestAppService_PreflightCheck tests that startup checks report an unbindable Modbus port clearly
+func TestAppService_PreflightCheck(t *testing.T) {
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer occupied.Close()
+	port := occupied.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name       string
+		port       int
+		wantFailed bool
+	}{
+		{name: "free port", port: 0, wantFailed: false},
+		{name: "port in use", port: port, wantFailed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgPath := filepath.Join(t.TempDir(), "configuration.yaml")
+			assert.NoError(t, os.WriteFile(cfgPath, []byte(fmt.Sprintf(`
+NodeID: "test-node"
+Mqtt:
+  Broker: "tcp://127.0.0.1:1883"
+  ClientID: "test-client"
+Modbus:
+  Type: "TCP"
+  TCP:
+    Host: "127.0.0.1"
+    Port: %d
+`, tt.port)), 0o644))
+
+			svc, err := NewAppService("test-service", "1.0.0")
+			assert.NoError(t, err)
+			err = svc.Initialize(cfgPath)
+
+			report := svc.PreflightCheck()
+			assert.Equal(t, tt.wantFailed, report.Failed())
+			if tt.wantFailed {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "preflight check failed")
+				assert.Contains(t, err.Error(), "[FAIL] modbus port")
+				assert.Contains(t, err.Error(), fmt.Sprintf("127.0.0.1:%d", port))
+				assert.Contains(t, err.Error(), "[ OK ] config")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestAppService_HandlePutCommandAudit tests that a PUT command is recorded as a command-sourced forward log entry
+func TestAppService_HandlePutCommandAudit(t *testing.T) {
+	svc, err := NewAppService("test-service", "1.0.0")
+	assert.NoError(t, err)
+
+	appSvc := svc.(*AppService)
+	appSvc.lc = logger.NewClient("ERROR")
+	appSvc.config = config.DefaultConfig()
+	appSvc.forwardLogMgr = forwardlog.NewManager(nil, appSvc.lc)
+
+	payload := &mqtt.CommandPayload{CmdType: "PUT"}
+	payload.CmdContent.NorthDeviceName = "device1"
+	payload.CmdContent.NorthResourceName = "setpoint"
+	payload.CmdContent.NorthResourceValue = "42"
+
+	resp := appSvc.handlePutCommand(appSvc.primaryNode(), payload)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	entries := appSvc.forwardLogMgr.Peek()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, forwardlog.SourceCommand, entries[0].Source)
+		assert.Equal(t, 1, entries[0].Status)
+		assert.Equal(t, "device1", entries[0].NorthDeviceName)
+		assert.Equal(t, map[string]interface{}{"setpoint": "42"}, entries[0].Data)
+	}
+}
+
+// failingPahoClient fails the first failures publishes, then succeeds; other Client methods are not implemented
+type failingPahoClient struct {
+	pahomqtt.Client
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (c *failingPahoClient) Publish(topic string, qos byte, retained bool, payload interface{}) pahomqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts++
+	if c.attempts <= c.failures {
+		return &doneToken{err: errors.New("connection lost")}
+	}
+	return &doneToken{}
+}
+
+// doneToken is an already completed token
+type doneToken struct {
+	pahomqtt.Token
+	err error
+}
+
+func (t *doneToken) Wait() bool   { return true }
+func (t *doneToken) Error() error { return t.err }
+
+// TestAppService_PublishCommandResponseRetry tests that failed command responses are retried with a bound
+func TestAppService_PublishCommandResponseRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		retries      int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "succeeds first time", failures: 0, retries: 3, wantAttempts: 1},
+		{name: "succeeds after retries", failures: 2, retries: 3, wantAttempts: 3},
+		{name: "gives up after retries", failures: 10, retries: 3, wantAttempts: 4, wantErr: true},
+		{name: "retry disabled", failures: 1, retries: 0, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := NewAppService("test-service", "1.0.0")
+			assert.NoError(t, err)
+
+			appSvc := svc.(*AppService)
+			appSvc.lc = logger.NewClient("ERROR")
+			appSvc.config = config.DefaultConfig()
+			appSvc.config.Mqtt.ResponseRetries = &tt.retries
+			appSvc.config.Mqtt.ResponseRetryDelay = "1ms"
+			client := &failingPahoClient{failures: tt.failures}
+			appSvc.mqttClient = mqtt.NewClientManager("test-node", mqtt.ClientConfig{}, appSvc.lc)
+			appSvc.mqttClient.SetClient(client)
+
+			resp := mqtt.NewResponse("req-1", mqtt.TypeCommand, 200, "success", nil)
+			err = appSvc.publishCommandResponse(appSvc.mqttClient, resp)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantAttempts, client.attempts)
+		})
+	}
+}
+
+// subscribingPahoClient records the callback passed to SubscribeMultiple; other Client methods are not implemented
+type subscribingPahoClient struct {
+	pahomqtt.Client
+	callback pahomqtt.MessageHandler
+}
+
+func (c *subscribingPahoClient) SubscribeMultiple(filters map[string]byte, callback pahomqtt.MessageHandler) pahomqtt.Token {
+	c.callback = callback
+	return &doneToken{}
+}
+
+func (c *subscribingPahoClient) IsConnected() bool { return true }
+
+// upMessage is a received MQTT message
+type upMessage struct {
+	pahomqtt.Message
+	topic   string
+	payload []byte
+}
+
+func (m *upMessage) Topic() string   { return m.topic }
+func (m *upMessage) Payload() []byte { return m.payload }
+
+// TestAppService_MultipleNodes tests that sensor data for each node only reaches that node's mapping manager
+func TestAppService_MultipleNodes(t *testing.T) {
+	svc, err := NewAppService("test-service", "1.0.0")
+	assert.NoError(t, err)
+
+	appSvc := svc.(*AppService)
+	appSvc.lc = logger.NewClient("ERROR")
+	appSvc.config = config.DefaultConfig()
+	appSvc.config.NodeID = "node-a"
+	appSvc.config.NodeIDs = []string{"node-b"}
+	appSvc.mqttClient = mqtt.NewClientManager("node-a", mqttClientConfig(appSvc.config, "node-a"), appSvc.lc)
+	appSvc.mapManage = appSvc.newMappingManager(appSvc.mqttClient)
+	appSvc.initNodes()
+	assert.Equal(t, "app-modbus-go-001-node-b", mqttClientConfig(appSvc.config, "node-b").ClientID)
+
+	values := map[string]float64{"node-a": 21.5, "node-b": 35.0}
+	for _, nodeID := range appSvc.config.GetNodeIDs() {
+		n := appSvc.nodes[nodeID]
+		if !assert.NotNil(t, n, nodeID) {
+			return
+		}
+		nr := &mqtt.NorthResource{Name: "temperature", ValueType: "float32"}
+		nr.OtherParameters.Modbus.Address = 100
+		assert.NoError(t, n.mapManage.UpdateMappings([]*mqtt.DeviceMapping{{
+			NorthDeviceName: "device1",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature"}},
+			},
+		}}))
+
+		client := &subscribingPahoClient{}
+		n.mqttClient.SetClient(client)
+		appSvc.registerNodeHandlers(n)
+		assert.NoError(t, n.mqttClient.Subscribe())
+
+		payload, err := json.Marshal(&mqtt.MQTTMessage{
+			RequestID: "req-" + nodeID,
+			Type:      mqtt.TypeSensorData,
+			Payload:   mqtt.SensorDataPayload{NorthDeviceName: "device1", Data: map[string]interface{}{"temperature": values[nodeID]}},
+		})
+		assert.NoError(t, err)
+		client.callback(client, &upMessage{topic: fmt.Sprintf("/v1/data/%s/up", nodeID), payload: payload})
+	}
+
+	for nodeID, want := range values {
+		mm, ok := appSvc.GetNodeMappingManager(nodeID)
+		assert.True(t, ok)
+		cached, ok := mm.GetCachedValue(100)
+		if assert.True(t, ok, nodeID) {
+			assert.Equal(t, want, cached.Value, nodeID)
+		}
+	}
+	primary, _ := appSvc.GetNodeMappingManager("node-a")
+	assert.Same(t, appSvc.mapManage, primary)
+	_, ok := appSvc.GetNodeMappingManager("node-c")
+	assert.False(t, ok)
+}
+
+// TestAppService_NodeCommandsAndSnapshots tests that an additional node restores its own snapshot,
+// answers commands from its own mappings through its own client and audits PUTs to its own forward log
+func TestAppService_NodeCommandsAndSnapshots(t *testing.T) {
+	svc, err := NewAppService("test-service", "1.0.0")
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	appSvc := svc.(*AppService)
+	appSvc.lc = logger.NewClient("ERROR")
+	appSvc.config = config.DefaultConfig()
+	appSvc.config.NodeID = "node-a"
+	appSvc.config.NodeIDs = []string{"node-b"}
+	appSvc.config.Cache.SnapshotPath = filepath.Join(dir, "cache.json")
+	appSvc.config.Modbus.NodeUnitIDs = map[string]byte{"node-b": 2}
+	assert.Equal(t, filepath.Join(dir, "cache.json"), appSvc.snapshotPath("node-a"))
+	assert.Equal(t, filepath.Join(dir, "cache-node-b.json"), appSvc.snapshotPath("node-b"))
+
+	mappings := func() []*mqtt.DeviceMapping {
+		nr := &mqtt.NorthResource{Name: "temperature", ValueType: "float32"}
+		nr.OtherParameters.Modbus.Address = 100
+		return []*mqtt.DeviceMapping{{
+			NorthDeviceName: "device2",
+			Resources: []*mqtt.ResourceMapping{
+				{NorthResource: nr, SouthResource: &mqtt.SouthResource{Name: "temperature"}},
+			},
+		}}
+	}
+	seed := mappingmanager.NewMappingManager(mqtt.NewClientManager("node-b", mqtt.ClientConfig{}, appSvc.lc), appSvc.lc, &appSvc.config.Cache)
+	assert.NoError(t, seed.UpdateMappings(mappings()))
+	assert.NoError(t, seed.UpdateCache("device2", map[string]interface{}{"temperature": 35.0}))
+	_, err = seed.SaveSnapshot(appSvc.snapshotPath("node-b"))
+	assert.NoError(t, err)
+
+	appSvc.mqttClient = mqtt.NewClientManager("node-a", mqttClientConfig(appSvc.config, "node-a"), appSvc.lc)
+	appSvc.mapManage = appSvc.newMappingManager(appSvc.mqttClient)
+	appSvc.forwardLogMgr = appSvc.newForwardLogManager(appSvc.mqttClient)
+	appSvc.mdbsServer = appSvc.newModbusServer(appSvc.primaryNode())
+	appSvc.initNodes()
+
+	n := appSvc.nodes["node-b"]
+	if !assert.NotNil(t, n) {
+		return
+	}
+	restored, ok := n.mapManage.GetCachedValue(100)
+	if assert.True(t, ok, "node-b snapshot restored") {
+		assert.Equal(t, 35.0, restored.Value)
+	}
+	_, ok = appSvc.mapManage.GetCachedValue(100)
+	assert.False(t, ok, "node-b snapshot must not reach the primary node")
+
+	assert.NoError(t, n.mapManage.UpdateMappings(mappings()))
+	client := &publishingPahoClient{published: make(chan []byte, 1)}
+	n.mqttClient.SetClient(client)
+	appSvc.registerNodeHandlers(n)
+	assert.NoError(t, n.mqttClient.Subscribe())
+
+	command := func(cmdType, value string) mqtt.CommandResponsePayload {
+		payload := mqtt.CommandPayload{CmdType: cmdType}
+		payload.CmdContent.NorthDeviceName = "device2"
+		payload.CmdContent.NorthResourceName = "temperature"
+		payload.CmdContent.NorthResourceValue = value
+		data, err := json.Marshal(&mqtt.MQTTMessage{RequestID: "cmd-" + cmdType, Type: mqtt.TypeCommand, Payload: payload})
+		assert.NoError(t, err)
+		client.callback(client, &upMessage{topic: "/v1/data/node-b/up", payload: data})
+
+		var resp struct {
+			Payload mqtt.CommandResponsePayload `json:"payload"`
+		}
+		select {
+		case published := <-client.published:
+			assert.NoError(t, json.Unmarshal(published, &resp))
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s response not published on node-b", cmdType)
+		}
+		return resp.Payload
+	}
+
+	get := command("GET", "")
+	assert.Equal(t, 200, get.StatusCode)
+	assert.Equal(t, "35", get.CmdContent.NorthResourceValue)
+
+	put := command("PUT", "40")
+	assert.Equal(t, 200, put.StatusCode)
+	assert.Len(t, n.forwardLogMgr.Peek(), 1)
+	assert.Empty(t, appSvc.forwardLogMgr.Peek())
+}
+
+// connectionPahoClient counts connects and disconnects; other Client methods are not implemented
+type connectionPahoClient struct {
+	pahomqtt.Client
+	mu          sync.Mutex
+	connects    int
+	disconnects int
+}
+
+func (c *connectionPahoClient) Connect() pahomqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connects++
+	return &doneToken{}
+}
+
+func (c *connectionPahoClient) Disconnect(quiesce uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disconnects++
+}
+
+func (c *connectionPahoClient) IsConnected() bool { return true }
+
+func (c *connectionPahoClient) SubscribeMultiple(filters map[string]byte, callback pahomqtt.MessageHandler) pahomqtt.Token {
+	return &doneToken{}
+}
+
+func (c *connectionPahoClient) Publish(topic string, qos byte, retained bool, payload interface{}) pahomqtt.Token {
+	return &doneToken{}
+}
+
+// TestAppService_Reload tests that a config reload only reinitializes the subsystems whose settings changed
+func TestAppService_Reload(t *testing.T) {
+	writeConfig := func(path, logLevel string, qos int) {
+		yaml := fmt.Sprintf("Writable:\n  LogLevel: %s\n", logLevel) +
+			"NodeID: node1\n" +
+			fmt.Sprintf("Mqtt:\n  Broker: tcp://localhost:1883\n  ClientID: test-client\n  QoS: %d\n", qos) +
+			"Modbus:\n  Type: TCP\n  TCP:\n    Host: 127.0.0.1\n"
+		assert.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+	}
+
+	tests := []struct {
+		name            string
+		logLevel        string
+		qos             int
+		wantSubsystems  []config.Subsystem
+		wantLogLevel    string
+		wantDisconnects int
+	}{
+		{name: "unchanged", logLevel: "INFO", qos: 1, wantLogLevel: "INFO"},
+		{name: "log level only", logLevel: "DEBUG", qos: 1, wantSubsystems: []config.Subsystem{config.SubsystemLogger}, wantLogLevel: "DEBUG"},
+		{name: "mqtt QoS", logLevel: "INFO", qos: 2, wantSubsystems: []config.Subsystem{config.SubsystemMQTT}, wantLogLevel: "INFO", wantDisconnects: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "configuration.yaml")
+			writeConfig(path, "INFO", 1)
+			cfg, err := config.LoadConfig(path)
+			assert.NoError(t, err)
+
+			svc, err := NewAppService("test-service", "1.0.0")
+			assert.NoError(t, err)
+			appSvc := svc.(*AppService)
+			appSvc.configPath = path
+			appSvc.config = cfg
+			appSvc.lc = logger.NewClient("INFO")
+			client := &connectionPahoClient{}
+			appSvc.mqttClient = mqtt.NewClientManager("node1", mqttClientConfig(cfg, "node1"), appSvc.lc)
+			appSvc.mqttClient.SetClient(client)
+			appSvc.mapManage = appSvc.newMappingManager(appSvc.mqttClient)
+			appSvc.initNodes()
+			t.Cleanup(appSvc.mqttClient.StopHeartbeat)
+
+			writeConfig(path, tt.logLevel, tt.qos)
+			plan, err := appSvc.Reload()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSubsystems, plan.Subsystems)
+			assert.Empty(t, plan.RestartRequired)
+			assert.Equal(t, tt.wantLogLevel, appSvc.lc.LogLevel())
+			assert.Equal(t, tt.wantLogLevel, appSvc.config.Writable.LogLevel)
+			assert.Equal(t, tt.qos, appSvc.config.Mqtt.QoS)
+			assert.Equal(t, tt.wantDisconnects, client.disconnects)
+			assert.Equal(t, tt.wantDisconnects, client.connects)
+		})
+	}
+}
+
+// TestAppService_ReloadConcurrentReaders tests that reloaded settings can be read by command and
+// connection-check paths while the reload runs (meaningful under -race)
+func TestAppService_ReloadConcurrentReaders(t *testing.T) {
+	writeConfig := func(path string, qos int, ttl string) {
+		yaml := "Writable:\n  LogLevel: INFO\n" +
+			"NodeID: node1\n" +
+			fmt.Sprintf("Mqtt:\n  Broker: tcp://localhost:1883\n  ClientID: test-client\n  QoS: %d\n", qos) +
+			fmt.Sprintf("Cache:\n  DefaultTTL: %s\n", ttl) +
+			"Modbus:\n  Type: TCP\n  TCP:\n    Host: 127.0.0.1\n"
+		assert.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+	}
+
+	path := filepath.Join(t.TempDir(), "configuration.yaml")
+	writeConfig(path, 1, "30s")
+	cfg, err := config.LoadConfig(path)
+	assert.NoError(t, err)
+
+	svc, err := NewAppService("test-service", "1.0.0")
+	assert.NoError(t, err)
+	appSvc := svc.(*AppService)
+	appSvc.configPath = path
+	appSvc.config = cfg
+	appSvc.lc = logger.NewClient("ERROR")
+	appSvc.mqttClient = mqtt.NewClientManager("node1", mqttClientConfig(cfg, "node1"), appSvc.lc)
+	appSvc.mqttClient.SetClient(&connectionPahoClient{})
+	appSvc.mapManage = appSvc.newMappingManager(appSvc.mqttClient)
+	appSvc.initNodes()
+	t.Cleanup(appSvc.mqttClient.StopHeartbeat)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				appSvc.writeConfirmTimeout()
+				appSvc.commandDedupWindow()
+				appSvc.snapshotPath("node1")
+				appSvc.mqttClient.IsConnected()
+			}
+		}
+	}()
+
+	writeConfig(path, 2, "1m")
+	plan, err := appSvc.Reload()
+	close(stop)
+	wg.Wait()
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []config.Subsystem{config.SubsystemMQTT, config.SubsystemCache}, plan.Subsystems)
+	assert.Equal(t, 2, appSvc.config.Mqtt.QoS)
+	assert.Equal(t, "1m", appSvc.config.Cache.DefaultTTL)
+}
+
+// qosPahoClient records subscription and publish QoS levels and delivers messages via the subscribed callback
+type qosPahoClient struct {
+	pahomqtt.Client
+	mu          sync.Mutex
+	callback    pahomqtt.MessageHandler
+	filters     map[string]byte
+	publishQoS  []byte
+	publishData [][]byte
+}
+
+func (c *qosPahoClient) SubscribeMultiple(filters map[string]byte, callback pahomqtt.MessageHandler) pahomqtt.Token {
+	c.filters = filters
+	c.callback = callback
+	return &doneToken{}
+}
+
+func (c *qosPahoClient) Publish(topic string, qos byte, retained bool, payload interface{}) pahomqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.publishQoS = append(c.publishQoS, qos)
+	c.publishData = append(c.publishData, payload.([]byte))
+	return &doneToken{}
+}
+
+func (c *qosPahoClient) IsConnected() bool { return true }
+
+// TestAppService_CommandQoS2ExactlyOnce tests that a redelivered QoS 2 command is executed once and answered twice
+func TestAppService_CommandQoS2ExactlyOnce(t *testing.T) {
+	svc, err := NewAppService("test-service", "1.0.0")
+	assert.NoError(t, err)
+
+	appSvc := svc.(*AppService)
+	appSvc.lc = logger.NewClient("ERROR")
+	appSvc.config = config.DefaultConfig()
+	appSvc.config.Mqtt.CommandQoS = 2
+	appSvc.mqttClient = mqtt.NewClientManager("test-node", mqttClientConfig(appSvc.config, "test-node"), appSvc.lc)
+	client := &qosPahoClient{}
+	appSvc.mqttClient.SetClient(client)
+
+	executed := 0
+	assert.NoError(t, appSvc.RegisterCommandHandler("ACTUATE", func(payload *mqtt.CommandPayload) *mqtt.CommandResponsePayload {
+		executed++
+		return &mqtt.CommandResponsePayload{CmdType: payload.CmdType, StatusCode: 200}
+	}))
+	appSvc.registerNodeHandlers(appSvc.primaryNode())
+	assert.NoError(t, appSvc.mqttClient.Subscribe())
+	assert.Equal(t, byte(2), client.filters["/v1/data/test-node/up"])
+
+	command := func(requestID string) []byte {
+		data, err := json.Marshal(&mqtt.MQTTMessage{
+			RequestID: requestID,
+			Type:      mqtt.TypeCommand,
+			Payload:   mqtt.CommandPayload{CmdType: "ACTUATE"},
+		})
+		assert.NoError(t, err)
+		return data
+	}
+	// Commands run asynchronously; wait for each one to publish its response, as a redelivery would
+	deliver := func(data []byte) {
+		client.callback(client, &upMessage{topic: "/v1/data/test-node/up", payload: data})
+		appSvc.wg.Wait()
+	}
+
+	deliver(command("req-1"))
+	deliver(command("req-1")) // redelivery after a session resume
+	assert.Equal(t, 1, executed)
+	if assert.Len(t, client.publishData, 2, "redelivery is answered with the original response") {
+		assert.Equal(t, client.publishData[0], client.publishData[1])
+	}
+	assert.Equal(t, []byte{2, 2}, client.publishQoS)
+
+	deliver(command("req-2"))
+	assert.Equal(t, 2, executed, "a new requestId is executed")
+
+	// Dedup can be disabled
+	appSvc.config.Mqtt.CommandDedupWindow = "0s"
+	deliver(command("req-2"))
+	assert.Equal(t, 3, executed)
+}
+
+// TestAppService_CommandsRunInOrder tests that consecutive commands of a node run one at a time in arrival order
+func TestAppService_CommandsRunInOrder(t *testing.T) {
+	svc, err := NewAppService("test-service", "1.0.0")
+	assert.NoError(t, err)
+
+	appSvc := svc.(*AppService)
+	appSvc.lc = logger.NewClient("ERROR")
+	appSvc.config = config.DefaultConfig()
+	appSvc.mqttClient = mqtt.NewClientManager("test-node", mqttClientConfig(appSvc.config, "test-node"), appSvc.lc)
+	client := &qosPahoClient{}
+	appSvc.mqttClient.SetClient(client)
+
+	var mu sync.Mutex
+	var written []string
+	running := 0
+	assert.NoError(t, appSvc.RegisterCommandHandler("PUT", func(payload *mqtt.CommandPayload) *mqtt.CommandResponsePayload {
+		mu.Lock()
+		running++
+		concurrent := running
+		mu.Unlock()
+		// The first PUT is slower, so it would finish last if commands ran concurrently
+		if payload.CmdContent.NorthResourceValue == "1" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		mu.Lock()
+		running--
+		written = append(written, payload.CmdContent.NorthResourceValue)
+		mu.Unlock()
+		assert.Equal(t, 1, concurrent, "commands must not overlap")
+		return &mqtt.CommandResponsePayload{CmdType: payload.CmdType, StatusCode: 200}
+	}))
+	appSvc.registerNodeHandlers(appSvc.primaryNode())
+	assert.NoError(t, appSvc.mqttClient.Subscribe())
+
+	put := func(requestID, value string) []byte {
+		command := mqtt.CommandPayload{CmdType: "PUT"}
+		command.CmdContent.NorthDeviceName = "device1"
+		command.CmdContent.NorthResourceName = "setpoint"
+		command.CmdContent.NorthResourceValue = value
+		data, err := json.Marshal(&mqtt.MQTTMessage{RequestID: requestID, Type: mqtt.TypeCommand, Payload: command})
+		assert.NoError(t, err)
+		return data
+	}
+	client.callback(client, &upMessage{topic: "/v1/data/test-node/up", payload: put("req-1", "1")})
+	client.callback(client, &upMessage{topic: "/v1/data/test-node/up", payload: put("req-2", "2")})
+	appSvc.wg.Wait()
+
+	assert.Equal(t, []string{"1", "2"}, written)
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	assert.Len(t, client.publishData, 2)
+}